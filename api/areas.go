@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/engine"
+	"home_automation_server/storage/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AreaRequest is the body of POST /api/areas and PUT /api/areas/{id}. The ID is derived from the name if it
+// is not given, it cannot be changed.
+type AreaRequest struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// AreaAssignRequest is the body of POST /api/areas/{id}/assign and /api/areas/{id}/unassign. Devices are
+// given by device ID, entities by entity ID.
+type AreaAssignRequest struct {
+	Devices  []string `json:"devices"`
+	Entities []string `json:"entities"`
+}
+
+// handleAreas lists (GET) and creates (POST) areas.
+func (s *Server) handleAreas(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		areas, err := s.Engine.AreaStore.LoadAreas(ctx)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to fetch areas: %v", err))
+			return
+		}
+		if areas == nil {
+			areas = []models.Area{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"areas": areas}, s.Logger)
+
+	case http.MethodPost:
+		var req AreaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		a, err := s.Engine.CreateArea(ctx, models.Area{ID: req.ID, Name: req.Name})
+		if err != nil {
+			s.writeAreaError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"area": a}, s.Logger)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAreaSubresources forwards requests for /api/areas/{id} and /api/areas/{id}/...
+func (s *Server) handleAreaSubresources(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(pathParts) < 3 {
+		http.Error(w, "Invalid area subresource path", http.StatusBadRequest)
+		return
+	}
+
+	id := pathParts[2]
+	if len(pathParts) == 3 {
+		s.handleArea(w, r, id)
+		return
+	}
+
+	switch pathParts[3] {
+	case "assign":
+		s.handleAreaAssign(w, r, id)
+	case "unassign":
+		s.handleAreaAssign(w, r, "")
+	case "summary":
+		s.handleAreaSummary(w, r, id)
+	default:
+		http.Error(w, "Unknown area subresource", http.StatusNotFound)
+	}
+}
+
+// handleArea reads (GET), renames (PUT) and deletes (DELETE) a single area. Deleting an area unassigns its
+// devices and entities.
+func (s *Server) handleArea(w http.ResponseWriter, r *http.Request, id string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		a, err := s.Engine.AreaStore.GetArea(ctx, id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = engine.ErrAreaNotFound
+			}
+			s.writeAreaError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"area": a}, s.Logger)
+
+	case http.MethodPut:
+		var req AreaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		a, err := s.Engine.UpdateArea(ctx, models.Area{ID: id, Name: req.Name})
+		if err != nil {
+			s.writeAreaError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"area": a}, s.Logger)
+
+	case http.MethodDelete:
+		if err := s.Engine.DeleteArea(ctx, id); err != nil {
+			s.writeAreaError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"message": "Area deleted successfully"}, s.Logger)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAreaAssign moves devices and entities to the area, or out of their area if id is empty.
+func (s *Server) handleAreaAssign(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req AreaAssignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if err := s.Engine.AssignArea(ctx, id, req.Devices, req.Entities); err != nil {
+		s.writeAreaError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"message": "Area assignment updated"}, s.Logger)
+}
+
+// handleAreaSummary returns the devices of an area and the states of its entities, counted per entity type.
+func (s *Server) handleAreaSummary(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	summary, err := s.Engine.AreaSummary(ctx, id)
+	if err != nil {
+		s.writeAreaError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"summary": summary}, s.Logger)
+}
+
+// writeAreaError maps engine errors to status codes. Validation errors include the list of issues.
+func (s *Server) writeAreaError(w http.ResponseWriter, err error) {
+	var verr *automation.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": verr.Error(), "issues": verr.Issues}, s.Logger)
+	case errors.Is(err, engine.ErrAreaNotFound):
+		writeJSONError(w, http.StatusNotFound, "Area not found")
+	default:
+		s.Logger.Error("Area request failed", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/engine"
+	"home_automation_server/storage"
+	"home_automation_server/storage/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AutomationRequest is the body of POST /api/automations and PUT /api/automations/{id}.
+type AutomationRequest struct {
+	Alias       string                     `json:"alias"`
+	Description string                     `json:"description"`
+	Triggers    []automation.BaseTrigger   `json:"triggers"`
+	Conditions  []automation.BaseCondition `json:"conditions"`
+	Actions     []automation.Action        `json:"actions"`
+	Enabled     *bool                      `json:"enabled,omitempty"` // defaults to true
+	Mode        automation.RunMode         `json:"mode,omitempty"`
+	Max         int                        `json:"max,omitempty"`
+}
+
+func (req AutomationRequest) toAutomation(id uint64) automation.Automation {
+	enabled := req.Enabled == nil || *req.Enabled
+	return automation.Automation{
+		Id:          id,
+		Alias:       req.Alias,
+		Description: req.Description,
+		Trigger:     req.Triggers,
+		Condition:   req.Conditions,
+		Actions:     req.Actions,
+		Enabled:     enabled,
+		Mode:        req.Mode,
+		Max:         req.Max,
+	}
+}
+
+type AutomationResponse struct {
+	ID            uint64                     `json:"id"`
+	Alias         string                     `json:"alias"`
+	Description   string                     `json:"description"`
+	Triggers      []automation.BaseTrigger   `json:"triggers"`
+	Conditions    []automation.BaseCondition `json:"conditions"`
+	Actions       []automation.Action        `json:"actions"`
+	Enabled       bool                       `json:"enabled"`
+	Mode          automation.RunMode         `json:"mode"`
+	Max           int                        `json:"max"`
+	LastTriggered *time.Time                 `json:"last_triggered"`
+	CreatedAt     time.Time                  `json:"created_at"`
+	UpdatedAt     time.Time                  `json:"updated_at"`
+	Issues        []automation.Issue         `json:"issues,omitempty"` // why the loaded automation is invalid
+	File          string                     `json:"file,omitempty"`   // set for read-only automations loaded from YAML
+}
+
+func newAutomationResponse(m models.Automation, issues map[uint64][]automation.Issue) (AutomationResponse, error) {
+	a, err := storage.AutomationFromStorage(m)
+	if err != nil {
+		return AutomationResponse{}, err
+	}
+	resp := automationResponse(a, issues)
+	resp.LastTriggered = m.LastTriggered
+	resp.CreatedAt = m.CreatedAt
+	resp.UpdatedAt = m.UpdatedAt
+	return resp, nil
+}
+
+func automationResponse(a automation.Automation, issues map[uint64][]automation.Issue) AutomationResponse {
+	resp := AutomationResponse{
+		ID:          a.Id,
+		Alias:       a.Alias,
+		Description: a.Description,
+		Triggers:    a.Trigger,
+		Conditions:  a.Condition,
+		Actions:     a.Actions,
+		Enabled:     a.Enabled,
+		Mode:        a.ModeOrDefault(),
+		Max:         a.MaxOrDefault(),
+		Issues:      issues[a.Id],
+		File:        a.File,
+	}
+	if resp.Triggers == nil {
+		resp.Triggers = []automation.BaseTrigger{}
+	}
+	if resp.Conditions == nil {
+		resp.Conditions = []automation.BaseCondition{}
+	}
+	if resp.Actions == nil {
+		resp.Actions = []automation.Action{}
+	}
+	return resp
+}
+
+// handleAutomations lists (GET) and creates (POST) automations.
+func (s *Server) handleAutomations(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		stored, err := s.Engine.AutomationStore.LoadAutomations(ctx)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to fetch automations: %v", err))
+			return
+		}
+		set := s.Engine.Automations()
+		automations := make([]AutomationResponse, 0, len(stored))
+		for _, m := range stored {
+			resp, err := newAutomationResponse(m, set.Issues)
+			if err != nil {
+				s.Logger.Error("Failed to convert automation", zap.Error(err), zap.Uint64("automation_id", m.ID))
+				continue
+			}
+			automations = append(automations, resp)
+		}
+		for _, a := range set.Automations {
+			if a.File != "" {
+				automations = append(automations, automationResponse(a, set.Issues))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"automations": automations}, s.Logger)
+
+	case http.MethodPost:
+		var req AutomationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		m, err := s.Engine.CreateAutomation(ctx, req.toAutomation(0))
+		if err != nil {
+			s.writeAutomationError(w, err)
+			return
+		}
+		s.writeAutomation(w, http.StatusCreated, *m)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAutomation reads (GET), replaces (PUT) and deletes (DELETE) a single automation.
+func (s *Server) handleAutomation(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		set := s.Engine.Automations()
+		for _, a := range set.Automations {
+			if a.Id == id && a.File != "" {
+				writeJSON(w, http.StatusOK, map[string]any{"automation": automationResponse(a, set.Issues)}, s.Logger)
+				return
+			}
+		}
+		m, err := s.Engine.AutomationStore.GetAutomation(ctx, id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = engine.ErrAutomationNotFound
+			}
+			s.writeAutomationError(w, err)
+			return
+		}
+		s.writeAutomation(w, http.StatusOK, *m)
+
+	case http.MethodPut:
+		var req AutomationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		m, err := s.Engine.UpdateAutomation(ctx, req.toAutomation(id))
+		if err != nil {
+			s.writeAutomationError(w, err)
+			return
+		}
+		s.writeAutomation(w, http.StatusOK, *m)
+
+	case http.MethodDelete:
+		if err := s.Engine.DeleteAutomation(ctx, id); err != nil {
+			s.writeAutomationError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"message": "Automation deleted successfully"}, s.Logger)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) writeAutomation(w http.ResponseWriter, status int, m models.Automation) {
+	resp, err := newAutomationResponse(m, s.Engine.Automations().Issues)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to convert automation: %v", err))
+		return
+	}
+	writeJSON(w, status, map[string]any{"automation": resp}, s.Logger)
+}
+
+// writeAutomationError maps engine errors to status codes. Validation errors include the list of issues.
+func (s *Server) writeAutomationError(w http.ResponseWriter, err error) {
+	var verr *automation.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": verr.Error(), "issues": verr.Issues}, s.Logger)
+	case errors.Is(err, engine.ErrAutomationNotFound):
+		writeJSONError(w, http.StatusNotFound, "Automation not found")
+	case errors.Is(err, engine.ErrAutomationReadOnly):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	default:
+		s.Logger.Error("Automation request failed", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any, logger *zap.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// writeJSONError writes {"error": msg}, which is what the UI expects from failed requests.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": msg})
+}
+
+// handleAutomationSubresources forwards requests for /api/automations/{id} and /api/automations/{id}/...
+func (s *Server) handleAutomationSubresources(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(pathParts) < 3 {
+		http.Error(w, "Invalid automation subresource path", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.ParseUint(pathParts[2], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid automation id", http.StatusBadRequest)
+		return
+	}
+
+	if len(pathParts) == 3 {
+		s.handleAutomation(w, r, id)
+		return
+	}
+
+	switch pathParts[3] {
+	case "traces":
+		s.handleAutomationTraces(w, r, id)
+	default:
+		http.Error(w, "Unknown automation subresource", http.StatusNotFound)
+	}
+}
+
+// handleAutomationTraces returns the stored traces of an automation, newest first.
+func (s *Server) handleAutomationTraces(w http.ResponseWriter, r *http.Request, id uint64) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	stored, err := s.Engine.TraceStore.GetTraces(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch traces: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	traces := make([]json.RawMessage, len(stored))
+	for i, t := range stored {
+		traces[i] = json.RawMessage(t.Trace)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"traces": traces}); err != nil {
+		s.Logger.Error("Failed to encode traces response", zap.Error(err))
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"home_automation_server/engine"
+	"net/http"
+	"strings"
+)
+
+// handleContext returns the causal chain of a context, GET /api/contexts/{id}. The chain starts with the
+// context and follows the parents through the events and automation or script runs that caused it.
+func (s *Server) handleContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/contexts/")
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "invalid context id", http.StatusBadRequest)
+		return
+	}
+	chain := s.Engine.ContextChain(id)
+	if chain == nil {
+		chain = []engine.ContextLink{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"chain": chain}, s.Logger)
+}
@@ -3,8 +3,10 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"home_automation_server/engine"
 	"home_automation_server/storage/models"
 	"home_automation_server/types"
 	"net/http"
@@ -24,7 +26,7 @@ func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
 	var devices []*models.Device
 	devices, err := s.Engine.DeviceStore.GetAllDevices(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("unable to fetch devices: %w", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("unable to fetch devices: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -34,12 +36,53 @@ func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// DeviceUpdateRequest is the body of PATCH /api/devices/{id}.
+type DeviceUpdateRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// handleDevice enables or disables (PATCH) a device, which applies to its entities without a restart.
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req DeviceUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if req.Enabled == nil {
+		writeJSONError(w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+	d, err := s.Engine.SetDeviceEnabled(ctx, deviceID, *req.Enabled)
+	if err != nil {
+		if errors.Is(err, engine.ErrDeviceNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Device not found")
+			return
+		}
+		s.Logger.Error("Device request failed", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"device": d}, s.Logger)
+}
+
 // handleDevicesSubResources forwards requests for /api/devices/{id}/...
 func (s *Server) handleDevicesSubResources(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 
 	s.Logger.Debug("Handling device sub resources", zap.Strings("path-parts", pathParts))
 
+	if len(pathParts) == 3 {
+		s.handleDevice(w, r, pathParts[2])
+		return
+	}
 	if len(pathParts) < 4 {
 		http.Error(w, "Invalid device subresource path", http.StatusBadRequest)
 		return
@@ -58,11 +101,6 @@ func (s *Server) handleDevicesSubResources(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-// Example stubs for the actual handlers
-func (s *Server) handleDeviceEntities(w http.ResponseWriter, r *http.Request, deviceID string) {
-	http.Error(w, "not supported", http.StatusBadRequest)
-}
-
 func (s *Server) handleDeviceEntityStates(w http.ResponseWriter, r *http.Request, deviceID string) {
 	s.Logger.Debug("Handling device state query", zap.String("device_id", deviceID))
 	entities, err := s.Engine.EntityStore.GetEntitiesByDevice(r.Context(), deviceID)
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/engine"
+	"home_automation_server/storage/models"
+	"home_automation_server/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EntityResponse is an entity of GET /api/entities and /api/entities/{entity_id}. The name is the friendly
+// name if one is set, else the name from the integration.
+type EntityResponse struct {
+	EntityID      string           `json:"entity_id"`
+	ExternalID    string           `json:"external_id"`
+	DeviceID      string           `json:"device_id"`
+	IntegrationID uint             `json:"integration_id"`
+	Integration   string           `json:"integration"` // empty if the integration is not loaded
+	Type          types.EntityType `json:"type"`
+	Name          string           `json:"name"`
+	OriginalName  string           `json:"original_name"` // the name from the integration
+	FriendlyName  string           `json:"friendly_name,omitempty"`
+	Icon          string           `json:"icon,omitempty"`
+	AreaID        string           `json:"area_id,omitempty"`
+	Labels        []string         `json:"labels"`
+	Enabled       bool             `json:"enabled"` // false if the entity or its device is disabled
+	Available     bool             `json:"available"`
+	State         *types.State     `json:"state,omitempty"`
+}
+
+// handleEntities lists the entities, filtered by the query parameters type, device_id, area_id, label,
+// integration_id, enabled and search.
+func (s *Server) handleEntities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	q := r.URL.Query()
+	filter := engine.EntityFilter{
+		Selector: automation.Target{
+			DeviceID:   q.Get("device_id"),
+			AreaID:     q.Get("area_id"),
+			EntityType: types.EntityType(q.Get("type")),
+			Label:      q.Get("label"),
+		},
+		Search: q.Get("search"),
+	}
+	if raw := q.Get("integration_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid integration_id %q", raw))
+			return
+		}
+		filter.IntegrationID = uint(id)
+	}
+	if raw := q.Get("enabled"); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid enabled %q", raw))
+			return
+		}
+		filter.Enabled = &enabled
+	}
+
+	entities, err := s.Engine.ListEntities(ctx, filter)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to fetch entities: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entities": s.entityResponses(entities)}, s.Logger)
+}
+
+// handleEntitySubresources reads (GET) and updates (PATCH) the entity of /api/entities/{entity_id}.
+func (s *Server) handleEntitySubresources(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(pathParts) != 3 {
+		http.Error(w, "Invalid entity subresource path", http.StatusBadRequest)
+		return
+	}
+	entityID := pathParts[2]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		ent, err := s.Engine.GetEntity(ctx, entityID)
+		if err != nil {
+			s.writeEntityError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"entity": s.entityResponses([]models.Entity{*ent})[0]}, s.Logger)
+
+	case http.MethodPatch:
+		var req engine.EntityUpdate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		ent, err := s.Engine.UpdateEntity(ctx, entityID, req)
+		if err != nil {
+			s.writeEntityError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"entity": s.entityResponses([]models.Entity{*ent})[0]}, s.Logger)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDeviceEntities lists the entities of a device.
+func (s *Server) handleDeviceEntities(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	entities, err := s.Engine.EntityStore.GetEntitiesByDevice(ctx, deviceID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to fetch entities: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entities": s.entityResponses(entities)}, s.Logger)
+}
+
+// entityResponses adds the owning integration and the current state to the entities.
+func (s *Server) entityResponses(entities []models.Entity) []EntityResponse {
+	loaded := s.Engine.LoadedIntegrations()
+	integrations := make(map[uint]string, len(loaded))
+	for name, i := range loaded {
+		integrations[i.ConfigID] = name
+	}
+
+	resp := make([]EntityResponse, len(entities))
+	for i, ent := range entities {
+		labels := []string{}
+		if len(ent.Labels) > 0 {
+			if err := json.Unmarshal(ent.Labels, &labels); err != nil {
+				s.Logger.Warn("Malformed entity labels", zap.String("entity_id", ent.EntityID), zap.Error(err))
+			}
+		}
+		name := ent.Name
+		if ent.FriendlyName != "" {
+			name = ent.FriendlyName
+		}
+		resp[i] = EntityResponse{
+			EntityID:     ent.EntityID,
+			ExternalID:   ent.ExternalID,
+			DeviceID:     ent.DeviceID,
+			Type:         types.EntityType(ent.Type),
+			Name:         name,
+			OriginalName: ent.Name,
+			FriendlyName: ent.FriendlyName,
+			Icon:         ent.Icon,
+			AreaID:       ent.AreaID,
+			Labels:       labels,
+			Enabled:      ent.Enabled && !s.Engine.EntityRegistry.Disabled(ent.EntityID),
+			Available:    ent.Available,
+		}
+		if owner, ok := s.Engine.EntityRegistry.Owner(ent.EntityID); ok {
+			resp[i].IntegrationID = owner.IntegrationID
+			resp[i].Integration = integrations[owner.IntegrationID]
+		}
+		if state, ok := s.Engine.StateCache.Get(ent.EntityID); ok {
+			resp[i].State = &state
+		}
+	}
+	return resp
+}
+
+// writeEntityError maps engine errors to status codes. Validation errors include the list of issues.
+func (s *Server) writeEntityError(w http.ResponseWriter, err error) {
+	var verr *automation.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": verr.Error(), "issues": verr.Issues}, s.Logger)
+	case errors.Is(err, engine.ErrEntityNotFound):
+		writeJSONError(w, http.StatusNotFound, "Entity not found")
+	default:
+		s.Logger.Error("Entity request failed", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
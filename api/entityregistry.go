@@ -0,0 +1,34 @@
+package api
+
+import (
+	"home_automation_server/engine"
+	"net/http"
+)
+
+// EntityRegistryEntry is an entity of the registry with the name of the integration that owns it, empty if the
+// integration is not loaded.
+type EntityRegistryEntry struct {
+	engine.RegistryEntry
+	Integration string `json:"integration"`
+}
+
+// handleEntityRegistry lists the registered entities and the integrations that own them.
+func (s *Server) handleEntityRegistry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	loaded := s.Engine.LoadedIntegrations()
+	integrations := make(map[uint]string, len(loaded))
+	for name, i := range loaded {
+		integrations[i.ConfigID] = name
+	}
+
+	entries := s.Engine.EntityRegistry.Entries()
+	resp := make([]EntityRegistryEntry, len(entries))
+	for i, entry := range entries {
+		resp[i] = EntityRegistryEntry{RegistryEntry: entry, Integration: integrations[entry.IntegrationID]}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entities": resp}, s.Logger)
+}
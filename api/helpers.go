@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/integrations/helpers"
+	"home_automation_server/types"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HelperResponse is a helper of GET /api/helpers and /api/helpers/{type}.{id}. The entity ID is the one the
+// helper is registered under, it differs from the helper ID if the entity was renamed.
+type HelperResponse struct {
+	helpers.Helper
+	HelperID string       `json:"helper_id"` // "<type>.<id>"
+	EntityID string       `json:"entity_id,omitempty"`
+	State    *types.State `json:"state,omitempty"`
+}
+
+// helpers returns the helpers of the built-in helpers integration, which its descriptor exposes.
+func (s *Server) helpers() (*helpers.Helpers, error) {
+	desc, ok := s.Engine.IntegrationDescRegistry.Available[helpers.Name]
+	if !ok {
+		return nil, errors.New("helpers integration is not registered")
+	}
+	h, ok := desc.Extension.(*helpers.Helpers)
+	if !ok {
+		return nil, errors.New("helpers integration has no helpers")
+	}
+	return h, nil
+}
+
+// handleHelpers lists (GET) and creates (POST) helpers.
+func (s *Server) handleHelpers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	h, err := s.helpers()
+	if err != nil {
+		s.writeHelperError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		defs := h.List()
+		resp := make([]HelperResponse, len(defs))
+		for i, def := range defs {
+			resp[i] = s.helperResponse(def)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"helpers": resp}, s.Logger)
+
+	case http.MethodPost:
+		var req helpers.Helper
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		def, err := s.createHelper(ctx, h, req)
+		if err != nil {
+			s.writeHelperError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"helper": s.helperResponse(def)}, s.Logger)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleHelperSubresources reads (GET), replaces (PUT) and deletes (DELETE) the helper of
+// /api/helpers/{type}.{id}. The type and ID of a helper cannot be changed.
+func (s *Server) handleHelperSubresources(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(pathParts) != 3 {
+		http.Error(w, "Invalid helper subresource path", http.StatusBadRequest)
+		return
+	}
+	helperID := pathParts[2]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	h, err := s.helpers()
+	if err != nil {
+		s.writeHelperError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		def, err := h.Get(helperID)
+		if err != nil {
+			s.writeHelperError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"helper": s.helperResponse(def)}, s.Logger)
+
+	case http.MethodPut:
+		var req helpers.Helper
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		def, err := s.updateHelper(ctx, h, helperID, req)
+		if err != nil {
+			s.writeHelperError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"helper": s.helperResponse(def)}, s.Logger)
+
+	case http.MethodDelete:
+		if err := s.deleteHelper(ctx, h, helperID); err != nil {
+			s.writeHelperError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"message": "Helper deleted successfully"}, s.Logger)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createHelper stores a new helper, registers its entity and publishes its initial state.
+func (s *Server) createHelper(ctx context.Context, h *helpers.Helpers, def helpers.Helper) (helpers.Helper, error) {
+	created, err := h.Create(ctx, def)
+	if err != nil {
+		return helpers.Helper{}, err
+	}
+	if err := s.Engine.DiscoverDevicesForIntegration(ctx, helpers.Name); err != nil {
+		return helpers.Helper{}, fmt.Errorf("helper created but its entity was not registered: %w", err)
+	}
+	h.Publish(created.ExternalID())
+	return created, nil
+}
+
+// updateHelper changes the definition of a helper, e.g. its name or options, and refreshes its entity.
+func (s *Server) updateHelper(ctx context.Context, h *helpers.Helpers, externalID string, def helpers.Helper) (helpers.Helper, error) {
+	updated, err := h.Update(ctx, externalID, def)
+	if err != nil {
+		return helpers.Helper{}, err
+	}
+	if err := s.Engine.DiscoverDevicesForIntegration(ctx, helpers.Name); err != nil {
+		return helpers.Helper{}, fmt.Errorf("helper updated but its entity was not refreshed: %w", err)
+	}
+	return updated, nil
+}
+
+// deleteHelper removes a helper. Its entity is kept as unavailable, like entities that disappear from other
+// integrations, and its state is removed.
+func (s *Server) deleteHelper(ctx context.Context, h *helpers.Helpers, externalID string) error {
+	if err := h.Delete(ctx, externalID); err != nil {
+		return err
+	}
+	s.Engine.RemoveEntityState(helpers.Name, externalID)
+	return s.Engine.DiscoverDevicesForIntegration(ctx, helpers.Name)
+}
+
+// helperResponse adds the entity ID and the current state to the helper.
+func (s *Server) helperResponse(def helpers.Helper) HelperResponse {
+	resp := HelperResponse{Helper: def, HelperID: def.ExternalID()}
+	if integration, ok := s.Engine.Integration(helpers.Name); ok {
+		if entityID, ok := s.Engine.EntityRegistry.ResolveFor(integration.ConfigID, def.ExternalID()); ok {
+			resp.EntityID = entityID
+			if state, ok := s.Engine.StateCache.Get(entityID); ok {
+				resp.State = &state
+			}
+		}
+	}
+	return resp
+}
+
+// writeHelperError maps helper errors to status codes. Validation errors include the list of issues.
+func (s *Server) writeHelperError(w http.ResponseWriter, err error) {
+	var verr *automation.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": verr.Error(), "issues": verr.Issues}, s.Logger)
+	case errors.Is(err, helpers.ErrHelperNotFound):
+		writeJSONError(w, http.StatusNotFound, "Helper not found")
+	default:
+		s.Logger.Error("Helper request failed", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -59,7 +59,7 @@ func (s *Server) handleIntegrations(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var names []string
-	for name, _ := range s.Engine.Integrations {
+	for name := range s.Engine.LoadedIntegrations() {
 		names = append(names, name)
 	}
 
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/engine"
+	"home_automation_server/storage"
+	"home_automation_server/storage/models"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SceneRequest is the body of POST /api/scenes and PUT /api/scenes/{id}. The current states of the entities
+// in Capture are taken from the state cache, entries in Entities take precedence over them.
+type SceneRequest struct {
+	Name        string                            `json:"name"`
+	Alias       string                            `json:"alias"`
+	Description string                            `json:"description"`
+	Entities    map[string]automation.SceneEntity `json:"entities"`
+	Capture     []string                          `json:"capture,omitempty"`
+}
+
+func (req SceneRequest) toScene(id uint, e *engine.Engine) (automation.Scene, error) {
+	entities, err := e.CaptureScene(req.Capture)
+	if err != nil {
+		return automation.Scene{}, err
+	}
+	maps.Copy(entities, req.Entities)
+
+	return automation.Scene{
+		Id:          id,
+		Name:        req.Name,
+		Alias:       req.Alias,
+		Description: req.Description,
+		Entities:    entities,
+	}, nil
+}
+
+type SceneResponse struct {
+	ID          uint                              `json:"id"`
+	Name        string                            `json:"name"`
+	Service     string                            `json:"service"`
+	Alias       string                            `json:"alias"`
+	Description string                            `json:"description"`
+	Entities    map[string]automation.SceneEntity `json:"entities"`
+	CreatedAt   time.Time                         `json:"created_at"`
+	UpdatedAt   time.Time                         `json:"updated_at"`
+}
+
+func newSceneResponse(m models.Scene) (SceneResponse, error) {
+	sc, err := storage.SceneFromStorage(m)
+	if err != nil {
+		return SceneResponse{}, err
+	}
+	resp := SceneResponse{
+		ID:          sc.Id,
+		Name:        sc.Name,
+		Service:     sc.Service(),
+		Alias:       sc.Alias,
+		Description: sc.Description,
+		Entities:    sc.Entities,
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+	if resp.Entities == nil {
+		resp.Entities = map[string]automation.SceneEntity{}
+	}
+	return resp, nil
+}
+
+// handleScenes lists (GET) and creates (POST) scenes. The list includes the snapshots taken by scene.snapshot,
+// which are kept in memory only.
+func (s *Server) handleScenes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		stored, err := s.Engine.SceneStore.LoadScenes(ctx)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to fetch scenes: %v", err))
+			return
+		}
+		scenes := make([]SceneResponse, 0, len(stored))
+		for _, m := range stored {
+			resp, err := newSceneResponse(m)
+			if err != nil {
+				s.Logger.Error("Failed to convert scene", zap.Error(err), zap.Uint("scene_id", m.ID))
+				continue
+			}
+			scenes = append(scenes, resp)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"scenes": scenes, "snapshots": s.Engine.SceneSnapshots()}, s.Logger)
+
+	case http.MethodPost:
+		var req SceneRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		scene, err := req.toScene(0, s.Engine)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		m, err := s.Engine.CreateScene(ctx, scene)
+		if err != nil {
+			s.writeSceneError(w, err)
+			return
+		}
+		s.writeScene(w, http.StatusCreated, *m)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSceneSubresources forwards requests for /api/scenes/{id} and /api/scenes/{id}/...
+func (s *Server) handleSceneSubresources(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(pathParts) < 3 {
+		http.Error(w, "Invalid scene subresource path", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.ParseUint(pathParts[2], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid scene id", http.StatusBadRequest)
+		return
+	}
+
+	if len(pathParts) == 3 {
+		s.handleScene(w, r, uint(id))
+		return
+	}
+
+	switch pathParts[3] {
+	case "apply":
+		s.handleSceneApply(w, r, uint(id))
+	default:
+		http.Error(w, "Unknown scene subresource", http.StatusNotFound)
+	}
+}
+
+// handleScene reads (GET), replaces (PUT) and deletes (DELETE) a single scene.
+func (s *Server) handleScene(w http.ResponseWriter, r *http.Request, id uint) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		m, err := s.Engine.SceneStore.GetScene(ctx, id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = engine.ErrSceneNotFound
+			}
+			s.writeSceneError(w, err)
+			return
+		}
+		s.writeScene(w, http.StatusOK, *m)
+
+	case http.MethodPut:
+		var req SceneRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		scene, err := req.toScene(id, s.Engine)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		m, err := s.Engine.UpdateScene(ctx, scene)
+		if err != nil {
+			s.writeSceneError(w, err)
+			return
+		}
+		s.writeScene(w, http.StatusOK, *m)
+
+	case http.MethodDelete:
+		if err := s.Engine.DeleteScene(ctx, id); err != nil {
+			s.writeSceneError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"message": "Scene deleted successfully"}, s.Logger)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSceneApply applies a scene and waits until all entities are restored.
+func (s *Server) handleSceneApply(w http.ResponseWriter, r *http.Request, id uint) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	scene, ok := s.Engine.SceneByID(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "Scene not found")
+		return
+	}
+	if err := s.Engine.ApplyScene(ctx, &scene); err != nil {
+		s.Logger.Error("Failed to apply scene", zap.Error(err), zap.Uint("scene_id", id))
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"message": "Scene applied"}, s.Logger)
+}
+
+func (s *Server) writeScene(w http.ResponseWriter, status int, m models.Scene) {
+	resp, err := newSceneResponse(m)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to convert scene: %v", err))
+		return
+	}
+	writeJSON(w, status, map[string]any{"scene": resp}, s.Logger)
+}
+
+// writeSceneError maps engine errors to status codes. Validation errors include the list of issues.
+func (s *Server) writeSceneError(w http.ResponseWriter, err error) {
+	var verr *automation.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": verr.Error(), "issues": verr.Issues}, s.Logger)
+	case errors.Is(err, engine.ErrSceneNotFound):
+		writeJSONError(w, http.StatusNotFound, "Scene not found")
+	default:
+		s.Logger.Error("Scene request failed", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/engine"
+	"home_automation_server/storage"
+	"home_automation_server/storage/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScriptRequest is the body of POST /api/scripts and PUT /api/scripts/{id}.
+type ScriptRequest struct {
+	Name        string                            `json:"name"`
+	Alias       string                            `json:"alias"`
+	Description string                            `json:"description"`
+	Fields      map[string]automation.ScriptField `json:"fields"`
+	Sequence    []automation.Action               `json:"sequence"`
+	Mode        automation.RunMode                `json:"mode,omitempty"`
+	Max         int                               `json:"max,omitempty"`
+}
+
+func (req ScriptRequest) toScript(id uint) automation.Script {
+	return automation.Script{
+		Id:          id,
+		Name:        req.Name,
+		Alias:       req.Alias,
+		Description: req.Description,
+		Fields:      req.Fields,
+		Sequence:    req.Sequence,
+		Mode:        req.Mode,
+		Max:         req.Max,
+	}
+}
+
+type ScriptResponse struct {
+	ID          uint                              `json:"id"`
+	Name        string                            `json:"name"`
+	Service     string                            `json:"service"`
+	Alias       string                            `json:"alias"`
+	Description string                            `json:"description"`
+	Fields      map[string]automation.ScriptField `json:"fields"`
+	Sequence    []automation.Action               `json:"sequence"`
+	Mode        automation.RunMode                `json:"mode"`
+	Max         int                               `json:"max"`
+	CreatedAt   time.Time                         `json:"created_at"`
+	UpdatedAt   time.Time                         `json:"updated_at"`
+}
+
+func newScriptResponse(m models.Script) (ScriptResponse, error) {
+	sc, err := storage.ScriptFromStorage(m)
+	if err != nil {
+		return ScriptResponse{}, err
+	}
+	resp := ScriptResponse{
+		ID:          sc.Id,
+		Name:        sc.Name,
+		Service:     sc.Service(),
+		Alias:       sc.Alias,
+		Description: sc.Description,
+		Fields:      sc.Fields,
+		Sequence:    sc.Sequence,
+		Mode:        sc.ModeOrDefault(),
+		Max:         sc.MaxOrDefault(),
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+	if resp.Fields == nil {
+		resp.Fields = map[string]automation.ScriptField{}
+	}
+	if resp.Sequence == nil {
+		resp.Sequence = []automation.Action{}
+	}
+	return resp, nil
+}
+
+// handleScripts lists (GET) and creates (POST) scripts.
+func (s *Server) handleScripts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		stored, err := s.Engine.ScriptStore.LoadScripts(ctx)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to fetch scripts: %v", err))
+			return
+		}
+		scripts := make([]ScriptResponse, 0, len(stored))
+		for _, m := range stored {
+			resp, err := newScriptResponse(m)
+			if err != nil {
+				s.Logger.Error("Failed to convert script", zap.Error(err), zap.Uint("script_id", m.ID))
+				continue
+			}
+			scripts = append(scripts, resp)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"scripts": scripts}, s.Logger)
+
+	case http.MethodPost:
+		var req ScriptRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		m, err := s.Engine.CreateScript(ctx, req.toScript(0))
+		if err != nil {
+			s.writeScriptError(w, err)
+			return
+		}
+		s.writeScript(w, http.StatusCreated, *m)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleScriptSubresources forwards requests for /api/scripts/{id} and /api/scripts/{id}/...
+func (s *Server) handleScriptSubresources(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(pathParts) < 3 {
+		http.Error(w, "Invalid script subresource path", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.ParseUint(pathParts[2], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid script id", http.StatusBadRequest)
+		return
+	}
+
+	if len(pathParts) == 3 {
+		s.handleScript(w, r, uint(id))
+		return
+	}
+
+	switch pathParts[3] {
+	case "run":
+		s.handleScriptRun(w, r, uint(id))
+	case "traces":
+		s.handleScriptTraces(w, r, uint(id))
+	default:
+		http.Error(w, "Unknown script subresource", http.StatusNotFound)
+	}
+}
+
+// handleScript reads (GET), replaces (PUT) and deletes (DELETE) a single script.
+func (s *Server) handleScript(w http.ResponseWriter, r *http.Request, id uint) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		m, err := s.Engine.ScriptStore.GetScript(ctx, id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = engine.ErrScriptNotFound
+			}
+			s.writeScriptError(w, err)
+			return
+		}
+		s.writeScript(w, http.StatusOK, *m)
+
+	case http.MethodPut:
+		var req ScriptRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		m, err := s.Engine.UpdateScript(ctx, req.toScript(id))
+		if err != nil {
+			s.writeScriptError(w, err)
+			return
+		}
+		s.writeScript(w, http.StatusOK, *m)
+
+	case http.MethodDelete:
+		if err := s.Engine.DeleteScript(ctx, id); err != nil {
+			s.writeScriptError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"message": "Script deleted successfully"}, s.Logger)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleScriptRun starts a script in the background with the params of the body, {"params": {...}}.
+func (s *Server) handleScriptRun(w http.ResponseWriter, r *http.Request, id uint) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Params map[string]any `json:"params"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+
+	// runs with the server context, the script may outlive the request
+	if err := s.Engine.StartScript(s.ctx, id, req.Params); err != nil {
+		if errors.Is(err, engine.ErrScriptNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Script not found")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"message": "Script started"}, s.Logger)
+}
+
+// handleScriptTraces returns the stored traces of a script, newest first.
+func (s *Server) handleScriptTraces(w http.ResponseWriter, r *http.Request, id uint) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	stored, err := s.Engine.TraceStore.GetScriptTraces(ctx, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch traces: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	traces := make([]json.RawMessage, len(stored))
+	for i, t := range stored {
+		traces[i] = json.RawMessage(t.Trace)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"traces": traces}, s.Logger)
+}
+
+func (s *Server) writeScript(w http.ResponseWriter, status int, m models.Script) {
+	resp, err := newScriptResponse(m)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("unable to convert script: %v", err))
+		return
+	}
+	writeJSON(w, status, map[string]any{"script": resp}, s.Logger)
+}
+
+// writeScriptError maps engine errors to status codes. Validation errors include the list of issues.
+func (s *Server) writeScriptError(w http.ResponseWriter, err error) {
+	var verr *automation.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": verr.Error(), "issues": verr.Issues}, s.Logger)
+	case errors.Is(err, engine.ErrScriptNotFound):
+		writeJSONError(w, http.StatusNotFound, "Script not found")
+	default:
+		s.Logger.Error("Script request failed", zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
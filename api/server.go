@@ -51,12 +51,28 @@ func (s *Server) routes() {
 
 	s.mux.HandleFunc("/api/devices", s.handleDevices)
 	s.mux.HandleFunc("/api/devices/", s.handleDevicesSubResources)
+	s.mux.HandleFunc("/api/entities", s.handleEntities)
+	s.mux.HandleFunc("/api/entities/", s.handleEntitySubresources)
 
 	s.mux.HandleFunc("/api/services", s.handleServices)
+	s.mux.HandleFunc("/api/services/", s.handleServiceCall)
+
+	s.mux.HandleFunc("/api/automations", s.handleAutomations)
+	s.mux.HandleFunc("/api/automations/", s.handleAutomationSubresources)
+	s.mux.HandleFunc("/api/scripts", s.handleScripts)
+	s.mux.HandleFunc("/api/scripts/", s.handleScriptSubresources)
+	s.mux.HandleFunc("/api/scenes", s.handleScenes)
+	s.mux.HandleFunc("/api/scenes/", s.handleSceneSubresources)
+	s.mux.HandleFunc("/api/areas", s.handleAreas)
+	s.mux.HandleFunc("/api/areas/", s.handleAreaSubresources)
+	s.mux.HandleFunc("/api/helpers", s.handleHelpers)
+	s.mux.HandleFunc("/api/helpers/", s.handleHelperSubresources)
 
 	s.mux.HandleFunc("/api/integrations/", s.handleIntegrationSubresources)
 
 	s.mux.HandleFunc("/api/states", s.handleStatesSubresources)
+	s.mux.HandleFunc("/api/entity_registry", s.handleEntityRegistry)
+	s.mux.HandleFunc("/api/contexts/", s.handleContext)
 
 	s.mux.HandleFunc("/ws", s.handleWS)
 }
@@ -1,14 +1,21 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/engine"
 	"home_automation_server/integrations"
 	"net/http"
+	"strings"
 )
 
 type ServiceResponse struct {
 	Name           string                                `json:"name"`
-	RequiredParams map[string]integrations.ParamMetadata `json:"required_params"`
+	Params         map[string]integrations.ParamMetadata `json:"params"`
 	AllowedTargets integrations.TargetSpec               `json:"allowed_targets"`
 }
 
@@ -23,10 +30,76 @@ func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
 	for name, spec := range serviceSpecs {
 		serviceResponse := ServiceResponse{
 			Name:           name,
-			RequiredParams: spec.RequiredParams,
+			Params:         spec.Params,
 			AllowedTargets: spec.AllowedTargets,
 		}
 		resp = append(resp, serviceResponse)
 	}
 	json.NewEncoder(w).Encode(map[string]any{"services": resp})
 }
+
+// ServiceCallRequest is the body of POST /api/services/{domain}/{service} and the data of the call_service WS
+// command. Targets are entity IDs, they are translated to the external IDs of the integration by the engine.
+type ServiceCallRequest struct {
+	Targets []automation.Target `json:"targets"`
+	Params  map[string]any      `json:"params"`
+}
+
+// ServiceCallResponse is the result of a service call. Failed calls have the error and, if the call was
+// invalid, the issues found by validation.
+type ServiceCallResponse struct {
+	Success bool               `json:"success"`
+	Error   string             `json:"error,omitempty"`
+	Issues  []automation.Issue `json:"issues,omitempty"`
+}
+
+// handleServiceCall calls a service, POST /api/services/{domain}/{service}, and waits for the result.
+func (s *Server) handleServiceCall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) != 4 {
+		http.Error(w, "Invalid service path, expected /api/services/{domain}/{service}", http.StatusBadRequest)
+		return
+	}
+
+	var req ServiceCallRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+
+	status, resp := s.callService(r.Context(), pathParts[2], pathParts[3], req)
+	writeJSON(w, status, resp, s.Logger)
+}
+
+// callService calls the service through the engine and maps the result to a response and its status code.
+func (s *Server) callService(ctx context.Context, domain, service string, req ServiceCallRequest) (int, ServiceCallResponse) {
+	err := s.Engine.CallService(ctx, domain, service, req.Targets, req.Params)
+	if err == nil {
+		return http.StatusOK, ServiceCallResponse{Success: true}
+	}
+
+	resp := ServiceCallResponse{Error: err.Error()}
+	var verr *automation.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		resp.Issues = verr.Issues
+		return http.StatusBadRequest, resp
+	case errors.Is(err, engine.ErrServiceNotFound):
+		return http.StatusNotFound, resp
+	case errors.Is(err, engine.ErrEntityDisabled):
+		return http.StatusBadRequest, resp
+	case errors.Is(err, context.DeadlineExceeded):
+		s.Logger.Warn("Service call timed out", zap.String("service", domain+"."+service))
+		return http.StatusGatewayTimeout, resp
+	default:
+		s.Logger.Error("Service call failed", zap.String("service", domain+"."+service), zap.Error(err))
+		return http.StatusBadGateway, resp
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"home_automation_server/types"
 	"net/http"
 	"sync"
@@ -34,6 +35,14 @@ func (wsm *WSManager) RemoveClient(conn *websocket.Conn) {
 	conn.Close()
 }
 
+// Send writes a message to a single client. Writes are serialized with the broadcast of events, a connection
+// supports only one concurrent writer.
+func (wsm *WSManager) Send(conn *websocket.Conn, v any) error {
+	wsm.mu.Lock()
+	defer wsm.mu.Unlock()
+	return conn.WriteJSON(v)
+}
+
 func (wsm *WSManager) Start(eventCh chan types.Event) {
 	go func() {
 		for event := range eventCh {
@@ -75,6 +84,7 @@ func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 		}
 
 		var msg struct {
+			ID   any                    `json:"id,omitempty"` // echoed in the result of commands that reply
 			Type string                 `json:"type"`
 			Data map[string]interface{} `json:"data,omitempty"`
 		}
@@ -93,8 +103,49 @@ func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 			if err := s.Engine.LoadIntegration(s.ctx, integrationName); err != nil {
 				s.Logger.Error("Failed to load integration", zap.Error(err), zap.String("integration_name", integrationName))
 			}
+		case "run_script":
+			name, _ := msg.Data["name"].(string)
+			script, ok := s.Engine.ScriptByName(name)
+			if !ok {
+				s.Logger.Warn("Unknown script", zap.String("name", name))
+				continue
+			}
+			params, _ := msg.Data["params"].(map[string]interface{})
+			if err := s.Engine.StartScript(s.ctx, script.Id, params); err != nil {
+				s.Logger.Error("Failed to run script", zap.Error(err), zap.String("script", script.Service()))
+			}
+		case "call_service":
+			var cmd struct {
+				Data struct {
+					Domain  string `json:"domain"`
+					Service string `json:"service"`
+					ServiceCallRequest
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(msgBytes, &cmd); err != nil {
+				s.Logger.Warn("Invalid call_service command", zap.Error(err))
+				s.sendServiceCallResult(conn, msg.ID, ServiceCallResponse{Error: fmt.Sprintf("invalid call_service command: %v", err)})
+				continue
+			}
+			if cmd.Data.Domain == "" || cmd.Data.Service == "" {
+				s.sendServiceCallResult(conn, msg.ID, ServiceCallResponse{Error: "call_service requires domain and service"})
+				continue
+			}
+			// calls may take until the action timeout, don't hold up the commands that follow
+			go func(id any) {
+				_, resp := s.callService(s.ctx, cmd.Data.Domain, cmd.Data.Service, cmd.Data.ServiceCallRequest)
+				s.sendServiceCallResult(conn, id, resp)
+			}(msg.ID)
 		default:
 			s.Logger.Warn("Unknown WS command", zap.String("type", msg.Type))
 		}
 	}
 }
+
+// sendServiceCallResult replies to a call_service command, echoing its id.
+func (s *Server) sendServiceCallResult(conn *websocket.Conn, id any, resp ServiceCallResponse) {
+	result := map[string]any{"type": "result", "id": id, "data": resp}
+	if err := s.WSManager.Send(conn, result); err != nil {
+		s.Logger.Warn("Failed to send call_service result", zap.Error(err))
+	}
+}
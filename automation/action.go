@@ -1,19 +1,105 @@
 package automation
 
 import (
+	"errors"
 	"fmt"
+	"home_automation_server/types"
 )
 
+type ActionType string
+
+const (
+	ActionTypeService        ActionType = "service"
+	ActionTypeDelay          ActionType = "delay"
+	ActionTypeWaitTemplate   ActionType = "wait_template"
+	ActionTypeWaitForTrigger ActionType = "wait_for_trigger"
+	ActionTypeChoose         ActionType = "choose"
+	ActionTypeRepeat         ActionType = "repeat"
+)
+
+// Action is a single step in an action sequence. The step type is given by which of the fields are set,
+// see Type. Only service calls are passed on to integrations.
 type Action struct {
 	Service  string         `json:"service"`
 	Targets  []Target       `json:"targets"`
 	Params   map[string]any `json:"params,omitempty"`
 	Blocking bool           `json:"blocking,omitempty"`
+
+	Delay *Duration `json:"delay,omitempty"`
+
+	WaitTemplate   string        `json:"wait_template,omitempty"`
+	WaitForTrigger []BaseTrigger `json:"wait_for_trigger,omitempty"`
+	// Timeout limits wait_template and wait_for_trigger. Unless ContinueOnTimeout is false the sequence
+	// continues after a timeout.
+	Timeout           *Duration `json:"timeout,omitempty"`
+	ContinueOnTimeout *bool     `json:"continue_on_timeout,omitempty"`
+
+	Choose  []ChooseOption `json:"choose,omitempty"`
+	Default []Action       `json:"default,omitempty"`
+
+	Repeat *Repeat `json:"repeat,omitempty"`
+}
+
+// ChooseOption runs Sequence if all Conditions pass. The options of a choose step are tried in order
+// and the first match wins; if none match the Default sequence runs.
+type ChooseOption struct {
+	Conditions []BaseCondition `json:"conditions"`
+	Sequence   []Action        `json:"sequence"`
+}
+
+// Repeat runs Sequence Count times, while all While conditions pass (checked before each iteration)
+// or until all Until conditions pass (checked after each iteration).
+type Repeat struct {
+	Count    int             `json:"count,omitempty"`
+	While    []BaseCondition `json:"while,omitempty"`
+	Until    []BaseCondition `json:"until,omitempty"`
+	Sequence []Action        `json:"sequence"`
 }
 
-// Target is the target for a service call. Currently, we only support entityIDs.
+// Type returns the kind of step the action describes.
+func (a *Action) Type() (ActionType, error) {
+	switch {
+	case a.Service != "":
+		return ActionTypeService, nil
+	case a.Delay != nil:
+		return ActionTypeDelay, nil
+	case a.WaitTemplate != "":
+		return ActionTypeWaitTemplate, nil
+	case len(a.WaitForTrigger) > 0:
+		return ActionTypeWaitForTrigger, nil
+	case len(a.Choose) > 0:
+		return ActionTypeChoose, nil
+	case a.Repeat != nil:
+		return ActionTypeRepeat, nil
+	default:
+		return "", errors.New("action has no service, delay, wait, choose or repeat")
+	}
+}
+
+// ContinuesOnTimeout reports whether the sequence continues after a wait timed out.
+func (a *Action) ContinuesOnTimeout() bool {
+	return a.ContinueOnTimeout == nil || *a.ContinueOnTimeout
+}
+
+// Target is the target for a service call: a single entity, or the entities selected by device, area, entity
+// type and label. Selectors set on the same target must all match, e.g. the lights of an area. The engine
+// expands selector targets to entity targets before the service is called.
 type Target struct {
-	EntityID string `json:"entity_id,omitempty"`
+	EntityID   string           `json:"entity_id,omitempty"`
+	DeviceID   string           `json:"device_id,omitempty"`
+	AreaID     string           `json:"area_id,omitempty"`
+	EntityType types.EntityType `json:"entity_type,omitempty"`
+	Label      string           `json:"label,omitempty"`
+}
+
+// IsEntity reports whether the target is a single entity.
+func (t Target) IsEntity() bool {
+	return t.EntityID != ""
+}
+
+// IsSelector reports whether the target selects entities by device, area, entity type or label.
+func (t Target) IsSelector() bool {
+	return t.DeviceID != "" || t.AreaID != "" || t.EntityType != "" || t.Label != ""
 }
 
 func (a *Action) FloatParam(key string) (float64, error) {
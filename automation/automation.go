@@ -1,15 +1,47 @@
 package automation
 
+type RunMode string
+
+const (
+	RunModeSingle   RunMode = "single"   // a new run is dropped while the automation is running
+	RunModeRestart  RunMode = "restart"  // a new run cancels the running one
+	RunModeQueued   RunMode = "queued"   // runs wait for the previous one to finish
+	RunModeParallel RunMode = "parallel" // runs execute side by side
+)
+
+// DefaultMaxRuns is the number of runs queued or parallel automations may have at once if Max is not set.
+const DefaultMaxRuns = 10
+
 type AutomationSet struct {
 	Automations []Automation
+	Issues      map[uint64][]Issue // validation issues of invalid automations, by automation ID
 }
 
 type Automation struct {
-	Id          uint          `yaml:"id" json:"id"`
-	Alias       string        `yaml:"alias" json:"alias"`
-	Description string        `yaml:"description" json:"description"`
-	Trigger     []BaseTrigger `yaml:"trigger" json:"trigger"`
-	Condition   []Condition   `yaml:"condition" json:"condition"`
-	Actions     []Action      `yaml:"action" json:"action"`
-	Enabled     bool          `yaml:"active" json:"active"`
+	Id          uint64          `yaml:"id" json:"id"`
+	Alias       string          `yaml:"alias" json:"alias"`
+	Description string          `yaml:"description" json:"description"`
+	Trigger     []BaseTrigger   `yaml:"trigger" json:"trigger"`
+	Condition   []BaseCondition `yaml:"condition" json:"condition"`
+	Actions     []Action        `yaml:"action" json:"action"`
+	Enabled     bool            `yaml:"active" json:"active"`
+	Mode        RunMode         `yaml:"mode" json:"mode,omitempty"`
+	Max         int             `yaml:"max" json:"max,omitempty"`
+	File        string          `yaml:"-" json:"-"` // the YAML file the automation was loaded from, empty if stored in the database
+}
+
+// ModeOrDefault returns the run mode of the automation, single if none is set.
+func (a *Automation) ModeOrDefault() RunMode {
+	if a.Mode == "" {
+		return RunModeSingle
+	}
+	return a.Mode
+}
+
+// MaxOrDefault returns the maximum number of runs for queued and parallel automations.
+func (a *Automation) MaxOrDefault() int {
+	if a.Max <= 0 {
+		return DefaultMaxRuns
+	}
+	return a.Max
 }
@@ -1,12 +1,368 @@
 package automation
 
-type Condition struct {
-	Entity string `yaml:"entity" json:"entity"` // Integration.Typ.Entity_name
-	Field  string `yaml:"field" json:"field"`   // "brightness"
-
-	// Comparison operators
-	Equals      interface{} `yaml:"equals,omitempty" json:"equals,omitempty"`
-	NotEquals   interface{} `yaml:"not_equals,omitempty" json:"not_equals,omitempty"`
-	GreaterThan *float64    `yaml:"gt,omitempty" json:"gt,omitempty"`
-	LessThan    *float64    `yaml:"lt,omitempty" json:"lt,omitempty"`
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"home_automation_server/types"
+	"home_automation_server/utils"
+	"strings"
+	"time"
+)
+
+type ConditionType string
+
+const (
+	ConditionTypeState        ConditionType = "state"
+	ConditionTypeNumericState ConditionType = "numeric_state"
+	ConditionTypeTime         ConditionType = "time"
+	ConditionTypeTemplate     ConditionType = "template"
+	ConditionTypeSun          ConditionType = "sun"
+	ConditionTypeAnd          ConditionType = "and"
+	ConditionTypeOr           ConditionType = "or"
+	ConditionTypeNot          ConditionType = "not"
+)
+
+type Condition interface {
+	Type() ConditionType
+	Evaluate(env *Env) (bool, error)
+}
+
+type BaseCondition struct {
+	Type ConditionType `json:"type"`
+	Data any           `json:"data"`
+}
+
+// legacyCondition is the condition format stored before conditions had a type, e.g.
+// {"entity": "light.kitchen", "field": "brightness", "gt": 50}.
+type legacyCondition struct {
+	Entity      string   `json:"entity"`
+	Field       string   `json:"field"`
+	Equals      any      `json:"equals,omitempty"`
+	NotEquals   any      `json:"not_equals,omitempty"`
+	GreaterThan *float64 `json:"gt,omitempty"`
+	LessThan    *float64 `json:"lt,omitempty"`
+}
+
+// UnmarshalJSON decodes a condition, converting conditions in the legacy format to state and numeric_state
+// conditions, all of which have to pass.
+func (b *BaseCondition) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	_, typed := raw["type"]
+	if _, legacy := raw["entity"]; typed || !legacy {
+		type plain BaseCondition // without the UnmarshalJSON method
+		return json.Unmarshal(data, (*plain)(b))
+	}
+
+	var lc legacyCondition
+	if err := json.Unmarshal(data, &lc); err != nil {
+		return err
+	}
+	*b = lc.convert()
+	return nil
+}
+
+// convert returns the condition in the current format.
+func (lc legacyCondition) convert() BaseCondition {
+	var attribute *string
+	if lc.Field != "" && lc.Field != "state" {
+		attribute = &lc.Field
+	}
+
+	var conditions []BaseCondition
+	if lc.Equals != nil {
+		conditions = append(conditions, BaseCondition{
+			Type: ConditionTypeState,
+			Data: StateCondition{EntityID: lc.Entity, Attribute: attribute, State: lc.Equals},
+		})
+	}
+	if lc.NotEquals != nil {
+		conditions = append(conditions, BaseCondition{
+			Type: ConditionTypeNot,
+			Data: LogicalCondition{Conditions: []BaseCondition{{
+				Type: ConditionTypeState,
+				Data: StateCondition{EntityID: lc.Entity, Attribute: attribute, State: lc.NotEquals},
+			}}},
+		})
+	}
+	if lc.GreaterThan != nil || lc.LessThan != nil {
+		conditions = append(conditions, BaseCondition{
+			Type: ConditionTypeNumericState,
+			Data: NumericStateCondition{EntityID: lc.Entity, Attribute: attribute, Above: lc.GreaterThan, Below: lc.LessThan},
+		})
+	}
+
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	// without a comparison the condition always passes, as nothing was evaluated for it before
+	return BaseCondition{Type: ConditionTypeAnd, Data: LogicalCondition{Conditions: conditions}}
+}
+
+// AsCondition Converts a BaseCondition into a concrete Condition implementation
+func (b BaseCondition) AsCondition() (Condition, error) {
+	dataBytes, err := json.Marshal(b.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Condition
+	switch b.Type {
+	case ConditionTypeState:
+		var sc StateCondition
+		err = json.Unmarshal(dataBytes, &sc)
+		c = sc
+	case ConditionTypeNumericState:
+		var nc NumericStateCondition
+		err = json.Unmarshal(dataBytes, &nc)
+		c = nc
+	case ConditionTypeTime:
+		var tc TimeCondition
+		err = json.Unmarshal(dataBytes, &tc)
+		c = tc
+	case ConditionTypeSun:
+		var sc SunCondition
+		err = json.Unmarshal(dataBytes, &sc)
+		c = sc
+	case ConditionTypeTemplate:
+		var tc TemplateCondition
+		err = json.Unmarshal(dataBytes, &tc)
+		c = tc
+	case ConditionTypeAnd, ConditionTypeOr, ConditionTypeNot:
+		var lc LogicalCondition
+		err = json.Unmarshal(dataBytes, &lc)
+		lc.Operator = b.Type
+		c = lc
+	default:
+		return nil, fmt.Errorf("unknown condition type: %s", b.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// EvaluateConditions returns true if all conditions pass. An empty list always passes.
+func EvaluateConditions(conditions []BaseCondition, env *Env) (bool, error) {
+	for i, baseCondition := range conditions {
+		condition, err := baseCondition.AsCondition()
+		if err != nil {
+			return false, fmt.Errorf("condition %d: %w", i, err)
+		}
+		ok, err := condition.Evaluate(env)
+		if err != nil {
+			return false, fmt.Errorf("condition %d (%s): %w", i, baseCondition.Type, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ---------- Concrete condition types ----------
+
+// StateCondition passes if the entity (or one of its attributes) currently has the given value.
+// State may be a single value or a list of accepted values.
+type StateCondition struct {
+	EntityID  string  `json:"entity_id"`
+	Attribute *string `json:"attribute,omitempty"`
+	State     any     `json:"state"`
+}
+
+func (c StateCondition) Type() ConditionType { return ConditionTypeState }
+
+func (c StateCondition) Evaluate(env *Env) (bool, error) {
+	val, ok := lookupValue(env.States, c.EntityID, c.Attribute)
+	if !ok {
+		return false, nil
+	}
+
+	if accepted, isList := c.State.([]any); isList {
+		for _, a := range accepted {
+			if utils.AnyEqual(val, a) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return utils.AnyEqual(val, c.State), nil
+}
+
+// NumericStateCondition passes if the numeric value of the entity (or attribute) is within the bounds.
+// Above and Below are exclusive; at least one of them must be set.
+type NumericStateCondition struct {
+	EntityID  string   `json:"entity_id"`
+	Attribute *string  `json:"attribute,omitempty"`
+	Above     *float64 `json:"above,omitempty"`
+	Below     *float64 `json:"below,omitempty"`
+}
+
+func (c NumericStateCondition) Type() ConditionType { return ConditionTypeNumericState }
+
+func (c NumericStateCondition) Evaluate(env *Env) (bool, error) {
+	if c.Above == nil && c.Below == nil {
+		return false, errors.New("numeric_state condition requires above or below")
+	}
+
+	raw, ok := lookupValue(env.States, c.EntityID, c.Attribute)
+	if !ok || raw == nil {
+		return false, nil
+	}
+	val, ok := utils.ParseNumber(raw)
+	if !ok {
+		return false, fmt.Errorf("value of %s is not numeric: %v", c.EntityID, raw)
+	}
+
+	if c.Above != nil && val <= *c.Above {
+		return false, nil
+	}
+	if c.Below != nil && val >= *c.Below {
+		return false, nil
+	}
+	return true, nil
+}
+
+// TimeCondition passes if the current time of day is within After and Before (format "15:04" or "15:04:05")
+// and, if Weekday is set, the current weekday is one of the listed days ("mon", "tue", ...).
+// A window where After is later than Before wraps around midnight.
+type TimeCondition struct {
+	After   string   `json:"after,omitempty"`
+	Before  string   `json:"before,omitempty"`
+	Weekday []string `json:"weekday,omitempty"`
+}
+
+func (c TimeCondition) Type() ConditionType { return ConditionTypeTime }
+
+func (c TimeCondition) Evaluate(env *Env) (bool, error) {
+	now := env.Now
+
+	if len(c.Weekday) > 0 {
+		today := strings.ToLower(now.Weekday().String()[:3])
+		match := false
+		for _, day := range c.Weekday {
+			if strings.ToLower(strings.TrimSpace(day)) == today {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false, nil
+		}
+	}
+
+	if c.After == "" && c.Before == "" {
+		return true, nil
+	}
+
+	current := sinceMidnight(now)
+	after, before := time.Duration(0), 24*time.Hour
+	if c.After != "" {
+		d, err := ParseTimeOfDay(c.After)
+		if err != nil {
+			return false, err
+		}
+		after = d
+	}
+	if c.Before != "" {
+		d, err := ParseTimeOfDay(c.Before)
+		if err != nil {
+			return false, err
+		}
+		before = d
+	}
+
+	if after <= before {
+		return current >= after && current < before, nil
+	}
+	// window wraps around midnight, e.g. 22:00 -> 06:00
+	return current >= after || current < before, nil
+}
+
+// TemplateCondition passes if the rendered template is truthy.
+type TemplateCondition struct {
+	ValueTemplate string `json:"value_template"`
+}
+
+func (c TemplateCondition) Type() ConditionType { return ConditionTypeTemplate }
+
+func (c TemplateCondition) Evaluate(env *Env) (bool, error) {
+	if env.Render == nil {
+		return false, errors.New("no template renderer available")
+	}
+	val, err := env.Render(c.ValueTemplate)
+	if err != nil {
+		return false, err
+	}
+	return utils.IsTruthy(val), nil
+}
+
+// LogicalCondition combines nested conditions with and/or/not. "not" passes if none of the nested conditions pass.
+type LogicalCondition struct {
+	Operator   ConditionType   `json:"-"`
+	Conditions []BaseCondition `json:"conditions"`
+}
+
+func (c LogicalCondition) Type() ConditionType { return c.Operator }
+
+func (c LogicalCondition) Evaluate(env *Env) (bool, error) {
+	switch c.Operator {
+	case ConditionTypeAnd:
+		return EvaluateConditions(c.Conditions, env)
+	case ConditionTypeOr, ConditionTypeNot:
+		anyPassed := false
+		for i, baseCondition := range c.Conditions {
+			condition, err := baseCondition.AsCondition()
+			if err != nil {
+				return false, fmt.Errorf("condition %d: %w", i, err)
+			}
+			ok, err := condition.Evaluate(env)
+			if err != nil {
+				return false, fmt.Errorf("condition %d (%s): %w", i, baseCondition.Type, err)
+			}
+			if ok {
+				anyPassed = true
+				break
+			}
+		}
+		if c.Operator == ConditionTypeNot {
+			return !anyPassed, nil
+		}
+		return anyPassed, nil
+	default:
+		return false, fmt.Errorf("unknown logical operator: %s", c.Operator)
+	}
+}
+
+// ---------- helpers ----------
+
+// lookupValue returns the main state of an entity or the given attribute.
+func lookupValue(states types.StateStore, entityID string, attribute *string) (any, bool) {
+	st, ok := states.Get(entityID)
+	if !ok {
+		return nil, false
+	}
+	if attribute != nil {
+		val, ok := st.Attributes[*attribute]
+		return val, ok
+	}
+	return st.State, true
+}
+
+// ParseTimeOfDay parses "15:04" or "15:04:05" into the offset from midnight.
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return sinceMidnight(t), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time of day: %q, expected HH:MM or HH:MM:SS", s)
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
 }
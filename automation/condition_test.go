@@ -0,0 +1,65 @@
+package automation
+
+import (
+	"encoding/json"
+	"home_automation_server/types"
+	"testing"
+)
+
+// stateStore is a types.StateStore backed by a map.
+type stateStore map[string]types.State
+
+func (s stateStore) Get(entityID string) (types.State, bool) {
+	st, ok := s[entityID]
+	return st, ok
+}
+func (s stateStore) Set(entityID string, newState types.State) { s[entityID] = newState }
+func (s stateStore) GetAll() []types.State {
+	states := make([]types.State, 0, len(s))
+	for _, st := range s {
+		states = append(states, st)
+	}
+	return states
+}
+func (s stateStore) Rename(entityID, newEntityID string) bool { return false }
+func (s stateStore) Delete(entityID string)                   { delete(s, entityID) }
+
+func TestLegacyConditions(t *testing.T) {
+	env := &Env{States: stateStore{
+		"light.kitchen": {EntityID: "light.kitchen", State: "on", Attributes: map[string]any{"brightness": 60}},
+	}}
+
+	tests := []struct {
+		name     string
+		json     string
+		wantType ConditionType
+		want     bool
+	}{
+		{"equals state", `{"entity": "light.kitchen", "field": "state", "equals": "on"}`, ConditionTypeState, true},
+		{"equals attribute", `{"entity": "light.kitchen", "field": "brightness", "equals": 50}`, ConditionTypeState, false},
+		{"not equals", `{"entity": "light.kitchen", "field": "state", "not_equals": "off"}`, ConditionTypeNot, true},
+		{"gt", `{"entity": "light.kitchen", "field": "brightness", "gt": 50}`, ConditionTypeNumericState, true},
+		{"gt and lt", `{"entity": "light.kitchen", "field": "brightness", "gt": 10, "lt": 50}`, ConditionTypeNumericState, false},
+		{"equals and gt", `{"entity": "light.kitchen", "field": "brightness", "equals": 60, "gt": 50}`, ConditionTypeAnd, true},
+		{"no comparison", `{"entity": "light.kitchen", "field": "state"}`, ConditionTypeAnd, true},
+		{"current format", `{"type": "state", "data": {"entity_id": "light.kitchen", "state": "off"}}`, ConditionTypeState, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bc BaseCondition
+			if err := json.Unmarshal([]byte(tt.json), &bc); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if bc.Type != tt.wantType {
+				t.Errorf("type = %s, want %s", bc.Type, tt.wantType)
+			}
+			got, err := EvaluateConditions([]BaseCondition{bc}, env)
+			if err != nil {
+				t.Fatalf("EvaluateConditions: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EvaluateConditions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
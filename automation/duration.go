@@ -0,0 +1,65 @@
+package automation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that can be configured as a Go duration string ("30m", "-1h15m"),
+// a clock string ("00:30:00", "-00:30") or a number of seconds.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var raw any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	switch v := raw.(type) {
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+		return nil
+	case string:
+		parsed, err := ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+		return nil
+	case nil:
+		d.Duration = 0
+		return nil
+	default:
+		return fmt.Errorf("invalid duration: %s", string(b))
+	}
+}
+
+// ParseDuration parses a Go duration string or a clock string of the form [-]HH:MM[:SS].
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	sign := time.Duration(1)
+	clock := s
+	if strings.HasPrefix(clock, "-") {
+		sign = -1
+		clock = clock[1:]
+	}
+
+	var h, m, sec int
+	n, err := fmt.Sscanf(clock, "%d:%d:%d", &h, &m, &sec)
+	if err != nil && n < 2 {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+	return sign * (time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second), nil
+}
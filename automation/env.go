@@ -0,0 +1,32 @@
+package automation
+
+import (
+	"home_automation_server/sun"
+	"home_automation_server/types"
+	"time"
+)
+
+// Env is the engine state available to triggers and conditions while they are evaluated.
+type Env struct {
+	States types.StateStore
+	Now    time.Time // current time in the home time zone
+
+	// Sun is the home location used for sun triggers and conditions, nil if not configured.
+	Sun *sun.Location
+
+	// Render resolves a template string against the current engine state and Vars.
+	Render func(tmpl string) (any, error)
+	// Vars are the variables available to templates, e.g. the trigger of an automation run.
+	Vars map[string]any
+
+	// Memory keeps state of stateful triggers between evaluations under TriggerKey,
+	// which the engine sets to identify the trigger being evaluated.
+	Memory     TriggerMemory
+	TriggerKey string
+}
+
+// TriggerMemory stores per-trigger state between evaluations.
+type TriggerMemory interface {
+	Load(key string) (any, bool)
+	Store(key string, value any)
+}
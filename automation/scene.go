@@ -0,0 +1,69 @@
+package automation
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	// SceneDomain is the service domain scenes are registered under, a scene is applied by calling scene.<name>.
+	SceneDomain = "scene"
+	// SceneSnapshotService captures the current states of entities as a scene, see Scene.
+	SceneSnapshotService = "snapshot"
+	// SceneApplyService applies a stored scene or a snapshot by name.
+	SceneApplyService = "apply"
+)
+
+// Scene holds target states of entities. Applying a scene brings the entities back to these states by calling
+// the services of their integrations. Scenes are stored, or captured while running by the scene.snapshot
+// service, e.g. to restore lights after flashing them.
+type Scene struct {
+	Id          uint                   `yaml:"id" json:"id"`     // 0 for snapshots, which are not stored
+	Name        string                 `yaml:"name" json:"name"` // the service name, e.g. "movie" for scene.movie
+	Alias       string                 `yaml:"alias" json:"alias"`
+	Description string                 `yaml:"description" json:"description"`
+	Entities    map[string]SceneEntity `yaml:"entities" json:"entities"` // target states by entity ID
+}
+
+// SceneEntity is the target state of an entity in a scene, in the shape of the state cache entries.
+type SceneEntity struct {
+	State      any            `json:"state"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Service returns the name the scene is applied by, e.g. scene.movie.
+func (s *Scene) Service() string {
+	return SceneDomain + "." + s.Name
+}
+
+// Validate checks that the scene is well-formed. It does not check that the entities exist.
+func (s *Scene) Validate() error {
+	v := &Validator{}
+	s.ValidateInto(v)
+	return v.Err()
+}
+
+// ValidateInto adds the issues found by Validate to v.
+func (s *Scene) ValidateInto(v *Validator) {
+	if !serviceNamePattern.MatchString(s.Name) {
+		v.Add("name", "name must consist of lowercase letters, digits and underscores, got %q", s.Name)
+	}
+	if s.Name == SceneSnapshotService || s.Name == SceneApplyService {
+		v.Add("name", "name %q is reserved", s.Name)
+	}
+	if strings.TrimSpace(s.Alias) == "" {
+		v.Add("alias", "alias is required")
+	}
+	if len(s.Entities) == 0 {
+		v.Add("entities", "at least one entity is required")
+	}
+	for _, entityID := range slices.Sorted(maps.Keys(s.Entities)) {
+		if !strings.Contains(entityID, ".") {
+			v.Add("entities/"+entityID, "invalid entity id %q", entityID)
+		}
+		if s.Entities[entityID].State == nil {
+			v.Add("entities/"+entityID, "state is required")
+		}
+	}
+}
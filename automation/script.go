@@ -0,0 +1,87 @@
+package automation
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ScriptDomain is the service domain scripts are registered under, a script is called as script.<name>.
+const ScriptDomain = "script"
+
+// serviceNamePattern matches the names of scripts and scenes, which are used as service names.
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Script is a named action sequence that can be called as a service. The params of the call are available
+// to the templates of the sequence as variables.
+type Script struct {
+	Id          uint                   `yaml:"id" json:"id"`
+	Name        string                 `yaml:"name" json:"name"` // the service name, e.g. "morning" for script.morning
+	Alias       string                 `yaml:"alias" json:"alias"`
+	Description string                 `yaml:"description" json:"description"`
+	Fields      map[string]ScriptField `yaml:"fields" json:"fields,omitempty"`
+	Sequence    []Action               `yaml:"sequence" json:"sequence"`
+	Mode        RunMode                `yaml:"mode" json:"mode,omitempty"`
+	Max         int                    `yaml:"max" json:"max,omitempty"`
+}
+
+// ScriptField describes a param of a script. Type is one of the DataTypes of service params.
+type ScriptField struct {
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Default     any    `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Service returns the name the script is called by, e.g. script.morning.
+func (s *Script) Service() string {
+	return ScriptDomain + "." + s.Name
+}
+
+// ModeOrDefault returns the run mode of the script, single if none is set.
+func (s *Script) ModeOrDefault() RunMode {
+	if s.Mode == "" {
+		return RunModeSingle
+	}
+	return s.Mode
+}
+
+// MaxOrDefault returns the maximum number of runs for queued and parallel scripts.
+func (s *Script) MaxOrDefault() int {
+	if s.Max <= 0 {
+		return DefaultMaxRuns
+	}
+	return s.Max
+}
+
+// Validate checks that the script is well-formed. Like Automation.Validate it does not check that services
+// or entities exist.
+func (s *Script) Validate() error {
+	v := &Validator{}
+	s.ValidateInto(v)
+	return v.Err()
+}
+
+// ValidateInto adds the issues found by Validate to v.
+func (s *Script) ValidateInto(v *Validator) {
+	if !serviceNamePattern.MatchString(s.Name) {
+		v.Add("name", "name must consist of lowercase letters, digits and underscores, got %q", s.Name)
+	}
+	if strings.TrimSpace(s.Alias) == "" {
+		v.Add("alias", "alias is required")
+	}
+	for name, field := range s.Fields {
+		switch field.Type {
+		case "", "string", "int", "float", "bool", "list":
+		default:
+			v.Add("fields/"+name, "unknown type %q", field.Type)
+		}
+	}
+	validateRunMode(v, s.Mode, s.Max)
+
+	if len(s.Sequence) == 0 {
+		v.Add("sequence", "at least one action is required")
+	}
+	WalkActions(s.Sequence, "sequence", func(action *Action, path string) {
+		validateAction(v, action, path)
+	})
+}
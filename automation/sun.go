@@ -0,0 +1,91 @@
+package automation
+
+import (
+	"errors"
+	"fmt"
+	"home_automation_server/sun"
+	"home_automation_server/types"
+	"time"
+)
+
+var errNoHomeLocation = errors.New("home location is not configured")
+
+// SunTrigger fires at a sun event (sunrise, sunset, dawn, dusk or noon) shifted by Offset, e.g. "-00:30" for
+// 30 minutes before the event. Like the other time based triggers it is evaluated once per minute.
+type SunTrigger struct {
+	Event  sun.Event `json:"event"`
+	Offset Duration  `json:"offset,omitempty"`
+}
+
+func (t SunTrigger) Type() TriggerType { return TriggerTypeSun }
+
+func (t SunTrigger) Evaluate(e types.Event, env *Env) (bool, error) {
+	now, ok, err := timeChangedNow(e)
+	if !ok || err != nil {
+		return false, err
+	}
+	if env.Sun == nil {
+		return false, errNoHomeLocation
+	}
+
+	// the offset may move the trigger into the previous or next day, so look up the event on the day it belongs to.
+	eventDay := now.Add(-t.Offset.Duration)
+	at := env.Sun.Times(eventDay).Get(t.Event)
+	if at.IsZero() {
+		if !isSunEvent(t.Event) {
+			return false, fmt.Errorf("unknown sun event: %s", t.Event)
+		}
+		return false, nil // the event does not occur on this day
+	}
+
+	return now.Truncate(time.Minute).Equal(at.Add(t.Offset.Duration).Truncate(time.Minute)), nil
+}
+
+// SunCondition passes if the current time is after the After event and before the Before event of today,
+// each shifted by its offset. Use an "or" condition for windows spanning midnight, e.g. after sunset or before sunrise.
+type SunCondition struct {
+	After        sun.Event `json:"after,omitempty"`
+	AfterOffset  Duration  `json:"after_offset,omitempty"`
+	Before       sun.Event `json:"before,omitempty"`
+	BeforeOffset Duration  `json:"before_offset,omitempty"`
+}
+
+func (c SunCondition) Type() ConditionType { return ConditionTypeSun }
+
+func (c SunCondition) Evaluate(env *Env) (bool, error) {
+	if env.Sun == nil {
+		return false, errNoHomeLocation
+	}
+	if c.After == "" && c.Before == "" {
+		return false, errors.New("sun condition requires after or before")
+	}
+
+	today := env.Sun.Times(env.Now)
+	if c.After != "" {
+		if !isSunEvent(c.After) {
+			return false, fmt.Errorf("unknown sun event: %s", c.After)
+		}
+		at := today.Get(c.After)
+		if at.IsZero() || env.Now.Before(at.Add(c.AfterOffset.Duration)) {
+			return false, nil
+		}
+	}
+	if c.Before != "" {
+		if !isSunEvent(c.Before) {
+			return false, fmt.Errorf("unknown sun event: %s", c.Before)
+		}
+		at := today.Get(c.Before)
+		if at.IsZero() || !env.Now.Before(at.Add(c.BeforeOffset.Duration)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func isSunEvent(event sun.Event) bool {
+	switch event {
+	case sun.Dawn, sun.Sunrise, sun.Noon, sun.Sunset, sun.Dusk:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package automation
+
+import (
+	"errors"
+	"fmt"
+	"home_automation_server/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time based triggers are evaluated against the time_changed events emitted by the engine scheduler once per minute.
+// Seconds in configured times are therefore ignored.
+
+// TimeTrigger fires every day at a fixed time of day, e.g. "23:30".
+type TimeTrigger struct {
+	At string `json:"at"`
+}
+
+func (t TimeTrigger) Type() TriggerType { return TriggerTypeTime }
+
+func (t TimeTrigger) Evaluate(e types.Event, env *Env) (bool, error) {
+	now, ok, err := timeChangedNow(e)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	at, err := ParseTimeOfDay(t.At)
+	if err != nil {
+		return false, err
+	}
+	return sameMinute(sinceMidnight(now), at), nil
+}
+
+// TimePatternTrigger fires when the current hour and minute match the patterns.
+// A pattern is "*" (any), "/N" (every N) or a fixed number. If only Hours is set Minutes defaults to "0".
+type TimePatternTrigger struct {
+	Hours   string `json:"hours,omitempty"`
+	Minutes string `json:"minutes,omitempty"`
+}
+
+func (t TimePatternTrigger) Type() TriggerType { return TriggerTypeTimePattern }
+
+func (t TimePatternTrigger) Evaluate(e types.Event, env *Env) (bool, error) {
+	now, ok, err := timeChangedNow(e)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	if t.Hours == "" && t.Minutes == "" {
+		return false, errors.New("time_pattern trigger requires hours or minutes")
+	}
+
+	hours, minutes := t.Hours, t.Minutes
+	if hours == "" {
+		hours = "*"
+	}
+	if minutes == "" {
+		minutes = "0"
+	}
+
+	hourMatch, err := matchPattern(hours, now.Hour(), 23)
+	if err != nil {
+		return false, fmt.Errorf("invalid hours pattern: %w", err)
+	}
+	minuteMatch, err := matchPattern(minutes, now.Minute(), 59)
+	if err != nil {
+		return false, fmt.Errorf("invalid minutes pattern: %w", err)
+	}
+	return hourMatch && minuteMatch, nil
+}
+
+// DateTrigger fires once at the given date and time of day. Date is either "2006-01-02" for a single occasion
+// or "01-02" to fire every year. At defaults to midnight.
+type DateTrigger struct {
+	Date string `json:"date"`
+	At   string `json:"at,omitempty"`
+}
+
+func (t DateTrigger) Type() TriggerType { return TriggerTypeDate }
+
+func (t DateTrigger) Evaluate(e types.Event, env *Env) (bool, error) {
+	now, ok, err := timeChangedNow(e)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	switch len(t.Date) {
+	case len("2006-01-02"):
+		if now.Format("2006-01-02") != t.Date {
+			return false, nil
+		}
+	case len("01-02"):
+		if now.Format("01-02") != t.Date {
+			return false, nil
+		}
+	default:
+		return false, fmt.Errorf("invalid date: %q, expected YYYY-MM-DD or MM-DD", t.Date)
+	}
+
+	at := time.Duration(0)
+	if t.At != "" {
+		at, err = ParseTimeOfDay(t.At)
+		if err != nil {
+			return false, err
+		}
+	}
+	return sameMinute(sinceMidnight(now), at), nil
+}
+
+// ---------- helpers ----------
+
+// timeChangedNow extracts the current time from a time_changed event. ok is false for other event types.
+func timeChangedNow(e types.Event) (time.Time, bool, error) {
+	if e.Type != types.EventTimeChanged {
+		return time.Time{}, false, nil
+	}
+	data, ok := e.Data.(types.TimeChangedData)
+	if !ok {
+		return time.Time{}, false, errors.New("unable to type assert time changed data")
+	}
+	return data.Now, true, nil
+}
+
+func sameMinute(a, b time.Duration) bool {
+	return a.Truncate(time.Minute) == b.Truncate(time.Minute)
+}
+
+func matchPattern(pattern string, value, max int) (bool, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "*" {
+		return true, nil
+	}
+	if strings.HasPrefix(pattern, "/") {
+		n, err := strconv.Atoi(pattern[1:])
+		if err != nil || n <= 0 || n > max {
+			return false, fmt.Errorf("%q is not a valid interval", pattern)
+		}
+		return value%n == 0, nil
+	}
+	n, err := strconv.Atoi(pattern)
+	if err != nil || n < 0 || n > max {
+		return false, fmt.Errorf("%q is not a valid value", pattern)
+	}
+	return value == n, nil
+}
@@ -0,0 +1,88 @@
+package automation
+
+import (
+	"home_automation_server/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func timeChanged(hour, minute int) types.Event {
+	return types.Event{
+		Type: types.EventTimeChanged,
+		Data: types.TimeChangedData{Now: time.Date(2024, 3, 10, hour, minute, 30, 0, time.UTC)},
+	}
+}
+
+func TestTimePatternTrigger(t *testing.T) {
+	tests := []struct {
+		name         string
+		hours        string
+		minutes      string
+		hour, minute int
+		want         bool
+	}{
+		{"every minute", "*", "*", 13, 47, true},
+		{"fixed minute", "", "15", 9, 15, true},
+		{"fixed minute, other minute", "", "15", 9, 16, false},
+		{"every 5 minutes", "", "/5", 9, 25, true},
+		{"every 5 minutes, between", "", "/5", 9, 26, false},
+		{"every 5 minutes, on the hour", "", "/5", 9, 0, true},
+		{"hours only fires on the hour", "7", "", 7, 0, true},
+		{"hours only, past the hour", "7", "", 7, 1, false},
+		{"every 2 hours", "/2", "0", 14, 0, true},
+		{"every 2 hours, odd hour", "/2", "0", 15, 0, false},
+		{"fixed hour and minute", "23", "59", 23, 59, true},
+		{"fixed hour, other hour", "23", "59", 22, 59, false},
+		{"whitespace", " 6 ", " /30 ", 6, 30, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger := TimePatternTrigger{Hours: tt.hours, Minutes: tt.minutes}
+			got, err := trigger.Evaluate(timeChanged(tt.hour, tt.minute), nil)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("hours %q minutes %q at %02d:%02d = %v, want %v", tt.hours, tt.minutes, tt.hour, tt.minute, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimePatternTriggerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		hours   string
+		minutes string
+		want    string // part of the error
+	}{
+		{"no pattern", "", "", "requires hours or minutes"},
+		{"hour out of range", "24", "", "invalid hours pattern"},
+		{"minute out of range", "", "60", "invalid minutes pattern"},
+		{"negative", "", "-1", "not a valid value"},
+		{"zero interval", "", "/0", "not a valid interval"},
+		{"interval out of range", "/24", "", "not a valid interval"},
+		{"not a number", "", "abc", "not a valid value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger := TimePatternTrigger{Hours: tt.hours, Minutes: tt.minutes}
+			_, err := trigger.Evaluate(timeChanged(0, 0), nil)
+			if err == nil {
+				t.Fatalf("hours %q minutes %q: want an error containing %q", tt.hours, tt.minutes, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("hours %q minutes %q: error = %q, want it to contain %q", tt.hours, tt.minutes, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimePatternTriggerIgnoresOtherEvents(t *testing.T) {
+	trigger := TimePatternTrigger{Minutes: "*"}
+	got, err := trigger.Evaluate(types.Event{Type: types.EventTypeStateChanged}, nil)
+	if err != nil || got {
+		t.Errorf("Evaluate(state_changed) = %v, %v, want false, nil", got, err)
+	}
+}
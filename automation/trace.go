@@ -0,0 +1,180 @@
+package automation
+
+import (
+	"home_automation_server/types"
+	"sync"
+	"time"
+)
+
+type TraceResult string
+
+const (
+	TraceResultRunning          TraceResult = "running"
+	TraceResultFinished         TraceResult = "finished"
+	TraceResultFailed           TraceResult = "failed"
+	TraceResultStopped          TraceResult = "stopped"   // a wait timed out and the sequence did not continue
+	TraceResultCancelled        TraceResult = "cancelled" // the automation was changed, disabled or restarted
+	TraceResultDropped          TraceResult = "dropped"   // the run was not started because of the run mode
+	TraceResultConditionsNotMet TraceResult = "conditions_not_met"
+)
+
+// Trace records a single run of an automation or script: what triggered it, how the triggers and conditions
+// evaluated and what each step of the sequence did. Script traces have a ScriptID instead of an AutomationID.
+// Steps are recorded concurrently by non-blocking service calls, all writes go through the methods.
+type Trace struct {
+	RunID        string            `json:"run_id"`
+	AutomationID uint64            `json:"automation_id,omitempty"`
+	ScriptID     uint              `json:"script_id,omitempty"`
+	Alias        string            `json:"alias"`
+	Context      *types.Context    `json:"context"`             // the context of the run, its parent is the triggering event or calling run
+	Variables    map[string]any    `json:"variables,omitempty"` // the params a script was called with
+	Event        *types.Event      `json:"event,omitempty"`     // the event that fired the trigger
+	Triggers     []TraceEvaluation `json:"triggers"`
+	Conditions   []TraceEvaluation `json:"conditions"`
+	Steps        []*TraceStep      `json:"steps"`
+	Result       TraceResult       `json:"result"`
+	Error        string            `json:"error,omitempty"`
+	Started      time.Time         `json:"started"`
+	Finished     *time.Time        `json:"finished,omitempty"`
+
+	mu      sync.Mutex
+	pending sync.WaitGroup // non-blocking service calls that are still running
+}
+
+// TraceEvaluation is the result of evaluating a trigger or condition.
+type TraceEvaluation struct {
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Result bool   `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TraceStep records the execution of one action. Path locates the action in the automation,
+// e.g. "action/1/choose/0/sequence/2".
+type TraceStep struct {
+	Path     string         `json:"path"`
+	Type     ActionType     `json:"type"`
+	Service  string         `json:"service,omitempty"`
+	Params   map[string]any `json:"params,omitempty"`  // params after templates were rendered
+	Targets  []Target       `json:"targets,omitempty"` // targets after templates were rendered
+	Attempts []TraceAttempt `json:"attempts,omitempty"`
+	Result   map[string]any `json:"result,omitempty"` // step specific outcome, e.g. the chosen option or whether a wait timed out
+	Error    string         `json:"error,omitempty"`
+	Started  time.Time      `json:"started"`
+	Finished *time.Time     `json:"finished,omitempty"`
+}
+
+// TraceAttempt is a failed attempt of a service call that was retried.
+type TraceAttempt struct {
+	Attempt int       `json:"attempt"`
+	Error   string    `json:"error"`
+	Time    time.Time `json:"time"`
+}
+
+func NewTrace(runID string, a *Automation, event *types.Event) *Trace {
+	runContext := &types.Context{ID: runID}
+	if event != nil && event.Context != nil {
+		runContext.ParentID = event.Context.ID
+	}
+	return &Trace{
+		RunID:        runID,
+		AutomationID: a.Id,
+		Alias:        a.Alias,
+		Context:      runContext,
+		Event:        event,
+		Result:       TraceResultRunning,
+		Started:      time.Now(),
+	}
+}
+
+func NewScriptTrace(runID string, s *Script, vars map[string]any) *Trace {
+	return &Trace{
+		RunID:     runID,
+		ScriptID:  s.Id,
+		Alias:     s.Alias,
+		Context:   &types.Context{ID: runID},
+		Variables: vars,
+		Result:    TraceResultRunning,
+		Started:   time.Now(),
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func (t *Trace) AddTrigger(index int, typ TriggerType, fired bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Triggers = append(t.Triggers, TraceEvaluation{Index: index, Type: string(typ), Result: fired, Error: errString(err)})
+}
+
+func (t *Trace) AddCondition(index int, typ ConditionType, passed bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Conditions = append(t.Conditions, TraceEvaluation{Index: index, Type: string(typ), Result: passed, Error: errString(err)})
+}
+
+// StartStep records the start of an action and returns the step to finish later.
+func (t *Trace) StartStep(path string, typ ActionType, service string) *TraceStep {
+	step := &TraceStep{Path: path, Type: typ, Service: service, Started: time.Now()}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Steps = append(t.Steps, step)
+	return step
+}
+
+// SetCall records the resolved params and targets of a service call.
+func (t *Trace) SetCall(step *TraceStep, params map[string]any, targets []Target) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	step.Params = params
+	step.Targets = targets
+}
+
+func (t *Trace) AddAttempt(step *TraceStep, attempt int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	step.Attempts = append(step.Attempts, TraceAttempt{Attempt: attempt, Error: errString(err), Time: time.Now()})
+}
+
+// SetStepResult records a step specific outcome under key.
+func (t *Trace) SetStepResult(step *TraceStep, key string, value any) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if step.Result == nil {
+		step.Result = make(map[string]any)
+	}
+	step.Result[key] = value
+}
+
+func (t *Trace) FinishStep(step *TraceStep, err error) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	step.Finished = &now
+	step.Error = errString(err)
+}
+
+// Go runs a non-blocking call. Finish waits for it before the trace is completed.
+func (t *Trace) Go(fn func()) {
+	t.pending.Add(1)
+	go func() {
+		defer t.pending.Done()
+		fn()
+	}()
+}
+
+// Finish waits for pending non-blocking calls and completes the trace.
+func (t *Trace) Finish(result TraceResult, err error) {
+	t.pending.Wait()
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Result = result
+	t.Error = errString(err)
+	t.Finished = &now
+}
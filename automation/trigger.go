@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"home_automation_server/types"
 	"home_automation_server/utils"
+	"time"
 )
 
 type TriggerType string
@@ -13,11 +14,18 @@ type TriggerType string
 const (
 	TriggerTypeState TriggerType = "state"
 	TriggerTypeEvent TriggerType = "event"
+
+	TriggerTypeNumericState TriggerType = "numeric_state"
+
+	TriggerTypeTime        TriggerType = "time"
+	TriggerTypeTimePattern TriggerType = "time_pattern"
+	TriggerTypeDate        TriggerType = "date"
+	TriggerTypeSun         TriggerType = "sun"
 )
 
 type Trigger interface {
 	Type() TriggerType
-	Evaluate(e types.Event) (bool, error)
+	Evaluate(e types.Event, env *Env) (bool, error)
 }
 
 type BaseTrigger struct {
@@ -39,12 +47,42 @@ func (b BaseTrigger) AsTrigger() (Trigger, error) {
 			return nil, err
 		}
 		return st, nil
+	case TriggerTypeNumericState:
+		var nt NumericStateTrigger
+		if err := json.Unmarshal(dataBytes, &nt); err != nil {
+			return nil, err
+		}
+		return nt, nil
 	case TriggerTypeEvent:
 		var et EventTrigger
 		if err := json.Unmarshal(dataBytes, &et); err != nil {
 			return nil, err
 		}
 		return et, nil
+	case TriggerTypeTime:
+		var tt TimeTrigger
+		if err := json.Unmarshal(dataBytes, &tt); err != nil {
+			return nil, err
+		}
+		return tt, nil
+	case TriggerTypeTimePattern:
+		var tp TimePatternTrigger
+		if err := json.Unmarshal(dataBytes, &tp); err != nil {
+			return nil, err
+		}
+		return tp, nil
+	case TriggerTypeDate:
+		var dt DateTrigger
+		if err := json.Unmarshal(dataBytes, &dt); err != nil {
+			return nil, err
+		}
+		return dt, nil
+	case TriggerTypeSun:
+		var st SunTrigger
+		if err := json.Unmarshal(dataBytes, &st); err != nil {
+			return nil, err
+		}
+		return st, nil
 	default:
 		return nil, fmt.Errorf("unknown trigger type: %s", b.Type)
 	}
@@ -53,16 +91,18 @@ func (b BaseTrigger) AsTrigger() (Trigger, error) {
 // ---------- Concrete trigger types ----------
 
 // StateTrigger triggers on state_change events that match the constraints.
+// If For is set the trigger only fires once the new value has been held for the duration.
 type StateTrigger struct {
-	EntityID  string  `json:"entity_id"`
-	Attribute *string `json:"attribute,omitempty"`
-	From      any     `json:"from,omitempty"`
-	To        any     `json:"to,omitempty"`
+	EntityID  string    `json:"entity_id"`
+	Attribute *string   `json:"attribute,omitempty"`
+	From      any       `json:"from,omitempty"`
+	To        any       `json:"to,omitempty"`
+	For       *Duration `json:"for,omitempty"`
 }
 
 func (t StateTrigger) Type() TriggerType { return TriggerTypeState }
 
-func (t StateTrigger) Evaluate(e types.Event) (bool, error) {
+func (t StateTrigger) Evaluate(e types.Event, env *Env) (bool, error) {
 	if e.Type != types.EventTypeStateChanged {
 		return false, nil
 	}
@@ -76,22 +116,8 @@ func (t StateTrigger) Evaluate(e types.Event) (bool, error) {
 		return false, nil
 	}
 
-	var oldVal, newVal any
-	if t.Attribute != nil {
-		if eventData.OldState != nil {
-			oldVal = eventData.OldState.Attributes[*t.Attribute]
-		}
-		if eventData.NewState != nil {
-			newVal = eventData.NewState.Attributes[*t.Attribute]
-		}
-	} else {
-		if eventData.OldState != nil {
-			oldVal = eventData.OldState.State
-		}
-		if eventData.NewState != nil {
-			newVal = eventData.NewState.State
-		}
-	}
+	oldVal := t.WatchedValue(eventData.OldState)
+	newVal := t.WatchedValue(eventData.NewState)
 
 	if utils.AnyEqual(oldVal, newVal) {
 		return false, nil
@@ -107,13 +133,141 @@ func (t StateTrigger) Evaluate(e types.Event) (bool, error) {
 	return true, nil
 }
 
-// EventTrigger triggers on any event of a given type.
+// WatchedValue returns the value the trigger compares: the configured attribute or the main state.
+func (t StateTrigger) WatchedValue(s *types.State) any {
+	if s == nil {
+		return nil
+	}
+	if t.Attribute != nil {
+		return s.Attributes[*t.Attribute]
+	}
+	return s.State
+}
+
+// HoldDuration returns the "for" duration, 0 if the trigger fires immediately.
+func (t StateTrigger) HoldDuration() time.Duration {
+	if t.For == nil || t.For.Duration < 0 {
+		return 0
+	}
+	return t.For.Duration
+}
+
+// NumericStateTrigger fires when the numeric value of an entity (or attribute) crosses into the range
+// given by Above and Below (both exclusive, at least one required).
+// With a Hysteresis the trigger only re-arms once the value has left the range by more than the hysteresis,
+// so a noisy value hovering around a threshold fires once.
+type NumericStateTrigger struct {
+	EntityID   string   `json:"entity_id"`
+	Attribute  *string  `json:"attribute,omitempty"`
+	Above      *float64 `json:"above,omitempty"`
+	Below      *float64 `json:"below,omitempty"`
+	Hysteresis float64  `json:"hysteresis,omitempty"`
+}
+
+func (t NumericStateTrigger) Type() TriggerType { return TriggerTypeNumericState }
+
+func (t NumericStateTrigger) Evaluate(e types.Event, env *Env) (bool, error) {
+	if e.Type != types.EventTypeStateChanged {
+		return false, nil
+	}
+	if t.Above == nil && t.Below == nil {
+		return false, errors.New("numeric_state trigger requires above or below")
+	}
+	if t.Hysteresis < 0 {
+		return false, errors.New("hysteresis must not be negative")
+	}
+
+	eventData, ok := e.Data.(types.StateChangedData)
+	if !ok {
+		return false, errors.New("unable to type assert state changed data")
+	}
+	if eventData.EntityID != t.EntityID {
+		return false, nil
+	}
+
+	newVal, ok := t.numericValue(eventData.NewState)
+	if !ok {
+		return false, nil
+	}
+
+	armed := true
+	if env.Memory != nil {
+		if v, ok := env.Memory.Load(env.TriggerKey); ok {
+			armed, _ = v.(bool)
+		}
+	}
+
+	if !t.inRange(newVal) {
+		if !armed && t.clearOfRange(newVal) {
+			t.setArmed(env, true)
+		}
+		return false, nil
+	}
+
+	oldVal, ok := t.numericValue(eventData.OldState)
+	if !armed || !ok || t.inRange(oldVal) {
+		return false, nil
+	}
+
+	t.setArmed(env, false)
+	return true, nil
+}
+
+func (t NumericStateTrigger) numericValue(s *types.State) (float64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	var raw any = s.State
+	if t.Attribute != nil {
+		raw = s.Attributes[*t.Attribute]
+	}
+	return utils.ParseNumber(raw)
+}
+
+func (t NumericStateTrigger) inRange(v float64) bool {
+	return (t.Above == nil || v > *t.Above) && (t.Below == nil || v < *t.Below)
+}
+
+// clearOfRange reports whether the value is outside the range by more than the hysteresis.
+func (t NumericStateTrigger) clearOfRange(v float64) bool {
+	return (t.Above != nil && v <= *t.Above-t.Hysteresis) || (t.Below != nil && v >= *t.Below+t.Hysteresis)
+}
+
+func (t NumericStateTrigger) setArmed(env *Env, armed bool) {
+	if env.Memory != nil {
+		env.Memory.Store(env.TriggerKey, armed)
+	}
+}
+
+// EventTrigger triggers on events of a given type. If EventData is set, the data of the event must have the
+// same values for its keys, e.g. {"domain": "hue", "service": "toggle"} for call_service events.
 type EventTrigger struct {
 	EventType types.EventType `json:"event_type"`
+	EventData map[string]any  `json:"event_data,omitempty"`
 }
 
 func (t EventTrigger) Type() TriggerType { return TriggerTypeEvent }
 
-func (t EventTrigger) Evaluate(e types.Event) (bool, error) {
-	return e.Type == t.EventType, nil
+func (t EventTrigger) Evaluate(e types.Event, env *Env) (bool, error) {
+	if e.Type != t.EventType {
+		return false, nil
+	}
+	if len(t.EventData) == 0 {
+		return true, nil
+	}
+
+	b, err := json.Marshal(e.Data)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal event data: %w", err)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return false, nil // not an object, e.g. no data
+	}
+	for key, want := range t.EventData {
+		if !utils.AnyEqual(data[key], want) {
+			return false, nil
+		}
+	}
+	return true, nil
 }
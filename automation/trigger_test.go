@@ -0,0 +1,45 @@
+package automation
+
+import (
+	"home_automation_server/types"
+	"testing"
+)
+
+func stateChanged(entityID string, oldState, newState any) types.Event {
+	return types.Event{
+		Type: types.EventTypeStateChanged,
+		Data: types.StateChangedData{
+			EntityID: entityID,
+			OldState: &types.State{EntityID: entityID, State: oldState},
+			NewState: &types.State{EntityID: entityID, State: newState},
+		},
+	}
+}
+
+func TestNumericStateTrigger(t *testing.T) {
+	above := 20.0
+	trigger := NumericStateTrigger{EntityID: "sensor.temperature", Above: &above}
+
+	tests := []struct {
+		name     string
+		old, new any
+		want     bool
+	}{
+		{"crosses above", 19.5, 21.0, true},
+		{"string state crosses above", "19.5", " 21.5 ", true},
+		{"string state stays below", "18", "19.9", false},
+		{"string state already above", "21", "22", false},
+		{"not a number", "unavailable", "21", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := trigger.Evaluate(stateChanged("sensor.temperature", tt.old, tt.new), &Env{})
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("%v -> %v = %v, want %v", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package automation
+
+import (
+	"fmt"
+	"home_automation_server/templating"
+	"strings"
+)
+
+// Issue is a single problem found while validating an automation. Path locates the offending part,
+// e.g. "action/2/choose/0/conditions/1".
+type Issue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the issues that make an automation invalid.
+type ValidationError struct {
+	Issues []Issue `json:"issues"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.Path + ": " + issue.Message
+	}
+	return "invalid automation: " + strings.Join(msgs, "; ")
+}
+
+// Validator collects issues while walking an automation.
+type Validator struct {
+	issues []Issue
+}
+
+func (v *Validator) Add(path, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Issues returns the collected issues.
+func (v *Validator) Issues() []Issue {
+	return v.issues
+}
+
+// Err returns a *ValidationError with the collected issues, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.issues) == 0 {
+		return nil
+	}
+	return &ValidationError{Issues: v.issues}
+}
+
+// Validate checks that the automation is well-formed: it has an alias and a trigger, and every trigger,
+// condition and action can be decoded. It does not check that services or entities exist.
+func (a *Automation) Validate() error {
+	v := &Validator{}
+	a.ValidateInto(v)
+	return v.Err()
+}
+
+// ValidateInto adds the issues found by Validate to v, so callers can add their own checks.
+func (a *Automation) ValidateInto(v *Validator) {
+	if strings.TrimSpace(a.Alias) == "" {
+		v.Add("alias", "alias is required")
+	}
+
+	if len(a.Trigger) == 0 {
+		v.Add("trigger", "at least one trigger is required")
+	}
+	for i, t := range a.Trigger {
+		if _, err := t.AsTrigger(); err != nil {
+			v.Add(fmt.Sprintf("trigger/%d", i), "%v", err)
+		}
+	}
+
+	ValidateConditions(v, a.Condition, "condition")
+
+	validateRunMode(v, a.Mode, a.Max)
+
+	if len(a.Actions) == 0 {
+		v.Add("action", "at least one action is required")
+	}
+	WalkActions(a.Actions, "action", func(action *Action, path string) {
+		validateAction(v, action, path)
+	})
+}
+
+func validateRunMode(v *Validator, mode RunMode, max int) {
+	switch mode {
+	case "", RunModeSingle, RunModeRestart, RunModeQueued, RunModeParallel:
+	default:
+		v.Add("mode", "unknown run mode %q", mode)
+	}
+	if max < 0 {
+		v.Add("max", "max must not be negative")
+	}
+}
+
+// ValidateConditions checks that the conditions, including nested ones, can be decoded.
+func ValidateConditions(v *Validator, conditions []BaseCondition, path string) {
+	for i, c := range conditions {
+		p := fmt.Sprintf("%s/%d", path, i)
+		condition, err := c.AsCondition()
+		if err != nil {
+			v.Add(p, "%v", err)
+			continue
+		}
+		switch c := condition.(type) {
+		case LogicalCondition:
+			ValidateConditions(v, c.Conditions, p+"/conditions")
+		case TemplateCondition:
+			validateTemplate(v, c.ValueTemplate, p+"/value_template")
+		}
+	}
+}
+
+func validateAction(v *Validator, action *Action, path string) {
+	typ, err := action.Type()
+	if err != nil {
+		v.Add(path, "%v", err)
+		return
+	}
+
+	switch typ {
+	case ActionTypeService:
+		if domain, service, ok := strings.Cut(action.Service, "."); !ok || domain == "" || service == "" {
+			v.Add(path+"/service", "invalid service format: %s, expected domain.service", action.Service)
+		}
+	case ActionTypeDelay:
+		if action.Delay.Duration < 0 {
+			v.Add(path+"/delay", "delay must not be negative")
+		}
+	case ActionTypeWaitTemplate:
+		validateTemplate(v, action.WaitTemplate, path+"/wait_template")
+	case ActionTypeWaitForTrigger:
+		for i, t := range action.WaitForTrigger {
+			if _, err := t.AsTrigger(); err != nil {
+				v.Add(fmt.Sprintf("%s/wait_for_trigger/%d", path, i), "%v", err)
+			}
+		}
+	case ActionTypeChoose:
+		for i, option := range action.Choose {
+			ValidateConditions(v, option.Conditions, fmt.Sprintf("%s/choose/%d/conditions", path, i))
+		}
+	case ActionTypeRepeat:
+		r := action.Repeat
+		if r.Count <= 0 && len(r.While) == 0 && len(r.Until) == 0 {
+			v.Add(path+"/repeat", "repeat requires count, while or until")
+		}
+		ValidateConditions(v, r.While, path+"/repeat/while")
+		ValidateConditions(v, r.Until, path+"/repeat/until")
+	}
+}
+
+func validateTemplate(v *Validator, tmpl, path string) {
+	if _, err := templating.Parse(tmpl); err != nil {
+		v.Add(path, "%v", err)
+	}
+}
+
+// WalkActions calls fn for every action of the sequence, including the actions nested in choose and repeat
+// steps. path is the location of the sequence, e.g. "action".
+func WalkActions(actions []Action, path string, fn func(action *Action, path string)) {
+	for i := range actions {
+		action := &actions[i]
+		p := fmt.Sprintf("%s/%d", path, i)
+		fn(action, p)
+		for j := range action.Choose {
+			WalkActions(action.Choose[j].Sequence, fmt.Sprintf("%s/choose/%d/sequence", p, j), fn)
+		}
+		WalkActions(action.Default, p+"/default", fn)
+		if action.Repeat != nil {
+			WalkActions(action.Repeat.Sequence, p+"/repeat/sequence", fn)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package automation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The IDs of automations from files lie in [fileIDBase, fileIDLimit). fileIDBase offsets them from the IDs
+// from the database, fileIDLimit keeps them exact as JavaScript numbers.
+const (
+	fileIDBase  uint64 = 1 << 32
+	fileIDLimit uint64 = 1 << 53
+)
+
+// ParseYAML parses the automations of the YAML file name, which is either a single automation or a list of
+// them. The keys are the same as in the JSON representation, so triggers, conditions and actions are decoded
+// the same way. Automations are active unless `active: false` is given.
+//
+// The ID of an automation is derived from the file name and its optional `id` key, any string or number, so
+// it keeps its ID, and its traces, across reloads and renames of its alias. Automations without an id are
+// identified by their position in the file instead.
+func ParseYAML(name string, data []byte) ([]Automation, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var raw []any
+	switch v := doc.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		raw = v
+	case map[string]any:
+		raw = []any{v}
+	default:
+		return nil, fmt.Errorf("expected an automation or a list of automations, got %T", doc)
+	}
+
+	automations := make([]Automation, 0, len(raw))
+	keys := make(map[uint64]string, len(raw))
+	for i, r := range raw {
+		m, ok := r.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("automation %d: expected a mapping, got %T", i, r)
+		}
+		if _, ok := m["active"]; !ok {
+			m["active"] = true
+		}
+		key := fmt.Sprintf("%s#%d", name, i)
+		if id, ok := m["id"]; ok {
+			key = fmt.Sprintf("%s#id=%v", name, id)
+			delete(m, "id")
+		}
+
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("automation %d: %w", i, err)
+		}
+		var a Automation
+		if err := json.Unmarshal(b, &a); err != nil {
+			return nil, fmt.Errorf("automation %d: %w", i, err)
+		}
+		a.Id = FileAutomationID(key)
+		if other, ok := keys[a.Id]; ok {
+			return nil, fmt.Errorf("automation %d: id of %s collides with %s, use another id", i, key, other)
+		}
+		keys[a.Id] = key
+		automations = append(automations, a)
+	}
+	return automations, nil
+}
+
+// FileAutomationID derives the ID of an automation from a file from its key, the file name and its id or
+// position in the file.
+func FileAutomationID(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return fileIDBase + h.Sum64()%(fileIDLimit-fileIDBase)
+}
+
+// LoadDir loads the automations of all .yaml and .yml files in dir, in the order of their names.
+// Files that fail to parse are skipped and reported in the returned error, the automations of the
+// other files are still returned.
+func LoadDir(dir string) ([]Automation, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read automations directory: %w", err)
+	}
+
+	var automations []Automation
+	var errs []error
+	files := make(map[uint64]string) // automation ID -> file
+	for _, entry := range entries {
+		if entry.IsDir() || !IsYAMLFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		parsed, err := ParseYAML(entry.Name(), data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		if err := checkFileIDs(files, path, parsed); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		for i := range parsed {
+			parsed[i].File = path
+		}
+		automations = append(automations, parsed...)
+	}
+	return automations, errors.Join(errs...)
+}
+
+// checkFileIDs fails if an automation of the file has the ID of an automation of another file, otherwise it adds
+// the IDs to files.
+func checkFileIDs(files map[uint64]string, path string, automations []Automation) error {
+	for _, a := range automations {
+		if other, ok := files[a.Id]; ok {
+			return fmt.Errorf("id of automation %q collides with an automation of %s, use another id", a.Alias, other)
+		}
+	}
+	for _, a := range automations {
+		files[a.Id] = path
+	}
+	return nil
+}
+
+func IsYAMLFile(name string) bool {
+	return slices.Contains([]string{".yaml", ".yml"}, strings.ToLower(filepath.Ext(name)))
+}
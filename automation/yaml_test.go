@@ -0,0 +1,45 @@
+package automation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLIDs(t *testing.T) {
+	data := []byte(`
+- alias: first
+  id: morning
+- alias: second
+`)
+	automations, err := ParseYAML("lights.yaml", data)
+	if err != nil {
+		t.Fatalf("ParseYAML: %v", err)
+	}
+	if len(automations) != 2 {
+		t.Fatalf("got %d automations, want 2", len(automations))
+	}
+	for _, a := range automations {
+		if a.Id < fileIDBase || a.Id >= fileIDLimit {
+			t.Errorf("id of %s = %d, want in [%d, %d)", a.Alias, a.Id, fileIDBase, fileIDLimit)
+		}
+	}
+	if want := FileAutomationID("lights.yaml#id=morning"); automations[0].Id != want {
+		t.Errorf("id of first = %d, want %d", automations[0].Id, want)
+	}
+	if automations[0].Id == automations[1].Id {
+		t.Error("automations have the same id")
+	}
+}
+
+func TestParseYAMLDuplicateIDs(t *testing.T) {
+	data := []byte(`
+- alias: first
+  id: morning
+- alias: second
+  id: morning
+`)
+	_, err := ParseYAML("lights.yaml", data)
+	if err == nil || !strings.Contains(err.Error(), "collides") {
+		t.Errorf("ParseYAML error = %v, want a collision", err)
+	}
+}
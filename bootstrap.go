@@ -9,11 +9,15 @@ import (
 	"home_automation_server/engine"
 	"home_automation_server/integrations/bangandolufsen"
 	"home_automation_server/integrations/halo"
+	"home_automation_server/integrations/helpers"
 	"home_automation_server/integrations/hue"
+	"home_automation_server/sun"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 )
 
 func setupContext() (context.Context, context.CancelFunc) {
@@ -40,6 +44,66 @@ func setupEngine(ctx context.Context, logger *zap.Logger, nWorkers int) (*engine
 	return e, nil
 }
 
+// setupHome configures the home location from HOME_TIMEZONE, HOME_LATITUDE and HOME_LONGITUDE.
+// Without coordinates sun triggers and conditions are unavailable.
+func setupHome(e *engine.Engine) error {
+	home := engine.Home{TimeZone: time.Local}
+
+	if tz := os.Getenv("HOME_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return fmt.Errorf("invalid HOME_TIMEZONE: %w", err)
+		}
+		home.TimeZone = loc
+	}
+
+	latStr, lonStr := os.Getenv("HOME_LATITUDE"), os.Getenv("HOME_LONGITUDE")
+	if latStr != "" || lonStr != "" {
+		lat, err := strconv.ParseFloat(latStr, 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return fmt.Errorf("invalid HOME_LATITUDE: %q", latStr)
+		}
+		lon, err := strconv.ParseFloat(lonStr, 64)
+		if err != nil || lon < -180 || lon > 180 {
+			return fmt.Errorf("invalid HOME_LONGITUDE: %q", lonStr)
+		}
+		home.Location = &sun.Location{Latitude: lat, Longitude: lon}
+	} else {
+		e.Logger.Warn("HOME_LATITUDE and HOME_LONGITUDE not set, sun triggers and conditions are unavailable")
+	}
+
+	e.SetHome(home)
+	return nil
+}
+
+// setupLoopBreaker reads AUTOMATION_LOOP_LIMIT, the number of times an automation may trigger itself in a row
+// before it is disabled. 0 turns the loop breaker off.
+func setupLoopBreaker(e *engine.Engine) error {
+	limitStr := os.Getenv("AUTOMATION_LOOP_LIMIT")
+	if limitStr == "" {
+		return nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid AUTOMATION_LOOP_LIMIT: %q", limitStr)
+	}
+	e.LoopLimit = limit
+	if limit == 0 {
+		e.Logger.Warn("AUTOMATION_LOOP_LIMIT is 0, automation loops are not detected")
+	}
+	return nil
+}
+
+// setupAutomationsDir loads the YAML automations in AUTOMATIONS_DIR, if set, and watches them for changes.
+func setupAutomationsDir(ctx context.Context, e *engine.Engine) {
+	dir := os.Getenv("AUTOMATIONS_DIR")
+	if dir == "" {
+		return
+	}
+	e.LoadAutomationsDir(dir)
+	go e.WatchAutomationsDir(ctx)
+}
+
 func setupLogger() *zap.Logger {
 	//mongoURI := os.Getenv("MONGO_URI")
 	//if mongoURI == "" {
@@ -67,11 +131,17 @@ func registerIntegrationDescriptors(e *engine.Engine) {
 	reg.Register(hue.Descriptor())
 	reg.Register(halo.Descriptor())
 	reg.Register(bangandolufsen.Descriptor())
+	reg.Register(helpers.Descriptor(helpers.New(e.HelperStore, e.Logger)))
 
 	e.Logger.Info("Integration descriptors registered successfully", zap.Int("num_descriptors", len(reg.List())))
 }
 
 func LoadIntegrations(ctx context.Context, e *engine.Engine) error {
+	// helpers are built in, they are always loaded
+	if err := e.EnableIntegration(ctx, helpers.Name); err != nil {
+		return fmt.Errorf("unable to enable helpers: %w", err)
+	}
+
 	integrationCfgs, err := e.IntegrationCfgStore.LoadAll(ctx)
 	if err != nil {
 		return fmt.Errorf("unable to load integration configurations: %w", err)
@@ -84,6 +154,12 @@ func LoadIntegrations(ctx context.Context, e *engine.Engine) error {
 	}
 
 	e.Logger.Info("Successfully loaded integration", zap.Int("num_active_integrations", len(integrationCfgs)))
+
+	// register the helper entities, then publish their states
+	if err := e.DiscoverDevicesForIntegration(ctx, helpers.Name); err != nil {
+		return fmt.Errorf("unable to start helpers: %w", err)
+	}
+	e.PublishStates(helpers.Name)
 	return nil
 }
 
@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/storage/models"
+	"home_automation_server/types"
+	"home_automation_server/utils"
+	"slices"
+	"strings"
+)
+
+var ErrAreaNotFound = errors.New("area not found")
+
+// AreaSummary summarizes the states of the entities in an area.
+type AreaSummary struct {
+	Area    models.Area                          `json:"area"`
+	ByType  map[types.EntityType]AreaTypeSummary `json:"by_type"`
+	States  []types.State                        `json:"states"`
+	Devices []string                             `json:"devices"`
+}
+
+// AreaTypeSummary counts the entities of a type in an area.
+type AreaTypeSummary struct {
+	Total       int `json:"total"`
+	On          int `json:"on"` // entities whose state is "on"
+	Unavailable int `json:"unavailable"`
+}
+
+// CreateArea validates and stores a new area. Without an ID, the ID is derived from the name, e.g.
+// "living_room" for "Living Room".
+func (e *Engine) CreateArea(ctx context.Context, a models.Area) (*models.Area, error) {
+	a.Name = strings.TrimSpace(a.Name)
+	if a.ID == "" {
+		a.ID = utils.NormalizeString(a.Name)
+	}
+
+	v := &automation.Validator{}
+	validateArea(v, &a)
+	if _, err := e.AreaStore.GetArea(ctx, a.ID); err == nil {
+		v.Add("id", "an area with id %q already exists", a.ID)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to query area: %w", err)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := e.AreaStore.CreateArea(ctx, &a); err != nil {
+		return nil, fmt.Errorf("failed to store area: %w", err)
+	}
+	e.Logger.Info("created area", zap.String("area_id", a.ID), zap.String("area", a.Name))
+	return &a, nil
+}
+
+// UpdateArea renames an area. The ID is kept, targets and assignments refer to it.
+func (e *Engine) UpdateArea(ctx context.Context, a models.Area) (*models.Area, error) {
+	a.Name = strings.TrimSpace(a.Name)
+	v := &automation.Validator{}
+	validateArea(v, &a)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := e.AreaStore.UpdateArea(ctx, &a); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAreaNotFound
+		}
+		return nil, fmt.Errorf("failed to store area: %w", err)
+	}
+	e.Logger.Info("updated area", zap.String("area_id", a.ID), zap.String("area", a.Name))
+	return e.getArea(ctx, a.ID)
+}
+
+// DeleteArea removes an area and unassigns its devices and entities.
+func (e *Engine) DeleteArea(ctx context.Context, id string) error {
+	if err := e.AreaStore.DeleteArea(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAreaNotFound
+		}
+		return fmt.Errorf("failed to delete area: %w", err)
+	}
+	e.Logger.Info("deleted area", zap.String("area_id", id))
+	e.refreshTargetIndex(ctx)
+	return nil
+}
+
+func validateArea(v *automation.Validator, a *models.Area) {
+	if a.Name == "" {
+		v.Add("name", "name is required")
+	}
+	if a.ID == "" || a.ID != utils.NormalizeString(a.ID) {
+		v.Add("id", "id %q must be lower case letters, digits and underscores", a.ID)
+	}
+}
+
+// AssignArea moves devices and entities, given by entity ID, to the area. An empty areaID unassigns them;
+// unassigned entities are in the area of their device.
+func (e *Engine) AssignArea(ctx context.Context, areaID string, deviceIDs, entityIDs []string) error {
+	if areaID != "" {
+		if _, err := e.getArea(ctx, areaID); err != nil {
+			return err
+		}
+	}
+
+	v := &automation.Validator{}
+	for i, id := range deviceIDs {
+		if _, err := e.DeviceStore.GetDeviceByID(ctx, id); err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("failed to query device: %w", err)
+			}
+			v.Add(fmt.Sprintf("devices/%d", i), "unknown device %q", id)
+		}
+	}
+	for i, id := range entityIDs {
+		if _, ok := e.EntityRegistry.Owner(id); !ok {
+			v.Add(fmt.Sprintf("entities/%d", i), "unknown entity %q", id)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	if err := e.AreaStore.AssignDevices(ctx, areaID, deviceIDs); err != nil {
+		return fmt.Errorf("failed to assign devices: %w", err)
+	}
+	if err := e.AreaStore.AssignEntities(ctx, areaID, entityIDs); err != nil {
+		return fmt.Errorf("failed to assign entities: %w", err)
+	}
+	e.Logger.Info("assigned area", zap.String("area_id", areaID), zap.Strings("devices", deviceIDs), zap.Strings("entities", entityIDs))
+	e.refreshTargetIndex(ctx)
+	return nil
+}
+
+// ensureArea returns the ID of the area with the name, creating it if it does not exist. Integrations suggest
+// areas by name during discovery, e.g. the rooms of a Hue bridge.
+func (e *Engine) ensureArea(ctx context.Context, name string) (string, error) {
+	id := utils.NormalizeString(name)
+	if id == "" {
+		return "", fmt.Errorf("invalid area name %q", name)
+	}
+	if _, err := e.AreaStore.GetArea(ctx, id); err == nil {
+		return id, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fmt.Errorf("failed to query area: %w", err)
+	}
+
+	a := models.Area{ID: id, Name: strings.TrimSpace(name)}
+	if err := e.AreaStore.CreateArea(ctx, &a); err != nil {
+		return "", fmt.Errorf("failed to store area: %w", err)
+	}
+	e.Logger.Info("imported area", zap.String("area_id", a.ID), zap.String("area", a.Name))
+	return id, nil
+}
+
+func (e *Engine) getArea(ctx context.Context, id string) (*models.Area, error) {
+	a, err := e.AreaStore.GetArea(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAreaNotFound
+		}
+		return nil, fmt.Errorf("failed to query area: %w", err)
+	}
+	return a, nil
+}
+
+// AreaSummary returns the devices of an area and the states of its enabled entities, with counts per entity
+// type. Entities are in the area they are assigned to, or else in the area of their device.
+func (e *Engine) AreaSummary(ctx context.Context, id string) (*AreaSummary, error) {
+	a, err := e.getArea(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &AreaSummary{
+		Area:    *a,
+		ByType:  make(map[types.EntityType]AreaTypeSummary),
+		States:  []types.State{},
+		Devices: []string{},
+	}
+	summary.Devices = append(summary.Devices, e.targets.devicesIn(id)...)
+	slices.Sort(summary.Devices)
+	for _, ent := range e.targets.match(automation.Target{AreaID: id}) {
+		if !ent.Enabled {
+			continue
+		}
+		typ := types.EntityType(ent.Type)
+		counts := summary.ByType[typ]
+		counts.Total++
+		if !ent.Available {
+			counts.Unavailable++
+		}
+		if state, ok := e.StateCache.Get(ent.EntityID); ok {
+			if state.State == "on" {
+				counts.On++
+			}
+			summary.States = append(summary.States, state)
+		}
+		summary.ByType[typ] = counts
+	}
+	return summary, nil
+}
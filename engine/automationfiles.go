@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"path/filepath"
+	"time"
+)
+
+// automationFilesDebounce groups the burst of events editors produce when saving a file into one reload.
+const automationFilesDebounce = 500 * time.Millisecond
+
+// LoadAutomationsDir loads the automations of the YAML files in dir next to the automations from the database.
+// They are reloaded by WatchAutomationsDir when the files change.
+func (e *Engine) LoadAutomationsDir(dir string) {
+	e.automationsMu.Lock()
+	e.automationsDir = dir
+	e.automationsMu.Unlock()
+	e.ReloadAutomationFiles()
+}
+
+// ReloadAutomationFiles reads the YAML files again and replaces the file automations. Files that fail to
+// parse are logged and skipped, validation issues are reported like for any other automation.
+func (e *Engine) ReloadAutomationFiles() {
+	e.automationsMu.Lock()
+	defer e.automationsMu.Unlock()
+	if e.automationsDir == "" {
+		return
+	}
+
+	files, err := automation.LoadDir(e.automationsDir)
+	if err != nil {
+		e.Logger.Error("failed to load automation files", zap.String("dir", e.automationsDir), zap.Error(err))
+	}
+	e.fileAutomations = files
+
+	e.swapAutomations(func(automations []automation.Automation) []automation.Automation {
+		stored := automations[:0]
+		for _, a := range automations {
+			if a.File == "" {
+				stored = append(stored, a)
+			}
+		}
+		return e.mergeFileAutomations(stored)
+	})
+	e.Logger.Info("loaded automation files", zap.String("dir", e.automationsDir), zap.Int("num_automations", len(files)))
+}
+
+// mergeFileAutomations appends the file automations to the stored ones. File automations whose ID is already
+// taken, e.g. by a second automation with the same alias, are skipped. Must be called with automationsMu held.
+func (e *Engine) mergeFileAutomations(stored []automation.Automation) []automation.Automation {
+	merged := make([]automation.Automation, 0, len(stored)+len(e.fileAutomations))
+	merged = append(merged, stored...)
+	ids := make(map[uint64]string, len(merged))
+	for _, a := range merged {
+		ids[a.Id] = a.Alias
+	}
+	for _, a := range e.fileAutomations {
+		if alias, ok := ids[a.Id]; ok {
+			e.Logger.Error("skipped automation from file, its id is already in use", zap.String("file", a.File), zap.String("automation", a.Alias), zap.Uint64("automation_id", a.Id), zap.String("used_by", alias))
+			continue
+		}
+		ids[a.Id] = a.Alias
+		merged = append(merged, a)
+	}
+	return merged
+}
+
+// WatchAutomationsDir reloads the file automations when a YAML file in the automations directory is
+// created, changed or removed. It blocks until ctx is cancelled.
+func (e *Engine) WatchAutomationsDir(ctx context.Context) {
+	e.automationsMu.Lock()
+	dir := e.automationsDir
+	e.automationsMu.Unlock()
+	if dir == "" {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		e.Logger.Error("failed to create fs watcher", zap.Error(err))
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(dir); err != nil {
+		e.Logger.Error("failed to add automations directory to watcher", zap.String("dir", dir), zap.Error(err))
+		return
+	}
+
+	reload := time.NewTimer(automationFilesDebounce)
+	reload.Stop()
+	defer reload.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !automation.IsYAMLFile(evt.Name) || evt.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			e.Logger.Debug("automation file changed", zap.String("file", filepath.Base(evt.Name)), zap.String("op", evt.Op.String()))
+			reload.Reset(automationFilesDebounce)
+		case <-reload.C:
+			e.Logger.Info("automation files changed, reloading", zap.String("dir", dir))
+			e.ReloadAutomationFiles()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			e.Logger.Warn("automations watcher error", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/storage"
+	"home_automation_server/storage/models"
+)
+
+var (
+	ErrAutomationNotFound = errors.New("automation not found")
+	ErrAutomationReadOnly = errors.New("automation is defined in a file and cannot be changed through the API")
+)
+
+// CreateAutomation validates and stores a new automation and adds it to the running automations.
+func (e *Engine) CreateAutomation(ctx context.Context, a automation.Automation) (*models.Automation, error) {
+	e.automationsMu.Lock()
+	defer e.automationsMu.Unlock()
+
+	a.Id = 0
+	if err := e.validateAutomation(&a); err != nil {
+		return nil, err
+	}
+
+	m, err := storage.AutomationToStorage(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.AutomationStore.CreateAutomation(ctx, &m); err != nil {
+		return nil, fmt.Errorf("failed to store automation: %w", err)
+	}
+	a.Id = m.ID
+
+	e.swapAutomations(func(automations []automation.Automation) []automation.Automation {
+		return append(automations, a)
+	})
+	e.Logger.Info("created automation", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias))
+	return &m, nil
+}
+
+// UpdateAutomation validates and stores the new definition of an automation and replaces it in the running
+// automations. Runs of the previous definition are cancelled.
+func (e *Engine) UpdateAutomation(ctx context.Context, a automation.Automation) (*models.Automation, error) {
+	e.automationsMu.Lock()
+	defer e.automationsMu.Unlock()
+
+	if err := e.checkWritable(a.Id); err != nil {
+		return nil, err
+	}
+	if err := e.validateAutomation(&a); err != nil {
+		return nil, err
+	}
+
+	m, err := storage.AutomationToStorage(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.AutomationStore.UpdateAutomation(ctx, &m); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAutomationNotFound
+		}
+		return nil, fmt.Errorf("failed to store automation: %w", err)
+	}
+
+	e.swapAutomations(func(automations []automation.Automation) []automation.Automation {
+		for i := range automations {
+			if automations[i].Id == a.Id {
+				automations[i] = a
+				return automations
+			}
+		}
+		return append(automations, a)
+	})
+	e.Logger.Info("updated automation", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias))
+
+	updated, err := e.AutomationStore.GetAutomation(ctx, a.Id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch updated automation: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteAutomation removes an automation with its traces and cancels its runs.
+func (e *Engine) DeleteAutomation(ctx context.Context, id uint64) error {
+	e.automationsMu.Lock()
+	defer e.automationsMu.Unlock()
+
+	if err := e.checkWritable(id); err != nil {
+		return err
+	}
+	if err := e.AutomationStore.DeleteAutomation(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAutomationNotFound
+		}
+		return fmt.Errorf("failed to delete automation: %w", err)
+	}
+
+	e.swapAutomations(func(automations []automation.Automation) []automation.Automation {
+		kept := automations[:0]
+		for _, a := range automations {
+			if a.Id != id {
+				kept = append(kept, a)
+			}
+		}
+		return kept
+	})
+
+	if err := e.TraceStore.DeleteTraces(ctx, id); err != nil {
+		e.Logger.Error("failed to delete traces", zap.Error(err), zap.Uint64("automation_id", id))
+	}
+	e.Logger.Info("deleted automation", zap.Uint64("automation_id", id))
+	return nil
+}
+
+// disableRunawayAutomation disables an automation the loop breaker caught triggering itself, which also cancels
+// its runs. Stored automations stay disabled until they are enabled again, file automations until their file
+// is reloaded.
+func (e *Engine) disableRunawayAutomation(ctx context.Context, a *automation.Automation, reason error) {
+	e.automationsMu.Lock()
+	defer e.automationsMu.Unlock()
+
+	e.Logger.Error("disabling automation", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias), zap.Error(reason))
+	if a.File == "" {
+		if err := e.AutomationStore.UpdateEnabled(ctx, a.Id, false); err != nil {
+			e.Logger.Error("failed to store disabled automation", zap.Uint64("automation_id", a.Id), zap.Error(err))
+		}
+	}
+	e.swapAutomations(func(automations []automation.Automation) []automation.Automation {
+		for i := range automations {
+			if automations[i].Id == a.Id {
+				automations[i].Enabled = false
+			}
+		}
+		return automations
+	})
+}
+
+// checkWritable returns ErrAutomationReadOnly for automations loaded from a YAML file.
+func (e *Engine) checkWritable(id uint64) error {
+	if a, ok := e.automationByID(id); ok && a.File != "" {
+		return fmt.Errorf("%w: %s", ErrAutomationReadOnly, a.File)
+	}
+	return nil
+}
+
+// validateAutomation checks an automation before it is stored. Aliases must be unique.
+func (e *Engine) validateAutomation(a *automation.Automation) error {
+	v := &automation.Validator{}
+	e.validateAutomationInto(v, a)
+	for _, other := range e.Automations().Automations {
+		if other.Id != a.Id && other.Alias == a.Alias {
+			v.Add("alias", "an automation with alias %q already exists", a.Alias)
+		}
+	}
+	return v.Err()
+}
+
+// swapAutomations replaces the running automations with the result of modify, which receives a copy of the
+// current automations. Must be called with automationsMu held.
+func (e *Engine) swapAutomations(modify func([]automation.Automation) []automation.Automation) {
+	current := e.Automations().Automations
+	automations := make([]automation.Automation, len(current))
+	copy(automations, current)
+	e.setAutomations(&automation.AutomationSet{Automations: modify(automations)})
+}
+
+// setAutomations validates and atomically replaces the running automations and cleans up the runs, pending
+// triggers and trigger memory of automations that changed. Must be called with automationsMu held.
+func (e *Engine) setAutomations(set *automation.AutomationSet) {
+	set.Issues = e.automationIssues(set)
+	e.automations.Store(set)
+	e.cancelOutdatedRuns(set)
+
+	valid := triggerKeys(set)
+	e.prunePendingTriggers(valid)
+	e.triggerMemory.prune(valid)
+}
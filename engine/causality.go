@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"home_automation_server/automation"
+	"home_automation_server/types"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLoopLimit is how often an automation may appear in the causal chain of the event that triggers it
+	// before the loop breaker disables it.
+	DefaultLoopLimit = 5
+
+	// causalityTTL is how long the links between contexts are kept. Chains are only followed through links
+	// that have not expired, so loops slower than this are not detected.
+	causalityTTL = 5 * time.Minute
+
+	// callAttributionWindow is how long after a service call a state change of one of its targets is
+	// attributed to the call. Integrations report state changes asynchronously, e.g. through an event stream.
+	callAttributionWindow = 5 * time.Second
+
+	// maxChainLength bounds the walk up a causal chain.
+	maxChainLength = 100
+)
+
+// ContextLink records what caused a context: its parent, and the automation run, script run or service call
+// it belongs to. Links without any of them belong to events.
+type ContextLink struct {
+	ContextID    string `json:"context_id"`
+	ParentID     string `json:"parent_id,omitempty"`
+	AutomationID uint64 `json:"automation_id,omitempty"`
+	ScriptID     uint   `json:"script_id,omitempty"`
+	Service      string `json:"service,omitempty"`
+
+	expires time.Time
+}
+
+type callerContextKey struct{}
+
+// withCallerContext returns a copy of ctx that carries the context of an automation or script run, or of a
+// service call, so the service calls made within can be attributed to it.
+func withCallerContext(ctx context.Context, c *types.Context) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, c)
+}
+
+// callerContext returns the context of the run or service call ctx belongs to, nil if there is none, e.g. for
+// calls from the API.
+func callerContext(ctx context.Context) *types.Context {
+	c, _ := ctx.Value(callerContextKey{}).(*types.Context)
+	return c
+}
+
+type pendingCall struct {
+	contextID string
+	expires   time.Time
+}
+
+// causality links events to the runs and service calls that caused them. A run's context has the context of its
+// triggering event as parent, a service call has the run that made it as parent, and a state change of an
+// entity targeted by a service call gets the call's context as parent. Following the parents of an event gives
+// the chain of events, calls and runs that led to it.
+type causality struct {
+	mu        sync.Mutex
+	links     map[string]ContextLink // by context ID
+	calls     map[string]pendingCall // the last service call targeting an entity, by entity ID
+	lastPrune time.Time
+}
+
+func newCausality() *causality {
+	return &causality{
+		links: make(map[string]ContextLink),
+		calls: make(map[string]pendingCall),
+	}
+}
+
+// link records the parent and run of a context.
+func (c *causality) link(l ContextLink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	l.expires = now.Add(causalityTTL)
+	c.links[l.ContextID] = l
+	c.prune(now)
+}
+
+// recordCall remembers that the service call with the given context targeted the entities.
+func (c *causality) recordCall(contextID string, entityIDs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, entityID := range entityIDs {
+		c.calls[entityID] = pendingCall{contextID: contextID, expires: now.Add(callAttributionWindow)}
+	}
+	c.prune(now)
+}
+
+// attribute sets the parent of a state_changed event to the service call that recently targeted the entity,
+// unless the integration already set a parent. Events with a parent are linked to it, unless the context is
+// already known, e.g. for call_service events that share the context of the call.
+func (c *causality) attribute(event *types.Event) {
+	if event.Context == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+
+	if data, ok := event.Data.(types.StateChangedData); ok && event.Context.ParentID == "" {
+		if call, ok := c.calls[data.EntityID]; ok && now.Before(call.expires) {
+			event.Context.ParentID = call.contextID
+			if data.NewState != nil && data.NewState.Context != nil {
+				data.NewState.Context.ParentID = call.contextID
+			}
+		}
+	}
+	if _, known := c.links[event.Context.ID]; !known && event.Context.ParentID != "" {
+		c.links[event.Context.ID] = ContextLink{ContextID: event.Context.ID, ParentID: event.Context.ParentID, expires: now.Add(causalityTTL)}
+	}
+}
+
+// chain returns the links from the context up to the first context without a known parent.
+func (c *causality) chain(contextID string) []ContextLink {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+
+	var chain []ContextLink
+	for id := contextID; id != "" && len(chain) < maxChainLength; {
+		l, ok := c.links[id]
+		if !ok || now.After(l.expires) {
+			break
+		}
+		chain = append(chain, l)
+		id = l.ParentID
+	}
+	return chain
+}
+
+// runs returns how many runs of the automation are in the causal chain of the context.
+func (c *causality) runs(contextID string, automationID uint64) int {
+	n := 0
+	for _, l := range c.chain(contextID) {
+		if l.AutomationID == automationID {
+			n++
+		}
+	}
+	return n
+}
+
+// prune removes expired links and calls, at most once per attribution window. Must be called with mu held.
+func (c *causality) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < callAttributionWindow {
+		return
+	}
+	c.lastPrune = now
+	for id, l := range c.links {
+		if now.After(l.expires) {
+			delete(c.links, id)
+		}
+	}
+	for entityID, call := range c.calls {
+		if now.After(call.expires) {
+			delete(c.calls, entityID)
+		}
+	}
+}
+
+// ContextChain returns the causal chain of a context, starting with the context itself: the events, service
+// calls and automation or script runs that led to it, as far as they are still known.
+func (e *Engine) ContextChain(contextID string) []ContextLink {
+	return e.causality.chain(contextID)
+}
+
+// checkLoop returns an error if the automation already ran LoopLimit times in the causal chain of the event,
+// i.e. it keeps triggering itself, directly or through other automations and scripts.
+func (e *Engine) checkLoop(a *automation.Automation, event *types.Event) error {
+	if e.LoopLimit <= 0 || event.Context == nil {
+		return nil
+	}
+	if n := e.causality.runs(event.Context.ID, a.Id); n >= e.LoopLimit {
+		return fmt.Errorf("automation loop detected: triggered by its own actions %d times in a row", n)
+	}
+	return nil
+}
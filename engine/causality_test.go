@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/types"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newEchoService registers test.echo, which answers each call with a "test_ping" event caused by the call,
+// like an integration reporting the state change a call made.
+func newEchoService(e *testEngine) chan types.Event {
+	echoes := make(chan types.Event, 32)
+	e.RegisterService("test", "echo", integrations.ServiceSpec{
+		Handler: func(ctx context.Context, action *automation.Action) error {
+			echoes <- types.Event{
+				Type:      "test_ping",
+				Context:   &types.Context{ID: uuid.NewString(), ParentID: callerContext(ctx).ID},
+				TimeFired: time.Now(),
+			}
+			return nil
+		},
+	})
+	return echoes
+}
+
+const pingAutomation = `{
+	"alias": "ping", "active": true,
+	"trigger": [{"type": "event", "data": {"event_type": "test_ping"}}],
+	"action": [{"service": "test.echo", "blocking": true}]
+}`
+
+// runEchoes processes the echoes of the automation until none arrive, and returns how many runs it took. It
+// gives up after 100 runs.
+func runEchoes(e *testEngine, echoes chan types.Event) int {
+	runs := 0
+	for runs < 100 {
+		select {
+		case event := <-echoes:
+			runs++
+			e.processEvent(context.Background(), event)
+		case <-time.After(quietPeriod):
+			return runs
+		}
+	}
+	return runs
+}
+
+func TestLoopBreaker(t *testing.T) {
+	t.Run("disables an automation that triggers itself", func(t *testing.T) {
+		e := newTestEngine(t)
+		echoes := newEchoService(e)
+		id := e.createAutomation(t, pingAutomation)
+
+		e.fire("test_ping")
+		if runs := runEchoes(e, echoes); runs != e.LoopLimit {
+			t.Errorf("automation ran %d times, want %d", runs, e.LoopLimit)
+		}
+
+		if a, _ := e.automationByID(id); a.Enabled {
+			t.Error("automation is still enabled")
+		}
+		if stored, _ := e.store.GetAutomation(context.Background(), id); stored.Enabled {
+			t.Error("automation is still enabled in the store")
+		}
+		results := e.traceResults(t, id, e.LoopLimit+1)
+		if want := "failed"; !slices.Contains(results, want) {
+			t.Errorf("traces = %v, want a %q trace", results, want)
+		}
+	})
+
+	t.Run("independent events are no loop", func(t *testing.T) {
+		e := newTestEngine(t)
+		echoes := newEchoService(e)
+		id := e.createAutomation(t, pingAutomation)
+
+		for range 2 * e.LoopLimit {
+			e.fire("test_ping")
+			select {
+			case <-echoes:
+			case <-time.After(waitTimeout):
+				t.Fatal("automation did not run")
+			}
+		}
+		if a, _ := e.automationByID(id); !a.Enabled {
+			t.Error("automation was disabled")
+		}
+	})
+
+	t.Run("disabled with a loop limit of 0", func(t *testing.T) {
+		e := newTestEngine(t)
+		e.LoopLimit = 0
+		echoes := newEchoService(e)
+		id := e.createAutomation(t, pingAutomation)
+
+		e.fire("test_ping")
+		if runs := runEchoes(e, echoes); runs <= DefaultLoopLimit {
+			t.Errorf("automation ran %d times, want it to keep running", runs)
+		}
+		if a, _ := e.automationByID(id); !a.Enabled {
+			t.Error("automation was disabled")
+		}
+	})
+}
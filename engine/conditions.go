@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/templating"
+)
+
+// newEnv builds the evaluation environment for triggers and conditions from the current engine state.
+func (e *Engine) newEnv() *automation.Env {
+	env := &automation.Env{
+		States: e.StateCache,
+		Now:    e.now(),
+		Sun:    e.Home.Location,
+		Memory: e.triggerMemory,
+	}
+	env.Render = func(tmpl string) (any, error) {
+		return templating.Render(tmpl, &templating.Env{States: env.States, Now: env.Now, Vars: env.Vars})
+	}
+	return env
+}
+
+// newRunEnv builds the evaluation environment for conditions and templates inside a running sequence.
+func (e *Engine) newRunEnv(vars map[string]any) *automation.Env {
+	env := e.newEnv()
+	env.Vars = vars
+	return env
+}
+
+// conditionsPass evaluates the conditions of an automation after one of its triggers fired and records
+// each result in the trace. Evaluation stops at the first condition that fails. Errors are logged and treated
+// as a failed condition.
+func (e *Engine) conditionsPass(a *automation.Automation, env *automation.Env, trace *automation.Trace) bool {
+	for i, baseCondition := range a.Condition {
+		passed, err := evaluateCondition(baseCondition, env)
+		trace.AddCondition(i, baseCondition.Type, passed, err)
+		if err != nil {
+			e.Logger.Error("condition evaluation failed", zap.Error(err), zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias), zap.Int("condition", i))
+			return false
+		}
+		if !passed {
+			e.Logger.Info("automation conditions not met", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias), zap.Int("condition", i))
+			return false
+		}
+	}
+
+	if len(a.Condition) > 0 {
+		e.Logger.Debug("automation conditions passed", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias))
+	}
+	return true
+}
+
+func evaluateCondition(baseCondition automation.BaseCondition, env *automation.Env) (bool, error) {
+	condition, err := baseCondition.AsCondition()
+	if err != nil {
+		return false, err
+	}
+	return condition.Evaluate(env)
+}
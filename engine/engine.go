@@ -12,14 +12,25 @@ import (
 	"home_automation_server/storage/models"
 	"home_automation_server/types"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Engine struct {
-	Automations             *automation.AutomationSet
-	Integrations            map[string]integration.Instance      // Enabled integration
+	automations             atomic.Pointer[automation.AutomationSet]
+	automationsMu           sync.Mutex                 // serializes changes to the automations
+	automationsDir          string                     // directory of YAML automations, optional
+	fileAutomations         []automation.Automation    // automations loaded from automationsDir
+	scripts                 map[uint]automation.Script // callable as script.<name> services
+	scriptsMu               sync.RWMutex
+	scenes                  map[uint]automation.Scene   // stored scenes, applied as scene.<name> services
+	sceneSnapshots          map[string]automation.Scene // scenes captured by scene.snapshot, by name
+	scenesMu                sync.RWMutex
+	Integrations            map[string]integration.Instance // Enabled integration, guarded by integrationsMu
+	integrationsMu          sync.RWMutex
 	IntegrationDescRegistry *integration.IntegrationDescRegistry // Holds descriptors for all available integration
 	ServiceRegistry         *ServiceRegistry
+	Home                    Home
 
 	// storage
 	EventStore          storage.EventStore
@@ -27,21 +38,39 @@ type Engine struct {
 	IntegrationCfgStore storage.IntegrationCfgStore
 	DeviceStore         storage.DeviceStore
 	EntityStore         storage.EntityStore
+	TraceStore          storage.TraceStore
+	ScriptStore         storage.ScriptStore
+	SceneStore          storage.SceneStore
+	AreaStore           storage.AreaStore
+	HelperStore         storage.HelperStore
 
 	// cache
 	StateCache     types.StateStore
-	EntityRegistry types.EntityRegistry // in-memory cache of the entityes
+	disabledStates *disabledStates // last states of disabled entities, restored when they are enabled
+	EntityRegistry *EntityRegistry // in-memory cache of the entityes
+	targets        *targetIndex    // entities by device, area, type and label, for resolving targets
 
 	// Event Transport
 	EventChannel      chan types.Event
 	ProcessedEventBus *EventBus // For publishing events after they have been processed.
+	timeEvents        *EventBus // time_changed events, which are not broadcast, for the time based triggers of waits
+	Scheduler         *Scheduler
 
 	// Execute actions
 	AutomationTaskQueue chan *AutomationTask
+	runs                *runTracker
+	scriptRuns          *scriptRunTracker
+	pendingTriggers     *pendingTriggers
+	triggerMemory       *triggerMemory
+	causality           *causality
+	LoopLimit           int // runs of an automation allowed in the causal chain of its trigger, 0 disables the loop breaker
 	ActionTimeout       time.Duration
 	RetryPolicy         RetryPolicy
+	MaxTraces           int // traces kept per automation, 0 disables tracing
+	traces              *traceWriter
 	wg                  sync.WaitGroup
-	nWorkers            int
+	nWorkers            int      // runs that execute at the same time
+	runSlots            runSlots // bounds the runs to nWorkers
 
 	Logger *zap.Logger
 }
@@ -52,6 +81,9 @@ type RetryPolicy struct {
 }
 
 func New(ctx context.Context, db *gorm.DB, logger *zap.Logger, nWorkers int) (*Engine, error) {
+	if err := storage.MigrateEntityKeys(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate db: %w", err)
+	}
 	err := db.AutoMigrate(
 		&models.IntegrationConfig{},
 		&models.Device{},
@@ -59,70 +91,123 @@ func New(ctx context.Context, db *gorm.DB, logger *zap.Logger, nWorkers int) (*E
 		&models.Automation{},
 		&models.Context{},
 		&models.Event{},
+		&models.AutomationTrace{},
+		&models.Script{},
+		&models.Scene{},
+		&models.Area{},
+		&models.Helper{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to auto migrate db: %w", err)
 	}
 
+	e := newEngine(logger, nWorkers)
+	e.EventStore = storage.NewGormEventStore(db)
+	e.AutomationStore = storage.NewGormRuleStore(db)
+	e.IntegrationCfgStore = storage.NewGormIntegrationCfgStore(db)
+	e.DeviceStore = storage.NewGormDeviceStore(db)
+	e.EntityStore = storage.NewGormEntityStore(db)
+	e.TraceStore = storage.NewGormTraceStore(db)
+	e.ScriptStore = storage.NewGormScriptStore(db)
+	e.SceneStore = storage.NewGormSceneStore(db)
+	e.AreaStore = storage.NewGormAreaStore(db)
+	e.HelperStore = storage.NewGormHelperStore(db)
+
+	if err := e.RefreshEntityRegistry(ctx); err != nil {
+		e.Logger.Error("failed to refresh entity registry", zap.Error(err))
+	}
+
+	if err := e.Init(ctx); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// newEngine returns an engine without storage, New sets the stores.
+func newEngine(logger *zap.Logger, nWorkers int) *Engine {
+	entityRegistry := NewEntityRegistry()
+	events := make(chan types.Event, 100)
+	causality := newCausality()
+
 	e := &Engine{
-		Automations:             &automation.AutomationSet{},
 		Integrations:            make(map[string]integration.Instance),
 		IntegrationDescRegistry: integration.NewIntegrationRegistry(),
-		ServiceRegistry:         newServiceRegistry(),
-
-		// storage
-		EventStore:          storage.NewGormEventStore(db),
-		AutomationStore:     storage.NewGormRuleStore(db),
-		IntegrationCfgStore: storage.NewGormIntegrationCfgStore(db),
-		DeviceStore:         storage.NewGormDeviceStore(db),
-		EntityStore:         storage.NewGormEntityStore(db),
+		ServiceRegistry:         newServiceRegistry(entityRegistry, causality, events, logger.Named("engine").Named("services")),
+		Home:                    Home{TimeZone: time.Local},
 
 		// Cache
 		StateCache:     NewStateCache(),
-		EntityRegistry: NewEntityRegistry(),
+		disabledStates: newDisabledStates(),
+		EntityRegistry: entityRegistry,
+		targets:        newTargetIndex(),
 
-		ProcessedEventBus: NewEventBus(),               // for transmitting processed events to the ws manager
-		EventChannel:      make(chan types.Event, 100), // for receiving events from eventPipelines supplied by the integration
+		ProcessedEventBus: NewEventBus(), // for transmitting processed events to the ws manager
+		EventChannel:      events,        // for receiving events from eventPipelines supplied by the integration
 
-		AutomationTaskQueue: make(chan *AutomationTask),
+		AutomationTaskQueue: make(chan *AutomationTask, 100),
+		runs:                newRunTracker(),
+		scriptRuns:          newScriptRunTracker(),
+		scripts:             make(map[uint]automation.Script),
+		scenes:              make(map[uint]automation.Scene),
+		sceneSnapshots:      make(map[string]automation.Scene),
+		pendingTriggers:     newPendingTriggers(),
+		triggerMemory:       newTriggerMemory(),
+		causality:           causality,
+		LoopLimit:           DefaultLoopLimit,
 		ActionTimeout:       5 * time.Second,
 		RetryPolicy: RetryPolicy{
 			MaxAttempts: 3,
 			Backoff:     500 * time.Millisecond,
 		},
-		nWorkers: nWorkers,
+		MaxTraces: DefaultMaxTraces,
+		traces:    newTraceWriter(),
+		nWorkers:  nWorkers,
+		runSlots:  newRunSlots(nWorkers),
 
 		Logger: logger.Named("engine"),
 	}
-
-	if err := e.RefreshEntityRegistry(ctx); err != nil {
-		e.Logger.Error("failed to refresh entity registry", zap.Error(err))
-	}
-
-	if err := e.Init(ctx); err != nil {
-		return nil, err
-	}
-	return e, nil
+	e.automations.Store(&automation.AutomationSet{})
+	e.ProcessedEventBus.Logger = e.Logger.Named("event_bus")
+	e.timeEvents = NewEventBus()
+	e.timeEvents.Logger = e.Logger.Named("time_events")
+	e.Scheduler = NewScheduler(e.EventChannel, time.Local, e.Logger.Named("scheduler"))
+	return e
 }
 
 func (e *Engine) Init(ctx context.Context) error {
+	// scripts and scenes first, automations are validated against the services they register
+	if err := e.LoadScripts(ctx); err != nil {
+		return err
+	}
+	if err := e.LoadScenes(ctx); err != nil {
+		return err
+	}
 	if err := e.LoadAutomations(ctx); err != nil {
 		return err
 	}
+	e.startTraceWriter()
 	e.startWorkers()
 	return nil
 }
 
+// startWorkers starts the worker that dispatches the queued automation runs. Each run executes in its own
+// goroutine once it gets one of the nWorkers run slots, runs waiting in a delay or wait give up their slot.
 func (e *Engine) startWorkers() {
-	for i := 0; i < e.nWorkers; i++ {
-		e.wg.Add(1)
-		go func(id int) {
-			defer e.wg.Done()
-			for task := range e.AutomationTaskQueue {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for task := range e.AutomationTaskQueue {
+			ctx := e.runSlots.acquire(task.ctx)
+			e.wg.Add(1)
+			go func() {
+				defer e.wg.Done()
+				defer e.runs.inFlight.Done()
+				defer e.runSlots.release()
+				task.ctx = ctx
 				e.executeAutomationTask(task)
-			}
-		}(i)
-	}
+			}()
+		}
+	}()
 }
 
 func (e *Engine) RegisterService(domain, service string, spec integrations.ServiceSpec) {
@@ -131,6 +216,9 @@ func (e *Engine) RegisterService(domain, service string, spec integrations.Servi
 }
 
 func (e *Engine) LoadAutomations(ctx context.Context) error {
+	e.automationsMu.Lock()
+	defer e.automationsMu.Unlock()
+
 	storageAutomations, err := e.AutomationStore.LoadAutomations(ctx)
 	if err != nil {
 		return err
@@ -146,14 +234,33 @@ func (e *Engine) LoadAutomations(ctx context.Context) error {
 	}
 
 	e.Logger.Info("successfully loaded automations from storage", zap.Int("num_automations", len(automations)))
-	e.Automations = &automation.AutomationSet{
-		Automations: automations,
-	}
-
+	e.setAutomations(&automation.AutomationSet{
+		Automations: e.mergeFileAutomations(automations),
+	})
 	return nil
 }
 
+// Automations returns the currently loaded automations. The set is replaced as a whole on reload and must not be modified.
+func (e *Engine) Automations() *automation.AutomationSet {
+	return e.automations.Load()
+}
+
+func (e *Engine) automationByID(id uint64) (*automation.Automation, bool) {
+	set := e.Automations()
+	for i := range set.Automations {
+		if set.Automations[i].Id == id {
+			return &set.Automations[i], true
+		}
+	}
+	return nil, false
+}
+
+// Shutdown stops the pending triggers and the runs of automations. The AutomationTaskQueue is closed once the
+// dispatched runs finished, so no run or trigger sends to it afterwards.
 func (e *Engine) Shutdown() {
+	e.stopPendingTriggers()
+	e.closeRuns()
 	close(e.AutomationTaskQueue)
 	e.wg.Wait()
+	e.stopTraceWriter()
 }
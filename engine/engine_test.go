@@ -0,0 +1,250 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/storage/models"
+	"home_automation_server/types"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitTimeout bounds how long the tests wait for something that should happen, quietPeriod how long they
+// wait to see that something does not happen.
+const (
+	waitTimeout = 2 * time.Second
+	quietPeriod = 50 * time.Millisecond
+)
+
+// testEngine is an engine backed by a memStore. It is shut down when the test finishes.
+type testEngine struct {
+	*Engine
+	store    *memStore
+	shutdown func()
+}
+
+func newTestEngine(t *testing.T) *testEngine {
+	t.Helper()
+	store := newMemStore()
+	e := newEngine(zap.NewNop(), 4)
+	e.EventStore = store
+	e.AutomationStore = store
+	e.IntegrationCfgStore = store
+	e.DeviceStore = store
+	e.EntityStore = store
+	e.TraceStore = store
+	e.ScriptStore = store
+	e.SceneStore = store
+	e.AreaStore = store
+	e.HelperStore = store
+	e.RetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	if err := e.Init(context.Background()); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	te := &testEngine{Engine: e, store: store, shutdown: sync.OnceFunc(e.Shutdown)}
+	t.Cleanup(te.shutdown)
+	return te
+}
+
+// testEntity returns an enabled entity of the device, its type is taken from the entity ID.
+func testEntity(integrationID uint, externalID, entityID, deviceID string) models.Entity {
+	typ, name, _ := strings.Cut(entityID, ".")
+	return models.Entity{
+		IntegrationID: integrationID,
+		ExternalID:    externalID,
+		DeviceID:      deviceID,
+		EntityID:      entityID,
+		Type:          typ,
+		Name:          name,
+		Enabled:       true,
+		Available:     true,
+	}
+}
+
+// addEntities stores the entities in the given order, which is the order they were created in, with enabled
+// devices for those that have none, and refreshes the entity registry.
+func (e *testEngine) addEntities(t *testing.T, entities ...models.Entity) {
+	t.Helper()
+	ctx := context.Background()
+	stored, _ := e.store.GetAllEntities(ctx)
+	for i, ent := range entities {
+		if _, err := e.store.GetDeviceByID(ctx, ent.DeviceID); err != nil {
+			e.store.AddDevice(ctx, &models.Device{ID: ent.DeviceID, IntegrationID: ent.IntegrationID, Name: ent.DeviceID, Enabled: true, Available: true})
+		}
+		ent.CreatedAt = time.Unix(int64(len(stored)+i+1), 0)
+		e.store.AddEntity(ctx, &ent)
+	}
+	if err := e.RefreshEntityRegistry(ctx); err != nil {
+		t.Fatalf("RefreshEntityRegistry: %v", err)
+	}
+}
+
+// createAutomation stores the automation given as JSON and returns its ID.
+func (e *testEngine) createAutomation(t *testing.T, def string) uint64 {
+	t.Helper()
+	var a automation.Automation
+	if err := json.Unmarshal([]byte(def), &a); err != nil {
+		t.Fatalf("invalid automation: %v", err)
+	}
+	m, err := e.CreateAutomation(context.Background(), a)
+	if err != nil {
+		t.Fatalf("CreateAutomation: %v", err)
+	}
+	return m.ID
+}
+
+// updateAutomation replaces the automation with the one given as JSON.
+func (e *testEngine) updateAutomation(t *testing.T, id uint64, def string) {
+	t.Helper()
+	var a automation.Automation
+	if err := json.Unmarshal([]byte(def), &a); err != nil {
+		t.Fatalf("invalid automation: %v", err)
+	}
+	a.Id = id
+	if _, err := e.UpdateAutomation(context.Background(), a); err != nil {
+		t.Fatalf("UpdateAutomation: %v", err)
+	}
+}
+
+// fire processes an event of the given type, as the event loop does.
+func (e *testEngine) fire(eventType types.EventType) {
+	e.processEvent(context.Background(), types.Event{
+		Type:      eventType,
+		Context:   &types.Context{ID: uuid.NewString()},
+		TimeFired: time.Now(),
+	})
+}
+
+// setState processes a state_changed event of the entity.
+func (e *testEngine) setState(entityID, state string) {
+	var oldState *types.State
+	if st, ok := e.StateCache.Get(entityID); ok {
+		oldState = &st
+	}
+	newState := types.State{EntityID: entityID, State: state, LastChanged: time.Now(), Context: &types.Context{ID: uuid.NewString()}}
+	e.processEvent(context.Background(), types.Event{
+		Type:      types.EventTypeStateChanged,
+		Data:      types.StateChangedData{EntityID: entityID, OldState: oldState, NewState: &newState},
+		Context:   &types.Context{ID: uuid.NewString()},
+		TimeFired: time.Now(),
+	})
+}
+
+// traceResults returns the results of the stored traces of the automation, oldest first. The traces are
+// written in the background, so it waits until n traces were stored.
+func (e *testEngine) traceResults(t *testing.T, automationID uint64, n int) []string {
+	t.Helper()
+	var results []string
+	eventually(t, func() bool {
+		traces, _ := e.store.GetTraces(context.Background(), automationID)
+		results = results[:0]
+		for i := len(traces) - 1; i >= 0; i-- {
+			results = append(results, traces[i].Result)
+		}
+		return len(results) >= n
+	})
+	return results
+}
+
+// pendingCount returns the number of armed "for" triggers.
+func pendingCount(e *testEngine) int {
+	e.pendingTriggers.mu.Lock()
+	defer e.pendingTriggers.mu.Unlock()
+	return len(e.pendingTriggers.pending)
+}
+
+// eventually fails the test if cond does not hold within waitTimeout.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// blockingService is a test service whose calls block until they are released or cancelled.
+type blockingService struct {
+	started  chan *automation.Action // receives each call when it starts
+	finished chan error              // receives the result of each call
+	release  chan struct{}           // a send releases one call
+}
+
+func newBlockingService(e *testEngine, domain, service string) *blockingService {
+	s := &blockingService{
+		started:  make(chan *automation.Action, 16),
+		finished: make(chan error, 16),
+		release:  make(chan struct{}),
+	}
+	e.RegisterService(domain, service, integrations.ServiceSpec{
+		Params: map[string]integrations.ParamMetadata{
+			"value": {DataType: "string", Optional: true},
+		},
+		Handler: func(ctx context.Context, action *automation.Action) error {
+			s.started <- action
+			var err error
+			select {
+			case <-s.release:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			s.finished <- err
+			return err
+		},
+	})
+	return s
+}
+
+// expectCall waits for the next call of the service.
+func (s *blockingService) expectCall(t *testing.T) *automation.Action {
+	t.Helper()
+	select {
+	case action := <-s.started:
+		return action
+	case <-time.After(waitTimeout):
+		t.Fatal("service was not called")
+		return nil
+	}
+}
+
+// expectNoCall fails the test if the service is called within quietPeriod.
+func (s *blockingService) expectNoCall(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.started:
+		t.Fatal("service was called unexpectedly")
+	case <-time.After(quietPeriod):
+	}
+}
+
+// expectFinished waits for a call to return and checks its result.
+func (s *blockingService) expectFinished(t *testing.T, want error) {
+	t.Helper()
+	select {
+	case err := <-s.finished:
+		if err != want {
+			t.Fatalf("call returned %v, want %v", err, want)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("call did not return")
+	}
+}
+
+// releaseOne lets one blocked call return.
+func (s *blockingService) releaseOne(t *testing.T) {
+	t.Helper()
+	select {
+	case s.release <- struct{}{}:
+	case <-time.After(waitTimeout):
+		t.Fatal("no call to release")
+	}
+}
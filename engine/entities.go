@@ -0,0 +1,450 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/storage"
+	"home_automation_server/storage/models"
+	"home_automation_server/utils"
+	"strings"
+)
+
+var (
+	ErrEntityNotFound = errors.New("entity not found")
+	ErrDeviceNotFound = errors.New("device not found")
+	ErrEntityDisabled = errors.New("entity is disabled") // returned for service calls that target a disabled entity
+)
+
+// EntityFilter selects entities to list. Zero fields match every entity.
+type EntityFilter struct {
+	Selector      automation.Target // device, area, entity type and label, matched like the targets of a service call
+	IntegrationID uint
+	Enabled       *bool
+	Search        string // part of the entity ID or name, case-insensitive
+}
+
+// EntityUpdate changes the settings of an entity. Nil fields are left unchanged.
+type EntityUpdate struct {
+	EntityID     *string   `json:"entity_id,omitempty"`
+	FriendlyName *string   `json:"friendly_name,omitempty"` // empty to use the name of the integration again
+	Icon         *string   `json:"icon,omitempty"`
+	Enabled      *bool     `json:"enabled,omitempty"`
+	Labels       *[]string `json:"labels,omitempty"`
+}
+
+// ListEntities returns the stored entities that match the filter, oldest first.
+func (e *Engine) ListEntities(ctx context.Context, filter EntityFilter) ([]models.Entity, error) {
+	entities := e.targets.match(filter.Selector)
+	search := strings.ToLower(filter.Search)
+
+	matched := make([]models.Entity, 0, len(entities))
+	for _, ent := range entities {
+		if filter.Enabled != nil && ent.Enabled != *filter.Enabled {
+			continue
+		}
+		if filter.IntegrationID != 0 {
+			if owner, ok := e.EntityRegistry.Owner(ent.EntityID); !ok || owner.IntegrationID != filter.IntegrationID {
+				continue
+			}
+		}
+		if search != "" && !strings.Contains(strings.ToLower(ent.EntityID), search) &&
+			!strings.Contains(strings.ToLower(ent.Name), search) && !strings.Contains(strings.ToLower(ent.FriendlyName), search) {
+			continue
+		}
+		matched = append(matched, ent)
+	}
+	return matched, nil
+}
+
+// GetEntity returns the stored entity with the entity ID.
+func (e *Engine) GetEntity(ctx context.Context, entityID string) (*models.Entity, error) {
+	owner, ok := e.EntityRegistry.Owner(entityID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrEntityNotFound, entityID)
+	}
+	ent, err := e.EntityStore.GetEntityByID(ctx, owner.IntegrationID, owner.ExternalID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrEntityNotFound, entityID)
+		}
+		return nil, fmt.Errorf("failed to query entity: %w", err)
+	}
+	return ent, nil
+}
+
+// UpdateEntity validates and stores the changes to an entity, they apply without a restart. Renaming the
+// entity ID moves its state and rewrites the references to it in the stored automations, scripts and scenes;
+// templates that mention it and automations loaded from YAML files are not rewritten.
+func (e *Engine) UpdateEntity(ctx context.Context, entityID string, u EntityUpdate) (*models.Entity, error) {
+	ent, err := e.GetEntity(ctx, entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &automation.Validator{}
+	newEntityID := ent.EntityID
+	if u.EntityID != nil {
+		newEntityID = strings.TrimSpace(*u.EntityID)
+		validateEntityID(v, newEntityID, ent.Type)
+		if owner, ok := e.EntityRegistry.Owner(newEntityID); ok && owner.ExternalID != ent.ExternalID {
+			v.Add("entity_id", "entity_id %q is already in use", newEntityID)
+		}
+	}
+	if u.FriendlyName != nil {
+		ent.FriendlyName = strings.TrimSpace(*u.FriendlyName)
+		if len(ent.FriendlyName) > 100 {
+			v.Add("friendly_name", "friendly_name must be at most 100 characters")
+		}
+	}
+	if u.Icon != nil {
+		ent.Icon = strings.TrimSpace(*u.Icon)
+		if len(ent.Icon) > 100 {
+			v.Add("icon", "icon must be at most 100 characters")
+		}
+	}
+	if u.Enabled != nil {
+		ent.Enabled = *u.Enabled
+	}
+	if u.Labels != nil {
+		for i, label := range *u.Labels {
+			if strings.TrimSpace(label) == "" {
+				v.Add(fmt.Sprintf("labels/%d", i), "label must not be empty")
+			}
+		}
+		labels, err := json.Marshal(*u.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode labels: %w", err)
+		}
+		ent.Labels = labels
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	renamed := newEntityID != ent.EntityID
+	if renamed {
+		// claim the new entity ID first, so concurrent renames cannot both take it
+		if !e.EntityRegistry.Rename(ent.EntityID, newEntityID) {
+			v.Add("entity_id", "entity_id %q is already in use", newEntityID)
+			return nil, v.Err()
+		}
+		ent.EntityID = newEntityID
+	}
+	if err := e.EntityStore.UpdateEntity(ctx, ent); err != nil {
+		if renamed {
+			e.EntityRegistry.Rename(newEntityID, entityID)
+		}
+		return nil, fmt.Errorf("failed to store entity: %w", err)
+	}
+	e.Logger.Info("updated entity", zap.String("entity_id", entityID), zap.Any("update", u))
+	e.refreshTargetIndex(ctx)
+
+	if renamed {
+		e.StateCache.Rename(entityID, newEntityID)
+		e.disabledStates.rename(entityID, newEntityID)
+		e.renameEntityReferences(ctx, entityID, newEntityID)
+	}
+	if u.Enabled != nil {
+		e.applyEnabled(ctx, []models.Entity{*ent})
+	}
+	return ent, nil
+}
+
+// SetDeviceEnabled enables or disables a device. The entities of a disabled device are disabled, regardless
+// of their own enabled flag.
+func (e *Engine) SetDeviceEnabled(ctx context.Context, deviceID string, enabled bool) (*models.Device, error) {
+	d, err := e.DeviceStore.GetDeviceByID(ctx, deviceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceID)
+		}
+		return nil, fmt.Errorf("failed to query device: %w", err)
+	}
+	d.Enabled = enabled
+	if err := e.DeviceStore.UpdateDevice(ctx, d); err != nil {
+		return nil, fmt.Errorf("failed to store device: %w", err)
+	}
+	e.Logger.Info("updated device", zap.String("device_id", deviceID), zap.Bool("enabled", enabled))
+	e.refreshTargetIndex(ctx)
+
+	entities, err := e.EntityStore.GetEntitiesByDevice(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load entities of device: %w", err)
+	}
+	e.applyEnabled(ctx, entities)
+	return d, nil
+}
+
+// applyEnabled updates the enabled flags of the entities in the registry. The states of those that are
+// disabled are removed, they are dropped from then on, those that are enabled again get their states back.
+func (e *Engine) applyEnabled(ctx context.Context, entities []models.Entity) {
+	devices := make(map[string]bool) // device ID -> enabled
+	for _, ent := range entities {
+		deviceEnabled, ok := devices[ent.DeviceID]
+		if !ok {
+			d, err := e.DeviceStore.GetDeviceByID(ctx, ent.DeviceID)
+			deviceEnabled = err != nil || d.Enabled // entities without a stored device only depend on their own flag
+			devices[ent.DeviceID] = deviceEnabled
+		}
+		enabled := ent.Enabled && deviceEnabled
+		e.EntityRegistry.SetEnabled(ent.EntityID, enabled)
+		if !enabled {
+			e.removeDisabledState(ent.EntityID)
+		}
+	}
+	e.restoreEnabledStates()
+
+	// events of disabled entities were dropped, integrations that can publish their current states instead
+	for _, ent := range entities {
+		owner, ok := e.EntityRegistry.Owner(ent.EntityID)
+		if !ok || !owner.Enabled {
+			continue
+		}
+		if integration, ok := e.integrationByConfigID(owner.IntegrationID); ok && integration.PublishStates != nil {
+			integration.PublishStates(owner.ExternalID)
+		}
+	}
+}
+
+// removeDisabledState removes the state of a disabled entity from the state cache and keeps it for
+// restoreEnabledStates.
+func (e *Engine) removeDisabledState(entityID string) {
+	if state, ok := e.StateCache.Get(entityID); ok {
+		e.disabledStates.put(entityID, state)
+	}
+	e.StateCache.Delete(entityID)
+}
+
+// restoreEnabledStates puts the last states of entities that were enabled again back into the state cache,
+// so they have a state, with all its attributes, before their integration sends the next update.
+func (e *Engine) restoreEnabledStates() {
+	restored := e.disabledStates.take(func(entityID string) bool {
+		_, known := e.EntityRegistry.Owner(entityID)
+		return known && !e.EntityRegistry.Disabled(entityID)
+	})
+	for _, state := range restored {
+		e.StateCache.Set(state.EntityID, state)
+	}
+}
+
+// validateEntityID checks that an entity ID is "<type>.<object_id>" with the type of the entity and an object
+// ID of lower case letters, digits and underscores.
+func validateEntityID(v *automation.Validator, entityID, entityType string) {
+	typ, objectID, ok := strings.Cut(entityID, ".")
+	switch {
+	case !ok || objectID == "":
+		v.Add("entity_id", "entity_id %q must be <type>.<object_id>", entityID)
+	case typ != entityType:
+		v.Add("entity_id", "entity_id %q must start with %q, the type of the entity", entityID, entityType+".")
+	case objectID != utils.NormalizeString(objectID):
+		v.Add("entity_id", "object_id %q must be lower case letters, digits and underscores", objectID)
+	}
+}
+
+// renameEntityReferences replaces the entity ID in the entity_id fields and targets of the stored automations,
+// scripts and scenes, and in the entities of the stored scenes, and reloads them. Failures are logged, the
+// entity stays renamed.
+func (e *Engine) renameEntityReferences(ctx context.Context, entityID, newEntityID string) {
+	log := e.Logger.With(zap.String("entity_id", entityID), zap.String("new_entity_id", newEntityID))
+	renameIDs := func(v any) (any, bool) { return renameEntityIDs(v, entityID, newEntityID) }
+
+	updated := e.renameAutomationEntityReferences(ctx, entityID, renameIDs, log)
+
+	scripts, err := e.ScriptStore.LoadScripts(ctx)
+	if err != nil {
+		log.Error("failed to load scripts to rename entity", zap.Error(err))
+	}
+	updatedScripts := 0
+	for _, m := range scripts {
+		if !renameEntityInJSON(&m.Sequence, entityID, renameIDs, log) {
+			continue
+		}
+		if err := e.ScriptStore.UpdateScript(ctx, &m); err != nil {
+			log.Error("failed to store renamed entity in script", zap.Error(err), zap.Uint("script_id", m.ID))
+			continue
+		}
+		updatedScripts++
+	}
+	if updatedScripts > 0 {
+		if err := e.LoadScripts(ctx); err != nil {
+			log.Error("failed to reload scripts", zap.Error(err))
+		}
+	}
+
+	scenes, err := e.SceneStore.LoadScenes(ctx)
+	if err != nil {
+		log.Error("failed to load scenes to rename entity", zap.Error(err))
+	}
+	renameKey := func(v any) (any, bool) { return renameEntityKey(v, entityID, newEntityID) }
+	updatedScenes := 0
+	for _, m := range scenes {
+		if !renameEntityInJSON(&m.Entities, entityID, renameKey, log) {
+			continue
+		}
+		if err := e.SceneStore.UpdateScene(ctx, &m); err != nil {
+			log.Error("failed to store renamed entity in scene", zap.Error(err), zap.Uint("scene_id", m.ID))
+			continue
+		}
+		updatedScenes++
+	}
+	if updatedScenes > 0 {
+		if err := e.LoadScenes(ctx); err != nil {
+			log.Error("failed to reload scenes", zap.Error(err))
+		}
+	}
+
+	log.Info("renamed entity references", zap.Int("automations", updated), zap.Int("scripts", updatedScripts), zap.Int("scenes", updatedScenes))
+}
+
+// renameAutomationEntityReferences renames the entity in the stored automations and swaps the renamed ones in.
+// Automation files are only reported, they are not rewritten. It returns the number of renamed automations.
+func (e *Engine) renameAutomationEntityReferences(ctx context.Context, entityID string, rename func(any) (any, bool), log *zap.Logger) int {
+	e.automationsMu.Lock()
+	defer e.automationsMu.Unlock()
+
+	automations, err := e.AutomationStore.LoadAutomations(ctx)
+	if err != nil {
+		log.Error("failed to load automations to rename entity", zap.Error(err))
+	}
+	renamed := make(map[uint64]automation.Automation)
+	for _, m := range automations {
+		changed := false
+		for _, field := range []*datatypes.JSON{&m.Triggers, &m.Conditions, &m.Actions} {
+			changed = renameEntityInJSON(field, entityID, rename, log) || changed
+		}
+		if !changed {
+			continue
+		}
+		if err := e.AutomationStore.UpdateAutomation(ctx, &m); err != nil {
+			log.Error("failed to store renamed entity in automation", zap.Error(err), zap.Uint64("automation_id", m.ID))
+			continue
+		}
+		a, err := storage.AutomationFromStorage(m)
+		if err != nil {
+			log.Error("unable to convert automation from storage model", zap.Error(err), zap.Uint64("automation_id", m.ID))
+			continue
+		}
+		renamed[a.Id] = a
+	}
+
+	if len(renamed) > 0 {
+		e.swapAutomations(func(automations []automation.Automation) []automation.Automation {
+			for i := range automations {
+				if a, ok := renamed[automations[i].Id]; ok && automations[i].File == "" {
+					automations[i] = a
+				}
+			}
+			return automations
+		})
+	}
+	for _, a := range e.Automations().Automations {
+		if a.File == "" {
+			continue
+		}
+		if raw, err := json.Marshal(a); err == nil {
+			var v any
+			if json.Unmarshal(raw, &v) == nil {
+				if _, refers := rename(v); refers {
+					log.Warn("automation file refers to renamed entity, update it", zap.String("file", a.File), zap.String("automation", a.Alias))
+				}
+			}
+		}
+	}
+	return len(renamed)
+}
+
+// renameEntityInJSON applies rename to the JSON document, if it mentions entityID. It reports whether the
+// document changed.
+func renameEntityInJSON(doc *datatypes.JSON, entityID string, rename func(any) (any, bool), log *zap.Logger) bool {
+	if len(*doc) == 0 || !bytes.Contains(*doc, []byte(entityID)) {
+		return false
+	}
+	var v any
+	if err := json.Unmarshal(*doc, &v); err != nil {
+		log.Warn("failed to decode stored JSON, entity not renamed in it", zap.Error(err))
+		return false
+	}
+	v, changed := rename(v)
+	if !changed {
+		return false
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		log.Warn("failed to encode stored JSON, entity not renamed in it", zap.Error(err))
+		return false
+	}
+	*doc = raw
+	return true
+}
+
+// renameEntityIDs replaces entityID in the entity_id fields of the document, e.g. of triggers, conditions and
+// targets. An entity_id field may hold a single entity ID or a list of them. Other strings equal to the entity
+// ID are kept.
+func renameEntityIDs(v any, entityID, newEntityID string) (any, bool) {
+	switch v := v.(type) {
+	case []any:
+		changed := false
+		for i, item := range v {
+			var c bool
+			v[i], c = renameEntityIDs(item, entityID, newEntityID)
+			changed = changed || c
+		}
+		return v, changed
+	case map[string]any:
+		changed := false
+		for key, item := range v {
+			var c bool
+			if key == "entity_id" {
+				item, c = renameEntityIDValue(item, entityID, newEntityID)
+			} else {
+				item, c = renameEntityIDs(item, entityID, newEntityID)
+			}
+			v[key] = item
+			changed = changed || c
+		}
+		return v, changed
+	default:
+		return v, false
+	}
+}
+
+// renameEntityIDValue renames the value of an entity_id field.
+func renameEntityIDValue(v any, entityID, newEntityID string) (any, bool) {
+	switch v := v.(type) {
+	case string:
+		if v == entityID {
+			return newEntityID, true
+		}
+	case []any:
+		changed := false
+		for i, item := range v {
+			if item == entityID {
+				v[i], changed = newEntityID, true
+			}
+		}
+		return v, changed
+	}
+	return v, false
+}
+
+// renameEntityKey renames the key entityID of an object keyed by entity ID, e.g. the entities of a scene.
+func renameEntityKey(v any, entityID, newEntityID string) (any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v, false
+	}
+	item, ok := m[entityID]
+	if !ok {
+		return v, false
+	}
+	delete(m, entityID)
+	m[newEntityID] = item
+	return m, true
+}
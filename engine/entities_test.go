@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"home_automation_server/automation"
+	"home_automation_server/engine/integration"
+	"home_automation_server/storage"
+	"slices"
+	"testing"
+)
+
+func TestRenameEntityReferences(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t)
+	newBlockingService(e, "test", "block")
+	e.addEntities(t,
+		testEntity(1, "a", "light.kitchen", "dev-1"),
+		testEntity(1, "b", "light.kitchen_lamp", "dev-1"),
+	)
+	e.setState("light.kitchen", "on")
+
+	id := e.createAutomation(t, `{
+		"alias": "kitchen", "active": true,
+		"trigger": [
+			{"type": "state", "data": {"entity_id": "light.kitchen", "to": "on"}},
+			{"type": "state", "data": {"entity_id": "light.kitchen_lamp", "to": "on"}}
+		],
+		"action": [{"service": "test.block", "targets": [{"entity_id": "light.kitchen"}], "params": {"value": "light.kitchen"}}]
+	}`)
+	script, err := e.CreateScript(ctx, automation.Script{
+		Name:     "kitchen",
+		Alias:    "Kitchen",
+		Fields:   map[string]automation.ScriptField{"light.kitchen": {Type: "string"}},
+		Sequence: []automation.Action{{Service: "test.block", Targets: []automation.Target{{EntityID: "light.kitchen"}}}},
+	})
+	if err != nil {
+		t.Fatalf("CreateScript: %v", err)
+	}
+	scene, err := e.CreateScene(ctx, automation.Scene{
+		Name:  "kitchen",
+		Alias: "Kitchen",
+		Entities: map[string]automation.SceneEntity{
+			"light.kitchen":      {State: "on", Attributes: map[string]any{"effect": "light.kitchen"}},
+			"light.kitchen_lamp": {State: "off"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateScene: %v", err)
+	}
+
+	newEntityID := "light.pantry"
+	if _, err := e.UpdateEntity(ctx, "light.kitchen", EntityUpdate{EntityID: &newEntityID}); err != nil {
+		t.Fatalf("UpdateEntity: %v", err)
+	}
+
+	if _, ok := e.StateCache.Get("light.pantry"); !ok {
+		t.Error("state was not moved to the new entity ID")
+	}
+
+	// the loaded and the stored automation reference the new entity ID in entity_id fields only
+	a, _ := e.automationByID(id)
+	if got, want := jsonString(t, a.Trigger), `[{"type":"state","data":{"entity_id":"light.pantry","to":"on"}},`+
+		`{"type":"state","data":{"entity_id":"light.kitchen_lamp","to":"on"}}]`; got != want {
+		t.Errorf("triggers = %s, want %s", got, want)
+	}
+	if got := a.Actions[0].Targets[0].EntityID; got != "light.pantry" {
+		t.Errorf("target = %q, want light.pantry", got)
+	}
+	if got := a.Actions[0].Params["value"]; got != "light.kitchen" {
+		t.Errorf("param = %v, want it unchanged", got)
+	}
+	if issues := e.Automations().Issues[id]; len(issues) > 0 {
+		t.Errorf("renamed automation is invalid: %v", issues)
+	}
+	m, _ := e.store.GetAutomation(ctx, id)
+	stored, err := storage.AutomationFromStorage(*m)
+	if err != nil {
+		t.Fatalf("AutomationFromStorage: %v", err)
+	}
+	if got, want := jsonString(t, stored), jsonString(t, a); got != want {
+		t.Errorf("stored automation = %s, want %s", got, want)
+	}
+
+	s, _ := e.ScriptByID(script.ID)
+	if got := s.Sequence[0].Targets[0].EntityID; got != "light.pantry" {
+		t.Errorf("script target = %q, want light.pantry", got)
+	}
+	if _, ok := s.Fields["light.kitchen"]; !ok {
+		t.Error("script fields were renamed")
+	}
+
+	sc, _ := e.SceneByID(scene.ID)
+	want := `{"light.kitchen_lamp":{"state":"off"},"light.pantry":{"state":"on","attributes":{"effect":"light.kitchen"}}}`
+	if got := jsonString(t, sc.Entities); got != want {
+		t.Errorf("scene entities = %s, want %s", got, want)
+	}
+}
+
+func jsonString(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return string(b)
+}
+
+// addIntegration loads an integration instance under its name.
+func (e *testEngine) addIntegration(name string, instance integration.Instance) {
+	instance.Descriptor.Name = name
+	e.integrationsMu.Lock()
+	defer e.integrationsMu.Unlock()
+	e.Integrations[name] = instance
+}
+
+func TestEntityEnabled(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t)
+	svc := newBlockingService(e, "test", "block")
+	published := make(chan []string, 16)
+	e.addIntegration("test", integration.Instance{
+		ConfigID:      1,
+		PublishStates: func(externalIDs ...string) { published <- externalIDs },
+	})
+	e.addEntities(t, testEntity(1, "a", "light.kitchen", "dev-1"))
+	e.createAutomation(t, `{
+		"alias": "kitchen", "active": true,
+		"trigger": [{"type": "state", "data": {"entity_id": "light.kitchen", "to": "on"}}],
+		"action": [{"service": "test.block", "blocking": true}]
+	}`)
+	e.setState("light.kitchen", "off")
+
+	disable, enable := false, true
+	if _, err := e.UpdateEntity(ctx, "light.kitchen", EntityUpdate{Enabled: &disable}); err != nil {
+		t.Fatalf("UpdateEntity: %v", err)
+	}
+	if _, ok := e.StateCache.Get("light.kitchen"); ok {
+		t.Error("disabled entity has a state")
+	}
+
+	// events of the disabled entity are dropped, they neither set its state nor trigger automations
+	e.setState("light.kitchen", "on")
+	if _, ok := e.StateCache.Get("light.kitchen"); ok {
+		t.Error("event of the disabled entity set its state")
+	}
+	svc.expectNoCall(t)
+
+	// service calls that target it fail
+	err := e.CallService(ctx, "test", "block", []automation.Target{{EntityID: "light.kitchen"}}, nil)
+	if !errors.Is(err, ErrEntityDisabled) {
+		t.Errorf("CallService = %v, want ErrEntityDisabled", err)
+	}
+
+	// enabled again, it gets its last state back and the integration publishes its current state
+	if _, err := e.UpdateEntity(ctx, "light.kitchen", EntityUpdate{Enabled: &enable}); err != nil {
+		t.Fatalf("UpdateEntity: %v", err)
+	}
+	if st, ok := e.StateCache.Get("light.kitchen"); !ok || st.State != "off" {
+		t.Errorf("state = %v, %v, want the last state off", st.State, ok)
+	}
+	select {
+	case ids := <-published:
+		if !slices.Equal(ids, []string{"a"}) {
+			t.Errorf("published states of %v, want [a]", ids)
+		}
+	default:
+		t.Error("integration did not publish the state")
+	}
+}
+
+func TestDeviceEnabled(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t)
+	e.addEntities(t,
+		testEntity(1, "a", "light.kitchen", "dev-1"),
+		testEntity(1, "b", "light.kitchen_spot", "dev-1"),
+	)
+	e.setState("light.kitchen", "on")
+	e.setState("light.kitchen_spot", "on")
+
+	if _, err := e.SetDeviceEnabled(ctx, "dev-1", false); err != nil {
+		t.Fatalf("SetDeviceEnabled: %v", err)
+	}
+	for _, entityID := range []string{"light.kitchen", "light.kitchen_spot"} {
+		if !e.EntityRegistry.Disabled(entityID) {
+			t.Errorf("%s of the disabled device is enabled", entityID)
+		}
+		if _, ok := e.StateCache.Get(entityID); ok {
+			t.Errorf("%s of the disabled device has a state", entityID)
+		}
+	}
+
+	// an entity that is enabled itself stays disabled with its device
+	enable := true
+	if _, err := e.UpdateEntity(ctx, "light.kitchen", EntityUpdate{Enabled: &enable}); err != nil {
+		t.Fatalf("UpdateEntity: %v", err)
+	}
+	if !e.EntityRegistry.Disabled("light.kitchen") {
+		t.Error("entity of the disabled device is enabled")
+	}
+
+	if _, err := e.SetDeviceEnabled(ctx, "dev-1", true); err != nil {
+		t.Fatalf("SetDeviceEnabled: %v", err)
+	}
+	for _, entityID := range []string{"light.kitchen", "light.kitchen_spot"} {
+		if e.EntityRegistry.Disabled(entityID) {
+			t.Errorf("%s is still disabled", entityID)
+		}
+		if st, ok := e.StateCache.Get(entityID); !ok || st.State != "on" {
+			t.Errorf("%s state = %v, %v, want the last state on", entityID, st.State, ok)
+		}
+	}
+
+	// the flags survive a refresh of the registry
+	if _, err := e.SetDeviceEnabled(ctx, "dev-1", false); err != nil {
+		t.Fatalf("SetDeviceEnabled: %v", err)
+	}
+	if err := e.RefreshEntityRegistry(ctx); err != nil {
+		t.Fatalf("RefreshEntityRegistry: %v", err)
+	}
+	if !e.EntityRegistry.Disabled("light.kitchen") {
+		t.Error("entity of the disabled device is enabled after a refresh")
+	}
+}
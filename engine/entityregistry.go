@@ -1,54 +1,295 @@
 package engine
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"go.uber.org/zap"
+	"home_automation_server/storage/models"
+	"home_automation_server/types"
+	"slices"
 	"sync"
 )
 
+// RegistryEntry is an entity known to the registry and the integration that owns it.
+type RegistryEntry struct {
+	IntegrationID uint   `json:"integration_id"` // ID of the integration config
+	ExternalID    string `json:"external_id"`
+	EntityID      string `json:"entity_id"`
+	Enabled       bool   `json:"enabled"` // false if the entity or its device is disabled
+}
+
+type registryKey struct {
+	integrationID uint
+	externalID    string
+}
+
+// EntityRegistry maps the external IDs integrations use to entity IDs. External IDs are namespaced by the
+// integration config that owns them, entity IDs are unique across integrations.
 type EntityRegistry struct {
-	mu      sync.RWMutex
-	mapping map[string]string // externalID -> entityID
+	mu         sync.RWMutex
+	byExternal map[registryKey]string       // (integration, externalID) -> entityID
+	byEntityID map[string]RegistryEntry     // entityID -> owner
+	anyOwner   map[string]map[uint]struct{} // externalID -> integrations that use it, for unscoped lookups
 }
 
 func NewEntityRegistry() *EntityRegistry {
 	return &EntityRegistry{
-		mapping: make(map[string]string),
+		byExternal: make(map[registryKey]string),
+		byEntityID: make(map[string]RegistryEntry),
+		anyOwner:   make(map[string]map[uint]struct{}),
 	}
 }
 
-func (r *EntityRegistry) Register(externalID, entityID string) {
+// Register maps the external ID of the integration to the entity ID, replacing a previous entity ID of the
+// external ID. Like Claim, an entity ID owned by another entity is not taken over, the entity gets a suffixed
+// entity ID instead. The entity keeps its enabled flag, new entities are enabled. It returns the registered
+// entity ID.
+func (r *EntityRegistry) Register(integrationID uint, externalID, entityID string) string {
+	return r.Claim(integrationID, externalID, entityID)
+}
+
+// Claim registers the external ID of the integration under entityID, or, if another entity owns it, under the
+// first free entityID with a numeric suffix, e.g. "light.kitchen_2". It returns the registered entity ID.
+func (r *EntityRegistry) Claim(integrationID uint, externalID, entityID string) string {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.mapping[externalID] = entityID
+	entry := r.entry(integrationID, externalID, r.free(integrationID, externalID, entityID))
+	r.register(entry)
+	return entry.EntityID
 }
 
-func (r *EntityRegistry) Resolve(externalID string) (string, bool) {
+// entry returns the entry for the external ID of the integration under entityID, with the enabled flag of the
+// registered entry, if any. Must be called with mu held.
+func (r *EntityRegistry) entry(integrationID uint, externalID, entityID string) RegistryEntry {
+	enabled := true
+	if old, ok := r.byExternal[registryKey{integrationID: integrationID, externalID: externalID}]; ok {
+		enabled = r.byEntityID[old].Enabled
+	}
+	return RegistryEntry{IntegrationID: integrationID, ExternalID: externalID, EntityID: entityID, Enabled: enabled}
+}
+
+// SetEnabled sets the enabled flag of an entity. It reports whether the entity is registered.
+func (r *EntityRegistry) SetEnabled(entityID string, enabled bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.byEntityID[entityID]
+	if !ok {
+		return false
+	}
+	entry.Enabled = enabled
+	r.byEntityID[entityID] = entry
+	return true
+}
+
+// Disabled reports whether the entity is registered and disabled. Entities the registry does not know, e.g.
+// those the engine provides itself like sun.sun, are not disabled.
+func (r *EntityRegistry) Disabled(entityID string) bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	entityID, ok := r.mapping[externalID]
-	return entityID, ok
+	entry, ok := r.byEntityID[entityID]
+	return ok && !entry.Enabled
 }
 
-func (r *EntityRegistry) ResolveExternalID(entityID string) (string, bool) {
-	for externalID, entID := range r.mapping {
-		if entityID == entID {
-			return externalID, true
+// Rename moves an entity to a new entity ID. It fails if the entity is not registered or the new entity ID
+// is owned by another entity.
+func (r *EntityRegistry) Rename(entityID, newEntityID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.byEntityID[entityID]
+	if !ok {
+		return false
+	}
+	if _, taken := r.byEntityID[newEntityID]; taken && newEntityID != entityID {
+		return false
+	}
+	entry.EntityID = newEntityID
+	r.register(entry)
+	return true
+}
+
+// free returns entityID, or the first suffixed variant of it that is not owned by another entity. Must be
+// called with mu held.
+func (r *EntityRegistry) free(integrationID uint, externalID, entityID string) string {
+	candidate := entityID
+	for i := 2; ; i++ {
+		owner, taken := r.byEntityID[candidate]
+		if !taken || (owner.IntegrationID == integrationID && owner.ExternalID == externalID) {
+			return candidate
 		}
+		candidate = fmt.Sprintf("%s_%d", entityID, i)
+	}
+}
+
+// register adds the entry and drops the previous entity ID of its external ID. The entity ID must not be owned
+// by another entity. Must be called with mu held.
+func (r *EntityRegistry) register(entry RegistryEntry) {
+	key := registryKey{integrationID: entry.IntegrationID, externalID: entry.ExternalID}
+	if old, ok := r.byExternal[key]; ok && old != entry.EntityID {
+		delete(r.byEntityID, old)
+	}
+
+	r.byExternal[key] = entry.EntityID
+	r.byEntityID[entry.EntityID] = entry
+	if r.anyOwner[entry.ExternalID] == nil {
+		r.anyOwner[entry.ExternalID] = make(map[uint]struct{})
+	}
+	r.anyOwner[entry.ExternalID][entry.IntegrationID] = struct{}{}
+}
+
+// unregister removes the entity of the key. Must be called with mu held.
+func (r *EntityRegistry) unregister(key registryKey) {
+	entityID, ok := r.byExternal[key]
+	if !ok {
+		return
+	}
+	delete(r.byExternal, key)
+	delete(r.byEntityID, entityID)
+	delete(r.anyOwner[key.externalID], key.integrationID)
+	if len(r.anyOwner[key.externalID]) == 0 {
+		delete(r.anyOwner, key.externalID)
+	}
+}
+
+// ResolveFor returns the entity ID of the external ID of the integration.
+func (r *EntityRegistry) ResolveFor(integrationID uint, externalID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entityID, ok := r.byExternal[registryKey{integrationID: integrationID, externalID: externalID}]
+	return entityID, ok
+}
+
+// Resolve returns the entity ID of an external ID of any integration. It fails if the external ID is used by
+// more than one integration, use ResolveFor then.
+func (r *EntityRegistry) Resolve(externalID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	owners := r.anyOwner[externalID]
+	if len(owners) != 1 {
+		return "", false
+	}
+	for integrationID := range owners {
+		entityID, ok := r.byExternal[registryKey{integrationID: integrationID, externalID: externalID}]
+		return entityID, ok
 	}
 	return "", false
 }
 
+// ResolveExternalID returns the external ID of an entity.
+func (r *EntityRegistry) ResolveExternalID(entityID string) (string, bool) {
+	entry, ok := r.Owner(entityID)
+	return entry.ExternalID, ok
+}
+
+// Owner returns the registry entry of an entity, including the integration that owns it.
+func (r *EntityRegistry) Owner(entityID string) (RegistryEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.byEntityID[entityID]
+	return entry, ok
+}
+
+// Entries returns all entries, ordered by entity ID.
+func (r *EntityRegistry) Entries() []RegistryEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := make([]RegistryEntry, 0, len(r.byEntityID))
+	for _, entry := range r.byEntityID {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b RegistryEntry) int {
+		return cmp.Compare(a.EntityID, b.EntityID)
+	})
+	return entries
+}
+
+// ForIntegration returns the view of the registry an integration works with: external IDs are those of the
+// integration, entity IDs of other integrations are not visible.
+func (r *EntityRegistry) ForIntegration(integrationID uint) types.EntityRegistry {
+	return integrationEntities{registry: r, integrationID: integrationID}
+}
+
+type integrationEntities struct {
+	registry      *EntityRegistry
+	integrationID uint
+}
+
+func (v integrationEntities) Register(externalID, entityID string) string {
+	return v.registry.Register(v.integrationID, externalID, entityID)
+}
+
+func (v integrationEntities) Resolve(externalID string) (string, bool) {
+	return v.registry.ResolveFor(v.integrationID, externalID)
+}
+
+func (v integrationEntities) ResolveExternalID(entityID string) (string, bool) {
+	entry, ok := v.registry.Owner(entityID)
+	if !ok || entry.IntegrationID != v.integrationID {
+		return "", false
+	}
+	return entry.ExternalID, true
+}
+
+// RefreshEntityRegistry rebuilds the registry from the stored entities. Entities whose entity ID collides with
+// one registered before get a suffixed entity ID, which is stored.
 func (e *Engine) RefreshEntityRegistry(ctx context.Context) error {
 	entities, err := e.EntityStore.GetAllEntities(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to refresh entity registry: %w", err)
 	}
+	devices, err := e.DeviceStore.GetAllDevices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to refresh entity registry: %w", err)
+	}
+	disabledDevices := make(map[string]struct{})
+	for _, d := range devices {
+		if !d.Enabled {
+			disabledDevices[d.ID] = struct{}{}
+		}
+	}
 
-	for _, entity := range entities {
-		e.EntityRegistry.Register(entity.ExternalID, entity.EntityID)
+	// oldest first, so entities keep their entity ID when a newer one collides with it
+	slices.SortStableFunc(entities, func(a, b models.Entity) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	registry := NewEntityRegistry()
+	var disabled []string
+	for i := range entities {
+		entity := &entities[i]
+		entityID := registry.Claim(entity.IntegrationID, entity.ExternalID, entity.EntityID)
+		_, deviceDisabled := disabledDevices[entity.DeviceID]
+		if !entity.Enabled || deviceDisabled {
+			registry.SetEnabled(entityID, false)
+			disabled = append(disabled, entityID)
+		}
+		if entityID == entity.EntityID {
+			continue
+		}
+		e.Logger.Warn("entity_id already in use, renamed entity",
+			zap.String("entity_id", entity.EntityID), zap.String("new_entity_id", entityID), zap.String("external_id", entity.ExternalID))
+		entity.EntityID = entityID
+		if err := e.EntityStore.UpdateEntity(ctx, entity); err != nil {
+			e.Logger.Error("failed to store renamed entity", zap.Error(err), zap.String("entity_id", entityID))
+		}
+	}
+	e.EntityRegistry.replace(registry)
+	e.targets.replace(entities, devices)
+
+	// disabled entities have no state
+	for _, entityID := range disabled {
+		e.removeDisabledState(entityID)
 	}
-	e.Logger.Info("refreshed entity registry", zap.Int("entity_count", len(entities)))
+	e.restoreEnabledStates()
+	e.Logger.Info("refreshed entity registry", zap.Int("entity_count", len(entities)), zap.Int("disabled_count", len(disabled)))
 	return nil
 }
+
+// replace swaps in the entries of other.
+func (r *EntityRegistry) replace(other *EntityRegistry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byExternal = other.byExternal
+	r.byEntityID = other.byEntityID
+	r.anyOwner = other.anyOwner
+}
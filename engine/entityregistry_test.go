@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEntityRegistryClaim(t *testing.T) {
+	r := NewEntityRegistry()
+
+	steps := []struct {
+		name          string
+		integrationID uint
+		externalID    string
+		entityID      string
+		want          string
+	}{
+		{"first claim", 1, "a", "light.kitchen", "light.kitchen"},
+		{"same external ID of another integration", 2, "a", "light.kitchen", "light.kitchen_2"},
+		{"third owner", 3, "b", "light.kitchen", "light.kitchen_3"},
+		{"owner claims again", 1, "a", "light.kitchen", "light.kitchen"},
+		{"suffixed owner claims again", 2, "a", "light.kitchen", "light.kitchen_2"},
+		{"owner moves to a free entity ID", 1, "a", "light.pantry", "light.pantry"},
+		{"freed entity ID", 4, "c", "light.kitchen", "light.kitchen"},
+	}
+	for _, step := range steps {
+		if got := r.Claim(step.integrationID, step.externalID, step.entityID); got != step.want {
+			t.Fatalf("%s: Claim = %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	if got, ok := r.ResolveFor(2, "a"); !ok || got != "light.kitchen_2" {
+		t.Errorf("ResolveFor(2, a) = %q, %v, want light.kitchen_2", got, ok)
+	}
+	if got, ok := r.Resolve("a"); ok {
+		t.Errorf("Resolve(a) = %q, want no result for an external ID of two integrations", got)
+	}
+	if got, ok := r.Resolve("b"); !ok || got != "light.kitchen_3" {
+		t.Errorf("Resolve(b) = %q, %v, want light.kitchen_3", got, ok)
+	}
+	if owner, ok := r.Owner("light.pantry"); !ok || owner.IntegrationID != 1 || owner.ExternalID != "a" {
+		t.Errorf("Owner(light.pantry) = %+v, %v, want integration 1, external ID a", owner, ok)
+	}
+}
+
+func TestEntityRegistryRename(t *testing.T) {
+	r := NewEntityRegistry()
+	r.Claim(1, "a", "light.kitchen")
+	r.Claim(1, "b", "light.pantry")
+	r.SetEnabled("light.kitchen", false)
+
+	if r.Rename("light.kitchen", "light.pantry") {
+		t.Fatal("renamed to an entity ID owned by another entity")
+	}
+	if !r.Rename("light.kitchen", "light.hall") {
+		t.Fatal("rename to a free entity ID failed")
+	}
+	if _, ok := r.Owner("light.kitchen"); ok {
+		t.Error("old entity ID is still registered")
+	}
+	if got, _ := r.ResolveFor(1, "a"); got != "light.hall" {
+		t.Errorf("ResolveFor(1, a) = %q, want light.hall", got)
+	}
+	if !r.Disabled("light.hall") {
+		t.Error("renamed entity lost its enabled flag")
+	}
+	if got := r.Claim(1, "c", "light.kitchen"); got != "light.kitchen" {
+		t.Errorf("Claim of the old entity ID = %q, want light.kitchen", got)
+	}
+}
+
+func TestRefreshEntityRegistryCollisions(t *testing.T) {
+	e := newTestEngine(t)
+	e.addEntities(t,
+		testEntity(1, "a", "light.kitchen", "dev-1"),
+		testEntity(2, "a", "light.kitchen", "dev-2"),
+	)
+
+	// the older entity keeps its entity ID, the newer one is renamed and stored
+	if got, _ := e.EntityRegistry.ResolveFor(1, "a"); got != "light.kitchen" {
+		t.Errorf("entity of integration 1 = %q, want light.kitchen", got)
+	}
+	if got, _ := e.EntityRegistry.ResolveFor(2, "a"); got != "light.kitchen_2" {
+		t.Errorf("entity of integration 2 = %q, want light.kitchen_2", got)
+	}
+	stored, err := e.store.GetEntityByID(context.Background(), 2, "a")
+	if err != nil {
+		t.Fatalf("GetEntityByID: %v", err)
+	}
+	if stored.EntityID != "light.kitchen_2" {
+		t.Errorf("stored entity ID = %q, want light.kitchen_2", stored.EntityID)
+	}
+
+	// a refresh keeps the entity IDs
+	if err := e.RefreshEntityRegistry(context.Background()); err != nil {
+		t.Fatalf("RefreshEntityRegistry: %v", err)
+	}
+	if got, _ := e.EntityRegistry.ResolveFor(2, "a"); got != "light.kitchen_2" {
+		t.Errorf("entity of integration 2 after refresh = %q, want light.kitchen_2", got)
+	}
+}
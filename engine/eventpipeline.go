@@ -17,6 +17,7 @@ type EventPipeline struct {
 	Aggregator   integration.EventAggregator
 	EventChannel chan types.Event
 	StateCache   types.StateStore
+	Entities     *EntityRegistry // events of disabled entities are dropped
 	Logger       *zap.Logger
 
 	rawCh chan []byte
@@ -24,7 +25,7 @@ type EventPipeline struct {
 }
 
 func (e *Engine) RunEventPipelines(ctx context.Context) {
-	for label, intg := range e.Integrations {
+	for label, intg := range e.LoadedIntegrations() {
 		go func(label string, i *integration.Instance) {
 			p := e.constructEventPipeline(label, e.StateCache, i)
 			if err := p.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
@@ -43,6 +44,7 @@ func (e *Engine) constructEventPipeline(label string, stateCache types.StateStor
 		Aggregator:   i.Aggregator,
 		EventChannel: e.EventChannel,
 		StateCache:   stateCache,
+		Entities:     e.EntityRegistry,
 		Logger:       e.Logger.With(zap.String("integration", label)),
 		rawCh:        make(chan []byte, 100), // per-integration buffer
 		done:         make(chan struct{}),
@@ -82,6 +84,10 @@ func (p *EventPipeline) Run(ctx context.Context) error {
 			}
 
 			for _, e := range events {
+				if entityID, ok := eventEntityID(e); ok && p.Entities.Disabled(entityID) {
+					p.Logger.Debug("entity is disabled, dropping event", zap.String("entity_id", entityID))
+					continue
+				}
 				// if events are passed through the aggregator publish them now
 				if aggregated := p.Aggregator.Aggregate(e); aggregated != nil {
 					p.sendEvent(*aggregated)
@@ -94,6 +100,18 @@ func (p *EventPipeline) Run(ctx context.Context) error {
 	}
 }
 
+// eventEntityID returns the entity an event is about, if any.
+func eventEntityID(event types.Event) (string, bool) {
+	switch data := event.Data.(type) {
+	case types.StateChangedData:
+		return data.EntityID, true
+	case types.TimerFinishedData:
+		return data.EntityID, true
+	default:
+		return "", false
+	}
+}
+
 // sendEvent is non-blocking; logs if the EventChannel is full
 func (p *EventPipeline) sendEvent(event types.Event) {
 	select {
@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"go.uber.org/zap"
+	"home_automation_server/sun"
+	"time"
+)
+
+// Home describes where the home is. It determines the local time used by time based triggers and the sun calculations.
+type Home struct {
+	TimeZone *time.Location
+	Location *sun.Location // nil if no coordinates are configured
+}
+
+// SetHome configures the home location and time zone. It should be called before the engine starts processing events.
+func (e *Engine) SetHome(home Home) {
+	if home.TimeZone == nil {
+		home.TimeZone = time.Local
+	}
+	e.Home = home
+	e.Scheduler.Location = home.TimeZone
+
+	fields := []zap.Field{zap.String("time_zone", home.TimeZone.String())}
+	if home.Location != nil {
+		fields = append(fields, zap.Float64("latitude", home.Location.Latitude), zap.Float64("longitude", home.Location.Longitude))
+	}
+	e.Logger.Info("home configured", fields...)
+}
+
+// now returns the current time in the home time zone.
+func (e *Engine) now() time.Time {
+	return time.Now().In(e.Home.TimeZone)
+}
@@ -21,6 +21,10 @@ type IntegrationDescriptor struct {
 	Capabilities []string               `json:"capabilities" yaml:"capabilities"`
 	ConfigSchema map[string]ConfigField `json:"config_schema" yaml:"config_schema"`
 	CreateFunc   IntegrationFactoryFunc `json:"-" yaml:"-"`
+
+	// Extension is functionality specific to the integration that is used outside of the engine, e.g. the
+	// helper definitions of the helpers integration, which the API manages. nil for most integrations.
+	Extension any `json:"-" yaml:"-"`
 }
 
 // IntegrationFactoryFunc creates an initialized IntegrationInstance from a config.
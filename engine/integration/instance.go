@@ -13,6 +13,14 @@ type Instance struct {
 	Aggregator  EventAggregator
 	Discovery   DiscoveryClient
 	Services    map[string]integrations.ServiceSpec // key = "domain.service"
+
+	// ReproduceState maps captured entity states to service calls when a scene is applied, nil if the integration
+	// has no state to restore.
+	ReproduceState integrations.ReproduceStateFunc
+
+	// PublishStates publishes the current states of the entities with the external IDs, or of all its entities if
+	// none are given, e.g. of entities that were enabled again. nil if the integration cannot.
+	PublishStates func(externalIDs ...string)
 }
 
 func IntegrationLogger(base *zap.Logger, name string) *zap.Logger {
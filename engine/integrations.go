@@ -11,6 +11,8 @@ import (
 	"home_automation_server/storage"
 	"home_automation_server/storage/models"
 	"home_automation_server/types"
+	"maps"
+	"strings"
 	"time"
 )
 
@@ -53,7 +55,7 @@ func (e *Engine) LoadIntegration(ctx context.Context, integrationName string) er
 		return fmt.Errorf("integration %s not available", integrationName)
 	}
 
-	integrationInstance, err := desc.CreateFunc(ctx, cfg.UserConfig, e.StateCache, e.EntityRegistry, e.Logger.Named(integrationName))
+	integrationInstance, err := desc.CreateFunc(ctx, cfg.UserConfig, e.StateCache, e.EntityRegistry.ForIntegration(cfg.ID), e.Logger.Named(integrationName))
 	if err != nil {
 		return fmt.Errorf("failed to create integration instance: %w", err)
 	}
@@ -83,9 +85,13 @@ func (e *Engine) LoadIntegration(ctx context.Context, integrationName string) er
 
 	// todo: add devices and integration to stateStore
 
-	// Register services
+	// Register services, under the integration's name unless the key has its own domain, e.g. "counter.increment"
 	for serviceName, data := range integrationInstance.Services {
-		e.RegisterService(integrationInstance.Descriptor.Name, serviceName, data)
+		domain := integrationInstance.Descriptor.Name
+		if d, service, ok := strings.Cut(serviceName, "."); ok {
+			domain, serviceName = d, service
+		}
+		e.RegisterService(domain, serviceName, data)
 	}
 
 	// Start event pipeline
@@ -96,13 +102,79 @@ func (e *Engine) LoadIntegration(ctx context.Context, integrationName string) er
 		}
 	}(integrationName, &integrationInstance)
 
+	e.integrationsMu.Lock()
 	e.Integrations[integrationName] = integrationInstance
+	e.integrationsMu.Unlock()
 	e.Logger.Info("integration loaded", zap.String("display_name", integrationInstance.Descriptor.DisplayName))
+
+	// automations loaded before the integration may use its services
+	e.RevalidateAutomations()
 	return nil
 }
 
+// EnableIntegration adds a config without user config for the integration if it has none, so LoadIntegration
+// loads it like any other integration, e.g. for built-in integrations. The descriptor must be registered first.
+func (e *Engine) EnableIntegration(ctx context.Context, integrationName string) error {
+	_, err := e.IntegrationCfgStore.LoadByIntegrationName(ctx, integrationName)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to load %s integration config: %w", integrationName, err)
+	}
+	return e.AddIntegration(ctx, integrationName, map[string]any{})
+}
+
+// PublishStates asks the integration to publish the current states of the entities with the external IDs, or
+// of all its entities if none are given. Integrations that cannot are skipped.
+func (e *Engine) PublishStates(integrationName string, externalIDs ...string) {
+	if integration, ok := e.Integration(integrationName); ok && integration.PublishStates != nil {
+		integration.PublishStates(externalIDs...)
+	}
+}
+
+// RemoveEntityState removes the state of an entity whose external ID was removed from the integration. Its
+// entity is kept, the next discovery marks it unavailable.
+func (e *Engine) RemoveEntityState(integrationName, externalID string) {
+	integration, ok := e.Integration(integrationName)
+	if !ok {
+		return
+	}
+	if entityID, ok := e.EntityRegistry.ResolveFor(integration.ConfigID, externalID); ok {
+		e.StateCache.Delete(entityID)
+		e.disabledStates.delete(entityID)
+	}
+}
+
+// Integration returns the loaded integration with the name.
+func (e *Engine) Integration(name string) (integration.Instance, bool) {
+	e.integrationsMu.RLock()
+	defer e.integrationsMu.RUnlock()
+	i, ok := e.Integrations[name]
+	return i, ok
+}
+
+// LoadedIntegrations returns a copy of the loaded integrations by name.
+func (e *Engine) LoadedIntegrations() map[string]integration.Instance {
+	e.integrationsMu.RLock()
+	defer e.integrationsMu.RUnlock()
+	return maps.Clone(e.Integrations)
+}
+
+// integrationByConfigID returns the loaded integration of the integration config.
+func (e *Engine) integrationByConfigID(configID uint) (integration.Instance, bool) {
+	e.integrationsMu.RLock()
+	defer e.integrationsMu.RUnlock()
+	for _, i := range e.Integrations {
+		if i.ConfigID == configID {
+			return i, true
+		}
+	}
+	return integration.Instance{}, false
+}
+
 func (e *Engine) DiscoverDevicesForIntegration(ctx context.Context, integrationName string) error {
-	integration, ok := e.Integrations[integrationName]
+	integration, ok := e.Integration(integrationName)
 	if !ok {
 		return fmt.Errorf("integration %s not active", integrationName)
 	}
@@ -129,14 +201,28 @@ func (e *Engine) DiscoverDevicesForIntegration(ctx context.Context, integrationN
 			e.Logger.Error("failed to convert device", zap.Error(err))
 			continue
 		}
+		if d.Area != "" {
+			if storageDevice.AreaID, err = e.ensureArea(ctx, d.Area); err != nil {
+				e.Logger.Warn("failed to import area", zap.Error(err), zap.String("area", d.Area))
+			}
+		}
 		if err := e.addOrUpdateDevicePreserveEnabled(ctx, &storageDevice); err != nil {
 			return fmt.Errorf("failed to save device %s: %w", d.Name, err)
 		}
 	}
 
-	// Add/update entities
+	// Add/update entities, known entities keep their entity ID, which may have been renamed, new entities whose
+	// entity ID is already used by other entities get a suffix
 	for _, ent := range entities {
 		ent.Available = true
+		ent.IntegrationID = integration.ConfigID
+		if entityID, ok := e.EntityRegistry.ResolveFor(integration.ConfigID, ent.ExternalID); ok {
+			ent.EntityID = entityID
+		}
+		if entityID := e.EntityRegistry.Claim(integration.ConfigID, ent.ExternalID, ent.EntityID); entityID != ent.EntityID {
+			e.Logger.Warn("entity_id already in use, renamed entity", zap.String("entity_id", ent.EntityID), zap.String("new_entity_id", entityID))
+			ent.EntityID = entityID
+		}
 		discoveredEntityIDs[ent.ExternalID] = struct{}{}
 		if err := e.addOrUpdateEntityPreserveEnabled(ctx, &ent); err != nil {
 			return fmt.Errorf("failed to save entity %s: %w", ent.Name, err)
@@ -151,6 +237,7 @@ func (e *Engine) DiscoverDevicesForIntegration(ctx context.Context, integrationN
 	if err := e.RefreshEntityRegistry(ctx); err != nil {
 		e.Logger.Error("failed to refresh entity registry", zap.Error(err))
 	}
+	e.RevalidateAutomations()
 	e.Logger.Info("successfully ran discovery for integration", zap.String("integration_name", integrationName))
 
 	return nil
@@ -169,8 +256,12 @@ func (e *Engine) addOrUpdateDevicePreserveEnabled(ctx context.Context, d *models
 			e.Logger.Error("failed to query device", zap.Error(err))
 		}
 	} else {
-		// Existing device: preserve enacbled flag
+		// Existing device: preserve enacbled flag and the area it was assigned to, the area suggested by the
+		// integration only applies to devices without one
 		d.Enabled = existing.Enabled
+		if existing.AreaID != "" {
+			d.AreaID = existing.AreaID
+		}
 		d.CreatedAt = existing.CreatedAt
 		if err := e.DeviceStore.UpdateDevice(ctx, d); err != nil {
 			e.Logger.Error("failed to update device", zap.Error(err))
@@ -185,7 +276,7 @@ func (e *Engine) addOrUpdateEntityPreserveEnabled(ctx context.Context, entity *t
 	if err != nil {
 		return fmt.Errorf("failed to convert entity to storage: %w", err)
 	}
-	existing, err := e.EntityStore.GetEntityByID(ctx, storageEntity.ExternalID)
+	existing, err := e.EntityStore.GetEntityByID(ctx, storageEntity.IntegrationID, storageEntity.ExternalID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			e.Logger.Info("adding new entity", zap.String("entity", entity.Name))
@@ -197,9 +288,15 @@ func (e *Engine) addOrUpdateEntityPreserveEnabled(ctx context.Context, entity *t
 			e.Logger.Error("failed to query entity", zap.Error(err))
 		}
 	} else {
-		// Existing entity: preserve enabled flag
+		// Existing entity: preserve enabled flag, area, labels and the name and icon set by the user
 		entity.Enabled = existing.Enabled
 		entity.CreatedAt = existing.CreatedAt
+		storageEntity.Enabled = existing.Enabled
+		storageEntity.CreatedAt = existing.CreatedAt
+		storageEntity.AreaID = existing.AreaID
+		storageEntity.Labels = existing.Labels
+		storageEntity.FriendlyName = existing.FriendlyName
+		storageEntity.Icon = existing.Icon
 		if err := e.EntityStore.UpdateEntity(ctx, &storageEntity); err != nil {
 			e.Logger.Error("failed to update device", zap.Error(err))
 		}
@@ -209,7 +306,7 @@ func (e *Engine) addOrUpdateEntityPreserveEnabled(ctx context.Context, entity *t
 }
 
 func (e *Engine) markUnavailable(ctx context.Context, integrationName string, discoveredDevices map[string]struct{}, discoveredEntities map[string]struct{}) error {
-	integration, ok := e.Integrations[integrationName]
+	integration, ok := e.Integration(integrationName)
 	if !ok {
 		return fmt.Errorf("integration %s not active", integrationName)
 	}
@@ -264,7 +361,8 @@ func (e *Engine) markUnavailable(ctx context.Context, integrationName string, di
 }
 
 func (e *Engine) markUnavailableEntities(ctx context.Context, integrationName string, discovered map[string]struct{}) {
-	allDevices, err := e.DeviceStore.GetDevicesByIntegration(ctx, e.Integrations[integrationName].ConfigID)
+	integration, _ := e.Integration(integrationName)
+	allDevices, err := e.DeviceStore.GetDevicesByIntegration(ctx, integration.ConfigID)
 	if err != nil {
 		e.Logger.Warn("failed to load devices for unavailable check", zap.Error(err))
 	}
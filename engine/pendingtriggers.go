@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/types"
+	"home_automation_server/utils"
+	"sync"
+	"time"
+)
+
+// pendingTrigger is a state trigger with a "for" duration that matched and now waits for the state to hold.
+type pendingTrigger struct {
+	automationID uint64
+	trigger      automation.StateTrigger
+	value        any         // the watched value when the trigger matched
+	event        types.Event // the event that armed the trigger, passed on to the automation when it fires
+	timer        *time.Timer
+}
+
+// pendingTriggers holds armed "for" timers. They are keyed by automation ID and trigger definition,
+// so a timer keeps running across automation reloads as long as the trigger is unchanged.
+type pendingTriggers struct {
+	mu      sync.Mutex
+	pending map[string]*pendingTrigger
+	stopped bool // set on shutdown, no triggers are armed afterwards
+
+	// fired receives the triggers whose timer expired. The event loop fires them, so they are evaluated in
+	// order with the events and never run concurrently with the event loop.
+	fired chan firedTrigger
+}
+
+// firedTrigger is a pending trigger whose timer expired.
+type firedTrigger struct {
+	key     string
+	trigger *pendingTrigger
+}
+
+func newPendingTriggers() *pendingTriggers {
+	return &pendingTriggers{
+		pending: make(map[string]*pendingTrigger),
+		fired:   make(chan firedTrigger, 16),
+	}
+}
+
+// armTrigger starts the "for" timer of a matched state trigger, replacing a timer that is already running.
+func (e *Engine) armTrigger(ctx context.Context, a *automation.Automation, baseTrigger automation.BaseTrigger, trigger automation.StateTrigger, event types.Event) error {
+	key, err := triggerKey(a.Id, baseTrigger)
+	if err != nil {
+		return err
+	}
+	data, ok := event.Data.(types.StateChangedData)
+	if !ok {
+		return fmt.Errorf("state trigger armed by %s event", event.Type)
+	}
+
+	p := &pendingTrigger{
+		automationID: a.Id,
+		trigger:      trigger,
+		value:        trigger.WatchedValue(data.NewState),
+		event:        event,
+	}
+
+	e.pendingTriggers.mu.Lock()
+	defer e.pendingTriggers.mu.Unlock()
+	if e.pendingTriggers.stopped {
+		return nil
+	}
+	if existing, ok := e.pendingTriggers.pending[key]; ok {
+		existing.timer.Stop()
+	}
+	p.timer = time.AfterFunc(trigger.HoldDuration(), func() {
+		select {
+		case e.pendingTriggers.fired <- firedTrigger{key: key, trigger: p}:
+		case <-ctx.Done():
+		}
+	})
+	e.pendingTriggers.pending[key] = p
+
+	e.Logger.Debug("armed state trigger", zap.Uint64("automation_id", a.Id), zap.String("entity_id", trigger.EntityID), zap.Duration("for", trigger.HoldDuration()))
+	return nil
+}
+
+// cancelBrokenTriggers stops the timers of pending triggers whose entity left the matched state.
+func (e *Engine) cancelBrokenTriggers(event types.Event) {
+	data, ok := event.Data.(types.StateChangedData)
+	if !ok {
+		return
+	}
+
+	e.pendingTriggers.mu.Lock()
+	defer e.pendingTriggers.mu.Unlock()
+	for key, p := range e.pendingTriggers.pending {
+		if p.trigger.EntityID != data.EntityID {
+			continue
+		}
+		if !utils.AnyEqual(p.trigger.WatchedValue(data.NewState), p.value) {
+			p.timer.Stop()
+			delete(e.pendingTriggers.pending, key)
+			e.Logger.Debug("cancelled pending state trigger", zap.Uint64("automation_id", p.automationID), zap.String("entity_id", data.EntityID))
+		}
+	}
+}
+
+// prunePendingTriggers stops the timers of triggers that no longer exist in the loaded automations.
+func (e *Engine) prunePendingTriggers(valid map[string]struct{}) {
+	e.pendingTriggers.mu.Lock()
+	defer e.pendingTriggers.mu.Unlock()
+	for key, p := range e.pendingTriggers.pending {
+		if _, ok := valid[key]; !ok {
+			p.timer.Stop()
+			delete(e.pendingTriggers.pending, key)
+		}
+	}
+}
+
+// stopPendingTriggers stops the timers of all pending triggers and arming new ones.
+func (e *Engine) stopPendingTriggers() {
+	e.pendingTriggers.mu.Lock()
+	defer e.pendingTriggers.mu.Unlock()
+	e.pendingTriggers.stopped = true
+	for key, p := range e.pendingTriggers.pending {
+		p.timer.Stop()
+		delete(e.pendingTriggers.pending, key)
+	}
+}
+
+// firePendingTrigger runs the automation of a trigger whose timer expired. It is called from the event loop.
+func (e *Engine) firePendingTrigger(ctx context.Context, key string, p *pendingTrigger) {
+	e.pendingTriggers.mu.Lock()
+	if e.pendingTriggers.pending[key] != p {
+		e.pendingTriggers.mu.Unlock()
+		return // cancelled or re-armed in the meantime
+	}
+	delete(e.pendingTriggers.pending, key)
+	e.pendingTriggers.mu.Unlock()
+
+	// guard against state changes that raced with the timer
+	current, ok := e.StateCache.Get(p.trigger.EntityID)
+	if !ok || !utils.AnyEqual(p.trigger.WatchedValue(&current), p.value) {
+		return
+	}
+
+	a, ok := e.automationByID(p.automationID)
+	if !ok || !a.Enabled {
+		return
+	}
+
+	e.Logger.Info("state held for trigger duration", zap.Uint64("automation_id", a.Id), zap.String("entity_id", p.trigger.EntityID), zap.Duration("for", p.trigger.HoldDuration()))
+	vars := triggerVariables(p.trigger, p.event)
+	vars["for"] = p.trigger.HoldDuration().Seconds()
+	env := e.newEnv()
+	env.Vars = map[string]any{"trigger": vars}
+	trace := automation.NewTrace(uuid.NewString(), a, &p.event)
+	trace.Triggers = []automation.TraceEvaluation{{Type: string(p.trigger.Type()), Result: true}}
+	e.runAutomation(ctx, a, p.event, env, trace)
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// holdAutomation returns an automation that calls test.block once light.kitchen was on for the duration.
+func holdAutomation(alias, duration string) string {
+	return fmt.Sprintf(`{
+		"alias": %q, "active": true,
+		"trigger": [{"type": "state", "data": {"entity_id": "light.kitchen", "to": "on", "for": %q}}],
+		"action": [{"service": "test.block", "blocking": true}]
+	}`, alias, duration)
+}
+
+// nextFired waits for the timer of a pending trigger to expire and returns the trigger, as the event loop
+// receives it.
+func nextFired(t *testing.T, e *testEngine) firedTrigger {
+	t.Helper()
+	select {
+	case fired := <-e.pendingTriggers.fired:
+		return fired
+	case <-time.After(waitTimeout):
+		t.Fatal("pending trigger did not fire")
+		return firedTrigger{}
+	}
+}
+
+// expectNotFired fails the test if the timer of a pending trigger expires within quietPeriod.
+func expectNotFired(t *testing.T, e *testEngine) {
+	t.Helper()
+	select {
+	case <-e.pendingTriggers.fired:
+		t.Fatal("pending trigger fired unexpectedly")
+	case <-time.After(quietPeriod):
+	}
+}
+
+func TestForTriggers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fires once the state held", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		e.createAutomation(t, holdAutomation("hold", "20ms"))
+
+		e.setState("light.kitchen", "on")
+		svc.expectNoCall(t) // only the event loop runs the automation
+		fired := nextFired(t, e)
+		e.firePendingTrigger(ctx, fired.key, fired.trigger)
+		svc.expectCall(t)
+		svc.releaseOne(t)
+		if n := pendingCount(e); n != 0 {
+			t.Errorf("%d triggers still armed after firing", n)
+		}
+	})
+
+	t.Run("cancelled when the state changes", func(t *testing.T) {
+		e := newTestEngine(t)
+		newBlockingService(e, "test", "block")
+		e.createAutomation(t, holdAutomation("hold", "20ms"))
+
+		e.setState("light.kitchen", "on")
+		e.setState("light.kitchen", "off")
+		if n := pendingCount(e); n != 0 {
+			t.Fatalf("%d triggers still armed after the state changed", n)
+		}
+		expectNotFired(t, e)
+	})
+
+	t.Run("cancelled after the timer expired", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		e.createAutomation(t, holdAutomation("hold", "20ms"))
+
+		// the state changes after the timer expired, before the event loop fires the trigger
+		e.setState("light.kitchen", "on")
+		fired := nextFired(t, e)
+		e.setState("light.kitchen", "off")
+		e.firePendingTrigger(ctx, fired.key, fired.trigger)
+		svc.expectNoCall(t)
+	})
+
+	t.Run("cancelled when the trigger changes", func(t *testing.T) {
+		e := newTestEngine(t)
+		newBlockingService(e, "test", "block")
+		id := e.createAutomation(t, holdAutomation("hold", "1h"))
+
+		e.setState("light.kitchen", "on")
+		e.updateAutomation(t, id, holdAutomation("renamed", "1h"))
+		if n := pendingCount(e); n != 1 {
+			t.Fatalf("%d triggers armed after an unrelated change, want 1", n)
+		}
+		e.updateAutomation(t, id, holdAutomation("renamed", "2h"))
+		if n := pendingCount(e); n != 0 {
+			t.Fatalf("%d triggers still armed after the trigger changed", n)
+		}
+	})
+
+	t.Run("not armed for disabled automations", func(t *testing.T) {
+		e := newTestEngine(t)
+		newBlockingService(e, "test", "block")
+		id := e.createAutomation(t, holdAutomation("hold", "1h"))
+
+		e.setState("light.kitchen", "on")
+		e.updateAutomation(t, id, `{
+			"alias": "hold", "active": false,
+			"trigger": [{"type": "state", "data": {"entity_id": "light.kitchen", "to": "on", "for": "1h"}}],
+			"action": [{"service": "test.block", "blocking": true}]
+		}`)
+		if n := pendingCount(e); n != 0 {
+			t.Fatalf("%d triggers still armed after the automation was disabled", n)
+		}
+		e.setState("light.kitchen", "off")
+		e.setState("light.kitchen", "on")
+		if n := pendingCount(e); n != 0 {
+			t.Fatalf("%d triggers armed for a disabled automation", n)
+		}
+	})
+}
@@ -4,34 +4,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"home_automation_server/automation"
 	"home_automation_server/storage"
 	"home_automation_server/types"
-	"regexp"
 	"strings"
 	"time"
 )
 
+// AutomationTask is a queued run of an automation. The run is cancelled through ctx when the automation
+// is reloaded, changed or disabled.
 type AutomationTask struct {
-	Actions []*automation.Action
-	Event   *types.Event
+	Automation *automation.Automation
+	Event      *types.Event
+	Vars       map[string]any // variables available to templates in the actions, e.g. the trigger
+	Trace      *automation.Trace
+	ctx        context.Context
+	run        *automationRun
 }
 
-type TemplateRef struct {
-	FullMatch string // the full template text, e.g. "{{ state_attr('light.living_room', 'brightness') }}"
-	EntityID  string
-	Attribute string
-	FuncName  string // "state" or "state_attr"
-}
-
-var (
-	reState     = regexp.MustCompile(`{{\s*state\(['"]([^'"]+)['"]\)\s*}}`)
-	reStateAttr = regexp.MustCompile(`{{\s*state_attr\(['"]([^'"]+)['"]\s*,\s*['"]([^'"]+)['"]\)\s*}}`)
-)
-
 func (e *Engine) ProcessEvents(ctx context.Context) {
+	go e.Scheduler.Run(ctx)
+
 	go func() {
+		e.updateSunEntity(ctx, e.now())
 		for {
 			select {
 			case <-ctx.Done():
@@ -39,6 +36,8 @@ func (e *Engine) ProcessEvents(ctx context.Context) {
 				return
 			case event := <-e.EventChannel:
 				e.processEvent(ctx, event)
+			case fired := <-e.pendingTriggers.fired:
+				e.firePendingTrigger(ctx, fired.key, fired.trigger)
 			}
 		}
 	}()
@@ -46,44 +45,87 @@ func (e *Engine) ProcessEvents(ctx context.Context) {
 
 func (e *Engine) processEvent(ctx context.Context, event types.Event) {
 	e.Logger.Debug("processing event", zap.Any("event", event))
+	// disabled entities have no state and their events are not broadcast, the pipelines drop most of them
+	// already, this also catches those sent while an entity was being disabled
+	if entityID, ok := eventEntityID(event); ok && e.EntityRegistry.Disabled(entityID) {
+		e.Logger.Debug("entity is disabled, dropping event", zap.String("entity_id", entityID))
+		return
+	}
+	e.causality.attribute(&event)
 	e.updateStateCache(event)
 
-	for _, a := range e.Automations.Automations {
+	if event.Type == types.EventTimeChanged {
+		e.updateSunEntity(ctx, e.now())
+	}
+
+	e.cancelBrokenTriggers(event)
+
+	env := e.newEnv()
+	set := e.Automations()
+	automations := set.Automations
+	for i := range automations {
+		a := &automations[i]
 		if !a.Enabled {
 			continue
 		}
+		if _, invalid := set.Issues[a.Id]; invalid {
+			continue // logged by automationIssues, it runs again once it is valid
+		}
 
-		triggerFired := false
-		for _, baseTrigger := range a.Trigger {
+		var firedTrigger automation.Trigger
+		var evaluations []automation.TraceEvaluation // recorded in the trace if a trigger fires
+		for i, baseTrigger := range a.Trigger {
 			trigger, err := baseTrigger.AsTrigger()
 			if err != nil {
-				e.Logger.Error("failed to convert baseTrigger to trigger", zap.Error(err))
-				return
+				e.Logger.Error("failed to convert baseTrigger to trigger", zap.Error(err), zap.Uint64("automation_id", a.Id))
+				evaluations = append(evaluations, automation.TraceEvaluation{Index: i, Type: string(baseTrigger.Type), Error: err.Error()})
+				continue
+			}
+			env.TriggerKey, err = triggerKey(a.Id, baseTrigger)
+			if err != nil {
+				e.Logger.Error("failed to build trigger key", zap.Error(err), zap.Uint64("automation_id", a.Id))
+				continue
 			}
-			fired, err := trigger.Evaluate(event)
+			fired, err := trigger.Evaluate(event, env)
 			if err != nil {
-				e.Logger.Error("trigger evaluation failed", zap.Error(err), zap.Uint("automation_id", a.Id))
+				e.Logger.Error("trigger evaluation failed", zap.Error(err), zap.Uint64("automation_id", a.Id))
+				evaluations = append(evaluations, automation.TraceEvaluation{Index: i, Type: string(trigger.Type()), Error: err.Error()})
+				continue
+			}
+			if !fired {
+				evaluations = append(evaluations, automation.TraceEvaluation{Index: i, Type: string(trigger.Type())})
 				continue
 			}
 
-			if fired {
-				triggerFired = true
-				break // if any trigger fires, the automation should run
+			// state triggers with a "for" duration fire later, once the state has held.
+			if st, ok := trigger.(automation.StateTrigger); ok && st.HoldDuration() > 0 {
+				if err := e.armTrigger(ctx, a, baseTrigger, st, event); err != nil {
+					e.Logger.Error("failed to arm state trigger", zap.Error(err), zap.Uint64("automation_id", a.Id))
+				}
+				continue
 			}
+
+			evaluations = append(evaluations, automation.TraceEvaluation{Index: i, Type: string(trigger.Type()), Result: true})
+			firedTrigger = trigger
+			break // if any trigger fires, the automation should run
 		}
 
-		if !triggerFired {
+		if firedTrigger == nil {
 			continue // skip this automation
 		}
 
-		if err := e.queueAutomationTask(&a, &event); err != nil {
-			e.Logger.Error("failed to enqueue automation task", zap.Error(err))
-		}
+		env.Vars = map[string]any{"trigger": triggerVariables(firedTrigger, event)}
+		trace := automation.NewTrace(uuid.NewString(), a, &event)
+		trace.Triggers = evaluations
+		e.runAutomation(ctx, a, event, env, trace)
+	}
 
-		if err := e.AutomationStore.UpdateLastTriggered(ctx, a.Id); err != nil {
-			e.Logger.Error("failed to update last triggered", zap.Error(err))
-		}
+	// time_changed events only drive time based triggers, they are not persisted or broadcast.
+	if event.Type == types.EventTimeChanged {
+		e.timeEvents.Publish(event)
+		return
 	}
+
 	storageEvent, err := storage.EventToStorage(event)
 	if err != nil {
 		e.Logger.Error("failed to convert event to storage model", zap.Error(err))
@@ -96,50 +138,80 @@ func (e *Engine) processEvent(ctx context.Context, event types.Event) {
 	e.ProcessedEventBus.Publish(event) // will be received by the ws-manager for real time updates in the UI.
 }
 
+// runAutomation checks the conditions of an automation whose trigger fired and queues its actions.
+// The variables of env, e.g. the trigger, are passed on to the run.
+func (e *Engine) runAutomation(ctx context.Context, a *automation.Automation, event types.Event, env *automation.Env, trace *automation.Trace) {
+	if err := e.checkLoop(a, &event); err != nil {
+		trace.Finish(automation.TraceResultFailed, err)
+		e.saveTrace(trace)
+		e.disableRunawayAutomation(ctx, a, err)
+		return
+	}
+
+	if !e.conditionsPass(a, env, trace) {
+		trace.Finish(automation.TraceResultConditionsNotMet, nil)
+		e.saveTrace(trace)
+		return
+	}
+
+	started, err := e.queueAutomationTask(ctx, a, &event, env.Vars, trace)
+	if err != nil {
+		e.Logger.Error("failed to enqueue automation task", zap.Error(err))
+	}
+
+	if !started {
+		return // dropped by the run mode or a full queue, the automation did not run
+	}
+	if a.File != "" {
+		return // not stored in the database
+	}
+	if err := e.AutomationStore.UpdateLastTriggered(ctx, a.Id); err != nil {
+		e.Logger.Error("failed to update last triggered", zap.Error(err))
+	}
+}
+
 func (e *Engine) executeAutomationTask(task *AutomationTask) {
-	for _, action := range task.Actions {
-		if action.Blocking {
-			ctx := context.Background()
-			if e.ActionTimeout > 0 {
-				var cancel context.CancelFunc
-				ctx, cancel = context.WithTimeout(ctx, e.ActionTimeout)
-				defer cancel()
-			}
-			// Wait for completion
-			if err := e.executeActionWithRetry(ctx, action); err != nil {
-				if errors.Is(err, context.DeadlineExceeded) {
-					e.Logger.Warn("Actions timed out", zap.String("service", action.Service))
-				} else {
-					e.Logger.Error("Failed blocking action", zap.String("service", action.Service), zap.Error(err))
-				}
-				break // stop further actions in this rule
-			}
-		} else {
-			// fire-and-forget
-			go func(action *automation.Action) {
-				// each goroutine gets its own cancel
-				ctx := context.Background()
-				if e.ActionTimeout > 0 {
-					var cancel context.CancelFunc
-					ctx, cancel = context.WithTimeout(ctx, e.ActionTimeout)
-					defer cancel()
-				}
+	a := task.Automation
+	if task.ctx.Err() != nil {
+		e.Logger.Info("skipping cancelled automation run", zap.Uint64("automation_id", a.Id))
+		e.finishRun(task.run)
+		e.finishTrace(task.Trace, task.ctx.Err())
+		return
+	}
 
-				if err := e.executeActionWithRetry(ctx, action); err != nil {
-					e.Logger.Error("Failed non-blocking action", zap.String("service", action.Service), zap.Error(err))
-				}
-			}(action)
-		}
+	runCtx := withCallerContext(task.ctx, task.Trace.Context)
+	err := e.runSequence(runCtx, &sequenceRun{vars: task.Vars, trace: task.Trace}, a.Actions, "action")
+	e.finishRun(task.run)
+
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		e.Logger.Info("automation run cancelled", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias))
+	case errors.Is(err, errSequenceStopped):
+		e.Logger.Info("automation run stopped", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias))
+	default:
+		e.Logger.Error("automation run failed", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias), zap.Error(err))
 	}
+	e.finishTrace(task.Trace, err)
 }
 
-func (e *Engine) executeActionWithRetry(ctx context.Context, action *automation.Action) error {
+// executeActionWithRetry calls the service of the action, retrying failed attempts according to the RetryPolicy.
+// Failed attempts are recorded in step of the trace, if one is given.
+func (e *Engine) executeActionWithRetry(ctx context.Context, action *automation.Action, trace *automation.Trace, step *automation.TraceStep) error {
+	maxAttempts := e.RetryPolicy.MaxAttempts
+	if isScriptCall(action) || isSceneCall(action) {
+		maxAttempts = 1 // a failed script is not run again from the start, scenes retry each of their entities
+	}
+
 	var err error
-	for attempt := 1; attempt <= e.RetryPolicy.MaxAttempts; attempt++ {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		err = e.executeAction(ctx, action)
 		if err == nil {
 			return nil
 		}
+		if trace != nil {
+			trace.AddAttempt(step, attempt, err)
+		}
 
 		if ctx.Err() != nil {
 			return ctx.Err()
@@ -153,7 +225,7 @@ func (e *Engine) executeActionWithRetry(ctx context.Context, action *automation.
 
 		time.Sleep(e.RetryPolicy.Backoff)
 	}
-	return fmt.Errorf("action failed after %d attempts: %w", e.RetryPolicy.MaxAttempts, err)
+	return fmt.Errorf("action failed after %d attempts: %w", maxAttempts, err)
 }
 
 func (e *Engine) executeAction(ctx context.Context, a *automation.Action) error {
@@ -173,37 +245,35 @@ func (e *Engine) executeAction(ctx context.Context, a *automation.Action) error
 	return nil
 }
 
-func (e *Engine) queueAutomationTask(a *automation.Automation, event *types.Event) error {
+// queueAutomationTask starts a run of the automation according to its run mode. Params and targets are
+// resolved when each step executes, so they see the state at that point of the sequence. started is false if
+// the run was dropped.
+func (e *Engine) queueAutomationTask(ctx context.Context, a *automation.Automation, event *types.Event, vars map[string]any, trace *automation.Trace) (started bool, err error) {
 	e.Logger.Info("queueing automation task", zap.String("automation", a.Alias))
+	e.causality.link(ContextLink{ContextID: trace.Context.ID, ParentID: trace.Context.ParentID, AutomationID: a.Id})
 
+	runCtx, cancel := context.WithCancel(ctx)
 	task := &AutomationTask{
-		Event:   event,
-		Actions: make([]*automation.Action, len(a.Actions)),
+		Automation: a,
+		Event:      event,
+		Vars:       vars,
+		Trace:      trace,
+		ctx:        runCtx,
 	}
-
-	for i, action := range a.Actions {
-		resolved, err := e.ResolveActionParams(&action)
-		if err != nil {
-			return fmt.Errorf("failed to resolve action params: %w", err)
-		}
-		action.Params = resolved
-
-		resolvedTargets, err := e.ResolveTargetsToExternalID(action.Targets)
-		if err != nil {
-			return err
-		}
-		action.Targets = resolvedTargets
-
-		task.Actions[i] = &action
+	started, err = e.startRun(a, task, cancel)
+	if !started {
+		trace.Finish(automation.TraceResultDropped, err)
+		e.saveTrace(trace)
 	}
-
-	e.AutomationTaskQueue <- task
-	return nil
+	return started, err
 }
 
 func (e *Engine) ResolveTargetsToExternalID(targets []automation.Target) ([]automation.Target, error) {
 	resolved := make([]automation.Target, len(targets))
 	for i, t := range targets {
+		if e.EntityRegistry.Disabled(t.EntityID) {
+			return nil, fmt.Errorf("%w: %s", ErrEntityDisabled, t.EntityID)
+		}
 		externalID, ok := e.EntityRegistry.ResolveExternalID(t.EntityID)
 		if !ok {
 			return nil, fmt.Errorf("failed to resolve externalID for entity %s", t.EntityID)
@@ -221,89 +291,3 @@ func (e *Engine) updateStateCache(event types.Event) {
 	}
 	e.StateCache.Set(data.EntityID, *data.NewState)
 }
-
-func (e *Engine) ResolveActionParams(action *automation.Action) (map[string]any, error) {
-	resolved := make(map[string]any, len(action.Params))
-
-	for name, val := range action.Params {
-		// If value is not a string, leave it as-is
-		str, ok := val.(string)
-		if !ok {
-			resolved[name] = val
-			continue
-		}
-
-		if strings.Contains(str, "{{") {
-			ref := ParseTemplateRef(str)
-			resolvedVal, err := e.ResolveTemplateRef(ref)
-			if err != nil {
-				return nil, fmt.Errorf("failed to resolve templateRef '%s': %w", name, err)
-			}
-			resolved[name] = resolvedVal
-			continue
-		}
-
-		// If not templated just keep the original string
-		resolved[name] = str
-	}
-
-	return resolved, nil
-}
-
-func ParseTemplateRef(tmpl string) TemplateRef {
-	// state_attr matches
-	for _, match := range reStateAttr.FindAllStringSubmatchIndex(tmpl, -1) {
-		full := tmpl[match[0]:match[1]]
-		entity := tmpl[match[2]:match[3]]
-		attr := tmpl[match[4]:match[5]]
-
-		return TemplateRef{
-			FullMatch: full,
-			EntityID:  entity,
-			Attribute: attr,
-			FuncName:  "state_attr",
-		}
-	}
-
-	// state() matches
-	for _, match := range reState.FindAllStringSubmatchIndex(tmpl, -1) {
-		full := tmpl[match[0]:match[1]]
-		entity := tmpl[match[2]:match[3]]
-
-		return TemplateRef{
-			FullMatch: full,
-			EntityID:  entity,
-			Attribute: "",
-			FuncName:  "state",
-		}
-	}
-
-	return TemplateRef{}
-}
-
-func (e *Engine) ResolveTemplateRef(ref TemplateRef) (any, error) {
-	st, ok := e.StateCache.Get(ref.EntityID)
-	if !ok {
-		return nil, fmt.Errorf("failed to get state for entity_id: %s", ref.EntityID)
-	}
-
-	if ref.FuncName == "state_attr" {
-		if ref.Attribute == "" {
-			return nil, fmt.Errorf("no attribute in 'state_attr' template ref")
-		}
-		attr, ok := st.Attributes[ref.Attribute]
-		if !ok {
-			return nil, fmt.Errorf("state does not contain the attribute: %s", ref.Attribute)
-		}
-		return attr, nil
-	}
-	if ref.FuncName == "state" {
-		state := st.State
-		if state == nil {
-			return nil, fmt.Errorf("main_state for entity: %s is nil", ref.EntityID)
-		}
-		return state, nil
-	}
-
-	return nil, fmt.Errorf("unknown template function: %s", ref.FuncName)
-}
@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"sync"
+)
+
+// automationRun is a queued or executing run of an automation.
+type automationRun struct {
+	automationID uint64
+	fingerprint  string // the automation definition the run was started with
+	cancel       context.CancelFunc
+	task         *AutomationTask
+	dispatched   bool // handed to the workers
+}
+
+// runTracker keeps track of the active runs per automation, in the order they were started.
+// It is used to enforce the run mode of an automation and to cancel runs when their automation changes.
+type runTracker struct {
+	mu       sync.Mutex
+	runs     map[uint64][]*automationRun
+	closed   bool           // set on shutdown, no runs are dispatched afterwards
+	inFlight sync.WaitGroup // dispatched runs that have not finished
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{
+		runs: make(map[uint64][]*automationRun),
+	}
+}
+
+func automationFingerprint(a *automation.Automation) string {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// remove drops the run from the tracker and reports whether it was still tracked. Must be called with mu held.
+func (t *runTracker) remove(run *automationRun) bool {
+	runs := t.runs[run.automationID]
+	for i, r := range runs {
+		if r != run {
+			continue
+		}
+		runs = append(runs[:i:i], runs[i+1:]...)
+		if len(runs) == 0 {
+			delete(t.runs, run.automationID)
+		} else {
+			t.runs[run.automationID] = runs
+		}
+		return true
+	}
+	return false
+}
+
+// startRun applies the run mode of the automation to a new run. Depending on the mode and the active runs
+// it is handed to the workers, queued behind the running one, or dropped with a warning.
+// started is false if the run was dropped.
+func (e *Engine) startRun(a *automation.Automation, task *AutomationTask, cancel context.CancelFunc) (started bool, err error) {
+	run := &automationRun{
+		automationID: a.Id,
+		fingerprint:  automationFingerprint(a),
+		cancel:       cancel,
+		task:         task,
+	}
+	task.run = run
+
+	e.runs.mu.Lock()
+	defer e.runs.mu.Unlock()
+
+	active := e.runs.runs[a.Id]
+	mode, max := a.ModeOrDefault(), a.MaxOrDefault()
+	switch mode {
+	case automation.RunModeSingle:
+		if len(active) > 0 {
+			cancel()
+			e.Logger.Warn("automation already running, dropped new run", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias), zap.String("mode", string(mode)))
+			return false, nil
+		}
+	case automation.RunModeRestart:
+		for _, r := range active {
+			r.cancel()
+		}
+		delete(e.runs.runs, a.Id)
+		if len(active) > 0 {
+			e.Logger.Info("restarting automation", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias))
+		}
+	case automation.RunModeQueued, automation.RunModeParallel:
+		if len(active) >= max {
+			cancel()
+			e.Logger.Warn("automation reached maximum number of runs, dropped new run", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias), zap.String("mode", string(mode)), zap.Int("max", max))
+			return false, nil
+		}
+	default:
+		cancel()
+		return false, fmt.Errorf("unknown run mode: %s", mode)
+	}
+
+	e.runs.runs[a.Id] = append(e.runs.runs[a.Id], run)
+	if mode == automation.RunModeQueued && len(e.runs.runs[a.Id]) > 1 {
+		e.Logger.Info("queued automation run", zap.Uint64("automation_id", a.Id), zap.Int("position", len(e.runs.runs[a.Id])-1))
+		return true, nil // dispatched when the previous run finishes
+	}
+	if err := e.dispatchRun(run); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// dispatchRun hands the run to the workers. Must be called with runs.mu held.
+func (e *Engine) dispatchRun(run *automationRun) error {
+	if e.runs.closed {
+		e.runs.remove(run)
+		run.cancel()
+		return fmt.Errorf("engine is shutting down, dropped run of %q", run.task.Automation.Alias)
+	}
+	// never block the event loop, running sequences may be waiting for the next event.
+	e.runs.inFlight.Add(1)
+	select {
+	case e.AutomationTaskQueue <- run.task:
+		run.dispatched = true
+		return nil
+	default:
+		e.runs.inFlight.Done()
+		e.runs.remove(run)
+		run.cancel()
+		return fmt.Errorf("automation task queue is full, dropped run of %q", run.task.Automation.Alias)
+	}
+}
+
+// closeRuns stops dispatching runs, cancels the active ones and waits until the dispatched runs finished.
+// Runs that are queued behind another run are dropped. Afterwards nothing is sent to the AutomationTaskQueue.
+func (e *Engine) closeRuns() {
+	var queued []*automationRun
+	e.runs.mu.Lock()
+	e.runs.closed = true
+	for id, runs := range e.runs.runs {
+		for _, run := range runs {
+			run.cancel()
+			if !run.dispatched {
+				queued = append(queued, run)
+			}
+		}
+		delete(e.runs.runs, id)
+	}
+	e.runs.mu.Unlock()
+
+	for _, run := range queued {
+		e.finishTrace(run.task.Trace, context.Canceled)
+	}
+	e.runs.inFlight.Wait()
+}
+
+// finishRun removes a run once it is done and dispatches the next queued run of the automation.
+func (e *Engine) finishRun(run *automationRun) {
+	run.cancel()
+
+	var dropped []*automationRun
+	var dropErr error
+	e.runs.mu.Lock()
+	if e.runs.remove(run) && !e.runs.closed {
+		for _, next := range e.runs.runs[run.automationID] {
+			if next.dispatched {
+				continue
+			}
+			if err := e.dispatchRun(next); err != nil {
+				e.Logger.Warn("failed to dispatch queued automation run", zap.Uint64("automation_id", run.automationID), zap.Error(err))
+				dropped, dropErr = append(dropped, next), err
+				continue
+			}
+			break
+		}
+	}
+	e.runs.mu.Unlock()
+
+	for _, r := range dropped {
+		r.task.Trace.Finish(automation.TraceResultDropped, dropErr)
+		e.saveTrace(r.task.Trace)
+	}
+}
+
+// cancelOutdatedRuns cancels the runs of automations that were removed, disabled or changed.
+func (e *Engine) cancelOutdatedRuns(set *automation.AutomationSet) {
+	current := make(map[uint64]string, len(set.Automations))
+	for i := range set.Automations {
+		a := &set.Automations[i]
+		if a.Enabled {
+			current[a.Id] = automationFingerprint(a)
+		}
+	}
+
+	var queued []*automationRun // cancelled before a worker picked them up
+	e.runs.mu.Lock()
+	for id, runs := range e.runs.runs {
+		kept := runs[:0:0]
+		for _, run := range runs {
+			if fingerprint, ok := current[id]; ok && fingerprint == run.fingerprint {
+				kept = append(kept, run)
+				continue
+			}
+			run.cancel()
+			if !run.dispatched {
+				queued = append(queued, run)
+			}
+			e.Logger.Info("cancelled run of changed automation", zap.Uint64("automation_id", id))
+		}
+		if len(kept) == 0 {
+			delete(e.runs.runs, id)
+		} else {
+			e.runs.runs[id] = kept
+		}
+	}
+	e.runs.mu.Unlock()
+
+	for _, run := range queued {
+		e.finishTrace(run.task.Trace, context.Canceled)
+	}
+}
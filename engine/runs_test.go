@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// blockingAutomation returns an automation that calls test.block when a "test_fire" event is processed.
+func blockingAutomation(alias, mode string, max int) string {
+	return fmt.Sprintf(`{
+		"alias": %q, "active": true, "mode": %q, "max": %d,
+		"trigger": [{"type": "event", "data": {"event_type": "test_fire"}}],
+		"action": [{"service": "test.block", "blocking": true}]
+	}`, alias, mode, max)
+}
+
+func TestRunModes(t *testing.T) {
+	t.Run("single drops new runs", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		id := e.createAutomation(t, blockingAutomation("single", "single", 0))
+
+		e.fire("test_fire")
+		svc.expectCall(t)
+		e.fire("test_fire")
+		svc.expectNoCall(t)
+
+		svc.releaseOne(t)
+		svc.expectFinished(t, nil)
+		if got, want := e.traceResults(t, id, 2), []string{"dropped", "finished"}; !slices.Equal(got, want) {
+			t.Errorf("traces = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("queued runs in order", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		e.createAutomation(t, blockingAutomation("queued", "queued", 3))
+
+		for range 3 {
+			e.fire("test_fire")
+		}
+		for range 3 {
+			svc.expectCall(t)
+			svc.expectNoCall(t) // the next run waits for this one
+			svc.releaseOne(t)
+			svc.expectFinished(t, nil)
+		}
+	})
+
+	t.Run("queued drops runs beyond max", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		id := e.createAutomation(t, blockingAutomation("queued", "queued", 2))
+
+		for range 3 {
+			e.fire("test_fire")
+		}
+		if got, want := e.traceResults(t, id, 1), []string{"dropped"}; !slices.Equal(got, want) {
+			t.Errorf("traces = %v, want %v", got, want)
+		}
+		for range 2 {
+			svc.expectCall(t)
+			svc.releaseOne(t)
+		}
+		svc.expectNoCall(t)
+	})
+
+	t.Run("restart cancels the running run", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		id := e.createAutomation(t, blockingAutomation("restart", "restart", 0))
+
+		e.fire("test_fire")
+		svc.expectCall(t)
+		e.fire("test_fire")
+		svc.expectFinished(t, context.Canceled)
+		svc.expectCall(t)
+		svc.releaseOne(t)
+		svc.expectFinished(t, nil)
+		if got, want := e.traceResults(t, id, 2), []string{"cancelled", "finished"}; !slices.Equal(got, want) {
+			t.Errorf("traces = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("parallel runs up to max", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		e.createAutomation(t, blockingAutomation("parallel", "parallel", 2))
+
+		for range 3 {
+			e.fire("test_fire")
+		}
+		svc.expectCall(t)
+		svc.expectCall(t)
+		svc.expectNoCall(t)
+		svc.releaseOne(t)
+		svc.releaseOne(t)
+	})
+}
+
+func TestShutdownDrainsRuns(t *testing.T) {
+	e := newTestEngine(t)
+	svc := newBlockingService(e, "test", "block")
+	id := e.createAutomation(t, blockingAutomation("queued", "queued", 3))
+	e.createAutomation(t, `{
+		"alias": "armed", "active": true,
+		"trigger": [{"type": "state", "data": {"entity_id": "light.kitchen", "to": "on", "for": "1h"}}],
+		"action": [{"service": "test.block", "blocking": true}]
+	}`)
+
+	e.setState("light.kitchen", "on")
+	if n := pendingCount(e); n != 1 {
+		t.Fatalf("%d triggers armed, want 1", n)
+	}
+	e.fire("test_fire")
+	e.fire("test_fire")
+	svc.expectCall(t)
+
+	// Shutdown cancels the running run, drops the queued one and stops the armed trigger. Nothing is sent to
+	// the closed task queue afterwards.
+	e.shutdown()
+	svc.expectFinished(t, context.Canceled)
+	svc.expectNoCall(t)
+
+	if n := pendingCount(e); n != 0 {
+		t.Errorf("%d triggers still armed after shutdown", n)
+	}
+
+	results := e.traceResults(t, id, 2)
+	slices.Sort(results)
+	if want := []string{"cancelled", "cancelled"}; !slices.Equal(results, want) {
+		t.Errorf("traces = %v, want %v", results, want)
+	}
+}
@@ -0,0 +1,34 @@
+package engine
+
+import "context"
+
+// runSlots limits the automation runs that execute at the same time. A run holds a slot while it executes
+// and gives it up while it waits in a delay or wait step, so waiting runs do not hold up the others.
+type runSlots chan struct{}
+
+func newRunSlots(n int) runSlots {
+	return make(runSlots, max(n, 1))
+}
+
+type runSlotKey struct{}
+
+// acquire blocks until a slot is free and returns a context that marks the run as holding it.
+func (s runSlots) acquire(ctx context.Context) context.Context {
+	s <- struct{}{}
+	return context.WithValue(ctx, runSlotKey{}, s)
+}
+
+func (s runSlots) release() {
+	<-s
+}
+
+// idle gives up the slot of the run of ctx, if it holds one, until resume is called. Runs call it before
+// they block in a delay or wait.
+func idle(ctx context.Context) (resume func()) {
+	s, ok := ctx.Value(runSlotKey{}).(runSlots)
+	if !ok {
+		return func() {}
+	}
+	s.release()
+	return func() { s <- struct{}{} }
+}
@@ -0,0 +1,411 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/storage"
+	"home_automation_server/storage/models"
+	"home_automation_server/types"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var ErrSceneNotFound = errors.New("scene not found")
+
+// LoadScenes loads the scenes from storage and registers them as scene.<name> services, next to the
+// scene.snapshot and scene.apply services.
+func (e *Engine) LoadScenes(ctx context.Context) error {
+	e.scenesMu.Lock()
+	defer e.scenesMu.Unlock()
+
+	stored, err := e.SceneStore.LoadScenes(ctx)
+	if err != nil {
+		return err
+	}
+
+	scenes := make(map[uint]automation.Scene, len(stored))
+	for _, m := range stored {
+		s, err := storage.SceneFromStorage(m)
+		if err != nil {
+			return fmt.Errorf("unable to convert scene from storage model: %w", err)
+		}
+		scenes[s.Id] = s
+	}
+
+	e.RegisterService(automation.SceneDomain, automation.SceneSnapshotService, e.snapshotSceneService())
+	e.RegisterService(automation.SceneDomain, automation.SceneApplyService, e.applySceneService())
+	e.setScenes(scenes)
+	e.Logger.Info("successfully loaded scenes from storage", zap.Int("num_scenes", len(scenes)))
+	return nil
+}
+
+// Scenes returns the stored scenes, ordered by ID.
+func (e *Engine) Scenes() []automation.Scene {
+	e.scenesMu.RLock()
+	defer e.scenesMu.RUnlock()
+	scenes := make([]automation.Scene, 0, len(e.scenes))
+	for _, s := range e.scenes {
+		scenes = append(scenes, s)
+	}
+	slices.SortFunc(scenes, func(a, b automation.Scene) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return scenes
+}
+
+// SceneSnapshots returns the scenes captured by scene.snapshot, ordered by name.
+func (e *Engine) SceneSnapshots() []automation.Scene {
+	e.scenesMu.RLock()
+	defer e.scenesMu.RUnlock()
+	snapshots := make([]automation.Scene, 0, len(e.sceneSnapshots))
+	for _, name := range slices.Sorted(maps.Keys(e.sceneSnapshots)) {
+		snapshots = append(snapshots, e.sceneSnapshots[name])
+	}
+	return snapshots
+}
+
+func (e *Engine) SceneByID(id uint) (automation.Scene, bool) {
+	e.scenesMu.RLock()
+	defer e.scenesMu.RUnlock()
+	s, ok := e.scenes[id]
+	return s, ok
+}
+
+// SceneByName returns the stored scene or snapshot with the given name.
+func (e *Engine) SceneByName(name string) (automation.Scene, bool) {
+	e.scenesMu.RLock()
+	defer e.scenesMu.RUnlock()
+	return e.sceneByName(name)
+}
+
+// sceneByName must be called with scenesMu held.
+func (e *Engine) sceneByName(name string) (automation.Scene, bool) {
+	for _, s := range e.scenes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	s, ok := e.sceneSnapshots[name]
+	return s, ok
+}
+
+// CreateScene validates and stores a new scene and registers its service.
+func (e *Engine) CreateScene(ctx context.Context, s automation.Scene) (*models.Scene, error) {
+	e.scenesMu.Lock()
+	defer e.scenesMu.Unlock()
+
+	s.Id = 0
+	if err := e.validateScene(&s); err != nil {
+		return nil, err
+	}
+	m, err := storage.SceneToStorage(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.SceneStore.CreateScene(ctx, &m); err != nil {
+		return nil, fmt.Errorf("failed to store scene: %w", err)
+	}
+	s.Id = m.ID
+
+	scenes := maps.Clone(e.scenes)
+	scenes[s.Id] = s
+	e.setScenes(scenes)
+	e.Logger.Info("created scene", zap.Uint("scene_id", s.Id), zap.String("scene", s.Service()))
+	return &m, nil
+}
+
+// UpdateScene validates and stores the new definition of a scene.
+func (e *Engine) UpdateScene(ctx context.Context, s automation.Scene) (*models.Scene, error) {
+	e.scenesMu.Lock()
+	defer e.scenesMu.Unlock()
+
+	if err := e.validateScene(&s); err != nil {
+		return nil, err
+	}
+	m, err := storage.SceneToStorage(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.SceneStore.UpdateScene(ctx, &m); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSceneNotFound
+		}
+		return nil, fmt.Errorf("failed to store scene: %w", err)
+	}
+
+	scenes := maps.Clone(e.scenes)
+	scenes[s.Id] = s
+	e.setScenes(scenes)
+	e.Logger.Info("updated scene", zap.Uint("scene_id", s.Id), zap.String("scene", s.Service()))
+
+	updated, err := e.SceneStore.GetScene(ctx, s.Id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch updated scene: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteScene removes a scene and unregisters its service.
+func (e *Engine) DeleteScene(ctx context.Context, id uint) error {
+	e.scenesMu.Lock()
+	defer e.scenesMu.Unlock()
+
+	if err := e.SceneStore.DeleteScene(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSceneNotFound
+		}
+		return fmt.Errorf("failed to delete scene: %w", err)
+	}
+
+	scenes := maps.Clone(e.scenes)
+	delete(scenes, id)
+	e.setScenes(scenes)
+	e.Logger.Info("deleted scene", zap.Uint("scene_id", id))
+	return nil
+}
+
+// validateScene checks a scene before it is stored. The entities must exist and names must be unique
+// among scenes and snapshots. Must be called with scenesMu held.
+func (e *Engine) validateScene(s *automation.Scene) error {
+	v := &automation.Validator{}
+	s.ValidateInto(v)
+	for _, entityID := range slices.Sorted(maps.Keys(s.Entities)) {
+		if _, ok := e.EntityRegistry.ResolveExternalID(entityID); !ok {
+			v.Add("entities/"+entityID, "unknown entity %q", entityID)
+		}
+	}
+	if other, ok := e.sceneByName(s.Name); ok && (other.Id != s.Id || other.Id == 0) {
+		v.Add("name", "a scene with name %q already exists", s.Name)
+	}
+	return v.Err()
+}
+
+// setScenes replaces the stored scenes and their services, and validates the automations again as they may
+// apply the scenes. Must be called with scenesMu held.
+func (e *Engine) setScenes(scenes map[uint]automation.Scene) {
+	for id, old := range e.scenes {
+		if s, ok := scenes[id]; ok && s.Name == old.Name {
+			continue
+		}
+		e.ServiceRegistry.Unregister(automation.SceneDomain, old.Name)
+	}
+
+	e.scenes = scenes
+	for _, s := range scenes {
+		e.RegisterService(automation.SceneDomain, s.Name, e.sceneService(s.Id))
+	}
+	e.RevalidateAutomations()
+}
+
+// sceneService applies the stored scene with the given ID. The scene is looked up when called, so updates
+// apply without registering the service again.
+func (e *Engine) sceneService(id uint) integrations.ServiceSpec {
+	return integrations.ServiceSpec{
+		Handler: func(ctx context.Context, action *automation.Action) error {
+			s, ok := e.SceneByID(id)
+			if !ok {
+				return ErrSceneNotFound
+			}
+			return e.ApplyScene(ctx, &s)
+		},
+		Params: map[string]integrations.ParamMetadata{},
+	}
+}
+
+// snapshotSceneService captures the current states of the given entities as a snapshot, which is applied
+// later with scene.apply, e.g. to restore lights after flashing them.
+func (e *Engine) snapshotSceneService() integrations.ServiceSpec {
+	return integrations.ServiceSpec{
+		Handler: func(ctx context.Context, action *automation.Action) error {
+			name, err := action.StringParam("name")
+			if err != nil {
+				return err
+			}
+			entityIDs, ok := action.Params["entities"].([]string)
+			if !ok {
+				return fmt.Errorf("expected entities to be a list, got %T", action.Params["entities"])
+			}
+			return e.SnapshotScene(name, entityIDs)
+		},
+		Params: map[string]integrations.ParamMetadata{
+			"name": {
+				DataType:    integrations.DataTypeString,
+				Description: "Name of the snapshot, applied with scene.apply",
+			},
+			"entities": {
+				DataType:    integrations.DataTypeList,
+				Description: "IDs of the entities to capture",
+			},
+		},
+	}
+}
+
+// applySceneService applies a stored scene or a snapshot by name. Unlike scene.<name> it can apply snapshots,
+// which only exist once scene.snapshot ran.
+func (e *Engine) applySceneService() integrations.ServiceSpec {
+	return integrations.ServiceSpec{
+		Handler: func(ctx context.Context, action *automation.Action) error {
+			name, err := action.StringParam("scene")
+			if err != nil {
+				return err
+			}
+			s, ok := e.SceneByName(name)
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrSceneNotFound, name)
+			}
+			return e.ApplyScene(ctx, &s)
+		},
+		Params: map[string]integrations.ParamMetadata{
+			"scene": {
+				DataType:    integrations.DataTypeString,
+				Description: "Name of the scene or snapshot to apply",
+			},
+		},
+	}
+}
+
+// SnapshotScene captures the current states of the entities from the StateCache as a snapshot with the given
+// name, replacing an earlier snapshot of the same name. Snapshots are kept in memory only.
+func (e *Engine) SnapshotScene(name string, entityIDs []string) error {
+	s := automation.Scene{
+		Name:     name,
+		Alias:    name,
+		Entities: make(map[string]automation.SceneEntity, len(entityIDs)),
+	}
+	for _, entityID := range entityIDs {
+		entity, err := e.captureState(entityID)
+		if err != nil {
+			return err
+		}
+		s.Entities[entityID] = entity
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	e.scenesMu.Lock()
+	defer e.scenesMu.Unlock()
+	if other, ok := e.sceneByName(name); ok && other.Id != 0 {
+		return fmt.Errorf("a stored scene with name %q already exists", name)
+	}
+	e.sceneSnapshots[name] = s
+	e.Logger.Info("captured scene snapshot", zap.String("scene", name), zap.Strings("entities", entityIDs))
+	return nil
+}
+
+// CaptureScene returns the current states of the entities from the StateCache, e.g. to store them as a scene.
+func (e *Engine) CaptureScene(entityIDs []string) (map[string]automation.SceneEntity, error) {
+	entities := make(map[string]automation.SceneEntity, len(entityIDs))
+	for _, entityID := range entityIDs {
+		entity, err := e.captureState(entityID)
+		if err != nil {
+			return nil, err
+		}
+		entities[entityID] = entity
+	}
+	return entities, nil
+}
+
+// captureState copies the cached state of an entity. The copy goes through JSON so it does not share
+// attribute maps with the cache, and holds the same values as a scene loaded from storage.
+func (e *Engine) captureState(entityID string) (automation.SceneEntity, error) {
+	state, ok := e.StateCache.Get(entityID)
+	if !ok {
+		return automation.SceneEntity{}, fmt.Errorf("no state known for entity %s", entityID)
+	}
+
+	raw, err := json.Marshal(automation.SceneEntity{State: state.State, Attributes: state.Attributes})
+	if err != nil {
+		return automation.SceneEntity{}, fmt.Errorf("failed to marshal state of %s: %w", entityID, err)
+	}
+	var entity automation.SceneEntity
+	if err := json.Unmarshal(raw, &entity); err != nil {
+		return automation.SceneEntity{}, fmt.Errorf("failed to unmarshal state of %s: %w", entityID, err)
+	}
+	return entity, nil
+}
+
+// ApplyScene brings the entities of the scene to their target states by calling the services the integrations
+// return for them. The entities are restored concurrently; a failing entity does not stop the others and its
+// error is included in the returned error.
+func (e *Engine) ApplyScene(ctx context.Context, s *automation.Scene) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, entityID := range slices.Sorted(maps.Keys(s.Entities)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := e.applySceneEntity(ctx, entityID, s.Entities[entityID]); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", entityID, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to apply scene %s: %w", s.Service(), err)
+	}
+	e.Logger.Info("applied scene", zap.String("scene", s.Service()), zap.Int("num_entities", len(s.Entities)))
+	return nil
+}
+
+// isSceneCall reports whether the action applies a scene. The service calls of the scene entities are retried
+// and time out on their own, so scene calls are exempt from the ActionTimeout and RetryPolicy.
+func isSceneCall(action *automation.Action) bool {
+	return strings.HasPrefix(action.Service, automation.SceneDomain+".")
+}
+
+// applySceneEntity restores one entity of a scene. Its service calls are retried according to the RetryPolicy.
+func (e *Engine) applySceneEntity(ctx context.Context, entityID string, entity automation.SceneEntity) error {
+	actions, err := e.reproduceState(entityID, entity)
+	if err != nil {
+		return err
+	}
+	for i := range actions {
+		targets, err := e.ResolveTargetsToExternalID(actions[i].Targets)
+		if err != nil {
+			return err
+		}
+		actions[i].Targets = targets
+		if err := e.executeActionWithRetry(ctx, &actions[i], nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reproduceState returns the service calls that restore the entity, asking the integration that exposes it.
+func (e *Engine) reproduceState(entityID string, entity automation.SceneEntity) ([]automation.Action, error) {
+	owner, ok := e.EntityRegistry.Owner(entityID)
+	if !ok {
+		return nil, errors.New("unknown entity")
+	}
+
+	instance, ok := e.integrationByConfigID(owner.IntegrationID)
+	if !ok {
+		return nil, fmt.Errorf("integration of entity %s is not loaded", entityID)
+	}
+	if instance.ReproduceState == nil {
+		return nil, fmt.Errorf("integration %s cannot restore entity states", instance.Descriptor.Name)
+	}
+
+	return instance.ReproduceState(entityID, entityType(entityID), types.State{
+		EntityID:   entityID,
+		State:      entity.State,
+		Attributes: entity.Attributes,
+	})
+}
@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"home_automation_server/automation"
+	"home_automation_server/engine/integration"
+	"home_automation_server/integrations"
+	"home_automation_server/types"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// sceneIntegration is a test integration that restores states through its service test.set. Calls for the
+// external IDs in failures fail that many times.
+type sceneIntegration struct {
+	mu       sync.Mutex
+	applied  map[string]any // external ID -> the state it was set to
+	calls    map[string]int // external ID -> number of calls
+	failures map[string]int
+}
+
+func newSceneTestEngine(t *testing.T) (*testEngine, *sceneIntegration) {
+	e := newTestEngine(t)
+	i := &sceneIntegration{applied: make(map[string]any), calls: make(map[string]int), failures: make(map[string]int)}
+	e.addIntegration("test", integration.Instance{
+		ConfigID: 1,
+		ReproduceState: func(entityID string, entityType types.EntityType, state types.State) ([]automation.Action, error) {
+			return []automation.Action{{
+				Service: "test.set",
+				Targets: []automation.Target{{EntityID: entityID}},
+				Params:  map[string]any{"state": state.State},
+			}}, nil
+		},
+	})
+	e.RegisterService("test", "set", integrations.ServiceSpec{
+		Params: map[string]integrations.ParamMetadata{"state": {DataType: "string"}},
+		Handler: func(ctx context.Context, action *automation.Action) error {
+			i.mu.Lock()
+			defer i.mu.Unlock()
+			externalID := action.Targets[0].EntityID
+			i.calls[externalID]++
+			if i.failures[externalID] > 0 {
+				i.failures[externalID]--
+				return errors.New("device did not respond")
+			}
+			i.applied[externalID] = action.Params["state"]
+			return nil
+		},
+	})
+	e.addEntities(t,
+		testEntity(1, "ext-kitchen", "light.kitchen", "dev-1"),
+		testEntity(1, "ext-hall", "light.hall", "dev-1"),
+	)
+	return e, i
+}
+
+// result returns the applied states and the number of calls per external ID.
+func (i *sceneIntegration) result() (map[string]any, map[string]int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return maps.Clone(i.applied), maps.Clone(i.calls)
+}
+
+func (i *sceneIntegration) fail(externalID string, times int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.failures[externalID] = times
+}
+
+func (e *testEngine) createScene(t *testing.T, name string, entities map[string]automation.SceneEntity) {
+	t.Helper()
+	_, err := e.CreateScene(context.Background(), automation.Scene{Name: name, Alias: name, Entities: entities})
+	if err != nil {
+		t.Fatalf("CreateScene: %v", err)
+	}
+}
+
+func TestScenes(t *testing.T) {
+	ctx := context.Background()
+	movie := map[string]automation.SceneEntity{
+		"light.kitchen": {State: "off"},
+		"light.hall":    {State: "on"},
+	}
+
+	t.Run("applies the states through the integration", func(t *testing.T) {
+		e, i := newSceneTestEngine(t)
+		e.createScene(t, "movie", movie)
+
+		if err := e.CallService(ctx, "scene", "movie", nil, nil); err != nil {
+			t.Fatalf("CallService: %v", err)
+		}
+		applied, _ := i.result()
+		if want := map[string]any{"ext-kitchen": "off", "ext-hall": "on"}; !maps.Equal(applied, want) {
+			t.Errorf("applied = %v, want %v", applied, want)
+		}
+	})
+
+	t.Run("entities are retried on their own", func(t *testing.T) {
+		e, i := newSceneTestEngine(t)
+		e.createScene(t, "movie", movie)
+		i.fail("ext-hall", 2)
+
+		if err := e.CallService(ctx, "scene", "movie", nil, nil); err != nil {
+			t.Fatalf("CallService: %v", err)
+		}
+		_, calls := i.result()
+		if want := map[string]int{"ext-kitchen": 1, "ext-hall": 3}; !maps.Equal(calls, want) {
+			t.Errorf("calls = %v, want %v", calls, want)
+		}
+	})
+
+	t.Run("a failing entity does not stop the others", func(t *testing.T) {
+		e, i := newSceneTestEngine(t)
+		e.createScene(t, "movie", movie)
+		i.fail("ext-hall", 100)
+
+		err := e.CallService(ctx, "scene", "movie", nil, nil)
+		if err == nil {
+			t.Fatal("CallService succeeded, want the error of light.hall")
+		}
+		applied, calls := i.result()
+		if want := map[string]any{"ext-kitchen": "off"}; !maps.Equal(applied, want) {
+			t.Errorf("applied = %v, want %v", applied, want)
+		}
+		// the scene call itself is not retried, only the calls of the entity
+		if got, want := calls["ext-hall"], e.RetryPolicy.MaxAttempts; got != want {
+			t.Errorf("light.hall was called %d times, want %d", got, want)
+		}
+	})
+
+	t.Run("snapshots restore the captured states", func(t *testing.T) {
+		e, i := newSceneTestEngine(t)
+		e.setState("light.kitchen", "on")
+		e.setState("light.hall", "off")
+
+		err := e.CallService(ctx, "scene", "snapshot", nil, map[string]any{
+			"name":     "before",
+			"entities": []any{"light.kitchen", "light.hall"},
+		})
+		if err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		e.setState("light.kitchen", "off")
+		e.setState("light.hall", "on")
+
+		if err := e.CallService(ctx, "scene", "apply", nil, map[string]any{"scene": "before"}); err != nil {
+			t.Fatalf("apply: %v", err)
+		}
+		applied, _ := i.result()
+		if want := map[string]any{"ext-kitchen": "on", "ext-hall": "off"}; !maps.Equal(applied, want) {
+			t.Errorf("applied = %v, want %v", applied, want)
+		}
+
+		// a snapshot cannot take the name of a stored scene
+		e.createScene(t, "movie", movie)
+		err = e.SnapshotScene("movie", []string{"light.kitchen"})
+		if err == nil {
+			t.Error("snapshot replaced a stored scene")
+		}
+	})
+
+	t.Run("scenes are validated", func(t *testing.T) {
+		e, _ := newSceneTestEngine(t)
+		e.createScene(t, "movie", movie)
+
+		tests := []struct {
+			name     string
+			scene    string
+			entities map[string]automation.SceneEntity
+		}{
+			{"unknown entity", "party", map[string]automation.SceneEntity{"light.garage": {State: "on"}}},
+			{"name taken", "movie", movie},
+		}
+		for _, tt := range tests {
+			_, err := e.CreateScene(ctx, automation.Scene{Name: tt.scene, Alias: tt.scene, Entities: tt.entities})
+			var validationErr *automation.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Errorf("%s: CreateScene = %v, want a validation error", tt.name, err)
+			}
+		}
+		if names := sceneNames(e); !slices.Equal(names, []string{"movie"}) {
+			t.Errorf("scenes = %v, want [movie]", names)
+		}
+	})
+}
+
+func sceneNames(e *testEngine) []string {
+	var names []string
+	for _, s := range e.Scenes() {
+		names = append(names, s.Name)
+	}
+	return names
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"home_automation_server/types"
+	"time"
+)
+
+// maxCatchUp is how far the scheduler may fall behind before it skips the missed minutes.
+const maxCatchUp = time.Hour
+
+// Scheduler is the engine clock. It emits a time_changed event on every minute boundary,
+// which drives the time based triggers.
+type Scheduler struct {
+	EventChannel chan types.Event
+	Location     *time.Location
+	Logger       *zap.Logger
+}
+
+func NewScheduler(eventCh chan types.Event, location *time.Location, logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		EventChannel: eventCh,
+		Location:     location,
+		Logger:       logger,
+	}
+}
+
+// Run emits the time_changed events until ctx is done. Minutes missed while the event loop was busy are
+// emitted late rather than skipped, so triggers on those minutes still fire.
+func (s *Scheduler) Run(ctx context.Context) {
+	next := time.Now().Truncate(time.Minute).Add(time.Minute)
+	for {
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if !s.emit(ctx, next.In(s.Location)) {
+				return
+			}
+			next = next.Add(time.Minute)
+			if behind := time.Since(next); behind > maxCatchUp {
+				// e.g. the clock jumped or the host was suspended, do not replay every missed minute
+				s.Logger.Warn("clock is behind, skipping missed time_changed events", zap.Duration("behind", behind))
+				next = time.Now().Truncate(time.Minute).Add(time.Minute)
+			}
+		}
+	}
+}
+
+// emit blocks until the event is sent or ctx is done. It reports whether the event was sent.
+func (s *Scheduler) emit(ctx context.Context, now time.Time) bool {
+	event := types.Event{
+		Type:      types.EventTimeChanged,
+		Data:      types.TimeChangedData{Now: now},
+		Context:   &types.Context{ID: uuid.NewString()},
+		TimeFired: now,
+	}
+
+	select {
+	case s.EventChannel <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
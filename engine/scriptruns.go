@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"sync"
+)
+
+// scriptRun is a waiting or executing run of a script. done is closed when the run finished.
+type scriptRun struct {
+	scriptID uint
+	cancel   context.CancelFunc
+	done     chan struct{}
+	caller   *scriptRun // the script run that called this one, nil if it was not called by a script
+}
+
+type scriptRunKey struct{}
+
+// callingScriptRun returns the script run ctx belongs to, nil if there is none.
+func callingScriptRun(ctx context.Context) *scriptRun {
+	run, _ := ctx.Value(scriptRunKey{}).(*scriptRun)
+	return run
+}
+
+// scriptRunTracker keeps track of the active runs per script, in the order they were started.
+// Scripts run in the goroutine of their caller, so unlike automation runs they are not dispatched to the
+// workers: queued runs wait for the run before them instead.
+type scriptRunTracker struct {
+	mu   sync.Mutex
+	runs map[uint][]*scriptRun
+}
+
+func newScriptRunTracker() *scriptRunTracker {
+	return &scriptRunTracker{
+		runs: make(map[uint][]*scriptRun),
+	}
+}
+
+func scriptFingerprint(s *automation.Script) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// startScriptRun applies the run mode of the script to a new run. run is nil if the run was dropped.
+// If wait is set, the run is queued and must wait for it to be closed before executing. A queued script that
+// is called from one of its own runs, directly or through other scripts, would wait for itself, the call
+// fails with ErrScriptReentrant instead.
+func (e *Engine) startScriptRun(ctx context.Context, s *automation.Script) (runCtx context.Context, run *scriptRun, wait <-chan struct{}, err error) {
+	caller := callingScriptRun(ctx)
+	t := e.scriptRuns
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	active := t.runs[s.Id]
+	mode, max := s.ModeOrDefault(), s.MaxOrDefault()
+	switch mode {
+	case automation.RunModeSingle:
+		if len(active) > 0 {
+			e.Logger.Warn("script already running, dropped new run", zap.Uint("script_id", s.Id), zap.String("script", s.Service()))
+			return nil, nil, nil, nil
+		}
+	case automation.RunModeRestart:
+		for _, r := range active {
+			r.cancel()
+		}
+		if len(active) > 0 {
+			e.Logger.Info("restarting script", zap.Uint("script_id", s.Id), zap.String("script", s.Service()))
+		}
+	case automation.RunModeQueued, automation.RunModeParallel:
+		if len(active) >= max {
+			e.Logger.Warn("script reached maximum number of runs, dropped new run", zap.Uint("script_id", s.Id), zap.String("script", s.Service()), zap.String("mode", string(mode)), zap.Int("max", max))
+			return nil, nil, nil, nil
+		}
+		if mode == automation.RunModeQueued {
+			for r := caller; r != nil; r = r.caller {
+				if r.scriptID == s.Id {
+					return nil, nil, nil, fmt.Errorf("%w: %s", ErrScriptReentrant, s.Service())
+				}
+			}
+			if len(active) > 0 {
+				wait = active[len(active)-1].done
+			}
+		}
+	default:
+		e.Logger.Error("unknown run mode, dropped script run", zap.Uint("script_id", s.Id), zap.String("mode", string(mode)))
+		return nil, nil, nil, nil
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	run = &scriptRun{scriptID: s.Id, cancel: cancel, done: make(chan struct{}), caller: caller}
+	t.runs[s.Id] = append(t.runs[s.Id], run)
+	return context.WithValue(runCtx, scriptRunKey{}, run), run, wait, nil
+}
+
+// finish removes a run once it is done, which lets the next queued run of the script start.
+func (t *scriptRunTracker) finish(run *scriptRun) {
+	run.cancel()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	runs := t.runs[run.scriptID]
+	for i, r := range runs {
+		if r == run {
+			runs = append(runs[:i:i], runs[i+1:]...)
+			break
+		}
+	}
+	if len(runs) == 0 {
+		delete(t.runs, run.scriptID)
+	} else {
+		t.runs[run.scriptID] = runs
+	}
+	close(run.done)
+}
+
+// cancel cancels all runs of a script, e.g. because it was changed or removed.
+func (t *scriptRunTracker) cancel(scriptID uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, r := range t.runs[scriptID] {
+		r.cancel()
+	}
+}
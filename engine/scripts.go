@@ -0,0 +1,302 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/storage"
+	"home_automation_server/storage/models"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrScriptNotFound  = errors.New("script not found")
+	ErrScriptReentrant = errors.New("queued script calls itself") // it would wait for its own run to finish
+)
+
+// LoadScripts loads the scripts from storage and registers them as script.<name> services.
+func (e *Engine) LoadScripts(ctx context.Context) error {
+	e.scriptsMu.Lock()
+	defer e.scriptsMu.Unlock()
+
+	stored, err := e.ScriptStore.LoadScripts(ctx)
+	if err != nil {
+		return err
+	}
+
+	scripts := make(map[uint]automation.Script, len(stored))
+	for _, m := range stored {
+		s, err := storage.ScriptFromStorage(m)
+		if err != nil {
+			return fmt.Errorf("unable to convert script from storage model: %w", err)
+		}
+		scripts[s.Id] = s
+	}
+	e.setScripts(scripts)
+	e.Logger.Info("successfully loaded scripts from storage", zap.Int("num_scripts", len(scripts)))
+	return nil
+}
+
+// Scripts returns the loaded scripts, ordered by ID.
+func (e *Engine) Scripts() []automation.Script {
+	e.scriptsMu.RLock()
+	defer e.scriptsMu.RUnlock()
+	scripts := make([]automation.Script, 0, len(e.scripts))
+	for _, s := range e.scripts {
+		scripts = append(scripts, s)
+	}
+	slices.SortFunc(scripts, func(a, b automation.Script) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return scripts
+}
+
+func (e *Engine) ScriptByID(id uint) (automation.Script, bool) {
+	e.scriptsMu.RLock()
+	defer e.scriptsMu.RUnlock()
+	s, ok := e.scripts[id]
+	return s, ok
+}
+
+func (e *Engine) ScriptByName(name string) (automation.Script, bool) {
+	e.scriptsMu.RLock()
+	defer e.scriptsMu.RUnlock()
+	for _, s := range e.scripts {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return automation.Script{}, false
+}
+
+// CreateScript validates and stores a new script and registers its service.
+func (e *Engine) CreateScript(ctx context.Context, s automation.Script) (*models.Script, error) {
+	e.scriptsMu.Lock()
+	defer e.scriptsMu.Unlock()
+
+	s.Id = 0
+	if err := e.validateScript(&s); err != nil {
+		return nil, err
+	}
+	m, err := storage.ScriptToStorage(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.ScriptStore.CreateScript(ctx, &m); err != nil {
+		return nil, fmt.Errorf("failed to store script: %w", err)
+	}
+	s.Id = m.ID
+
+	scripts := maps.Clone(e.scripts)
+	scripts[s.Id] = s
+	e.setScripts(scripts)
+	e.Logger.Info("created script", zap.Uint("script_id", s.Id), zap.String("script", s.Service()))
+	return &m, nil
+}
+
+// UpdateScript validates and stores the new definition of a script. Runs of the previous definition are cancelled.
+func (e *Engine) UpdateScript(ctx context.Context, s automation.Script) (*models.Script, error) {
+	e.scriptsMu.Lock()
+	defer e.scriptsMu.Unlock()
+
+	if err := e.validateScript(&s); err != nil {
+		return nil, err
+	}
+	m, err := storage.ScriptToStorage(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.ScriptStore.UpdateScript(ctx, &m); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScriptNotFound
+		}
+		return nil, fmt.Errorf("failed to store script: %w", err)
+	}
+
+	scripts := maps.Clone(e.scripts)
+	scripts[s.Id] = s
+	e.setScripts(scripts)
+	e.Logger.Info("updated script", zap.Uint("script_id", s.Id), zap.String("script", s.Service()))
+
+	updated, err := e.ScriptStore.GetScript(ctx, s.Id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch updated script: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteScript removes a script with its traces, unregisters its service and cancels its runs.
+func (e *Engine) DeleteScript(ctx context.Context, id uint) error {
+	e.scriptsMu.Lock()
+	defer e.scriptsMu.Unlock()
+
+	if err := e.ScriptStore.DeleteScript(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrScriptNotFound
+		}
+		return fmt.Errorf("failed to delete script: %w", err)
+	}
+
+	scripts := maps.Clone(e.scripts)
+	delete(scripts, id)
+	e.setScripts(scripts)
+
+	if err := e.TraceStore.DeleteScriptTraces(ctx, id); err != nil {
+		e.Logger.Error("failed to delete traces", zap.Error(err), zap.Uint("script_id", id))
+	}
+	e.Logger.Info("deleted script", zap.Uint("script_id", id))
+	return nil
+}
+
+// validateScript checks a script before it is stored. Names must be unique.
+func (e *Engine) validateScript(s *automation.Script) error {
+	v := &automation.Validator{}
+	s.ValidateInto(v)
+	automation.WalkActions(s.Sequence, "sequence", func(action *automation.Action, path string) {
+		if typ, err := action.Type(); err == nil && typ == automation.ActionTypeService {
+			e.validateServiceCall(v, action, path)
+		}
+	})
+	for _, other := range e.scripts {
+		if other.Id != s.Id && other.Name == s.Name {
+			v.Add("name", "a script with name %q already exists", s.Name)
+		}
+	}
+	return v.Err()
+}
+
+// setScripts replaces the loaded scripts and their services. Runs of scripts that were removed or changed
+// are cancelled, and the automations are validated again as they may call the scripts.
+// Must be called with scriptsMu held.
+func (e *Engine) setScripts(scripts map[uint]automation.Script) {
+	for id, old := range e.scripts {
+		s, ok := scripts[id]
+		if ok && s.Name == old.Name {
+			continue
+		}
+		e.ServiceRegistry.Unregister(automation.ScriptDomain, old.Name)
+	}
+	for id, old := range e.scripts {
+		if s, ok := scripts[id]; !ok || scriptFingerprint(&s) != scriptFingerprint(&old) {
+			e.scriptRuns.cancel(id)
+		}
+	}
+
+	e.scripts = scripts
+	for _, s := range scripts {
+		e.RegisterService(automation.ScriptDomain, s.Name, e.scriptService(s))
+	}
+	e.RevalidateAutomations()
+}
+
+// scriptService describes the script as a service. The fields of the script become its params.
+func (e *Engine) scriptService(s automation.Script) integrations.ServiceSpec {
+	params := make(map[string]integrations.ParamMetadata, len(s.Fields))
+	for name, f := range s.Fields {
+		params[name] = integrations.ParamMetadata{
+			DataType:    f.Type,
+			Description: f.Description,
+			Default:     f.Default,
+			Optional:    !f.Required,
+		}
+	}
+	id := s.Id
+	return integrations.ServiceSpec{
+		Handler: func(ctx context.Context, action *automation.Action) error {
+			return e.RunScript(ctx, id, action.Params)
+		},
+		Params: params,
+	}
+}
+
+// StartScript runs a script in the background, e.g. when started from the API. The params are checked
+// against the fields of the script before it is started.
+func (e *Engine) StartScript(ctx context.Context, id uint, params map[string]any) error {
+	s, ok := e.ScriptByID(id)
+	if !ok {
+		return ErrScriptNotFound
+	}
+	spec := e.scriptService(s)
+	coerced, err := integrations.CoerceParams(spec.Params, params)
+	if err != nil {
+		return fmt.Errorf("invalid params for %s: %w", s.Service(), err)
+	}
+	go func() {
+		if err := e.RunScript(ctx, id, coerced); err != nil {
+			e.Logger.Error("script run failed", zap.Uint("script_id", id), zap.String("script", s.Service()), zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// RunScript runs the sequence of a script with params as variables and waits for it to finish. The run mode
+// of the script decides whether the run starts, waits for the running one or replaces it.
+// A run that was dropped, stopped by a wait timeout, or cancelled because the script changed is not an error.
+func (e *Engine) RunScript(ctx context.Context, id uint, params map[string]any) error {
+	s, ok := e.ScriptByID(id)
+	if !ok {
+		return ErrScriptNotFound
+	}
+
+	vars := maps.Clone(params)
+	if vars == nil {
+		vars = make(map[string]any)
+	}
+	trace := automation.NewScriptTrace(uuid.NewString(), &s, vars)
+	if parent := callerContext(ctx); parent != nil {
+		trace.Context.ParentID = parent.ID
+	}
+
+	runCtx, run, wait, err := e.startScriptRun(ctx, &s)
+	if err != nil {
+		trace.Finish(automation.TraceResultFailed, err)
+		e.saveTrace(trace)
+		return err
+	}
+	if run == nil {
+		trace.Finish(automation.TraceResultDropped, nil)
+		e.saveTrace(trace)
+		return nil
+	}
+	defer e.scriptRuns.finish(run)
+
+	if wait != nil {
+		resume := idle(runCtx) // the run slot is not needed while waiting for the run before
+		select {
+		case <-wait:
+			resume()
+		case <-runCtx.Done():
+			resume()
+			e.finishTrace(trace, runCtx.Err())
+			return ctx.Err()
+		}
+	}
+
+	e.causality.link(ContextLink{ContextID: trace.Context.ID, ParentID: trace.Context.ParentID, ScriptID: s.Id})
+	err = e.runSequence(withCallerContext(runCtx, trace.Context), &sequenceRun{vars: vars, trace: trace}, s.Sequence, "sequence")
+	e.finishTrace(trace, err)
+
+	switch {
+	case err == nil, errors.Is(err, errSequenceStopped):
+		return nil
+	case errors.Is(err, context.Canceled) && ctx.Err() == nil:
+		e.Logger.Info("script run cancelled", zap.Uint("script_id", id), zap.String("script", s.Service()))
+		return nil
+	default:
+		return fmt.Errorf("script %s failed: %w", s.Service(), err)
+	}
+}
+
+// isScriptCall reports whether the action calls a script. Scripts run as long as their sequence takes and
+// are not retried, so they are exempt from the ActionTimeout and RetryPolicy.
+func isScriptCall(action *automation.Action) bool {
+	return strings.HasPrefix(action.Service, automation.ScriptDomain+".")
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"home_automation_server/automation"
+	"home_automation_server/storage/models"
+	"testing"
+	"time"
+)
+
+// saveScript creates the script given as JSON, or updates it if it has an ID, and returns its ID.
+func (e *testEngine) saveScript(t *testing.T, def string) uint {
+	t.Helper()
+	var s automation.Script
+	if err := json.Unmarshal([]byte(def), &s); err != nil {
+		t.Fatalf("invalid script: %v", err)
+	}
+	if s.Id != 0 {
+		if _, err := e.UpdateScript(context.Background(), s); err != nil {
+			t.Fatalf("UpdateScript: %v", err)
+		}
+		return s.Id
+	}
+	m, err := e.CreateScript(context.Background(), s)
+	if err != nil {
+		t.Fatalf("CreateScript: %v", err)
+	}
+	return m.ID
+}
+
+// runScript runs the script in the background and returns the channel that receives its result.
+func (e *testEngine) runScript(id uint, params map[string]any) chan error {
+	result := make(chan error, 1)
+	go func() { result <- e.RunScript(context.Background(), id, params) }()
+	return result
+}
+
+func expectResult(t *testing.T, result chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(waitTimeout):
+		t.Fatal("script did not return")
+		return nil
+	}
+}
+
+func TestScripts(t *testing.T) {
+	t.Run("fields are variables of the sequence", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		id := e.saveScript(t, `{
+			"name": "greet", "alias": "Greet",
+			"fields": {"who": {"type": "string", "default": "world"}},
+			"sequence": [{"service": "test.block", "blocking": true, "params": {"value": "hello {{ who }}"}}]
+		}`)
+
+		result := e.runScript(id, map[string]any{"who": "kitchen"})
+		if got := svc.expectCall(t).Params["value"]; got != "hello kitchen" {
+			t.Errorf("value = %v, want hello kitchen", got)
+		}
+		svc.releaseOne(t)
+		if err := expectResult(t, result); err != nil {
+			t.Errorf("RunScript: %v", err)
+		}
+
+		// called as a service, the default of the field applies
+		result = make(chan error, 1)
+		go func() { result <- e.CallService(context.Background(), "script", "greet", nil, nil) }()
+		if got := svc.expectCall(t).Params["value"]; got != "hello world" {
+			t.Errorf("value = %v, want hello world", got)
+		}
+		svc.releaseOne(t)
+		if err := expectResult(t, result); err != nil {
+			t.Errorf("CallService: %v", err)
+		}
+	})
+
+	t.Run("queued runs wait for the run before", func(t *testing.T) {
+		e := newTestEngine(t)
+		svc := newBlockingService(e, "test", "block")
+		id := e.saveScript(t, `{
+			"name": "queued", "alias": "Queued", "mode": "queued", "max": 2,
+			"sequence": [{"service": "test.block", "blocking": true}]
+		}`)
+
+		first := e.runScript(id, nil)
+		svc.expectCall(t)
+		second := e.runScript(id, nil)
+		svc.expectNoCall(t)
+		svc.releaseOne(t)
+		if err := expectResult(t, first); err != nil {
+			t.Errorf("first run: %v", err)
+		}
+		svc.expectCall(t)
+		svc.releaseOne(t)
+		if err := expectResult(t, second); err != nil {
+			t.Errorf("second run: %v", err)
+		}
+	})
+
+	t.Run("queued script calling itself fails", func(t *testing.T) {
+		e := newTestEngine(t)
+		newBlockingService(e, "test", "block")
+		a := e.saveScript(t, `{"name": "a", "alias": "A", "mode": "queued", "sequence": [{"service": "test.block"}]}`)
+		e.saveScript(t, `{"name": "b", "alias": "B", "sequence": [{"service": "script.a", "blocking": true}]}`)
+		e.saveScript(t, fmt.Sprintf(`{"id": %d, "name": "a", "alias": "A", "mode": "queued", "sequence": [{"service": "script.b", "blocking": true}]}`, a))
+
+		err := expectResult(t, e.runScript(a, nil))
+		if !errors.Is(err, ErrScriptReentrant) {
+			t.Fatalf("RunScript = %v, want ErrScriptReentrant", err)
+		}
+		var traces []models.AutomationTrace
+		eventually(t, func() bool {
+			traces, _ = e.store.GetScriptTraces(context.Background(), a)
+			return len(traces) == 2
+		})
+		for _, trace := range traces {
+			if trace.Result != "failed" {
+				t.Errorf("trace result = %s, want failed", trace.Result)
+			}
+		}
+	})
+
+	t.Run("script calls are not bounded by the ActionTimeout", func(t *testing.T) {
+		e := newTestEngine(t)
+		e.ActionTimeout = 10 * time.Millisecond
+		e.saveScript(t, `{"name": "slow", "alias": "Slow", "sequence": [{"delay": "50ms"}]}`)
+
+		if err := e.CallService(context.Background(), "script", "slow", nil, nil); err != nil {
+			t.Errorf("CallService: %v", err)
+		}
+	})
+}
@@ -0,0 +1,298 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/types"
+	"home_automation_server/utils"
+	"time"
+)
+
+// errSequenceStopped is returned when a wait timed out and the step does not continue on timeout.
+var errSequenceStopped = errors.New("sequence stopped after wait timeout")
+
+// sequenceRun is the state shared by the steps of a running sequence.
+type sequenceRun struct {
+	vars  map[string]any // variables available to templates, e.g. the trigger
+	trace *automation.Trace
+}
+
+func (r *sequenceRun) withVars(vars map[string]any) *sequenceRun {
+	return &sequenceRun{vars: vars, trace: r.trace}
+}
+
+// runSequence executes the actions in order. It stops at the first failing step or when ctx is cancelled.
+// path locates the sequence in the automation for the trace, e.g. "action".
+func (e *Engine) runSequence(ctx context.Context, run *sequenceRun, actions []automation.Action, path string) error {
+	for i := range actions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := e.runStep(ctx, run, &actions[i], fmt.Sprintf("%s/%d", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) runStep(ctx context.Context, run *sequenceRun, action *automation.Action, path string) error {
+	typ, err := action.Type()
+	if err != nil {
+		return err
+	}
+
+	step := run.trace.StartStep(path, typ, action.Service)
+	if typ == automation.ActionTypeService {
+		return e.runServiceStep(ctx, run, action, step) // finishes the step itself, the call may not block
+	}
+	err = e.runControlStep(ctx, run, action, typ, step, path)
+	run.trace.FinishStep(step, err)
+	return err
+}
+
+// runControlStep executes the steps that control the flow of the sequence.
+func (e *Engine) runControlStep(ctx context.Context, run *sequenceRun, action *automation.Action, typ automation.ActionType, step *automation.TraceStep, path string) error {
+	switch typ {
+	case automation.ActionTypeDelay:
+		e.Logger.Debug("delaying sequence", zap.Duration("delay", action.Delay.Duration))
+		timer := time.NewTimer(action.Delay.Duration)
+		defer timer.Stop()
+		defer idle(ctx)()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+
+	case automation.ActionTypeWaitTemplate:
+		matched, err := e.waitFor(ctx, action, func(*types.Event) (bool, error) {
+			val, err := e.newRunEnv(run.vars).Render(action.WaitTemplate)
+			if err != nil {
+				return false, err
+			}
+			return utils.IsTruthy(val), nil
+		}, true)
+		return e.afterWait(run, action, step, matched, err)
+
+	case automation.ActionTypeWaitForTrigger:
+		triggers := make([]automation.Trigger, 0, len(action.WaitForTrigger))
+		for _, baseTrigger := range action.WaitForTrigger {
+			trigger, err := baseTrigger.AsTrigger()
+			if err != nil {
+				return fmt.Errorf("invalid wait_for_trigger: %w", err)
+			}
+			triggers = append(triggers, trigger)
+		}
+		matched, err := e.waitFor(ctx, action, func(event *types.Event) (bool, error) {
+			env := e.newRunEnv(run.vars)
+			env.Memory = nil // waits are short-lived, stateful triggers start fresh
+			for _, trigger := range triggers {
+				if fired, err := trigger.Evaluate(*event, env); err != nil || fired {
+					return fired, err
+				}
+			}
+			return false, nil
+		}, false)
+		return e.afterWait(run, action, step, matched, err)
+
+	case automation.ActionTypeChoose:
+		for i, option := range action.Choose {
+			passed, err := automation.EvaluateConditions(option.Conditions, e.newRunEnv(run.vars))
+			if err != nil {
+				return fmt.Errorf("choose condition failed: %w", err)
+			}
+			if passed {
+				run.trace.SetStepResult(step, "choice", i)
+				return e.runSequence(ctx, run, option.Sequence, fmt.Sprintf("%s/choose/%d/sequence", path, i))
+			}
+		}
+		run.trace.SetStepResult(step, "choice", "default")
+		return e.runSequence(ctx, run, action.Default, path+"/default")
+
+	case automation.ActionTypeRepeat:
+		return e.runRepeat(ctx, run, action.Repeat, step, path+"/repeat/sequence")
+
+	default:
+		return fmt.Errorf("unsupported action type: %s", typ)
+	}
+}
+
+// runServiceStep calls the service of the action. Blocking calls are awaited and stop the sequence on failure,
+// non-blocking calls are fired and forgotten. Both are bounded by the ActionTimeout and cancelled with the run.
+func (e *Engine) runServiceStep(ctx context.Context, run *sequenceRun, action *automation.Action, step *automation.TraceStep) error {
+	resolved, err := e.resolveServiceCall(action, run.vars)
+	if err != nil {
+		run.trace.FinishStep(step, err)
+		return err
+	}
+	run.trace.SetCall(step, resolved.Params, resolved.Targets)
+	if len(action.Targets) > 0 && len(resolved.Targets) == 0 {
+		e.Logger.Info("Targets match no entities, skipping service call", zap.String("service", resolved.Service))
+		run.trace.FinishStep(step, nil)
+		return nil
+	}
+
+	call := func() error {
+		callCtx := ctx
+		if e.ActionTimeout > 0 && !isScriptCall(resolved) && !isSceneCall(resolved) {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(ctx, e.ActionTimeout)
+			defer cancel()
+		}
+		err := e.executeActionWithRetry(callCtx, resolved, run.trace, step)
+		run.trace.FinishStep(step, err)
+		return err
+	}
+
+	if !resolved.Blocking {
+		run.trace.Go(func() {
+			if err := call(); err != nil {
+				e.Logger.Error("Failed non-blocking action", zap.String("service", resolved.Service), zap.Error(err))
+			}
+		})
+		return nil
+	}
+
+	// Wait for completion
+	if err := call(); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			e.Logger.Warn("Actions timed out", zap.String("service", resolved.Service))
+		}
+		return fmt.Errorf("blocking action %s failed: %w", resolved.Service, err)
+	}
+	return nil
+}
+
+// resolveServiceCall returns a copy of the action with its params and targets rendered, the targets expanded
+// to entities and their entity IDs translated to the external IDs of the integration.
+func (e *Engine) resolveServiceCall(action *automation.Action, vars map[string]any) (*automation.Action, error) {
+	resolved := *action
+	params, err := e.ResolveActionParams(action, vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve action params: %w", err)
+	}
+	resolved.Params = params
+
+	targets, err := e.resolveTargets(action.Targets, vars)
+	if err != nil {
+		return nil, err
+	}
+	resolved.Targets, err = e.ResolveTargetsToExternalID(e.expandTargets(action.Service, targets))
+	if err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+func (e *Engine) runRepeat(ctx context.Context, run *sequenceRun, repeat *automation.Repeat, step *automation.TraceStep, path string) error {
+	if repeat.Count <= 0 && len(repeat.While) == 0 && len(repeat.Until) == 0 {
+		return errors.New("repeat requires count, while or until")
+	}
+
+	iterations := 0
+	defer func() { run.trace.SetStepResult(step, "iterations", iterations) }()
+
+	for i := 0; repeat.Count <= 0 || i < repeat.Count; i++ {
+		// the current iteration is available to templates as repeat.index (starting at 1) and repeat.first
+		iterVars := make(map[string]any, len(run.vars)+1)
+		for k, v := range run.vars {
+			iterVars[k] = v
+		}
+		iterVars["repeat"] = map[string]any{"index": i + 1, "first": i == 0}
+
+		if len(repeat.While) > 0 {
+			passed, err := automation.EvaluateConditions(repeat.While, e.newRunEnv(iterVars))
+			if err != nil {
+				return fmt.Errorf("repeat while condition failed: %w", err)
+			}
+			if !passed {
+				return nil
+			}
+		}
+
+		iterations++
+		if err := e.runSequence(ctx, run.withVars(iterVars), repeat.Sequence, path); err != nil {
+			return err
+		}
+
+		if len(repeat.Until) > 0 {
+			passed, err := automation.EvaluateConditions(repeat.Until, e.newRunEnv(iterVars))
+			if err != nil {
+				return fmt.Errorf("repeat until condition failed: %w", err)
+			}
+			if passed {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// waitFor blocks until check passes for a processed event, the timeout of the action expires or ctx is cancelled.
+// If checkNow is set, check is also run against the current state (with a nil event) before waiting.
+// The processed events are observed, and the time_changed events of the scheduler.
+func (e *Engine) waitFor(ctx context.Context, action *automation.Action, check func(*types.Event) (bool, error), checkNow bool) (bool, error) {
+	// subscribe before the first check so no event is missed in between. time_changed events are not
+	// broadcast, they have their own bus.
+	events := e.ProcessedEventBus.Subscribe()
+	defer e.ProcessedEventBus.Unsubscribe(events)
+	timeEvents := e.timeEvents.Subscribe()
+	defer e.timeEvents.Unsubscribe(timeEvents)
+
+	if checkNow {
+		if matched, err := check(nil); err != nil || matched {
+			return matched, err
+		}
+	}
+
+	var timeout <-chan time.Time
+	if action.Timeout != nil && action.Timeout.Duration > 0 {
+		timer := time.NewTimer(action.Timeout.Duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	defer idle(ctx)()
+
+	for {
+		var event types.Event
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-timeout:
+			return false, nil
+		case ev, ok := <-events:
+			if !ok {
+				return false, errors.New("event bus closed")
+			}
+			event = ev
+		case event = <-timeEvents:
+		}
+
+		matched, err := check(&event)
+		if err != nil {
+			e.Logger.Warn("wait check failed", zap.Error(err))
+			continue
+		}
+		if matched {
+			return true, nil
+		}
+	}
+}
+
+func (e *Engine) afterWait(run *sequenceRun, action *automation.Action, step *automation.TraceStep, matched bool, err error) error {
+	if err != nil {
+		return err
+	}
+	run.trace.SetStepResult(step, "timed_out", !matched)
+	if !matched {
+		e.Logger.Info("wait timed out", zap.Bool("continue", action.ContinuesOnTimeout()))
+		if !action.ContinuesOnTimeout() {
+			return errSequenceStopped
+		}
+	}
+	return nil
+}
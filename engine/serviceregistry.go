@@ -4,20 +4,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
 	"home_automation_server/automation"
 	"home_automation_server/integrations"
+	"home_automation_server/types"
 	"sync"
+	"time"
 )
 
 type ServiceRegistry struct {
 	mu       sync.RWMutex
 	services map[string]integrations.ServiceSpec // key = "domain.service"
+
+	entities  *EntityRegistry // resolves the targets of calls for their call_service events
+	causality *causality
+	events    chan<- types.Event // receives a call_service event for every call
+	logger    *zap.Logger
 }
 
-func newServiceRegistry() *ServiceRegistry {
+func newServiceRegistry(entities *EntityRegistry, causality *causality, events chan<- types.Event, logger *zap.Logger) *ServiceRegistry {
 	return &ServiceRegistry{
-		mu:       sync.RWMutex{},
-		services: make(map[string]integrations.ServiceSpec),
+		mu:        sync.RWMutex{},
+		services:  make(map[string]integrations.ServiceSpec),
+		entities:  entities,
+		causality: causality,
+		events:    events,
+		logger:    logger,
 	}
 }
 
@@ -28,15 +41,96 @@ func (r *ServiceRegistry) Register(domain, service string, spec integrations.Ser
 	r.services[key] = spec
 }
 
+func (r *ServiceRegistry) Unregister(domain, service string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.services, getKey(domain, service))
+}
+
+// Call invokes the handler of the service. The params of the action are coerced to the types declared in the
+// ParamMetadata of the service first, the handler receives a copy of the action with the coerced params.
+//
+// Every call gets its own context, with the run or call it was made from as parent, and is published as a
+// call_service event once the handler returned. State changes of the targets are attributed to the call.
 func (r *ServiceRegistry) Call(ctx context.Context, domain, service string, action *automation.Action) error {
+	callContext := &types.Context{ID: uuid.NewString()}
+	if caller := callerContext(ctx); caller != nil {
+		callContext.ParentID = caller.ID
+	}
+	targets := r.targetEntityIDs(action.Targets)
+	r.causality.link(ContextLink{ContextID: callContext.ID, ParentID: callContext.ParentID, Service: getKey(domain, service)})
+	r.causality.recordCall(callContext.ID, targets)
+
+	timeFired := time.Now()
+	params, err := r.call(withCallerContext(ctx, callContext), domain, service, action)
+
+	data := types.CallServiceData{
+		Domain:      domain,
+		Service:     service,
+		ServiceData: params,
+		Targets:     targets,
+		Success:     err == nil,
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	event := types.Event{
+		Type:      types.EventTypeCallService,
+		Data:      data,
+		Context:   callContext,
+		TimeFired: timeFired,
+	}
+	// non-blocking like EventPipeline.sendEvent, the caller is not held up by a busy event loop
+	select {
+	case r.events <- event:
+	default:
+		r.logger.Warn("event channel full, dropping call_service event", zap.String("service", getKey(domain, service)))
+	}
+	return err
+}
+
+// call coerces the params and invokes the handler. It returns the params the handler was called with, or the
+// given params if the call failed before.
+func (r *ServiceRegistry) call(ctx context.Context, domain, service string, action *automation.Action) (map[string]any, error) {
 	key := getKey(domain, service)
 	r.mu.RLock()
-	defer r.mu.RUnlock()
 	serviceData, ok := r.services[key]
+	r.mu.RUnlock()
 	if !ok {
-		return errors.New(fmt.Sprintf("service %s not registered yet", key))
+		return action.Params, errors.New(fmt.Sprintf("service %s not registered yet", key))
+	}
+
+	params, err := integrations.CoerceParams(serviceData.Params, action.Params)
+	if err != nil {
+		return action.Params, fmt.Errorf("invalid params for service %s: %w", key, err)
+	}
+	coerced := *action
+	coerced.Params = params
+	return params, serviceData.Handler(ctx, &coerced)
+}
+
+// targetEntityIDs translates the external IDs of the targets back to entity IDs. Targets that are not
+// registered are kept as they are.
+func (r *ServiceRegistry) targetEntityIDs(targets []automation.Target) []string {
+	if len(targets) == 0 {
+		return nil
+	}
+	entityIDs := make([]string, len(targets))
+	for i, t := range targets {
+		entityIDs[i] = t.EntityID
+		if entityID, ok := r.entities.Resolve(t.EntityID); ok {
+			entityIDs[i] = entityID
+		}
 	}
-	return serviceData.Handler(ctx, action)
+	return entityIDs
+}
+
+// Get returns the spec of a registered service.
+func (r *ServiceRegistry) Get(domain, service string) (integrations.ServiceSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, ok := r.services[getKey(domain, service)]
+	return spec, ok
 }
 
 func getKey(domain, service string) string {
@@ -44,6 +138,8 @@ func getKey(domain, service string) string {
 }
 
 func (r *ServiceRegistry) GetAll() map[string]integrations.ServiceSpec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	services := make(map[string]integrations.ServiceSpec)
 	for name, serviceSpec := range r.services {
 		services[name] = serviceSpec
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+)
+
+// ErrServiceNotFound is returned by CallService for services that are not registered.
+var ErrServiceNotFound = errors.New("service not found")
+
+// CallService calls a service directly, e.g. from the API. The call is validated like a service call of an
+// automation and runs like a blocking action: templated params are rendered, the targets are expanded to
+// entities and translated to the external IDs of the integration, and the call is bounded by the
+// ActionTimeout and retried according to the RetryPolicy. Invalid calls return a *automation.ValidationError.
+// Calls whose targets match no entities are skipped.
+func (e *Engine) CallService(ctx context.Context, domain, service string, targets []automation.Target, params map[string]any) error {
+	if _, ok := e.ServiceRegistry.Get(domain, service); !ok {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, getKey(domain, service))
+	}
+
+	action := &automation.Action{Service: getKey(domain, service), Targets: targets, Params: params, Blocking: true}
+	v := &automation.Validator{}
+	e.validateServiceCall(v, action, "call")
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	resolved, err := e.resolveServiceCall(action, map[string]any{})
+	if err != nil {
+		return err
+	}
+	if len(targets) > 0 && len(resolved.Targets) == 0 {
+		e.Logger.Info("Targets match no entities, skipping service call", zap.String("service", resolved.Service))
+		return nil
+	}
+
+	callCtx := ctx
+	if e.ActionTimeout > 0 && !isScriptCall(resolved) && !isSceneCall(resolved) {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, e.ActionTimeout)
+		defer cancel()
+	}
+	e.Logger.Info("Calling service directly", zap.String("service", resolved.Service), zap.Any("targets", targets))
+	return e.executeActionWithRetry(callCtx, resolved, nil, nil)
+}
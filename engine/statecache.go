@@ -28,8 +28,12 @@ func (s *StateCache) Get(entityID string) (types.State, bool) {
 	return state, ok
 }
 
+// GetAll returns a copy of all states.
 func (s *StateCache) GetAll() []types.State {
-	res := make([]types.State, 0)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]types.State, 0, len(s.cache))
 	for _, state := range s.cache {
 		res = append(res, state)
 	}
@@ -59,3 +63,73 @@ func (s *StateCache) Set(entityID string, newState types.State) {
 
 	s.cache[entityID] = newState
 }
+
+// Rename moves the state of an entity to its new entity ID. It reports whether the entity had a state.
+func (s *StateCache) Rename(entityID, newEntityID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.cache[entityID]
+	if !ok {
+		return false
+	}
+	delete(s.cache, entityID)
+	state.EntityID = newEntityID
+	s.cache[newEntityID] = state
+	return true
+}
+
+// Delete removes the state of the given entityID.
+func (s *StateCache) Delete(entityID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cache, entityID)
+}
+
+// disabledStates keeps the last states of disabled entities, which are removed from the state cache, so they
+// can be restored when the entities are enabled again.
+type disabledStates struct {
+	mu     sync.Mutex
+	states map[string]types.State
+}
+
+func newDisabledStates() *disabledStates {
+	return &disabledStates{states: make(map[string]types.State)}
+}
+
+func (d *disabledStates) put(entityID string, state types.State) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.states[entityID] = state
+}
+
+// take removes and returns the states of the entities for which enabled is true.
+func (d *disabledStates) take(enabled func(entityID string) bool) []types.State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var states []types.State
+	for entityID, state := range d.states {
+		if enabled(entityID) {
+			states = append(states, state)
+			delete(d.states, entityID)
+		}
+	}
+	return states
+}
+
+func (d *disabledStates) rename(entityID, newEntityID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if state, ok := d.states[entityID]; ok {
+		delete(d.states, entityID)
+		state.EntityID = newEntityID
+		d.states[newEntityID] = state
+	}
+}
+
+func (d *disabledStates) delete(entityID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.states, entityID)
+}
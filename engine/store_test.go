@@ -0,0 +1,575 @@
+package engine
+
+import (
+	"context"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"home_automation_server/storage/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memStore implements the storage interfaces of the engine in memory.
+type memStore struct {
+	mu           sync.Mutex
+	automations  map[uint64]models.Automation
+	scripts      map[uint]models.Script
+	scenes       map[uint]models.Scene
+	devices      map[string]models.Device
+	entities     map[entityKey]models.Entity
+	areas        map[string]models.Area
+	helpers      map[string]models.Helper
+	integrations map[uint]models.IntegrationConfig
+	traces       []models.AutomationTrace
+	events       []models.Event
+	nextID       uint64
+}
+
+type entityKey struct {
+	integrationID uint
+	externalID    string
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		automations:  make(map[uint64]models.Automation),
+		scripts:      make(map[uint]models.Script),
+		scenes:       make(map[uint]models.Scene),
+		devices:      make(map[string]models.Device),
+		entities:     make(map[entityKey]models.Entity),
+		areas:        make(map[string]models.Area),
+		helpers:      make(map[string]models.Helper),
+		integrations: make(map[uint]models.IntegrationConfig),
+	}
+}
+
+func (s *memStore) id() uint64 {
+	s.nextID++
+	return s.nextID
+}
+
+// sortedValues returns the values of m ordered by key.
+func sortedValues[K interface{ ~uint | ~uint64 | ~string }, V any](m map[K]V) []V {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	values := make([]V, 0, len(m))
+	for _, k := range keys {
+		values = append(values, m[k])
+	}
+	return values
+}
+
+// EventStore
+
+func (s *memStore) SaveEvent(ctx context.Context, event models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// AutomationStore
+
+func (s *memStore) LoadAutomations(ctx context.Context) ([]models.Automation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedValues(s.automations), nil
+}
+
+func (s *memStore) GetAutomation(ctx context.Context, id uint64) (*models.Automation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.automations[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &a, nil
+}
+
+func (s *memStore) CreateAutomation(ctx context.Context, a *models.Automation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.ID == 0 {
+		a.ID = s.id()
+	}
+	s.automations[a.ID] = *a
+	return nil
+}
+
+func (s *memStore) UpdateAutomation(ctx context.Context, a *models.Automation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.automations[a.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	s.automations[a.ID] = *a
+	return nil
+}
+
+func (s *memStore) DeleteAutomation(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.automations[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.automations, id)
+	return nil
+}
+
+func (s *memStore) UpdateLastTriggered(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.automations[id]; ok {
+		now := time.Now()
+		a.LastTriggered = &now
+		s.automations[id] = a
+	}
+	return nil
+}
+
+func (s *memStore) UpdateEnabled(ctx context.Context, id uint64, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.automations[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	a.Enabled = enabled
+	s.automations[id] = a
+	return nil
+}
+
+// ScriptStore
+
+func (s *memStore) LoadScripts(ctx context.Context) ([]models.Script, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedValues(s.scripts), nil
+}
+
+func (s *memStore) GetScript(ctx context.Context, id uint) (*models.Script, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.scripts[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &sc, nil
+}
+
+func (s *memStore) CreateScript(ctx context.Context, sc *models.Script) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sc.ID == 0 {
+		sc.ID = uint(s.id())
+	}
+	s.scripts[sc.ID] = *sc
+	return nil
+}
+
+func (s *memStore) UpdateScript(ctx context.Context, sc *models.Script) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scripts[sc.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	s.scripts[sc.ID] = *sc
+	return nil
+}
+
+func (s *memStore) DeleteScript(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scripts[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.scripts, id)
+	return nil
+}
+
+// SceneStore
+
+func (s *memStore) LoadScenes(ctx context.Context) ([]models.Scene, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedValues(s.scenes), nil
+}
+
+func (s *memStore) GetScene(ctx context.Context, id uint) (*models.Scene, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.scenes[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &sc, nil
+}
+
+func (s *memStore) CreateScene(ctx context.Context, sc *models.Scene) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sc.ID == 0 {
+		sc.ID = uint(s.id())
+	}
+	s.scenes[sc.ID] = *sc
+	return nil
+}
+
+func (s *memStore) UpdateScene(ctx context.Context, sc *models.Scene) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scenes[sc.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	s.scenes[sc.ID] = *sc
+	return nil
+}
+
+func (s *memStore) DeleteScene(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scenes[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.scenes, id)
+	return nil
+}
+
+// DeviceStore
+
+func (s *memStore) AddDevice(ctx context.Context, d *models.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices[d.ID] = *d
+	return nil
+}
+
+func (s *memStore) UpdateDevice(ctx context.Context, d *models.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices[d.ID] = *d
+	return nil
+}
+
+func (s *memStore) GetDeviceByID(ctx context.Context, id string) (*models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.devices[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &d, nil
+}
+
+func (s *memStore) GetAllDevices(ctx context.Context) ([]*models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []*models.Device
+	for _, d := range sortedValues(s.devices) {
+		devices = append(devices, &d)
+	}
+	return devices, nil
+}
+
+func (s *memStore) GetDevicesByIntegration(ctx context.Context, integrationID uint) ([]*models.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []*models.Device
+	for _, d := range sortedValues(s.devices) {
+		if d.IntegrationID == integrationID {
+			devices = append(devices, &d)
+		}
+	}
+	return devices, nil
+}
+
+func (s *memStore) DeleteDevice(ctx context.Context, id uint) error {
+	return nil // devices are keyed by their string ID, nothing calls this
+}
+
+// EntityStore
+
+func (s *memStore) AddEntity(ctx context.Context, e *models.Entity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entities[entityKey{e.IntegrationID, e.ExternalID}] = *e
+	return nil
+}
+
+func (s *memStore) UpdateEntity(ctx context.Context, e *models.Entity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entities[entityKey{e.IntegrationID, e.ExternalID}] = *e
+	return nil
+}
+
+func (s *memStore) GetEntityByID(ctx context.Context, integrationID uint, externalID string) (*models.Entity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entities[entityKey{integrationID, externalID}]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &e, nil
+}
+
+func (s *memStore) GetAllEntities(ctx context.Context) ([]models.Entity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filterEntities(func(models.Entity) bool { return true }), nil
+}
+
+func (s *memStore) GetEntitiesByDevice(ctx context.Context, deviceID string) ([]models.Entity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filterEntities(func(e models.Entity) bool { return e.DeviceID == deviceID }), nil
+}
+
+func (s *memStore) GetEntitiesByDeviceIDs(ctx context.Context, deviceIDs []string) ([]models.Entity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filterEntities(func(e models.Entity) bool { return slices.Contains(deviceIDs, e.DeviceID) }), nil
+}
+
+func (s *memStore) DeleteEntity(ctx context.Context, integrationID uint, externalID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entities, entityKey{integrationID, externalID})
+	return nil
+}
+
+// filterEntities returns the matching entities ordered by entity ID, s.mu must be held.
+func (s *memStore) filterEntities(match func(models.Entity) bool) []models.Entity {
+	var entities []models.Entity
+	for _, e := range s.entities {
+		if match(e) {
+			entities = append(entities, e)
+		}
+	}
+	slices.SortFunc(entities, func(a, b models.Entity) int {
+		if a.EntityID < b.EntityID {
+			return -1
+		}
+		if a.EntityID > b.EntityID {
+			return 1
+		}
+		return 0
+	})
+	return entities
+}
+
+// AreaStore
+
+func (s *memStore) LoadAreas(ctx context.Context) ([]models.Area, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedValues(s.areas), nil
+}
+
+func (s *memStore) GetArea(ctx context.Context, id string) (*models.Area, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.areas[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &a, nil
+}
+
+func (s *memStore) CreateArea(ctx context.Context, a *models.Area) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.areas[a.ID] = *a
+	return nil
+}
+
+func (s *memStore) UpdateArea(ctx context.Context, a *models.Area) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.areas[a.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	s.areas[a.ID] = *a
+	return nil
+}
+
+func (s *memStore) DeleteArea(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.areas[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.areas, id)
+	return nil
+}
+
+func (s *memStore) AssignDevices(ctx context.Context, areaID string, deviceIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range deviceIDs {
+		if d, ok := s.devices[id]; ok {
+			d.AreaID = areaID
+			s.devices[id] = d
+		}
+	}
+	return nil
+}
+
+func (s *memStore) AssignEntities(ctx context.Context, areaID string, entityIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.entities {
+		if slices.Contains(entityIDs, e.EntityID) {
+			e.AreaID = areaID
+			s.entities[k] = e
+		}
+	}
+	return nil
+}
+
+// HelperStore
+
+func (s *memStore) LoadHelpers(ctx context.Context) ([]models.Helper, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedValues(s.helpers), nil
+}
+
+func (s *memStore) CreateHelper(ctx context.Context, h *models.Helper) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.helpers[h.ID] = *h
+	return nil
+}
+
+func (s *memStore) UpdateHelper(ctx context.Context, h *models.Helper) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.helpers[h.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	s.helpers[h.ID] = *h
+	return nil
+}
+
+func (s *memStore) DeleteHelper(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.helpers, id)
+	return nil
+}
+
+func (s *memStore) SaveHelperState(ctx context.Context, id string, state datatypes.JSON) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.helpers[id]; ok {
+		h.State = state
+		s.helpers[id] = h
+	}
+	return nil
+}
+
+// IntegrationCfgStore
+
+func (s *memStore) Save(ctx context.Context, cfg *models.IntegrationConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cfg.ID == 0 {
+		cfg.ID = uint(s.id())
+	}
+	s.integrations[cfg.ID] = *cfg
+	return nil
+}
+
+func (s *memStore) LoadAll(ctx context.Context) ([]*models.IntegrationConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cfgs []*models.IntegrationConfig
+	for _, cfg := range sortedValues(s.integrations) {
+		cfgs = append(cfgs, &cfg)
+	}
+	return cfgs, nil
+}
+
+func (s *memStore) LoadByID(ctx context.Context, id uint) (*models.IntegrationConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg, ok := s.integrations[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &cfg, nil
+}
+
+func (s *memStore) LoadByIntegrationName(ctx context.Context, name string) (*models.IntegrationConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cfg := range sortedValues(s.integrations) {
+		if cfg.IntegrationName == name {
+			return &cfg, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *memStore) Delete(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.integrations, id)
+	return nil
+}
+
+func (s *memStore) AutoMigrate() error { return nil }
+
+// TraceStore
+
+func (s *memStore) SaveTrace(ctx context.Context, trace models.AutomationTrace, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traces = append(s.traces, trace)
+	return nil
+}
+
+func (s *memStore) GetTraces(ctx context.Context, automationID uint64) ([]models.AutomationTrace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var traces []models.AutomationTrace
+	for _, t := range slices.Backward(s.traces) {
+		if t.ScriptID == 0 && t.AutomationID == automationID {
+			traces = append(traces, t)
+		}
+	}
+	return traces, nil
+}
+
+func (s *memStore) DeleteTraces(ctx context.Context, automationID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traces = slices.DeleteFunc(s.traces, func(t models.AutomationTrace) bool {
+		return t.ScriptID == 0 && t.AutomationID == automationID
+	})
+	return nil
+}
+
+func (s *memStore) GetScriptTraces(ctx context.Context, scriptID uint) ([]models.AutomationTrace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var traces []models.AutomationTrace
+	for _, t := range slices.Backward(s.traces) {
+		if t.ScriptID == scriptID {
+			traces = append(traces, t)
+		}
+	}
+	return traces, nil
+}
+
+func (s *memStore) DeleteScriptTraces(ctx context.Context, scriptID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traces = slices.DeleteFunc(s.traces, func(t models.AutomationTrace) bool { return t.ScriptID == scriptID })
+	return nil
+}
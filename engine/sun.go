@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"home_automation_server/sun"
+	"home_automation_server/types"
+	"home_automation_server/utils"
+	"time"
+)
+
+const (
+	SunEntityID = "sun.sun"
+
+	SunStateAboveHorizon = "above_horizon"
+	SunStateBelowHorizon = "below_horizon"
+)
+
+// updateSunEntity recomputes the sun.sun entity and processes a state_changed event if it changed.
+func (e *Engine) updateSunEntity(ctx context.Context, now time.Time) {
+	if e.Home.Location == nil {
+		return
+	}
+
+	newState := sunState(*e.Home.Location, now)
+	oldState, exists := e.StateCache.Get(SunEntityID)
+	if exists && utils.AnyEqual(oldState.State, newState.State) && sameAttributes(oldState.Attributes, newState.Attributes) {
+		return
+	}
+
+	context := &types.Context{ID: uuid.NewString()}
+	newState.Context = context
+
+	var old *types.State
+	if exists {
+		old = &oldState
+	}
+
+	e.processEvent(ctx, types.Event{
+		Type: types.EventTypeStateChanged,
+		Data: types.StateChangedData{
+			EntityID: SunEntityID,
+			OldState: old,
+			NewState: &newState,
+		},
+		Context:   context,
+		TimeFired: now,
+	})
+}
+
+func sunState(location sun.Location, now time.Time) types.State {
+	state := SunStateBelowHorizon
+	if location.Elevation(now) > sun.HorizonElevation {
+		state = SunStateAboveHorizon
+	}
+
+	next := func(event sun.Event) any {
+		t := location.Next(event, now)
+		if t.IsZero() {
+			return nil
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	return types.State{
+		EntityID: SunEntityID,
+		State:    state,
+		Attributes: map[string]any{
+			"next_dawn":    next(sun.Dawn),
+			"next_rising":  next(sun.Sunrise),
+			"next_noon":    next(sun.Noon),
+			"next_setting": next(sun.Sunset),
+			"next_dusk":    next(sun.Dusk),
+		},
+	}
+}
+
+func sameAttributes(a, b map[string]any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if !utils.AnyEqual(v, b[k]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/storage/models"
+	"slices"
+	"sync"
+)
+
+// targetIndex keeps the stored entities indexed by device, area, entity type and label, so targets and entity
+// filters are resolved without loading every entity and device. It is rebuilt with the entity registry and
+// whenever the entities, devices or areas are changed through the engine.
+type targetIndex struct {
+	mu          sync.RWMutex
+	entities    []models.Entity   // entities of disabled devices are disabled
+	deviceAreas map[string]string // device ID -> area ID
+	byDevice    map[string][]int  // device ID -> indices into entities
+	byArea      map[string][]int  // area ID, the entity's own or else its device's -> indices into entities
+	byType      map[string][]int
+	byLabel     map[string][]int
+}
+
+func newTargetIndex() *targetIndex {
+	return &targetIndex{
+		deviceAreas: make(map[string]string),
+		byDevice:    make(map[string][]int),
+		byArea:      make(map[string][]int),
+		byType:      make(map[string][]int),
+		byLabel:     make(map[string][]int),
+	}
+}
+
+// replace rebuilds the index from the stored entities and devices. Entities are kept oldest first.
+func (x *targetIndex) replace(entities []models.Entity, devices []*models.Device) {
+	next := newTargetIndex()
+	disabledDevices := make(map[string]struct{})
+	for _, d := range devices {
+		next.deviceAreas[d.ID] = d.AreaID
+		if !d.Enabled {
+			disabledDevices[d.ID] = struct{}{}
+		}
+	}
+	next.entities = slices.Clone(entities)
+	slices.SortStableFunc(next.entities, func(a, b models.Entity) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	for i := range next.entities {
+		ent := &next.entities[i]
+		if _, ok := disabledDevices[ent.DeviceID]; ok {
+			ent.Enabled = false
+		}
+
+		area := ent.AreaID
+		if area == "" {
+			area = next.deviceAreas[ent.DeviceID]
+		}
+		if ent.DeviceID != "" {
+			next.byDevice[ent.DeviceID] = append(next.byDevice[ent.DeviceID], i)
+		}
+		if area != "" {
+			next.byArea[area] = append(next.byArea[area], i)
+		}
+		next.byType[ent.Type] = append(next.byType[ent.Type], i)
+		for _, label := range entityLabels(*ent) {
+			next.byLabel[label] = append(next.byLabel[label], i)
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.entities = next.entities
+	x.deviceAreas = next.deviceAreas
+	x.byDevice = next.byDevice
+	x.byArea = next.byArea
+	x.byType = next.byType
+	x.byLabel = next.byLabel
+}
+
+// match returns the entities that match every selector of the target, in the order of the index. A target
+// without selectors matches every entity.
+func (x *targetIndex) match(t automation.Target) []models.Entity {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	// narrow down by one selector, selects checks the others
+	var candidates []int
+	switch {
+	case t.DeviceID != "":
+		candidates = x.byDevice[t.DeviceID]
+	case t.EntityType != "":
+		candidates = x.byType[string(t.EntityType)]
+	case t.AreaID != "":
+		candidates = x.byArea[t.AreaID]
+	case t.Label != "":
+		candidates = x.byLabel[t.Label]
+	default:
+		return append([]models.Entity(nil), x.entities...)
+	}
+
+	matched := make([]models.Entity, 0, len(candidates))
+	for _, i := range candidates {
+		ent := x.entities[i]
+		if selects(t, ent, x.deviceAreas[ent.DeviceID]) {
+			matched = append(matched, ent)
+		}
+	}
+	return matched
+}
+
+// devicesIn returns the IDs of the devices in the area.
+func (x *targetIndex) devicesIn(areaID string) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var devices []string
+	for deviceID, area := range x.deviceAreas {
+		if area == areaID {
+			devices = append(devices, deviceID)
+		}
+	}
+	return devices
+}
+
+// refreshTargetIndex rebuilds the target index from the stored entities and devices, after they are changed
+// outside of discovery. Errors are logged, the index keeps its previous entries until the next refresh.
+func (e *Engine) refreshTargetIndex(ctx context.Context) {
+	entities, err := e.EntityStore.GetAllEntities(ctx)
+	if err != nil {
+		e.Logger.Error("failed to refresh target index", zap.Error(err))
+		return
+	}
+	devices, err := e.DeviceStore.GetAllDevices(ctx)
+	if err != nil {
+		e.Logger.Error("failed to refresh target index", zap.Error(err))
+		return
+	}
+	e.targets.replace(entities, devices)
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"encoding/json"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/storage/models"
+	"slices"
+	"strings"
+)
+
+// expandTargets replaces the device, area, entity type and label targets of a call to the service with entity
+// targets for the entities they select. Only enabled and available entities of a type the service accepts are
+// selected. Entity targets are kept as they are; an entity selected more than once is targeted once.
+func (e *Engine) expandTargets(service string, targets []automation.Target) []automation.Target {
+	if !slices.ContainsFunc(targets, automation.Target.IsSelector) {
+		return targets
+	}
+
+	var spec integrations.TargetSpec
+	if domain, name, ok := strings.Cut(service, "."); ok {
+		if s, ok := e.ServiceRegistry.Get(domain, name); ok {
+			spec = s.AllowedTargets
+		}
+	}
+
+	seen := make(map[string]struct{})
+	expanded := make([]automation.Target, 0, len(targets))
+	add := func(entityID string) {
+		if _, ok := seen[entityID]; ok {
+			return
+		}
+		seen[entityID] = struct{}{}
+		expanded = append(expanded, automation.Target{EntityID: entityID})
+	}
+
+	for _, t := range targets {
+		if t.IsEntity() {
+			add(t.EntityID)
+			continue
+		}
+		for _, ent := range e.targets.match(t) {
+			if ent.Enabled && ent.Available && acceptsEntity(spec, ent.EntityID) {
+				add(ent.EntityID)
+			}
+		}
+	}
+	return expanded
+}
+
+// selects reports whether the entity matches every selector of the target. The area of an entity is its own,
+// or that of its device if it has none.
+func selects(t automation.Target, ent models.Entity, deviceArea string) bool {
+	if t.DeviceID != "" && ent.DeviceID != t.DeviceID {
+		return false
+	}
+	if t.EntityType != "" && ent.Type != string(t.EntityType) {
+		return false
+	}
+	if t.AreaID != "" {
+		area := ent.AreaID
+		if area == "" {
+			area = deviceArea
+		}
+		if area != t.AreaID {
+			return false
+		}
+	}
+	if t.Label != "" && !slices.Contains(entityLabels(ent), t.Label) {
+		return false
+	}
+	return true
+}
+
+// entityLabels decodes the labels of an entity. Malformed labels are treated as none.
+func entityLabels(ent models.Entity) []string {
+	if len(ent.Labels) == 0 {
+		return nil
+	}
+	var labels []string
+	if err := json.Unmarshal(ent.Labels, &labels); err != nil {
+		return nil
+	}
+	return labels
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/storage/models"
+	"home_automation_server/types"
+	"slices"
+	"testing"
+)
+
+// newTargetTestEngine returns an engine with lights, a switch and the service test.lights, which accepts lights.
+// The handler receives the targets of each call.
+func newTargetTestEngine(t *testing.T) (*testEngine, chan []automation.Target) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	e.store.AddDevice(ctx, &models.Device{ID: "dev-1", IntegrationID: 1, Enabled: true, AreaID: "kitchen"})
+	e.store.AddDevice(ctx, &models.Device{ID: "dev-2", IntegrationID: 1, Enabled: true, AreaID: "hall"})
+	e.store.AddDevice(ctx, &models.Device{ID: "dev-3", IntegrationID: 1, Enabled: false, AreaID: "hall"})
+
+	spot := testEntity(1, "ext-spot", "light.kitchen_spot", "dev-1")
+	spot.AreaID = "hall"
+	hall := testEntity(1, "ext-hall", "light.hall", "dev-2")
+	hall.Labels = []byte(`["night"]`)
+	broken := testEntity(1, "ext-broken", "light.broken", "dev-2")
+	broken.Available = false
+	disabled := testEntity(1, "ext-disabled", "light.disabled", "dev-2")
+	disabled.Enabled = false
+	e.addEntities(t,
+		testEntity(1, "ext-kitchen", "light.kitchen", "dev-1"),
+		spot,
+		testEntity(1, "ext-fan", "switch.kitchen_fan", "dev-1"),
+		hall,
+		broken,
+		disabled,
+		testEntity(1, "ext-porch", "light.porch", "dev-3"),
+	)
+
+	calls := make(chan []automation.Target, 16)
+	e.RegisterService("test", "lights", integrations.ServiceSpec{
+		AllowedTargets: integrations.TargetSpec{
+			Type:        []integrations.TargetType{integrations.TargetTypeEntity},
+			EntityTypes: []types.EntityType{"light"},
+		},
+		Handler: func(ctx context.Context, action *automation.Action) error {
+			calls <- action.Targets
+			return nil
+		},
+	})
+	return e, calls
+}
+
+func TestExpandTargets(t *testing.T) {
+	e, _ := newTargetTestEngine(t)
+
+	tests := []struct {
+		name    string
+		targets []automation.Target
+		want    []string
+	}{
+		{"device", []automation.Target{{DeviceID: "dev-1"}}, []string{"light.kitchen", "light.kitchen_spot"}},
+		{"area of the device", []automation.Target{{AreaID: "kitchen"}}, []string{"light.kitchen"}},
+		{"area of the entity", []automation.Target{{AreaID: "hall"}}, []string{"light.kitchen_spot", "light.hall"}},
+		{"entity type", []automation.Target{{EntityType: "light"}}, []string{"light.kitchen", "light.kitchen_spot", "light.hall"}},
+		{"entity type the service does not accept", []automation.Target{{EntityType: "switch"}}, []string{}},
+		{"label", []automation.Target{{Label: "night"}}, []string{"light.hall"}},
+		{"all selectors must match", []automation.Target{{AreaID: "hall", Label: "night"}}, []string{"light.hall"}},
+		{"no match", []automation.Target{{AreaID: "garage"}}, []string{}},
+		{"entities are targeted once", []automation.Target{{EntityID: "light.hall"}, {Label: "night"}, {AreaID: "hall"}}, []string{"light.hall", "light.kitchen_spot"}},
+		{"entity targets are kept", []automation.Target{{EntityID: "switch.kitchen_fan"}}, []string{"switch.kitchen_fan"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, target := range e.expandTargets("test.lights", tt.targets) {
+				got = append(got, target.EntityID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expandTargets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallServiceExpandsTargets(t *testing.T) {
+	ctx := context.Background()
+	e, calls := newTargetTestEngine(t)
+
+	if err := e.CallService(ctx, "test", "lights", []automation.Target{{AreaID: "hall"}}, nil); err != nil {
+		t.Fatalf("CallService: %v", err)
+	}
+	// the handler gets the external IDs of the selected entities
+	if got, want := <-calls, []automation.Target{{EntityID: "ext-spot"}, {EntityID: "ext-hall"}}; !slices.Equal(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+
+	// calls whose targets select no entities are skipped
+	if err := e.CallService(ctx, "test", "lights", []automation.Target{{AreaID: "garage"}}, nil); err != nil {
+		t.Fatalf("CallService: %v", err)
+	}
+	select {
+	case got := <-calls:
+		t.Errorf("service was called with %v", got)
+	default:
+	}
+
+	// selectors cannot be combined with an entity_id
+	err := e.CallService(ctx, "test", "lights", []automation.Target{{EntityID: "light.hall", AreaID: "hall"}}, nil)
+	var validationErr *automation.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("CallService = %v, want a validation error", err)
+	}
+}
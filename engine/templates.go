@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"fmt"
+	"home_automation_server/automation"
+	"home_automation_server/templating"
+	"home_automation_server/types"
+)
+
+// templateEnv builds the environment templates are rendered against from the current engine state and vars.
+func (e *Engine) templateEnv(vars map[string]any) *templating.Env {
+	return &templating.Env{
+		States: e.StateCache,
+		Now:    e.now(),
+		Vars:   vars,
+	}
+}
+
+// RenderTemplate renders a template against the current engine state.
+func (e *Engine) RenderTemplate(tmpl string) (any, error) {
+	return templating.Render(tmpl, e.templateEnv(nil))
+}
+
+// ResolveActionParams renders the templates in the params of an action, including those nested in lists and maps.
+// Values without template syntax are kept as they are.
+func (e *Engine) ResolveActionParams(action *automation.Action, vars map[string]any) (map[string]any, error) {
+	env := e.templateEnv(vars)
+	resolved := make(map[string]any, len(action.Params))
+	for name, val := range action.Params {
+		v, err := resolveParam(val, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve param '%s': %w", name, err)
+		}
+		resolved[name] = v
+	}
+	return resolved, nil
+}
+
+func resolveParam(val any, env *templating.Env) (any, error) {
+	switch v := val.(type) {
+	case string:
+		if !templating.IsTemplate(v) {
+			return v, nil
+		}
+		return templating.Render(v, env)
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			resolved, err := resolveParam(item, env)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			resolved, err := resolveParam(item, env)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	default:
+		return val, nil
+	}
+}
+
+// resolveTargets renders the templated entity IDs and selectors of the targets, e.g. "{{ trigger.entity_id }}".
+func (e *Engine) resolveTargets(targets []automation.Target, vars map[string]any) ([]automation.Target, error) {
+	env := e.templateEnv(vars)
+	render := func(s string) (string, error) {
+		if !templating.IsTemplate(s) {
+			return s, nil
+		}
+		rendered, err := templating.RenderString(s, env)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve target '%s': %w", s, err)
+		}
+		return rendered, nil
+	}
+
+	resolved := make([]automation.Target, len(targets))
+	for i, t := range targets {
+		var err error
+		if resolved[i].EntityID, err = render(t.EntityID); err != nil {
+			return nil, err
+		}
+		if resolved[i].DeviceID, err = render(t.DeviceID); err != nil {
+			return nil, err
+		}
+		if resolved[i].AreaID, err = render(t.AreaID); err != nil {
+			return nil, err
+		}
+		entityType, err := render(string(t.EntityType))
+		if err != nil {
+			return nil, err
+		}
+		resolved[i].EntityType = types.EntityType(entityType)
+		if resolved[i].Label, err = render(t.Label); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
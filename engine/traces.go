@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/storage"
+	"time"
+)
+
+// DefaultMaxTraces is the number of traces kept per automation.
+const DefaultMaxTraces = 10
+
+// finishTrace completes the trace of a run that ended with err and stores it.
+func (e *Engine) finishTrace(trace *automation.Trace, err error) {
+	result := automation.TraceResultFinished
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		result = automation.TraceResultCancelled
+	case errors.Is(err, errSequenceStopped):
+		result = automation.TraceResultStopped
+	default:
+		result = automation.TraceResultFailed
+	}
+	trace.Finish(result, err)
+	e.saveTrace(trace)
+}
+
+// traceWriter stores finished traces in its own goroutine, so runs and the event loop do not wait for the
+// database.
+type traceWriter struct {
+	queue chan *automation.Trace
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newTraceWriter() *traceWriter {
+	return &traceWriter{
+		queue: make(chan *automation.Trace, 256),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// saveTrace hands a finished trace to the trace writer, which keeps the last MaxTraces traces of the
+// automation. The trace is dropped if the writer is behind.
+func (e *Engine) saveTrace(trace *automation.Trace) {
+	if e.MaxTraces <= 0 {
+		return
+	}
+	select {
+	case e.traces.queue <- trace:
+	default:
+		e.Logger.Warn("trace queue is full, dropped trace", zap.Uint64("automation_id", trace.AutomationID))
+	}
+}
+
+// startTraceWriter starts the goroutine that stores the traces passed to saveTrace.
+func (e *Engine) startTraceWriter() {
+	go func() {
+		defer close(e.traces.done)
+		for {
+			select {
+			case trace := <-e.traces.queue:
+				e.writeTrace(trace)
+			case <-e.traces.stop:
+				// store what is left, nothing is queued once the runs finished
+				for {
+					select {
+					case trace := <-e.traces.queue:
+						e.writeTrace(trace)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// stopTraceWriter stores the queued traces and stops the trace writer.
+func (e *Engine) stopTraceWriter() {
+	close(e.traces.stop)
+	<-e.traces.done
+}
+
+// writeTrace stores a trace, keeping the last MaxTraces traces of the automation.
+func (e *Engine) writeTrace(trace *automation.Trace) {
+
+	model, err := storage.TraceToStorage(trace)
+	if err != nil {
+		e.Logger.Error("failed to convert trace to storage model", zap.Error(err), zap.Uint64("automation_id", trace.AutomationID))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.TraceStore.SaveTrace(ctx, model, e.MaxTraces); err != nil {
+		e.Logger.Error("failed to save trace", zap.Error(err), zap.Uint64("automation_id", trace.AutomationID))
+	}
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"home_automation_server/automation"
+	"sync"
+)
+
+// triggerKey identifies a trigger by its automation and definition, so per-trigger state survives
+// automation reloads as long as the trigger is unchanged.
+func triggerKey(automationID uint64, baseTrigger automation.BaseTrigger) (string, error) {
+	definition, err := json.Marshal(baseTrigger)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s", automationID, definition), nil
+}
+
+// triggerKeys returns the keys of all triggers of the enabled automations in the set.
+func triggerKeys(set *automation.AutomationSet) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, a := range set.Automations {
+		if _, invalid := set.Issues[a.Id]; !a.Enabled || invalid {
+			continue
+		}
+		for _, baseTrigger := range a.Trigger {
+			if key, err := triggerKey(a.Id, baseTrigger); err == nil {
+				keys[key] = struct{}{}
+			}
+		}
+	}
+	return keys
+}
+
+// triggerMemory implements automation.TriggerMemory for stateful triggers.
+type triggerMemory struct {
+	mu     sync.Mutex
+	values map[string]any
+}
+
+func newTriggerMemory() *triggerMemory {
+	return &triggerMemory{
+		values: make(map[string]any),
+	}
+}
+
+func (m *triggerMemory) Load(key string) (any, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func (m *triggerMemory) Store(key string, value any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = value
+}
+
+// prune drops the memory of triggers that are no longer loaded.
+func (m *triggerMemory) prune(valid map[string]struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.values {
+		if _, ok := valid[key]; !ok {
+			delete(m.values, key)
+		}
+	}
+}
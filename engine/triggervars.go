@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"encoding/json"
+	"home_automation_server/automation"
+	"home_automation_server/templating"
+	"home_automation_server/types"
+)
+
+// triggerVariables describes what fired an automation. It is available to templates as "trigger", e.g.
+// trigger.entity_id, trigger.to_state.state or trigger.event.data.
+func triggerVariables(trigger automation.Trigger, event types.Event) map[string]any {
+	vars := map[string]any{
+		"platform": string(trigger.Type()),
+		"event":    eventObject(event),
+	}
+
+	switch data := event.Data.(type) {
+	case types.StateChangedData:
+		vars["entity_id"] = data.EntityID
+		vars["from_state"] = stateObjectOrNil(data.OldState)
+		vars["to_state"] = stateObjectOrNil(data.NewState)
+	case types.TimeChangedData:
+		vars["now"] = data.Now
+	}
+	return vars
+}
+
+func stateObjectOrNil(st *types.State) any {
+	if st == nil {
+		return nil
+	}
+	return templating.StateObject(*st)
+}
+
+// eventObject converts an event to plain maps, so its data can be accessed from templates.
+func eventObject(event types.Event) map[string]any {
+	var data any
+	if b, err := json.Marshal(event.Data); err == nil {
+		_ = json.Unmarshal(b, &data)
+	}
+
+	obj := map[string]any{
+		"event_type": string(event.Type),
+		"data":       data,
+		"time_fired": event.TimeFired,
+	}
+	if event.Context != nil {
+		obj["context"] = map[string]any{"id": event.Context.ID, "parent_id": event.Context.ParentID}
+	}
+	return obj
+}
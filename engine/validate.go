@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/templating"
+	"home_automation_server/types"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// validateAutomationInto checks that the automation is well-formed and that the services and entities it uses
+// exist: services are registered, their required params are present with the declared data type, and targets
+// are known entities of a type the service accepts. Templated params and targets are only checked when rendered.
+func (e *Engine) validateAutomationInto(v *automation.Validator, a *automation.Automation) {
+	a.ValidateInto(v)
+	automation.WalkActions(a.Actions, "action", func(action *automation.Action, path string) {
+		if typ, err := action.Type(); err == nil && typ == automation.ActionTypeService {
+			e.validateServiceCall(v, action, path)
+		}
+	})
+}
+
+func (e *Engine) validateServiceCall(v *automation.Validator, action *automation.Action, path string) {
+	domain, service, ok := strings.Cut(action.Service, ".")
+	if !ok {
+		return // reported by the automation itself
+	}
+	spec, ok := e.ServiceRegistry.Get(domain, service)
+	if !ok {
+		v.Add(path+"/service", "service %s is not registered", action.Service)
+		return
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(spec.Params)) {
+		meta := spec.Params[name]
+		val, ok := action.Params[name]
+		if !ok || val == nil {
+			if meta.Default == nil && !meta.Optional {
+				v.Add(path+"/params/"+name, "missing required param %q of service %s", name, action.Service)
+			}
+			continue
+		}
+		if s, ok := val.(string); ok && templating.IsTemplate(s) {
+			continue
+		}
+		if _, err := meta.Coerce(val); err != nil {
+			v.Add(path+"/params/"+name, "param %q %v", name, err)
+		}
+	}
+
+	for i, target := range action.Targets {
+		p := fmt.Sprintf("%s/targets/%d", path, i)
+		if target.IsSelector() {
+			if target.IsEntity() {
+				v.Add(p, "target entity_id cannot be combined with device_id, area_id, entity_type or label")
+				continue
+			}
+			typ := target.EntityType
+			if typ != "" && !templating.IsTemplate(string(typ)) && !acceptsEntityType(spec.AllowedTargets, typ) {
+				v.Add(p+"/entity_type", "service %s does not accept %s entities, allowed: %v", action.Service, typ, spec.AllowedTargets.EntityTypes)
+			}
+			continue // expanded to entities when the service is called
+		}
+		if target.EntityID == "" {
+			v.Add(p, "target requires entity_id, device_id, area_id, entity_type or label")
+			continue
+		}
+		if templating.IsTemplate(target.EntityID) {
+			continue
+		}
+		if _, ok := e.EntityRegistry.ResolveExternalID(target.EntityID); !ok {
+			v.Add(p, "unknown entity %s", target.EntityID)
+			continue
+		}
+		if !acceptsEntity(spec.AllowedTargets, target.EntityID) {
+			v.Add(p, "service %s does not accept %s entities, allowed: %v", action.Service, entityType(target.EntityID), spec.AllowedTargets.EntityTypes)
+		}
+	}
+}
+
+// entityType returns the type of an entity from the domain of its ID, e.g. "light" for "light.living_room".
+func entityType(entityID string) types.EntityType {
+	domain, _, _ := strings.Cut(entityID, ".")
+	return types.EntityType(domain)
+}
+
+func acceptsEntity(spec integrations.TargetSpec, entityID string) bool {
+	return acceptsEntityType(spec, entityType(entityID))
+}
+
+func acceptsEntityType(spec integrations.TargetSpec, typ types.EntityType) bool {
+	if len(spec.EntityTypes) == 0 {
+		return true
+	}
+	return slices.Contains(spec.EntityTypes, typ)
+}
+
+// automationIssues validates every automation of the set. Invalid automations do not run, their triggers are
+// skipped. Automations that became invalid, or whose issues changed, and those that became valid again are
+// logged.
+func (e *Engine) automationIssues(set *automation.AutomationSet) map[uint64][]automation.Issue {
+	previous := e.Automations().Issues
+	aliases := make(map[string]int, len(set.Automations))
+	for _, a := range set.Automations {
+		aliases[a.Alias]++
+	}
+
+	issues := make(map[uint64][]automation.Issue)
+	for i := range set.Automations {
+		a := &set.Automations[i]
+		v := &automation.Validator{}
+		e.validateAutomationInto(v, a)
+		if aliases[a.Alias] > 1 {
+			v.Add("alias", "alias %q is used by another automation", a.Alias)
+		}
+		if err := v.Err(); err != nil {
+			issues[a.Id] = v.Issues()
+			if !slices.Equal(previous[a.Id], issues[a.Id]) {
+				e.Logger.Warn("invalid automation, its triggers are skipped until it is fixed", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias), zap.Error(err))
+			}
+		} else if _, wasInvalid := previous[a.Id]; wasInvalid {
+			e.Logger.Info("automation is valid again", zap.Uint64("automation_id", a.Id), zap.String("automation", a.Alias))
+		}
+	}
+	return issues
+}
+
+// RevalidateAutomations validates the loaded automations again, e.g. after an integration registered its
+// services and entities.
+func (e *Engine) RevalidateAutomations() {
+	e.automationsMu.Lock()
+	defer e.automationsMu.Unlock()
+	e.swapAutomations(func(automations []automation.Automation) []automation.Automation {
+		return automations
+	})
+}
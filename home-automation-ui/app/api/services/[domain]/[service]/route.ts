@@ -0,0 +1,28 @@
+"use server";
+import { NextResponse } from 'next/server';
+
+const ENGINE_URL = 'http://localhost:8080/api/services';
+
+export async function POST(req: Request, { params }: { params: Promise<{ domain: string; service: string }> }) {
+  const { domain, service } = await params;
+  if (!domain || !service) {
+    return NextResponse.json({ error: 'Domain and service are required' }, { status: 400 });
+  }
+  try {
+    const body = await req.json();
+    const res = await fetch(`${ENGINE_URL}/${encodeURIComponent(domain)}/${encodeURIComponent(service)}`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(body),
+      cache: 'no-store',
+    });
+    const data = await res.json();
+    return NextResponse.json(data, { status: res.status });
+  } catch (err: any) {
+    console.error('Error calling service:', err);
+    return NextResponse.json(
+      { success: false, error: 'Failed to call service', details: err.message },
+      { status: 500 }
+    );
+  }
+}
@@ -13,8 +13,6 @@ import { TriggerSection } from "./form-sections/trigger"
 import { ActionSection } from "./form-sections/action"
 import { ChevronLeft, ChevronRight } from "lucide-react"
 
-import { engineWSsendMessage } from "@/lib/engine-socket"
-
 const STEPS = [
   { id: 0, label: "Details" },
   { id: 1, label: "Triggers" },
@@ -81,7 +79,6 @@ export const CreateAutomationSheet = /* @__PURE__ */ React.memo(function CreateA
     onAutomationSaved(data.automation)
     onOpenChange(false)
     methods.reset(emptyAutomation)
-    engineWSsendMessage({ type: "reload_automations" })
   }
 
   return (
@@ -3,7 +3,16 @@
 import { Accordion, AccordionContent, AccordionItem, AccordionTrigger } from "@/components/ui/accordion"
 import { StateTriggerDetails } from "./state-trigger-details"
 import { EventTriggerDetails } from "./event-trigger-details"
-import { Action, BaseTrigger, Condition, EventTrigger, StateTrigger } from "@/types/automation"
+import { Action, BaseTrigger, Condition, EventTrigger, StateTrigger, Target } from "@/types/automation"
+
+// describes a target, e.g. "light.kitchen" or "area_id: kitchen, entity_type: light"
+function describeTarget(target: Target) {
+  if (target.entity_id) return target.entity_id
+  return Object.entries(target)
+    .filter(([, value]) => value)
+    .map(([key, value]) => `${key}: ${value}`)
+    .join(", ")
+}
 
 export function TriggerDetails({ triggers }: { triggers: BaseTrigger[] }) {
   if (!triggers || triggers.length === 0) return null
@@ -30,40 +39,39 @@ export function TriggerDetails({ triggers }: { triggers: BaseTrigger[] }) {
   )
 }
 
+// renders a condition and, for "and", "or" and "not", its nested conditions
+function ConditionItem({ cond }: { cond: Condition }) {
+  const { conditions, ...fields } = cond.data ?? {}
+  return (
+    <div className="flex flex-col space-y-0.5">
+      <p>
+        <span className="font-medium">Type:</span> {cond.type}
+      </p>
+      {Object.entries(fields)
+        .filter(([, value]) => value !== undefined && value !== null)
+        .map(([key, value]) => (
+          <p key={key}>
+            <span className="font-medium">{key}:</span> {typeof value === "string" ? value : JSON.stringify(value)}
+          </p>
+        ))}
+      {Array.isArray(conditions) && conditions.length > 0 && (
+        <div className="flex flex-col space-y-1 border-l pl-3">
+          {conditions.map((nested: Condition, index: number) => (
+            <ConditionItem key={index} cond={nested} />
+          ))}
+        </div>
+      )}
+    </div>
+  )
+}
+
 export function ConditionDetails({ conditions }: { conditions: Condition[] }) {
   return (
     <div className="space-y-1">
       <p className="font-semibold mb-1">Conditions:</p>
       <div className="flex flex-col space-y-1 bg-muted p-3 rounded-md text-sm">
         {conditions.map((cond, index) => (
-          <div key={index} className="flex flex-col space-y-0.5">
-            <p>
-              <span className="font-medium">Entity:</span> {cond.entity}
-            </p>
-            <p>
-              <span className="font-medium">Field:</span> {cond.field}
-            </p>
-            {cond.equals !== undefined && (
-              <p>
-                <span className="font-medium">Equals:</span> {JSON.stringify(cond.equals)}
-              </p>
-            )}
-            {cond.notEquals !== undefined && (
-              <p>
-                <span className="font-medium">Not Equals:</span> {JSON.stringify(cond.notEquals)}
-              </p>
-            )}
-            {cond.gt !== undefined && (
-              <p>
-                <span className="font-medium">Greater Than:</span> {cond.gt}
-              </p>
-            )}
-            {cond.lt !== undefined && (
-              <p>
-                <span className="font-medium">Less Than:</span> {cond.lt}
-              </p>
-            )}
-          </div>
+          <ConditionItem key={index} cond={cond} />
         ))}
       </div>
     </div>
@@ -87,7 +95,7 @@ export function ActionDetails({ actions }: { actions: Action[] }) {
                     <span className="font-medium">Targets:</span>
                     <ul className="list-disc list-inside ml-2">
                       {action.targets.map((target, tIndex) => (
-                        <li key={tIndex}>{target.entity_id}</li>
+                        <li key={tIndex}>{describeTarget(target)}</li>
                       ))}
                     </ul>
                   </div>
@@ -8,6 +8,11 @@ export function EventTriggerDetails({ trigger }: { trigger: EventTrigger }) {
       <p>
         <span className="font-medium">Event Type:</span> {trigger.event_type}
       </p>
+      {trigger.event_data && Object.keys(trigger.event_data).length > 0 && (
+        <p>
+          <span className="font-medium">Event Data:</span> {JSON.stringify(trigger.event_data)}
+        </p>
+      )}
     </div>
   )
 }
@@ -14,7 +14,7 @@ import { useFieldArray, useFormContext } from "react-hook-form"
 
 interface ServiceSpec {
   name: string
-  required_params: Record<
+  params: Record<
     string,
     {
       DataType: string
@@ -146,10 +146,10 @@ export function ActionSection() {
                     )}
 
                     {/* Params section */}
-                    {selectedService && Object.keys(selectedService.required_params).length > 0 && (
+                    {selectedService && Object.keys(selectedService.params).length > 0 && (
                       <>
                         <h4 className="text-sm font-medium text-gray-700 mt-4">Parameters</h4>
-                        {Object.entries(selectedService.required_params).map(([paramName, paramSpec]) => (
+                        {Object.entries(selectedService.params).map(([paramName, paramSpec]) => (
                           <FormItem key={paramName}>
                             <FormLabel>
                               {paramName} ({paramSpec.DataType})
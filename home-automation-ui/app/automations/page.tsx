@@ -9,7 +9,6 @@ import { CreateAutomationSheet } from "./create-automation-sheet"
 import { AutomationDetailsDialog } from "./data-table/automation-details-dialog"
 import { RowActionMenu } from "@/components/common/row-action-menu"
 import { useMemo } from "react"
-import { engineWSsendMessage } from "@/lib/engine-socket"
 
 async function getData(): Promise<Automation[]> {
   const res = await fetch("/api/automations", { cache: "no-store" })
@@ -87,7 +86,6 @@ export default function AutomationsPage() {
         throw new Error(data.error || "Failed to delete automation")
       }
       if (typeof window !== "undefined") console.log("delete success", automation.id)
-      engineWSsendMessage({ type: "reload_automations" })
     } catch (err: any) {
       // rollback
       if (typeof window !== "undefined") console.log("delete failed, rollback", automation.id)
@@ -1,7 +1,7 @@
 "use client"
 
 import { ColumnDef } from "@tanstack/react-table"
-import { Event } from "@/types/events"
+import { CallServiceData, Event } from "@/types/events"
 import { Badge } from "@/components/ui/badge"
 import { ENTITY_ICON_MAP, ENTITY_STATE_KEY_MAP } from "@/lib/entity-display-map"
 
@@ -79,21 +79,25 @@ function renderSummary(event: Event) {
     }
 
     case "call_service": {
-      const d = event.data as any
-      const domain = d?.domain
-      const service = d?.service
-      const entity = d?.entity_id
+      const d = event.data as CallServiceData
+      const targets = d?.targets ?? []
       return (
         <div className="flex flex-col">
           <div className="flex items-center space-x-2">
             <Badge variant="outline" className="text-xs">call_service</Badge>
-            <span className="font-medium truncate">{`${domain}.${service}`}</span>
+            <span className="font-medium truncate">{`${d?.domain}.${d?.service}`}</span>
+            {d?.success === false && (
+              <Badge variant="destructive" className="text-xs">failed</Badge>
+            )}
           </div>
-          {entity && (
+          {targets.length > 0 && (
             <span className="text-muted-foreground text-xs truncate">
-              Target: {entity}
+              Target: {targets.join(", ")}
             </span>
           )}
+          {d?.error && (
+            <span className="text-destructive text-xs truncate">{d.error}</span>
+          )}
         </div>
       )
     }
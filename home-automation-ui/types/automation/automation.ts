@@ -29,11 +29,15 @@ export type StateTrigger = {
 
 export type EventTrigger = {
   event_type: string;
+  event_data?: Record<string, any>;
 };
 
 // ------------------- Conditions -------------------
-// Keep as any[] for now, we can expand later
-export type Condition = any;
+// data depends on the type, e.g. { entity_id, state } for "state" or { conditions } for "and", "or" and "not"
+export type Condition = {
+  type: string;
+  data: Record<string, any>;
+};
 
 // ------------------- Actions -------------------
 
@@ -45,5 +49,9 @@ export type Action = {
 };
 
 export type Target = {
-  entity_id: string;
+  entity_id?: string;
+  device_id?: string;
+  area_id?: string;
+  entity_type?: string;
+  label?: string;
 };
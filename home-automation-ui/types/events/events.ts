@@ -19,7 +19,9 @@ export type CallServiceData = {
   domain: string;
   service: string;
   service_data: Record<string, any>;
-  entity_id?: string;
+  targets?: string[];
+  success: boolean;
+  error?: string;
 };
 
 export type Event = {
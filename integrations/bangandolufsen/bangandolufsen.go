@@ -43,5 +43,7 @@ func NewIntegration(ctx context.Context, cfg map[string]any, stateStore types.St
 		Translator:  &integration.NoopTranslator{},
 		Aggregator:  &integration.PassThroughAggregator{},
 		Services:    s.ExportServices(),
+
+		ReproduceState: s.ReproduceState,
 	}, nil
 }
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"fmt"
+	"home_automation_server/automation"
+	"home_automation_server/types"
+)
+
+// ReproduceState returns the set_playback_source call that restores the source of a speaker, given by the
+// source attribute. The integration does not report speaker states, so they have to be set in the scene.
+func (s *Service) ReproduceState(entityID string, entityType types.EntityType, state types.State) ([]automation.Action, error) {
+	if entityType != types.EntityTypeSpeaker {
+		return nil, fmt.Errorf("entity type %s is not supported", entityType)
+	}
+	source, ok := state.Attributes["source"].(string)
+	if !ok || source == "" {
+		return nil, fmt.Errorf("expected source attribute to be a string, got %T", state.Attributes["source"])
+	}
+
+	return []automation.Action{{
+		Service: "bang_and_olufsen_mozart.set_playback_source",
+		Targets: []automation.Target{{EntityID: entityID}},
+		Params:  map[string]any{"source": source},
+	}}, nil
+}
@@ -19,7 +19,7 @@ func (s *Service) ExportServices() map[string]integrations.ServiceSpec {
 	return map[string]integrations.ServiceSpec{
 		"set_playback_source": {
 			Handler: s.SetPlaybackSource,
-			RequiredParams: map[string]integrations.ParamMetadata{
+			Params: map[string]integrations.ParamMetadata{
 				"source": {
 					DataType:    "string",
 					Description: "the name of the source to activate",
@@ -32,7 +32,7 @@ func (s *Service) ExportServices() map[string]integrations.ServiceSpec {
 		},
 		"expand_experience": {
 			Handler: s.ExpandExperience,
-			RequiredParams: map[string]integrations.ParamMetadata{
+			Params: map[string]integrations.ParamMetadata{
 				"to": {
 					DataType:    "string",
 					Description: "the friendly name of the device to expand the experience to",
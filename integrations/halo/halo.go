@@ -76,5 +76,7 @@ func NewIntegration(ctx context.Context, cfg map[string]any, stateStore types.St
 		Aggregator:  aggregator,
 		Discovery:   discoveryClient,
 		Services:    s.ExportServices(),
+
+		ReproduceState: s.ReproduceState,
 	}, nil
 }
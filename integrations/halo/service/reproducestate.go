@@ -0,0 +1,25 @@
+package service
+
+import (
+	"fmt"
+	"home_automation_server/automation"
+	"home_automation_server/types"
+	"home_automation_server/utils"
+)
+
+// ReproduceState returns the update_button_value call that restores the value of a button.
+func (s *Service) ReproduceState(entityID string, entityType types.EntityType, state types.State) ([]automation.Action, error) {
+	if entityType != types.EntityTypeButton {
+		return nil, fmt.Errorf("entity type %s is not supported", entityType)
+	}
+	value, ok := utils.ToFloat64(state.State)
+	if !ok {
+		return nil, fmt.Errorf("expected button state to be a number, got %T", state.State)
+	}
+
+	return []automation.Action{{
+		Service: "beoremote_halo.update_button_value",
+		Targets: []automation.Target{{EntityID: entityID}},
+		Params:  map[string]any{"value": value},
+	}}, nil
+}
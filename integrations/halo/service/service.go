@@ -18,10 +18,12 @@ func (s *Service) ExportServices() map[string]integrations.ServiceSpec {
 	return map[string]integrations.ServiceSpec{
 		"update_button_value": {
 			Handler: s.UpdateButtonValue,
-			RequiredParams: map[string]integrations.ParamMetadata{
+			Params: map[string]integrations.ParamMetadata{
 				"value": {
 					DataType:    "float",
 					Description: "New value for button, between 0..100",
+					Min:         integrations.Bound(0),
+					Max:         integrations.Bound(100),
 				},
 			},
 			AllowedTargets: integrations.TargetSpec{
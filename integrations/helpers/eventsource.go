@@ -0,0 +1,23 @@
+package helpers
+
+import "context"
+
+// eventSource forwards the raw events the helpers publish.
+type eventSource struct {
+	events chan []byte
+}
+
+func (s *eventSource) Run(ctx context.Context, out chan<- []byte) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-s.events:
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
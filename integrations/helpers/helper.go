@@ -0,0 +1,276 @@
+package helpers
+
+import (
+	"fmt"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/types"
+	"home_automation_server/utils"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	TimerIdle   = "idle"
+	TimerActive = "active"
+	TimerPaused = "paused"
+)
+
+// Types are the entity types of helpers, each is also the domain of its services.
+var Types = []types.EntityType{
+	types.EntityTypeInputBoolean,
+	types.EntityTypeInputNumber,
+	types.EntityTypeInputSelect,
+	types.EntityTypeCounter,
+	types.EntityTypeTimer,
+}
+
+// Helper is the definition of a helper entity. Options only apply to the types in their comment.
+type Helper struct {
+	Type     types.EntityType     `json:"type"`
+	ID       string               `json:"id"` // the entity ID of the helper is "<type>.<id>", e.g. "input_boolean.night_mode"
+	Name     string               `json:"name"`
+	Initial  any                  `json:"initial,omitempty"`  // the state of a new helper, also the value counter.reset returns to
+	Min      *float64             `json:"min,omitempty"`      // input_number (default 0) and counter (default none)
+	Max      *float64             `json:"max,omitempty"`      // input_number (default 100) and counter (default none)
+	Step     float64              `json:"step,omitempty"`     // input_number and counter, default 1
+	Options  []string             `json:"options,omitempty"`  // input_select
+	Duration *automation.Duration `json:"duration,omitempty"` // timer, used by timer.start if no duration is given
+}
+
+// ExternalID returns the ID of the helper's entity in the integration, "<type>.<id>". It does not change when
+// the entity ID is renamed.
+func (h Helper) ExternalID() string {
+	return fmt.Sprintf("%s.%s", h.Type, h.ID)
+}
+
+// validate checks the definition and fills in the defaults of its options.
+func (h *Helper) validate(v *automation.Validator) {
+	if !slices.Contains(Types, h.Type) {
+		v.Add("type", "unknown helper type %q", h.Type)
+	}
+	if h.ID == "" || h.ID != utils.NormalizeString(h.ID) {
+		v.Add("id", "id %q must be lower case letters, digits and underscores", h.ID)
+	}
+	if h.Name == "" {
+		v.Add("name", "name is required")
+	}
+	if h.Step < 0 {
+		v.Add("step", "step must be positive")
+	}
+
+	switch h.Type {
+	case types.EntityTypeInputBoolean:
+		if h.Initial != nil {
+			if _, ok := h.Initial.(bool); !ok {
+				v.Add("initial", "initial must be true or false")
+			}
+		}
+	case types.EntityTypeInputNumber:
+		if h.Min == nil {
+			h.Min = integrations.Bound(0)
+		}
+		if h.Max == nil {
+			h.Max = integrations.Bound(100)
+		}
+		if *h.Min >= *h.Max {
+			v.Add("max", "max must be greater than min")
+		}
+		if h.Step == 0 {
+			h.Step = 1
+		}
+		if h.Initial != nil {
+			if n, ok := h.Initial.(float64); !ok || n < *h.Min || n > *h.Max {
+				v.Add("initial", "initial must be a number between min and max")
+			}
+		}
+	case types.EntityTypeInputSelect:
+		if len(h.Options) == 0 {
+			v.Add("options", "options are required")
+		}
+		for i, option := range h.Options {
+			if option == "" || slices.Index(h.Options, option) != i {
+				v.Add(fmt.Sprintf("options/%d", i), "options must be unique and not empty")
+			}
+		}
+		if h.Initial != nil {
+			if s, ok := h.Initial.(string); !ok || !slices.Contains(h.Options, s) {
+				v.Add("initial", "initial must be one of the options")
+			}
+		}
+	case types.EntityTypeCounter:
+		if h.Min != nil && h.Max != nil && *h.Min >= *h.Max {
+			v.Add("max", "max must be greater than min")
+		}
+		if h.Step == 0 {
+			h.Step = 1
+		}
+		if h.Step != math.Trunc(h.Step) {
+			v.Add("step", "step of a counter must be a whole number")
+		}
+		if h.Initial != nil {
+			if n, ok := h.Initial.(float64); !ok || n != math.Trunc(n) || !h.inRange(n) {
+				v.Add("initial", "initial must be a whole number between min and max")
+			}
+		}
+	case types.EntityTypeTimer:
+		if h.Duration != nil && h.Duration.Duration < 0 {
+			v.Add("duration", "duration must not be negative")
+		}
+	}
+}
+
+// inRange reports whether n is within the min and max of the helper, if set.
+func (h Helper) inRange(n float64) bool {
+	return (h.Min == nil || n >= *h.Min) && (h.Max == nil || n <= *h.Max)
+}
+
+// clamp limits n to the min and max of the helper, if set.
+func (h Helper) clamp(n float64) float64 {
+	if h.Min != nil {
+		n = math.Max(n, *h.Min)
+	}
+	if h.Max != nil {
+		n = math.Min(n, *h.Max)
+	}
+	return n
+}
+
+// initialValue returns the value of a new helper.
+func (h Helper) initialValue() any {
+	switch h.Type {
+	case types.EntityTypeInputBoolean:
+		initial, _ := h.Initial.(bool)
+		return initial
+	case types.EntityTypeInputNumber:
+		if n, ok := h.Initial.(float64); ok {
+			return n
+		}
+		return *h.Min
+	case types.EntityTypeInputSelect:
+		if s, ok := h.Initial.(string); ok {
+			return s
+		}
+		return h.Options[0]
+	case types.EntityTypeCounter:
+		n, _ := h.Initial.(float64)
+		return h.clamp(n)
+	default:
+		return nil
+	}
+}
+
+// defaultDuration returns the duration of a timer started without one, 0 if it has none.
+func (h Helper) defaultDuration() time.Duration {
+	if h.Duration == nil {
+		return 0
+	}
+	return h.Duration.Duration
+}
+
+// entry is a helper with its current value. Timers keep their run in timer instead.
+type entry struct {
+	Helper
+	value any // bool for input_boolean, float64 for input_number and counter, string for input_select
+	timer timerRun
+}
+
+type timerRun struct {
+	status     string
+	duration   time.Duration // of the current run
+	remaining  time.Duration // while paused
+	finishesAt time.Time     // while active
+	t          *time.Timer
+}
+
+// state returns the state and attributes of the helper's entity.
+func (e *entry) state() (any, map[string]any) {
+	switch e.Type {
+	case types.EntityTypeInputBoolean:
+		if on, _ := e.value.(bool); on {
+			return "on", map[string]any{}
+		}
+		return "off", map[string]any{}
+	case types.EntityTypeInputNumber:
+		return e.value, map[string]any{"min": *e.Min, "max": *e.Max, "step": e.Step}
+	case types.EntityTypeInputSelect:
+		return e.value, map[string]any{"options": e.Options}
+	case types.EntityTypeCounter:
+		attributes := map[string]any{"initial": e.initialValue(), "step": e.Step}
+		if e.Min != nil {
+			attributes["minimum"] = *e.Min
+		}
+		if e.Max != nil {
+			attributes["maximum"] = *e.Max
+		}
+		return e.value, attributes
+	case types.EntityTypeTimer:
+		attributes := map[string]any{"duration": formatDuration(e.timer.duration)}
+		switch e.timer.status {
+		case TimerActive:
+			attributes["remaining"] = formatDuration(time.Until(e.timer.finishesAt))
+			attributes["finishes_at"] = e.timer.finishesAt.Format(time.RFC3339)
+		case TimerPaused:
+			attributes["remaining"] = formatDuration(e.timer.remaining)
+		}
+		return e.timer.status, attributes
+	default:
+		return nil, map[string]any{}
+	}
+}
+
+// restore sets the value from a state published before, e.g. by a previous run of the engine. States that
+// do not fit the definition, e.g. an option that was removed, are ignored.
+func (e *entry) restore(state any, attributes map[string]any) {
+	switch e.Type {
+	case types.EntityTypeInputBoolean:
+		if state == "on" || state == "off" {
+			e.value = state == "on"
+		}
+	case types.EntityTypeInputNumber:
+		if n, ok := state.(float64); ok && e.inRange(n) {
+			e.value = n
+		}
+	case types.EntityTypeInputSelect:
+		if s, ok := state.(string); ok && slices.Contains(e.Options, s) {
+			e.value = s
+		}
+	case types.EntityTypeCounter:
+		if n, ok := state.(float64); ok && e.inRange(n) {
+			e.value = n
+		}
+	case types.EntityTypeTimer:
+		status, _ := state.(string)
+		duration, _ := parseDurationAttribute(attributes["duration"])
+		switch status {
+		case TimerActive:
+			finishesAt, err := time.Parse(time.RFC3339, fmt.Sprint(attributes["finishes_at"]))
+			if err != nil {
+				return
+			}
+			e.timer = timerRun{status: TimerActive, duration: duration, finishesAt: finishesAt}
+		case TimerPaused:
+			remaining, ok := parseDurationAttribute(attributes["remaining"])
+			if !ok {
+				return
+			}
+			e.timer = timerRun{status: TimerPaused, duration: duration, remaining: remaining}
+		}
+	}
+}
+
+// formatDuration formats a duration as H:MM:SS, the clock string automation.ParseDuration accepts.
+func formatDuration(d time.Duration) string {
+	d = max(d, 0).Round(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+func parseDurationAttribute(v any) (time.Duration, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, false
+	}
+	d, err := automation.ParseDuration(s)
+	return d, err == nil
+}
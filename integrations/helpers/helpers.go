@@ -0,0 +1,467 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"home_automation_server/automation"
+	"home_automation_server/engine/integration"
+	"home_automation_server/storage"
+	"home_automation_server/storage/models"
+	"home_automation_server/types"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Name is the name of the helpers integration.
+	Name = "helpers"
+	// DeviceID is the ID of the virtual device the helper entities belong to.
+	DeviceID = "helpers"
+)
+
+var ErrHelperNotFound = errors.New("helper not found")
+
+// Helpers are virtual entities for modes, thresholds and countdowns that do not belong to any hardware, e.g.
+// an input_select for home/away/night. The definitions and the last states are stored, changes are published
+// as raw events to the event source of the integration, which the translator turns into state_changed events.
+type Helpers struct {
+	store  storage.HelperStore
+	events chan []byte
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	entries map[string]*entry // external ID -> helper
+	version uint64            // counts the state changes, so stores of older states are skipped
+
+	savedMu sync.Mutex
+	saved   map[string]*savedState // external ID -> stored state
+}
+
+// savedState serializes the stores of the state of a helper.
+type savedState struct {
+	mu      sync.Mutex
+	version uint64
+}
+
+// message is a raw event of the helpers integration.
+type message struct {
+	ID         string          `json:"id"` // external ID of the helper
+	Event      types.EventType `json:"event"`
+	State      any             `json:"state,omitempty"`
+	Attributes map[string]any  `json:"attributes,omitempty"`
+}
+
+// storedState is the last state of a helper, as published.
+type storedState struct {
+	State      any            `json:"state"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+func New(store storage.HelperStore, baseLogger *zap.Logger) *Helpers {
+	return &Helpers{
+		store:   store,
+		events:  make(chan []byte, 100),
+		logger:  integration.IntegrationLogger(baseLogger, Name),
+		entries: make(map[string]*entry),
+		saved:   make(map[string]*savedState),
+	}
+}
+
+func Descriptor(h *Helpers) integration.IntegrationDescriptor {
+	return integration.IntegrationDescriptor{
+		Name:         Name,
+		DisplayName:  "Helpers",
+		Description:  "Virtual entities for modes, thresholds and countdowns: input_boolean, input_number, input_select, counter and timer.",
+		Version:      "1.0.0",
+		Capabilities: []string{integration.CapabilityDiscovery, integration.CapabilityControl},
+		ConfigSchema: map[string]integration.ConfigField{},
+		CreateFunc:   h.newIntegration,
+		Extension:    h,
+	}
+}
+
+// newIntegration loads the helpers. They log through the logger given to New, which baseLogger is not.
+func (h *Helpers) newIntegration(ctx context.Context, cfg map[string]any, stateStore types.StateStore, entityRegistry types.EntityRegistry, baseLogger *zap.Logger) (integration.Instance, error) {
+	if err := h.load(ctx); err != nil {
+		return integration.Instance{}, err
+	}
+
+	return integration.Instance{
+		EventSource: &eventSource{events: h.events},
+		Translator:  &translator{stateStore: stateStore, entityRegistry: entityRegistry, logger: h.logger.Named("translator")},
+		Aggregator:  &integration.PassThroughAggregator{},
+		Discovery:   h,
+		Services:    h.services(),
+
+		ReproduceState: h.reproduceState,
+		PublishStates:  h.Publish,
+	}, nil
+}
+
+// load reads the helpers and their last states from storage. Timers that ran out while the engine was stopped
+// finish now.
+func (h *Helpers) load(ctx context.Context) error {
+	stored, err := h.store.LoadHelpers(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]*entry, len(stored))
+	for _, m := range stored {
+		e, err := entryFromStorage(m)
+		if err != nil {
+			h.logger.Error("skipped invalid helper", zap.String("helper", m.ID), zap.Error(err))
+			continue
+		}
+		entries[m.ID] = e
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.entries {
+		e.stopTimer()
+	}
+	h.entries = entries
+	for _, e := range entries {
+		if e.timer.status == TimerActive {
+			h.scheduleTimer(e)
+		}
+	}
+	h.logger.Info("loaded helpers", zap.Int("num_helpers", len(entries)))
+	return nil
+}
+
+func entryFromStorage(m models.Helper) (*entry, error) {
+	var def Helper
+	if len(m.Config) > 0 {
+		if err := json.Unmarshal(m.Config, &def); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	def.Type = types.EntityType(m.Type)
+	def.ID = strings.TrimPrefix(m.ID, m.Type+".")
+	def.Name = m.Name
+
+	v := &automation.Validator{}
+	def.validate(v)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	e := newEntry(def)
+	if len(m.State) > 0 {
+		var last storedState
+		if err := json.Unmarshal(m.State, &last); err == nil {
+			e.restore(last.State, last.Attributes)
+		}
+	}
+	return e, nil
+}
+
+func newEntry(def Helper) *entry {
+	return &entry{Helper: def, value: def.initialValue(), timer: timerRun{status: TimerIdle, duration: def.defaultDuration()}}
+}
+
+// List returns the helper definitions, ordered by external ID.
+func (h *Helpers) List() []Helper {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]Helper, 0, len(h.entries))
+	for _, e := range h.entries {
+		list = append(list, e.Helper)
+	}
+	slices.SortFunc(list, func(a, b Helper) int {
+		return strings.Compare(a.ExternalID(), b.ExternalID())
+	})
+	return list
+}
+
+// Get returns the definition of a helper by external ID.
+func (h *Helpers) Get(externalID string) (Helper, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.entries[externalID]
+	if !ok {
+		return Helper{}, fmt.Errorf("%w: %s", ErrHelperNotFound, externalID)
+	}
+	return e.Helper, nil
+}
+
+// Create validates and stores a new helper. Its entity is added by the next discovery, its state is published
+// by Publish.
+func (h *Helpers) Create(ctx context.Context, def Helper) (Helper, error) {
+	v := &automation.Validator{}
+	def.validate(v)
+	h.mu.Lock()
+	_, exists := h.entries[def.ExternalID()]
+	h.mu.Unlock()
+	if exists {
+		v.Add("id", "a helper %q already exists", def.ExternalID())
+	}
+	if err := v.Err(); err != nil {
+		return Helper{}, err
+	}
+
+	// stored without holding mu, the primary key rejects a helper created concurrently with the same ID
+	m, err := helperToStorage(def)
+	if err != nil {
+		return Helper{}, err
+	}
+	if err := h.store.CreateHelper(ctx, &m); err != nil {
+		return Helper{}, fmt.Errorf("failed to store helper: %w", err)
+	}
+	h.mu.Lock()
+	h.entries[def.ExternalID()] = newEntry(def)
+	h.mu.Unlock()
+	h.logger.Info("created helper", zap.String("helper", def.ExternalID()))
+	return def, nil
+}
+
+// Update validates and stores the new definition of a helper, its type and ID cannot change. The value is
+// kept if it fits the new definition.
+func (h *Helpers) Update(ctx context.Context, externalID string, def Helper) (Helper, error) {
+	current, err := h.Get(externalID)
+	if err != nil {
+		return Helper{}, err
+	}
+	def.Type, def.ID = current.Type, current.ID
+	v := &automation.Validator{}
+	def.validate(v)
+	if err := v.Err(); err != nil {
+		return Helper{}, err
+	}
+
+	// stored without holding mu, so a slow database does not hold up the other helpers and their timers
+	m, err := helperToStorage(def)
+	if err != nil {
+		return Helper{}, err
+	}
+	if err := h.store.UpdateHelper(ctx, &m); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Helper{}, fmt.Errorf("%w: %s", ErrHelperNotFound, externalID)
+		}
+		return Helper{}, fmt.Errorf("failed to store helper: %w", err)
+	}
+
+	var pending pendingState
+	defer func() { h.save(ctx, pending) }() // runs after the unlock below
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.entries[externalID]
+	if !ok {
+		return Helper{}, fmt.Errorf("%w: %s", ErrHelperNotFound, externalID) // deleted meanwhile
+	}
+	state, attributes := e.state()
+	e.stopTimer()
+	updated := newEntry(def)
+	updated.restore(state, attributes)
+	if updated.timer.status == TimerActive {
+		h.scheduleTimer(updated)
+	}
+	h.entries[externalID] = updated
+	pending = h.changed(updated)
+	h.logger.Info("updated helper", zap.String("helper", externalID))
+	return def, nil
+}
+
+// Delete removes a helper. Its entity becomes unavailable with the next discovery.
+func (h *Helpers) Delete(ctx context.Context, externalID string) error {
+	if _, err := h.Get(externalID); err != nil {
+		return err
+	}
+	// deleted without holding mu, so a slow database does not hold up the other helpers and their timers
+	if err := h.store.DeleteHelper(ctx, externalID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to delete helper: %w", err)
+	}
+
+	h.mu.Lock()
+	if e, ok := h.entries[externalID]; ok {
+		e.stopTimer()
+		delete(h.entries, externalID)
+	}
+	h.mu.Unlock()
+	h.logger.Info("deleted helper", zap.String("helper", externalID))
+	return nil
+}
+
+func helperToStorage(def Helper) (models.Helper, error) {
+	config, err := json.Marshal(def)
+	if err != nil {
+		return models.Helper{}, fmt.Errorf("failed to encode helper: %w", err)
+	}
+	return models.Helper{ID: def.ExternalID(), Type: string(def.Type), Name: def.Name, Config: config}, nil
+}
+
+// Discover returns the virtual device of the helpers and an entity for every helper.
+func (h *Helpers) Discover(ctx context.Context) ([]types.Device, []types.Entity, error) {
+	device := types.Device{
+		ID:        DeviceID,
+		Type:      types.DeviceTypeVirtual,
+		Name:      "Helpers",
+		Metadata:  map[string]any{},
+		Enabled:   true,
+		Available: true,
+	}
+
+	var entities []types.Entity
+	for _, def := range h.List() {
+		entities = append(entities, types.Entity{
+			ExternalID: def.ExternalID(),
+			DeviceID:   DeviceID,
+			EntityID:   def.ExternalID(),
+			Type:       def.Type,
+			Name:       def.Name,
+			Enabled:    true,
+			Available:  true,
+		})
+	}
+	return []types.Device{device}, entities, nil
+}
+
+// Publish publishes the current state of the helpers with the external IDs, or of all helpers if none are
+// given, e.g. once their entities are registered.
+func (h *Helpers) Publish(externalIDs ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(externalIDs) == 0 {
+		for id := range h.entries {
+			externalIDs = append(externalIDs, id)
+		}
+	}
+	for _, id := range externalIDs {
+		if e, ok := h.entries[id]; ok {
+			h.publishState(e)
+		}
+	}
+}
+
+// update applies change to the helper and publishes and stores its new state. The helper must be of type typ.
+func (h *Helpers) update(ctx context.Context, externalID string, typ types.EntityType, change func(e *entry) error) error {
+	h.mu.Lock()
+	e, ok := h.entries[externalID]
+	if !ok || e.Type != typ {
+		h.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrHelperNotFound, externalID)
+	}
+	if err := change(e); err != nil {
+		h.mu.Unlock()
+		return fmt.Errorf("%s: %w", externalID, err)
+	}
+	pending := h.changed(e)
+	h.mu.Unlock()
+
+	h.save(ctx, pending)
+	return nil
+}
+
+// pendingState is a published state of a helper that is yet to be stored.
+type pendingState struct {
+	id      string
+	version uint64
+	state   datatypes.JSON
+}
+
+// changed publishes the state of the helper and returns it for save. Must be called with mu held, save must
+// not be, so a slow database does not hold up the other helpers and their timers.
+func (h *Helpers) changed(e *entry) pendingState {
+	state, attributes := h.publishState(e)
+	h.version++
+	pending := pendingState{id: e.ExternalID(), version: h.version}
+	raw, err := json.Marshal(storedState{State: state, Attributes: attributes})
+	if err != nil {
+		h.logger.Error("failed to encode helper state", zap.String("helper", pending.id), zap.Error(err))
+		return pendingState{}
+	}
+	pending.state = raw
+	return pending
+}
+
+// save stores the state returned by changed, unless a newer state of the helper was stored meanwhile.
+func (h *Helpers) save(ctx context.Context, pending pendingState) {
+	if pending.state == nil {
+		return
+	}
+	h.savedMu.Lock()
+	saved, ok := h.saved[pending.id]
+	if !ok {
+		saved = &savedState{}
+		h.saved[pending.id] = saved
+	}
+	h.savedMu.Unlock()
+
+	saved.mu.Lock()
+	defer saved.mu.Unlock()
+	if saved.version >= pending.version {
+		return
+	}
+	if err := h.store.SaveHelperState(ctx, pending.id, pending.state); err != nil {
+		h.logger.Error("failed to store helper state", zap.String("helper", pending.id), zap.Error(err))
+		return
+	}
+	saved.version = pending.version
+}
+
+// publishState sends the state of the helper to the event source. Must be called with mu held.
+func (h *Helpers) publishState(e *entry) (any, map[string]any) {
+	state, attributes := e.state()
+	h.send(message{ID: e.ExternalID(), Event: types.EventTypeStateChanged, State: state, Attributes: attributes})
+	return state, attributes
+}
+
+// send is non-blocking, the message is dropped if the event source does not keep up.
+func (h *Helpers) send(msg message) {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		h.logger.Error("failed to encode helper event", zap.String("helper", msg.ID), zap.Error(err))
+		return
+	}
+	select {
+	case h.events <- raw:
+	default:
+		h.logger.Warn("helper event channel full, dropping event", zap.String("helper", msg.ID))
+	}
+}
+
+// scheduleTimer finishes the active timer when it runs out. Must be called with mu held.
+func (h *Helpers) scheduleTimer(e *entry) {
+	e.stopTimer()
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(e.timer.finishesAt), func() {
+		h.mu.Lock()
+		if e.timer.t != t {
+			h.mu.Unlock()
+			return // restarted, paused or cancelled meanwhile
+		}
+		pending := h.finishTimer(e)
+		h.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		h.save(ctx, pending)
+	})
+	e.timer.t = t
+}
+
+// finishTimer stops the timer and publishes timer_finished. The idle state is returned for save. Must be
+// called with mu held.
+func (h *Helpers) finishTimer(e *entry) pendingState {
+	e.stopTimer()
+	e.timer = timerRun{status: TimerIdle, duration: e.timer.duration}
+	pending := h.changed(e)
+	h.send(message{ID: e.ExternalID(), Event: types.EventTimerFinished})
+	return pending
+}
+
+func (e *entry) stopTimer() {
+	if e.timer.t != nil {
+		e.timer.t.Stop()
+		e.timer.t = nil
+	}
+}
@@ -0,0 +1,229 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"home_automation_server/automation"
+	"home_automation_server/integrations"
+	"home_automation_server/types"
+	"slices"
+	"time"
+)
+
+// services returns the services of the helpers, keyed by "<type>.<service>", e.g. "counter.increment".
+func (h *Helpers) services() map[string]integrations.ServiceSpec {
+	services := make(map[string]integrations.ServiceSpec)
+	register := func(typ types.EntityType, name string, params map[string]integrations.ParamMetadata, handler integrations.ServiceHandler) {
+		services[fmt.Sprintf("%s.%s", typ, name)] = integrations.ServiceSpec{
+			Handler: handler,
+			Params:  params,
+			AllowedTargets: integrations.TargetSpec{
+				Type:        []integrations.TargetType{integrations.TargetTypeEntity},
+				EntityTypes: []types.EntityType{typ},
+			},
+		}
+	}
+	add := func(typ types.EntityType, name string, params map[string]integrations.ParamMetadata, change func(e *entry, params map[string]any) error) {
+		register(typ, name, params, h.handler(typ, change))
+	}
+
+	add(types.EntityTypeInputBoolean, "turn_on", nil, func(e *entry, _ map[string]any) error {
+		e.value = true
+		return nil
+	})
+	add(types.EntityTypeInputBoolean, "turn_off", nil, func(e *entry, _ map[string]any) error {
+		e.value = false
+		return nil
+	})
+	add(types.EntityTypeInputBoolean, "toggle", nil, func(e *entry, _ map[string]any) error {
+		on, _ := e.value.(bool)
+		e.value = !on
+		return nil
+	})
+
+	add(types.EntityTypeInputNumber, "set_value", map[string]integrations.ParamMetadata{
+		"value": {DataType: integrations.DataTypeFloat, Description: "Between the min and max of the helper."},
+	}, func(e *entry, params map[string]any) error {
+		value := params["value"].(float64)
+		if !e.inRange(value) {
+			return fmt.Errorf("value %v is not between %v and %v", value, *e.Min, *e.Max)
+		}
+		e.value = value
+		return nil
+	})
+	add(types.EntityTypeInputNumber, "increment", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.clamp(e.value.(float64) + e.Step)
+		return nil
+	})
+	add(types.EntityTypeInputNumber, "decrement", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.clamp(e.value.(float64) - e.Step)
+		return nil
+	})
+
+	add(types.EntityTypeInputSelect, "select_option", map[string]integrations.ParamMetadata{
+		"option": {DataType: integrations.DataTypeString, Description: "One of the options of the helper."},
+	}, func(e *entry, params map[string]any) error {
+		option := params["option"].(string)
+		if !slices.Contains(e.Options, option) {
+			return fmt.Errorf("%q is not an option", option)
+		}
+		e.value = option
+		return nil
+	})
+	add(types.EntityTypeInputSelect, "select_next", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.Options[(slices.Index(e.Options, e.value.(string))+1)%len(e.Options)]
+		return nil
+	})
+	add(types.EntityTypeInputSelect, "select_previous", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.Options[(slices.Index(e.Options, e.value.(string))+len(e.Options)-1)%len(e.Options)]
+		return nil
+	})
+	add(types.EntityTypeInputSelect, "select_first", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.Options[0]
+		return nil
+	})
+	add(types.EntityTypeInputSelect, "select_last", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.Options[len(e.Options)-1]
+		return nil
+	})
+
+	// counters stop at their min and max
+	add(types.EntityTypeCounter, "increment", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.clamp(e.value.(float64) + e.Step)
+		return nil
+	})
+	add(types.EntityTypeCounter, "decrement", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.clamp(e.value.(float64) - e.Step)
+		return nil
+	})
+	add(types.EntityTypeCounter, "reset", nil, func(e *entry, _ map[string]any) error {
+		e.value = e.initialValue()
+		return nil
+	})
+	add(types.EntityTypeCounter, "set_value", map[string]integrations.ParamMetadata{
+		"value": {DataType: integrations.DataTypeInt, Description: "Between the min and max of the counter, if set."},
+	}, func(e *entry, params map[string]any) error {
+		value := float64(params["value"].(int))
+		if !e.inRange(value) {
+			return fmt.Errorf("value %v is outside the min and max of the counter", value)
+		}
+		e.value = value
+		return nil
+	})
+
+	timerParams := map[string]integrations.ParamMetadata{
+		"duration": {DataType: integrations.DataTypeString, Description: "e.g. \"00:05:00\" or \"5m\". Defaults to the remaining time of a paused timer, else the duration of the helper.", Optional: true},
+	}
+	add(types.EntityTypeTimer, "start", timerParams, func(e *entry, params map[string]any) error {
+		return h.startTimer(e, params)
+	})
+	add(types.EntityTypeTimer, "pause", nil, func(e *entry, _ map[string]any) error {
+		if e.timer.status != TimerActive {
+			return nil
+		}
+		e.stopTimer()
+		e.timer = timerRun{status: TimerPaused, duration: e.timer.duration, remaining: time.Until(e.timer.finishesAt)}
+		return nil
+	})
+	add(types.EntityTypeTimer, "cancel", nil, func(e *entry, _ map[string]any) error {
+		e.stopTimer()
+		e.timer = timerRun{status: TimerIdle, duration: e.defaultDuration()}
+		return nil
+	})
+	register(types.EntityTypeTimer, "finish", nil, h.finishHandler)
+	return services
+}
+
+// finishHandler finishes the targeted timers as if they ran out, timers that are idle are left alone.
+func (h *Helpers) finishHandler(ctx context.Context, action *automation.Action) error {
+	for _, t := range action.Targets {
+		h.mu.Lock()
+		e, ok := h.entries[t.EntityID]
+		if !ok || e.Type != types.EntityTypeTimer {
+			h.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrHelperNotFound, t.EntityID)
+		}
+		if e.timer.status == TimerIdle {
+			h.mu.Unlock()
+			continue
+		}
+		pending := h.finishTimer(e)
+		h.mu.Unlock()
+
+		h.save(ctx, pending)
+	}
+	return nil
+}
+
+// handler returns the handler of a service that applies change to every target.
+func (h *Helpers) handler(typ types.EntityType, change func(e *entry, params map[string]any) error) integrations.ServiceHandler {
+	return func(ctx context.Context, action *automation.Action) error {
+		for _, t := range action.Targets {
+			err := h.update(ctx, t.EntityID, typ, func(e *entry) error {
+				return change(e, action.Params)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// startTimer starts the timer, or restarts it if it is active. Must be called with mu held.
+func (h *Helpers) startTimer(e *entry, params map[string]any) error {
+	duration := e.defaultDuration()
+	if e.timer.status == TimerPaused {
+		duration = e.timer.remaining
+	}
+	if s, ok := params["duration"].(string); ok && s != "" {
+		d, err := automation.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		duration = d
+	}
+	if duration <= 0 {
+		return fmt.Errorf("timer has no duration, set one on the helper or pass a duration")
+	}
+
+	total := duration
+	if e.timer.status == TimerPaused && params["duration"] == nil {
+		total = e.timer.duration // resumed, the run keeps its duration
+	}
+	e.timer = timerRun{status: TimerActive, duration: total, finishesAt: time.Now().Add(duration)}
+	h.scheduleTimer(e)
+	return nil
+}
+
+// reproduceState returns the service call that sets a helper to a captured state. Timers are not restored.
+func (h *Helpers) reproduceState(entityID string, entityType types.EntityType, state types.State) ([]automation.Action, error) {
+	call := func(service string, params map[string]any) []automation.Action {
+		return []automation.Action{{
+			Service: fmt.Sprintf("%s.%s", entityType, service),
+			Targets: []automation.Target{{EntityID: entityID}},
+			Params:  params,
+		}}
+	}
+
+	switch entityType {
+	case types.EntityTypeInputBoolean:
+		switch state.State {
+		case "on":
+			return call("turn_on", nil), nil
+		case "off":
+			return call("turn_off", nil), nil
+		}
+	case types.EntityTypeInputNumber, types.EntityTypeCounter:
+		if _, ok := state.State.(float64); ok {
+			return call("set_value", map[string]any{"value": state.State}), nil
+		}
+	case types.EntityTypeInputSelect:
+		if _, ok := state.State.(string); ok {
+			return call("select_option", map[string]any{"option": state.State}), nil
+		}
+	case types.EntityTypeTimer:
+		return nil, fmt.Errorf("timers cannot be captured in scenes")
+	}
+	return nil, fmt.Errorf("cannot reproduce state %v of %s", state.State, entityID)
+}
@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"home_automation_server/types"
+	"time"
+)
+
+// translator turns the raw events of the helpers into state_changed and timer_finished events.
+type translator struct {
+	stateStore     types.StateStore
+	entityRegistry types.EntityRegistry
+	logger         *zap.Logger
+}
+
+func (t *translator) Translate(raw []byte) ([]types.Event, error) {
+	var msg message
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, fmt.Errorf("failed to parse helper event: %w", err)
+	}
+	entityID, ok := t.entityRegistry.Resolve(msg.ID)
+	if !ok {
+		return nil, fmt.Errorf("failed to resolve entityID for helper %s", msg.ID)
+	}
+	context := &types.Context{ID: uuid.NewString()}
+
+	switch msg.Event {
+	case types.EventTypeStateChanged:
+		var oldState *types.State
+		if old, ok := t.stateStore.Get(entityID); ok {
+			oldState = &old
+		}
+		if msg.Attributes == nil {
+			msg.Attributes = map[string]any{}
+		}
+		return []types.Event{{
+			Type: types.EventTypeStateChanged,
+			Data: types.StateChangedData{
+				EntityID: entityID,
+				OldState: oldState,
+				NewState: &types.State{EntityID: entityID, State: msg.State, Attributes: msg.Attributes, Context: context},
+			},
+			Context:   context,
+			TimeFired: time.Now(),
+		}}, nil
+	case types.EventTimerFinished:
+		return []types.Event{{
+			Type:      types.EventTimerFinished,
+			Data:      types.TimerFinishedData{EntityID: entityID},
+			Context:   context,
+			TimeFired: time.Now(),
+		}}, nil
+	default:
+		t.logger.Info("unknown helper event", zap.String("event", string(msg.Event)))
+		return nil, nil
+	}
+}
@@ -0,0 +1,21 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"home_automation_server/integrations/hue/client/types"
+)
+
+// GroupedLightSetState applies the non-nil fields of state to all lights of the room or zone of the grouped
+// light in a single request.
+func (c *ApiClient) GroupedLightSetState(ctx context.Context, id string, state types.GroupedLightPut) error {
+	path := fmt.Sprintf("resource/grouped_light/%s", id)
+
+	resp := types.PutResponse{}
+	if err := c.put(ctx, path, state, &resp); err != nil {
+		c.Logger.Error("failed to set grouped light state", zap.Any("errs", resp.Errors), zap.Any("resource_identifiers", resp.Data))
+		return err
+	}
+	return nil
+}
@@ -73,3 +73,15 @@ func (c *ApiClient) LightStepColor(ctx context.Context, id string, xy types.XY)
 	}
 	return nil
 }
+
+// LightSetState applies the non-nil fields of state to the light in a single request.
+func (c *ApiClient) LightSetState(ctx context.Context, id string, state types.LightPut) error {
+	path := fmt.Sprintf("resource/light/%s", id)
+
+	resp := types.PutResponse{}
+	if err := c.put(ctx, path, state, &resp); err != nil {
+		c.Logger.Error("failed to set light state", zap.Any("errs", resp.Errors), zap.Any("resource_identifiers", resp.Data))
+		return err
+	}
+	return nil
+}
@@ -33,7 +33,8 @@ func (c *ApiClient) GetResources(ctx context.Context) ([]Resource, error) {
 			}
 			res = append(res, light)
 
-		case "room":
+		case "room", "zone":
+			// zones have the same shape as rooms, but contain lights instead of devices
 			room := &types.RoomGet{}
 			if err := json.Unmarshal(raw, room); err != nil {
 				return nil, fmt.Errorf("failed to unmarshal roomGet")
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"home_automation_server/integrations/hue/client/types"
+	"slices"
 	"time"
 )
 
@@ -91,6 +92,31 @@ func (r *ResourceRegistry) ResolveID(typ, name string) (string, error) {
 	return id, nil
 }
 
+// ResolveAreaName returns the name of the room the light is in, or else of a zone it is part of.
+// Rooms contain the devices that own the lights, zones contain the lights themselves. If several rooms or zones
+// match, the first name in order is returned, so the area does not change between discoveries.
+func (r *ResourceRegistry) ResolveAreaName(light *types.LightGet) (string, bool) {
+	for _, typ := range []string{"room", "zone"} {
+		var names []string
+		for _, resource := range r.byTypeAndID[typ] {
+			group, ok := resource.(*types.RoomGet)
+			if !ok {
+				continue
+			}
+			for _, child := range group.Children {
+				if child.RID == light.Owner.RID || child.RID == light.ID {
+					names = append(names, group.Metadata.Name)
+					break
+				}
+			}
+		}
+		if len(names) > 0 {
+			return slices.Min(names), true
+		}
+	}
+	return "", false
+}
+
 func (r *ResourceRegistry) ResolveGroupedLightForResource(resource Resource) (*types.GroupedLightGet, bool) {
 	// Base case
 	if resource.GetType() == "grouped_light" {
@@ -176,7 +202,7 @@ func (c *ApiClient) BuildResourceRegistry() error {
 				return fmt.Errorf("failed to add resource to registry: %w", err)
 			}
 
-		case "room":
+		case "room", "zone":
 			room := &types.RoomGet{}
 			if err := json.Unmarshal(raw, room); err != nil {
 				return err
@@ -5,7 +5,7 @@ type RoomGet struct {
 	IDV1     string               `json:"id_v1,omitempty"` // optional Clip v1 identifier
 	Children []ResourceIdentifier `json:"children"`        // child devices/services
 	Services []ResourceIdentifier `json:"services"`        // aggregated services
-	Type     string               `json:"type"`            // always "room"
+	Type     string               `json:"type"`            // "room", or "zone" for zones
 	Metadata RoomMetadataGet      `json:"metadata"`        // configuration object for room
 }
 
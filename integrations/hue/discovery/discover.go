@@ -58,6 +58,9 @@ func (d *DiscoveryClient) Discover(ctx context.Context) ([]types.Device, []types
 				Enabled:   true,
 				Available: true,
 			}
+			if area, ok := d.ApiClient.ResourceRegistry.ResolveAreaName(lightGet); ok {
+				device.Area = area
+			}
 			devices = append(devices, device)
 
 			// Create Entity
@@ -93,6 +96,7 @@ func (d *DiscoveryClient) Discover(ctx context.Context) ([]types.Device, []types
 				Metadata:  deviceMetadata,
 				Enabled:   false,
 				Available: true,
+				Area:      name, // the room or zone the grouped light belongs to
 			}
 			devices = append(devices, device)
 
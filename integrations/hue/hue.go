@@ -85,5 +85,7 @@ func NewIntegration(ctx context.Context, cfg map[string]any, stateCache types.St
 		Aggregator:  &integration.PassThroughAggregator{},
 		Discovery:   discoveryClient,
 		Services:    s.ExportServices(),
+
+		ReproduceState: s.ReproduceState,
 	}, nil
 }
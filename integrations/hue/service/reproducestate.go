@@ -0,0 +1,40 @@
+package service
+
+import (
+	"fmt"
+	"home_automation_server/automation"
+	"home_automation_server/types"
+	"home_automation_server/utils"
+)
+
+// ReproduceState returns the set_state call that restores a light. Lights that were off are only turned off,
+// brightness and color are restored for lights that were on. The color is restored from color_xy if known,
+// which also covers color temperatures, otherwise from mirek.
+func (s *Service) ReproduceState(entityID string, entityType types.EntityType, state types.State) ([]automation.Action, error) {
+	if entityType != types.EntityTypeLight {
+		return nil, fmt.Errorf("entity type %s is not supported", entityType)
+	}
+	on, ok := state.State.(bool)
+	if !ok {
+		return nil, fmt.Errorf("expected light state to be bool, got %T", state.State)
+	}
+
+	params := map[string]any{"on": on}
+	if on {
+		if brightness, ok := utils.ToFloat64(state.Attributes["brightness"]); ok {
+			params["brightness"] = brightness
+		}
+		if xy, ok := state.Attributes["color_xy"].(map[string]any); ok {
+			params["color_x"] = xy["x"]
+			params["color_y"] = xy["y"]
+		} else if mirek, ok := state.Attributes["mirek"]; ok {
+			params["mirek"] = mirek
+		}
+	}
+
+	return []automation.Action{{
+		Service: "hue.set_state",
+		Targets: []automation.Target{{EntityID: entityID}},
+		Params:  params,
+	}}, nil
+}
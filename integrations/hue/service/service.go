@@ -8,6 +8,7 @@ import (
 	"home_automation_server/automation"
 	"home_automation_server/integrations"
 	"home_automation_server/integrations/hue/client"
+	huetypes "home_automation_server/integrations/hue/client/types"
 	"home_automation_server/types"
 	"math"
 )
@@ -21,14 +22,59 @@ func (s *Service) ExportServices() map[string]integrations.ServiceSpec {
 	return map[string]integrations.ServiceSpec{
 		"step_brightness": {
 			Handler: s.StepBrightness,
-			RequiredParams: map[string]integrations.ParamMetadata{
+			Params: map[string]integrations.ParamMetadata{
 				"direction": {
 					DataType:    "string",
 					Description: "One of: up, down",
+					Enum:        []string{"up", "down"},
 				},
 				"step": {
 					DataType:    "int",
 					Description: "Maximum 100, clips at Max-level or Min-level.",
+					Min:         integrations.Bound(0),
+					Max:         integrations.Bound(100),
+				},
+			},
+			AllowedTargets: integrations.TargetSpec{
+				Type:        []integrations.TargetType{integrations.TargetTypeEntity},
+				EntityTypes: []types.EntityType{types.EntityTypeLight},
+			},
+		},
+		"set_state": {
+			Handler: s.SetState,
+			Params: map[string]integrations.ParamMetadata{
+				"on": {
+					DataType:    "bool",
+					Description: "Turn the light on or off",
+					Optional:    true,
+				},
+				"brightness": {
+					DataType:    "float",
+					Description: "Brightness in percent",
+					Min:         integrations.Bound(0),
+					Max:         integrations.Bound(100),
+					Optional:    true,
+				},
+				"mirek": {
+					DataType:    "int",
+					Description: "Color temperature in mirek, 153-500",
+					Min:         integrations.Bound(153),
+					Max:         integrations.Bound(500),
+					Optional:    true,
+				},
+				"color_x": {
+					DataType:    "float",
+					Description: "X coordinate of the CIE color, requires color_y",
+					Min:         integrations.Bound(0),
+					Max:         integrations.Bound(1),
+					Optional:    true,
+				},
+				"color_y": {
+					DataType:    "float",
+					Description: "Y coordinate of the CIE color, requires color_x",
+					Min:         integrations.Bound(0),
+					Max:         integrations.Bound(1),
+					Optional:    true,
 				},
 			},
 			AllowedTargets: integrations.TargetSpec{
@@ -37,8 +83,8 @@ func (s *Service) ExportServices() map[string]integrations.ServiceSpec {
 			},
 		},
 		"toggle": {
-			Handler:        s.Toggle,
-			RequiredParams: map[string]integrations.ParamMetadata{},
+			Handler: s.Toggle,
+			Params:  map[string]integrations.ParamMetadata{},
 			AllowedTargets: integrations.TargetSpec{
 				Type:        []integrations.TargetType{integrations.TargetTypeEntity},
 				EntityTypes: []types.EntityType{types.EntityTypeLight},
@@ -55,6 +101,9 @@ func (s *Service) StepBrightness(ctx context.Context, action *automation.Action)
 	}
 
 	direction, err := action.StringParam("direction")
+	if err != nil {
+		return err
+	}
 
 	for _, target := range action.Targets {
 		if target.EntityID == "" {
@@ -113,3 +162,85 @@ func (s *Service) Toggle(ctx context.Context, action *automation.Action) error {
 
 	return nil
 }
+
+// SetState sets the on state, brightness and color of lights, or of all lights of a grouped light, in one
+// request. Params that are not given are left unchanged.
+func (s *Service) SetState(ctx context.Context, action *automation.Action) error {
+	state, err := lightPut(action)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range action.Targets {
+		if target.EntityID == "" {
+			return errors.New("target entity id required")
+		}
+		typ, ok := s.Client.ResourceRegistry.GetTypeByID(target.EntityID)
+		if !ok {
+			s.Logger.Warn("Unable to resolve type by id", zap.String("id", target.EntityID))
+		}
+
+		switch typ {
+		case "light":
+			if err := s.Client.LightSetState(ctx, target.EntityID, state); err != nil {
+				return fmt.Errorf("failed to set light state: %w", err)
+			}
+		case "grouped_light":
+			groupState := huetypes.GroupedLightPut{
+				On:               state.On,
+				Dimming:          state.Dimming,
+				ColorTemperature: state.ColorTemperature,
+				Color:            state.Color,
+			}
+			if err := s.Client.GroupedLightSetState(ctx, target.EntityID, groupState); err != nil {
+				return fmt.Errorf("failed to set grouped light state: %w", err)
+			}
+		default:
+			return fmt.Errorf("entity type %s is not supported", typ)
+		}
+	}
+	return nil
+}
+
+func lightPut(action *automation.Action) (huetypes.LightPut, error) {
+	var state huetypes.LightPut
+	if _, ok := action.Params["on"]; ok {
+		on, err := action.BooleanParam("on")
+		if err != nil {
+			return state, err
+		}
+		state.On = &huetypes.OnPut{On: on}
+	}
+	if _, ok := action.Params["brightness"]; ok {
+		brightness, err := action.FloatParam("brightness")
+		if err != nil {
+			return state, err
+		}
+		state.Dimming = &huetypes.DimmingPut{Brightness: brightness}
+	}
+	if _, ok := action.Params["mirek"]; ok {
+		mirek, err := action.IntParam("mirek")
+		if err != nil {
+			return state, err
+		}
+		state.ColorTemperature = &huetypes.ColorTemperaturePut{Mirek: mirek}
+	}
+
+	_, hasX := action.Params["color_x"]
+	_, hasY := action.Params["color_y"]
+	if hasX != hasY {
+		return state, errors.New("color_x and color_y must be given together")
+	}
+	if hasX {
+		x, err := action.FloatParam("color_x")
+		if err != nil {
+			return state, err
+		}
+		y, err := action.FloatParam("color_y")
+		if err != nil {
+			return state, err
+		}
+		state.Color = &huetypes.ColorPut{XY: huetypes.XY{X: x, Y: y}}
+	}
+	return state, nil
+}
@@ -143,7 +143,7 @@ func (t *Translator) translateLightUpdate(e types.ExternalEvent, ts time.Time, c
 
 	entityID, ok := t.entityRegistry.Resolve(lightUpdate.ID)
 	if !ok {
-		return nil, fmt.Errorf("failed to resolve entityID for %s", lightUpdate.Metadata.Name)
+		return nil, fmt.Errorf("failed to resolve entityID for light with id: %s", lightUpdate.ID)
 	}
 
 	oldState, err := t.getOldState(entityID)
@@ -0,0 +1,193 @@
+package integrations
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	DataTypeString = "string"
+	DataTypeInt    = "int"
+	DataTypeFloat  = "float"
+	DataTypeBool   = "bool"
+	DataTypeList   = "list" // a list of strings, e.g. entity IDs
+)
+
+// Bound returns a pointer to v, for the Min and Max of a ParamMetadata.
+func Bound(v float64) *float64 {
+	return &v
+}
+
+// CoerceParams returns a copy of params with every described param converted to its DataType and checked
+// against its constraints. Missing params get their default. Params without metadata are passed unchanged.
+func CoerceParams(metadata map[string]ParamMetadata, params map[string]any) (map[string]any, error) {
+	coerced := make(map[string]any, len(params)+len(metadata))
+	maps.Copy(coerced, params)
+
+	for _, name := range slices.Sorted(maps.Keys(metadata)) {
+		meta := metadata[name]
+		val, ok := params[name]
+		if !ok || val == nil {
+			switch {
+			case meta.Default != nil:
+				val = meta.Default
+			case meta.Optional:
+				continue
+			default:
+				return nil, fmt.Errorf("missing param: %s", name)
+			}
+		}
+		v, err := meta.Coerce(val)
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %w", name, err)
+		}
+		coerced[name] = v
+	}
+	return coerced, nil
+}
+
+// Coerce converts val to the DataType of the param and checks it against Enum, Min and Max.
+// Numbers and booleans may be given as strings, e.g. when rendered by a template.
+func (m ParamMetadata) Coerce(val any) (any, error) {
+	var coerced any
+	var err error
+	switch m.DataType {
+	case DataTypeString:
+		coerced, err = toString(val)
+	case DataTypeInt:
+		coerced, err = toInt(val)
+	case DataTypeFloat:
+		coerced, err = toFloat(val)
+	case DataTypeBool:
+		coerced, err = toBool(val)
+	case DataTypeList:
+		coerced, err = toList(val)
+	default:
+		coerced = val
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.Enum) > 0 && !slices.Contains(m.Enum, fmt.Sprint(coerced)) {
+		return nil, fmt.Errorf("must be one of %s, got %v", strings.Join(m.Enum, ", "), coerced)
+	}
+
+	var n float64
+	switch v := coerced.(type) {
+	case int:
+		n = float64(v)
+	case float64:
+		n = v
+	default:
+		return coerced, nil
+	}
+	if m.Min != nil && n < *m.Min {
+		return nil, fmt.Errorf("must be at least %v, got %v", *m.Min, coerced)
+	}
+	if m.Max != nil && n > *m.Max {
+		return nil, fmt.Errorf("must be at most %v, got %v", *m.Max, coerced)
+	}
+	return coerced, nil
+}
+
+func toString(val any) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case int, int64, float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("must be string, got %T", val)
+	}
+}
+
+func toInt(val any) (int, error) {
+	switch v := val.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("must be int, got %v", v)
+		}
+		return int(v), nil
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("must be int, got %q", v)
+		}
+		return i, nil
+	default:
+		return 0, fmt.Errorf("must be int, got %T", val)
+	}
+}
+
+func toFloat(val any) (float64, error) {
+	switch v := val.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("must be float, got %q", v)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("must be float, got %T", val)
+	}
+}
+
+func toBool(val any) (bool, error) {
+	switch v := val.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "on", "yes", "1":
+			return true, nil
+		case "false", "off", "no", "0":
+			return false, nil
+		}
+		return false, fmt.Errorf("must be bool, got %q", v)
+	default:
+		return false, fmt.Errorf("must be bool, got %T", val)
+	}
+}
+
+// toList accepts a list of strings or a single comma separated string, as rendered by a template.
+func toList(val any) ([]string, error) {
+	switch v := val.(type) {
+	case []string:
+		return v, nil
+	case []any:
+		list := make([]string, len(v))
+		for i, item := range v {
+			s, err := toString(item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			list[i] = s
+		}
+		return list, nil
+	case string:
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("must be list, got %T", val)
+	}
+}
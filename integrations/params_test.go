@@ -0,0 +1,133 @@
+package integrations
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoerceParams(t *testing.T) {
+	metadata := map[string]ParamMetadata{
+		"brightness": {DataType: DataTypeInt, Min: Bound(0), Max: Bound(100)},
+		"transition": {DataType: DataTypeFloat, Optional: true},
+		"on":         {DataType: DataTypeBool, Default: true},
+		"effect":     {DataType: DataTypeString, Enum: []string{"none", "colorloop"}, Optional: true},
+		"entities":   {DataType: DataTypeList, Optional: true},
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]any
+		want   map[string]any
+	}{
+		{
+			name:   "typed values",
+			params: map[string]any{"brightness": 50, "transition": 1.5, "on": false},
+			want:   map[string]any{"brightness": 50, "transition": 1.5, "on": false},
+		},
+		{
+			name:   "strings from templates",
+			params: map[string]any{"brightness": " 42 ", "transition": "0.5", "on": "off"},
+			want:   map[string]any{"brightness": 42, "transition": 0.5, "on": false},
+		},
+		{
+			name:   "whole float to int",
+			params: map[string]any{"brightness": 80.0},
+			want:   map[string]any{"brightness": 80, "on": true},
+		},
+		{
+			name:   "int to float",
+			params: map[string]any{"brightness": 1, "transition": 2},
+			want:   map[string]any{"brightness": 1, "transition": 2.0, "on": true},
+		},
+		{
+			name:   "default for missing and nil",
+			params: map[string]any{"brightness": 0, "on": nil},
+			want:   map[string]any{"brightness": 0, "on": true},
+		},
+		{
+			name:   "bounds are inclusive",
+			params: map[string]any{"brightness": 100},
+			want:   map[string]any{"brightness": 100, "on": true},
+		},
+		{
+			name:   "enum",
+			params: map[string]any{"brightness": 1, "effect": "colorloop"},
+			want:   map[string]any{"brightness": 1, "on": true, "effect": "colorloop"},
+		},
+		{
+			name:   "list from comma separated string",
+			params: map[string]any{"brightness": 1, "entities": "light.a, light.b,"},
+			want:   map[string]any{"brightness": 1, "on": true, "entities": []string{"light.a", "light.b"}},
+		},
+		{
+			name:   "list from any slice",
+			params: map[string]any{"brightness": 1, "entities": []any{"light.a", 2}},
+			want:   map[string]any{"brightness": 1, "on": true, "entities": []string{"light.a", "2"}},
+		},
+		{
+			name:   "params without metadata are kept",
+			params: map[string]any{"brightness": 1, "extra": map[string]any{"x": 1}},
+			want:   map[string]any{"brightness": 1, "on": true, "extra": map[string]any{"x": 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CoerceParams(metadata, tt.params)
+			if err != nil {
+				t.Fatalf("CoerceParams(%v): %v", tt.params, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CoerceParams(%v) = %#v, want %#v", tt.params, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoerceParamsErrors(t *testing.T) {
+	metadata := map[string]ParamMetadata{
+		"brightness": {DataType: DataTypeInt, Min: Bound(0), Max: Bound(100)},
+		"transition": {DataType: DataTypeFloat, Optional: true},
+		"on":         {DataType: DataTypeBool, Optional: true},
+		"effect":     {DataType: DataTypeString, Enum: []string{"none", "colorloop"}, Optional: true},
+		"entities":   {DataType: DataTypeList, Optional: true},
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]any
+		want   string // part of the error
+	}{
+		{"missing required", map[string]any{}, "missing param: brightness"},
+		{"below min", map[string]any{"brightness": -1}, "param brightness: must be at least 0"},
+		{"above max", map[string]any{"brightness": "101"}, "param brightness: must be at most 100"},
+		{"fractional int", map[string]any{"brightness": 1.5}, "param brightness: must be int"},
+		{"not an int", map[string]any{"brightness": "bright"}, "param brightness: must be int"},
+		{"not a float", map[string]any{"brightness": 1, "transition": "slow"}, "param transition: must be float"},
+		{"not a bool", map[string]any{"brightness": 1, "on": "maybe"}, "param on: must be bool"},
+		{"not in enum", map[string]any{"brightness": 1, "effect": "strobe"}, "param effect: must be one of none, colorloop"},
+		{"not a string", map[string]any{"brightness": 1, "effect": []any{"none"}}, "param effect: must be string"},
+		{"not a list", map[string]any{"brightness": 1, "entities": 3}, "param entities: must be list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CoerceParams(metadata, tt.params)
+			if err == nil {
+				t.Fatalf("CoerceParams(%v) = %v, want an error containing %q", tt.params, got, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CoerceParams(%v) error = %q, want it to contain %q", tt.params, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoerceParamsDoesNotModifyParams(t *testing.T) {
+	params := map[string]any{"brightness": "10"}
+	if _, err := CoerceParams(map[string]ParamMetadata{"brightness": {DataType: DataTypeInt}}, params); err != nil {
+		t.Fatal(err)
+	}
+	if params["brightness"] != "10" {
+		t.Errorf("params were modified: %v", params)
+	}
+}
@@ -0,0 +1,11 @@
+package integrations
+
+import (
+	"home_automation_server/automation"
+	"home_automation_server/types"
+)
+
+// ReproduceStateFunc returns the service calls that bring an entity of the integration back to a captured state,
+// e.g. when a scene is applied. The calls target entityID and are made through the service registry like any
+// other action. State and attributes are JSON-decoded values, so numbers are float64 and objects map[string]any.
+type ReproduceStateFunc func(entityID string, entityType types.EntityType, state types.State) ([]automation.Action, error)
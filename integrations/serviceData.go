@@ -16,16 +16,25 @@ type ServiceHandler func(ctx context.Context, action *automation.Action) error
 
 type ServiceSpec struct {
 	Handler        ServiceHandler
-	RequiredParams map[string]ParamMetadata
+	Params         map[string]ParamMetadata // required and optional params, see ParamMetadata.Optional
 	AllowedTargets TargetSpec
 }
 
+// TargetSpec describes the targets a service accepts. Device, area, entity type and label targets are expanded
+// to the matching entities of EntityTypes by the engine, handlers only receive entity targets.
 type TargetSpec struct {
 	Type        []TargetType       // could be TargetTypeEntity, TargetTypeDevice ... only entity supported at the moment.
-	EntityTypes []types.EntityType // valid if TargetTypeEntity is in TargetType array
+	EntityTypes []types.EntityType // valid if TargetTypeEntity is in TargetType array, empty to accept any type
 }
 
+// ParamMetadata describes a service param. Params are coerced to the DataType and checked against the
+// constraints before the handler is called, see CoerceParams.
 type ParamMetadata struct {
-	DataType    string
+	DataType    string // one of: string, int, float, bool, list
 	Description string
+	Enum        []string `json:",omitempty"` // allowed values
+	Min         *float64 `json:",omitempty"` // lower bound of int and float params
+	Max         *float64 `json:",omitempty"` // upper bound of int and float params
+	Default     any      `json:",omitempty"` // used when the param is missing
+	Optional    bool     `json:",omitempty"` // the param may be omitted without a default
 }
@@ -31,10 +31,18 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := setupHome(e); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupLoopBreaker(e); err != nil {
+		log.Fatal(err)
+	}
+
 	registerIntegrationDescriptors(e)
 	if err := LoadIntegrations(ctx, e); err != nil {
 		log.Fatal(err)
 	}
+	setupAutomationsDir(ctx, e)
 
 	// Setup API + WS Server
 	eventCh := e.ProcessedEventBus.Subscribe()
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"home_automation_server/storage/models"
+	"time"
+)
+
+type AreaStore interface {
+	LoadAreas(ctx context.Context) ([]models.Area, error)
+	GetArea(ctx context.Context, id string) (*models.Area, error)
+	CreateArea(ctx context.Context, a *models.Area) error
+	UpdateArea(ctx context.Context, a *models.Area) error
+	DeleteArea(ctx context.Context, id string) error
+	AssignDevices(ctx context.Context, areaID string, deviceIDs []string) error
+	AssignEntities(ctx context.Context, areaID string, entityIDs []string) error
+}
+
+type GormAreaStore struct {
+	db *gorm.DB
+}
+
+func NewGormAreaStore(db *gorm.DB) *GormAreaStore {
+	return &GormAreaStore{db: db}
+}
+
+func (s *GormAreaStore) LoadAreas(ctx context.Context) ([]models.Area, error) {
+	var areas []models.Area
+	if err := s.db.WithContext(ctx).Order("name ASC").Find(&areas).Error; err != nil {
+		return nil, fmt.Errorf("failed to load areas: %w", err)
+	}
+	return areas, nil
+}
+
+// GetArea fetches a single area. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormAreaStore) GetArea(ctx context.Context, id string) (*models.Area, error) {
+	var area models.Area
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&area).Error; err != nil {
+		return nil, err
+	}
+	return &area, nil
+}
+
+// CreateArea inserts a new area
+func (s *GormAreaStore) CreateArea(ctx context.Context, a *models.Area) error {
+	return s.db.WithContext(ctx).Create(a).Error
+}
+
+// UpdateArea renames an existing area. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormAreaStore) UpdateArea(ctx context.Context, a *models.Area) error {
+	a.UpdatedAt = time.Now()
+	res := s.db.WithContext(ctx).Model(&models.Area{ID: a.ID}).
+		Select("name", "updated_at").
+		Updates(a)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteArea removes an area and unassigns its devices and entities. It returns gorm.ErrRecordNotFound if it
+// does not exist.
+func (s *GormAreaStore) DeleteArea(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&models.Area{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Model(&models.Device{}).Where("area_id = ?", id).Update("area_id", "").Error; err != nil {
+			return fmt.Errorf("failed to unassign devices: %w", err)
+		}
+		if err := tx.Model(&models.Entity{}).Where("area_id = ?", id).Update("area_id", "").Error; err != nil {
+			return fmt.Errorf("failed to unassign entities: %w", err)
+		}
+		return nil
+	})
+}
+
+// AssignDevices moves the devices to the area, an empty areaID unassigns them.
+func (s *GormAreaStore) AssignDevices(ctx context.Context, areaID string, deviceIDs []string) error {
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Model(&models.Device{}).Where("id IN ?", deviceIDs).
+		Updates(map[string]any{"area_id": areaID, "updated_at": time.Now()}).Error
+}
+
+// AssignEntities moves the entities to the area, an empty areaID makes them use the area of their device.
+func (s *GormAreaStore) AssignEntities(ctx context.Context, areaID string, entityIDs []string) error {
+	if len(entityIDs) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).Model(&models.Entity{}).Where("entity_id IN ?", entityIDs).
+		Updates(map[string]any{"area_id": areaID, "updated_at": time.Now()}).Error
+}
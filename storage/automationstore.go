@@ -10,7 +10,12 @@ import (
 
 type AutomationStore interface {
 	LoadAutomations(ctx context.Context) ([]models.Automation, error)
-	UpdateLastTriggered(ctx context.Context, id uint) error
+	GetAutomation(ctx context.Context, id uint64) (*models.Automation, error)
+	CreateAutomation(ctx context.Context, a *models.Automation) error
+	UpdateAutomation(ctx context.Context, a *models.Automation) error
+	DeleteAutomation(ctx context.Context, id uint64) error
+	UpdateLastTriggered(ctx context.Context, id uint64) error
+	UpdateEnabled(ctx context.Context, id uint64, enabled bool) error
 }
 
 type GormRuleStore struct {
@@ -31,8 +36,55 @@ func (s *GormRuleStore) LoadAutomations(ctx context.Context) ([]models.Automatio
 	return rules, nil
 }
 
+// GetAutomation fetches a single automation. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormRuleStore) GetAutomation(ctx context.Context, id uint64) (*models.Automation, error) {
+	var a models.Automation
+	if err := s.db.WithContext(ctx).First(&a, id).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// CreateAutomation inserts a new automation and sets its ID
+func (s *GormRuleStore) CreateAutomation(ctx context.Context, a *models.Automation) error {
+	return s.db.WithContext(ctx).Create(a).Error
+}
+
+// UpdateAutomation overwrites the definition of an existing automation, keeping last_triggered and created_at.
+// It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormRuleStore) UpdateAutomation(ctx context.Context, a *models.Automation) error {
+	a.UpdatedAt = time.Now()
+	res := s.db.WithContext(ctx).Model(&models.Automation{ID: a.ID}).
+		Select("alias", "description", "triggers", "conditions", "actions", "enabled", "mode", "max", "updated_at").
+		Updates(a)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAutomation removes an automation. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormRuleStore) DeleteAutomation(ctx context.Context, id uint64) error {
+	res := s.db.WithContext(ctx).Delete(&models.Automation{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 // UpdateLastTriggered sets the last_triggered timestamp for an automation
-func (s *GormRuleStore) UpdateLastTriggered(ctx context.Context, id uint) error {
+func (s *GormRuleStore) UpdateLastTriggered(ctx context.Context, id uint64) error {
 	now := time.Now().UTC()
 	return s.db.WithContext(ctx).Model(&models.Automation{}).Where("id = ?", id).Update("last_triggered", &now).Error
 }
+
+// UpdateEnabled enables or disables an automation without changing its definition
+func (s *GormRuleStore) UpdateEnabled(ctx context.Context, id uint64, enabled bool) error {
+	return s.db.WithContext(ctx).Model(&models.Automation{}).Where("id = ?", id).Update("enabled", enabled).Error
+}
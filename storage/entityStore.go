@@ -13,11 +13,11 @@ import (
 type EntityStore interface {
 	AddEntity(ctx context.Context, e *models.Entity) error
 	UpdateEntity(ctx context.Context, e *models.Entity) error
-	GetEntityByID(ctx context.Context, id string) (*models.Entity, error)
+	GetEntityByID(ctx context.Context, integrationID uint, externalID string) (*models.Entity, error)
 	GetAllEntities(ctx context.Context) ([]models.Entity, error)
 	GetEntitiesByDevice(ctx context.Context, deviceID string) ([]models.Entity, error)
 	GetEntitiesByDeviceIDs(ctx context.Context, deviceIDs []string) ([]models.Entity, error)
-	DeleteEntity(ctx context.Context, id uint) error
+	DeleteEntity(ctx context.Context, integrationID uint, externalID string) error
 }
 
 // GormEntityStore implements EntityStore using GORM
@@ -43,10 +43,10 @@ func (s *GormEntityStore) UpdateEntity(ctx context.Context, e *models.Entity) er
 	return s.db.WithContext(ctx).Save(e).Error
 }
 
-// GetEntityByID fetches an entity by primary key
-func (s *GormEntityStore) GetEntityByID(ctx context.Context, id string) (*models.Entity, error) {
+// GetEntityByID fetches an entity by primary key, the integration that owns it and its external ID
+func (s *GormEntityStore) GetEntityByID(ctx context.Context, integrationID uint, externalID string) (*models.Entity, error) {
 	var e models.Entity
-	err := s.db.WithContext(ctx).Where("external_id = ?", id).First(&e).Error
+	err := s.db.WithContext(ctx).Where("integration_id = ? AND external_id = ?", integrationID, externalID).First(&e).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, err
@@ -91,9 +91,10 @@ func (s *GormEntityStore) GetEntitiesByDevice(ctx context.Context, deviceID stri
 	return entities, nil
 }
 
-// DeleteEntity removes an entity by ExternalID
-func (s *GormEntityStore) DeleteEntity(ctx context.Context, id uint) error {
-	return s.db.WithContext(ctx).Delete(&models.Entity{}, id).Error
+// DeleteEntity removes an entity by the integration that owns it and its ExternalID
+func (s *GormEntityStore) DeleteEntity(ctx context.Context, integrationID uint, externalID string) error {
+	return s.db.WithContext(ctx).Where("integration_id = ? AND external_id = ?", integrationID, externalID).
+		Delete(&models.Entity{}).Error
 }
 
 // GetAllEntities fetches all entities in the database
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"home_automation_server/storage/models"
+	"time"
+)
+
+type HelperStore interface {
+	LoadHelpers(ctx context.Context) ([]models.Helper, error)
+	CreateHelper(ctx context.Context, h *models.Helper) error
+	UpdateHelper(ctx context.Context, h *models.Helper) error
+	DeleteHelper(ctx context.Context, id string) error
+	SaveHelperState(ctx context.Context, id string, state datatypes.JSON) error
+}
+
+type GormHelperStore struct {
+	db *gorm.DB
+}
+
+func NewGormHelperStore(db *gorm.DB) *GormHelperStore {
+	return &GormHelperStore{db: db}
+}
+
+func (s *GormHelperStore) LoadHelpers(ctx context.Context) ([]models.Helper, error) {
+	var helpers []models.Helper
+	if err := s.db.WithContext(ctx).Order("id ASC").Find(&helpers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load helpers: %w", err)
+	}
+	return helpers, nil
+}
+
+// CreateHelper inserts a new helper
+func (s *GormHelperStore) CreateHelper(ctx context.Context, h *models.Helper) error {
+	return s.db.WithContext(ctx).Create(h).Error
+}
+
+// UpdateHelper stores the name and config of an existing helper. It returns gorm.ErrRecordNotFound if it does
+// not exist.
+func (s *GormHelperStore) UpdateHelper(ctx context.Context, h *models.Helper) error {
+	h.UpdatedAt = time.Now()
+	res := s.db.WithContext(ctx).Model(&models.Helper{ID: h.ID}).
+		Select("name", "config", "updated_at").
+		Updates(h)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteHelper removes a helper. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormHelperStore) DeleteHelper(ctx context.Context, id string) error {
+	res := s.db.WithContext(ctx).Where("id = ?", id).Delete(&models.Helper{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SaveHelperState stores the last state of a helper.
+func (s *GormHelperStore) SaveHelperState(ctx context.Context, id string, state datatypes.JSON) error {
+	return s.db.WithContext(ctx).Model(&models.Helper{}).Where("id = ?", id).Update("state", state).Error
+}
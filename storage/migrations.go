@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"fmt"
+	"home_automation_server/storage/models"
+
+	"gorm.io/gorm"
+)
+
+// MigrateEntityKeys moves the entities table from the external ID as primary key to the integration config
+// ID and external ID. The integration of existing entities is taken from their device. It must run before
+// AutoMigrate, which can not change a primary key, and does nothing for new or migrated tables.
+func MigrateEntityKeys(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Entity{}) || migrator.HasColumn(&models.Entity{}, "IntegrationID") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().AddColumn(&models.Entity{}, "IntegrationID"); err != nil {
+			return fmt.Errorf("failed to add entity integration id: %w", err)
+		}
+		err := tx.Exec("UPDATE entities JOIN devices ON devices.id = entities.device_id " +
+			"SET entities.integration_id = devices.integration_id").Error
+		if err != nil {
+			return fmt.Errorf("failed to set entity integration ids: %w", err)
+		}
+		err = tx.Exec("ALTER TABLE entities DROP PRIMARY KEY, ADD PRIMARY KEY (integration_id, external_id)").Error
+		if err != nil {
+			return fmt.Errorf("failed to change entity primary key: %w", err)
+		}
+		return nil
+	})
+}
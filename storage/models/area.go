@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Area is a room or zone devices and entities can be assigned to.
+type Area struct {
+	ID        string    `gorm:"primaryKey;size:191" json:"id"` // e.g. "living_room", used in area_id targets
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -13,6 +13,7 @@ type Device struct {
 	Metadata      datatypes.JSON `gorm:"type:json" json:"metadata"`     // extra device info
 	Enabled       bool           `gorm:"default:false" json:"enabled"`
 	Available     bool           `gorm:"default:true" json:"available"`
+	AreaID        string         `gorm:"size:191;index" json:"area_id"` // area of the device's entities
 
 	Entities  []Entity  `gorm:"foreignKey:DeviceID" json:"entities,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
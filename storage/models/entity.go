@@ -1,17 +1,28 @@
 package models
 
 import (
+	"gorm.io/datatypes"
 	"time"
 )
 
+// Entity is keyed by the integration config that owns it and its external ID, integrations may use the same
+// external IDs, e.g. two Hue bridges.
 type Entity struct {
-	ExternalID string `gorm:"primaryKey;size:191"`
-	DeviceID   string `gorm:"size:191;not null;index"` // the ID of the device that exposes the entity
-	EntityID   string `gorm:"size:255;not null;index"` // human readable unique_id e.g. "light.living_room"
-	Type       string `gorm:"size:50;index;not null"`  // e.g. "light", "sensor", "switch"
-	Name       string `gorm:"size:100;not null"`
-	Enabled    bool   `gorm:"default:false"`
-	Available  bool   `gorm:"default:true"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	IntegrationID uint   `gorm:"primaryKey;autoIncrement:false"`
+	ExternalID    string `gorm:"primaryKey;size:191"`
+	DeviceID      string `gorm:"size:191;not null;index"` // the ID of the device that exposes the entity
+	EntityID      string `gorm:"size:255;not null;index"` // human readable unique_id e.g. "light.living_room"
+	Type          string `gorm:"size:50;index;not null"`  // e.g. "light", "sensor", "switch"
+	Name          string `gorm:"size:100;not null"`
+	Enabled       bool   `gorm:"default:false"`
+	Available     bool   `gorm:"default:true"`
+
+	FriendlyName string `gorm:"size:100"` // set by the user, overrides Name
+	Icon         string `gorm:"size:100"` // e.g. "mdi:lamp", empty for the default icon of the type
+
+	AreaID string         `gorm:"size:191;index"` // overrides the area of the device, empty to use it
+	Labels datatypes.JSON `gorm:"type:json"`      // list of labels, used to target entities across devices and areas
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
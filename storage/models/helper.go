@@ -0,0 +1,17 @@
+package models
+
+import (
+	"gorm.io/datatypes"
+	"time"
+)
+
+// Helper is a virtual entity of the helpers integration, e.g. an input_boolean for a mode of the home.
+type Helper struct {
+	ID        string         `gorm:"primaryKey;size:191"` // "<type>.<id>", the external ID of the entity, e.g. "input_boolean.night_mode"
+	Type      string         `gorm:"size:50;not null"`    // e.g. "input_boolean", "counter"
+	Name      string         `gorm:"size:100;not null"`
+	Config    datatypes.JSON `gorm:"type:json"` // the options of the type, e.g. min and max of an input_number
+	State     datatypes.JSON `gorm:"type:json"` // the last state, restored on start
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
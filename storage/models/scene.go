@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/datatypes"
+	"time"
+)
+
+type Scene struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement"`
+	Name        string         `gorm:"size:191;uniqueIndex;not null"` // the service name, applied as scene.<name>
+	Alias       string         `gorm:"size:255;not null"`
+	Description string         `gorm:"size:255;not null"`
+	Entities    datatypes.JSON `gorm:"type:json;not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"gorm.io/datatypes"
+	"time"
+)
+
+type Script struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement"`
+	Name        string         `gorm:"size:191;uniqueIndex;not null"` // the service name, called as script.<name>
+	Alias       string         `gorm:"size:255;not null"`
+	Description string         `gorm:"size:255;not null"`
+	Fields      datatypes.JSON `gorm:"type:json"`
+	Sequence    datatypes.JSON `gorm:"type:json;not null"`
+	Mode        string         `gorm:"size:16"`
+	Max         int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"gorm.io/datatypes"
+	"time"
+)
+
+// AutomationTrace is a recorded run of an automation or, if ScriptID is set, of a script.
+// The trace itself is stored as JSON.
+type AutomationTrace struct {
+	ID           uint           `gorm:"primaryKey;autoIncrement"`
+	AutomationID uint64         `gorm:"index;not null"`
+	ScriptID     uint           `gorm:"index;not null;default:0"`
+	RunID        string         `gorm:"type:char(36);uniqueIndex;not null"`
+	Result       string         `gorm:"size:32;not null"`
+	Trace        datatypes.JSON `gorm:"type:json;not null"`
+	StartedAt    time.Time      `gorm:"index;not null"`
+	FinishedAt   *time.Time
+	CreatedAt    time.Time
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"home_automation_server/storage/models"
+	"time"
+)
+
+type SceneStore interface {
+	LoadScenes(ctx context.Context) ([]models.Scene, error)
+	GetScene(ctx context.Context, id uint) (*models.Scene, error)
+	CreateScene(ctx context.Context, s *models.Scene) error
+	UpdateScene(ctx context.Context, s *models.Scene) error
+	DeleteScene(ctx context.Context, id uint) error
+}
+
+type GormSceneStore struct {
+	db *gorm.DB
+}
+
+func NewGormSceneStore(db *gorm.DB) *GormSceneStore {
+	return &GormSceneStore{db: db}
+}
+
+func (s *GormSceneStore) LoadScenes(ctx context.Context) ([]models.Scene, error) {
+	var scenes []models.Scene
+	if err := s.db.WithContext(ctx).Order("id ASC").Find(&scenes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load scenes: %w", err)
+	}
+	return scenes, nil
+}
+
+// GetScene fetches a single scene. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormSceneStore) GetScene(ctx context.Context, id uint) (*models.Scene, error) {
+	var scene models.Scene
+	if err := s.db.WithContext(ctx).First(&scene, id).Error; err != nil {
+		return nil, err
+	}
+	return &scene, nil
+}
+
+// CreateScene inserts a new scene and sets its ID
+func (s *GormSceneStore) CreateScene(ctx context.Context, scene *models.Scene) error {
+	return s.db.WithContext(ctx).Create(scene).Error
+}
+
+// UpdateScene overwrites the definition of an existing scene, keeping created_at.
+// It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormSceneStore) UpdateScene(ctx context.Context, scene *models.Scene) error {
+	scene.UpdatedAt = time.Now()
+	res := s.db.WithContext(ctx).Model(&models.Scene{ID: scene.ID}).
+		Select("name", "alias", "description", "entities", "updated_at").
+		Updates(scene)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteScene removes a scene. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormSceneStore) DeleteScene(ctx context.Context, id uint) error {
+	res := s.db.WithContext(ctx).Delete(&models.Scene{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"home_automation_server/storage/models"
+	"time"
+)
+
+type ScriptStore interface {
+	LoadScripts(ctx context.Context) ([]models.Script, error)
+	GetScript(ctx context.Context, id uint) (*models.Script, error)
+	CreateScript(ctx context.Context, s *models.Script) error
+	UpdateScript(ctx context.Context, s *models.Script) error
+	DeleteScript(ctx context.Context, id uint) error
+}
+
+type GormScriptStore struct {
+	db *gorm.DB
+}
+
+func NewGormScriptStore(db *gorm.DB) *GormScriptStore {
+	return &GormScriptStore{db: db}
+}
+
+func (s *GormScriptStore) LoadScripts(ctx context.Context) ([]models.Script, error) {
+	var scripts []models.Script
+	if err := s.db.WithContext(ctx).Order("id ASC").Find(&scripts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load scripts: %w", err)
+	}
+	return scripts, nil
+}
+
+// GetScript fetches a single script. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormScriptStore) GetScript(ctx context.Context, id uint) (*models.Script, error) {
+	var script models.Script
+	if err := s.db.WithContext(ctx).First(&script, id).Error; err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+// CreateScript inserts a new script and sets its ID
+func (s *GormScriptStore) CreateScript(ctx context.Context, script *models.Script) error {
+	return s.db.WithContext(ctx).Create(script).Error
+}
+
+// UpdateScript overwrites the definition of an existing script, keeping created_at.
+// It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormScriptStore) UpdateScript(ctx context.Context, script *models.Script) error {
+	script.UpdatedAt = time.Now()
+	res := s.db.WithContext(ctx).Model(&models.Script{ID: script.ID}).
+		Select("name", "alias", "description", "fields", "sequence", "mode", "max", "updated_at").
+		Updates(script)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteScript removes a script. It returns gorm.ErrRecordNotFound if it does not exist.
+func (s *GormScriptStore) DeleteScript(ctx context.Context, id uint) error {
+	res := s.db.WithContext(ctx).Delete(&models.Script{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
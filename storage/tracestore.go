@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"home_automation_server/storage/models"
+)
+
+type TraceStore interface {
+	// SaveTrace stores a trace and deletes the oldest traces of the automation or script beyond keep.
+	SaveTrace(ctx context.Context, trace models.AutomationTrace, keep int) error
+	// GetTraces returns the traces of an automation, newest first.
+	GetTraces(ctx context.Context, automationID uint64) ([]models.AutomationTrace, error)
+	DeleteTraces(ctx context.Context, automationID uint64) error
+	// GetScriptTraces returns the traces of a script, newest first.
+	GetScriptTraces(ctx context.Context, scriptID uint) ([]models.AutomationTrace, error)
+	DeleteScriptTraces(ctx context.Context, scriptID uint) error
+}
+
+type GormTraceStore struct {
+	db *gorm.DB
+}
+
+func NewGormTraceStore(db *gorm.DB) *GormTraceStore {
+	return &GormTraceStore{db: db}
+}
+
+func (s *GormTraceStore) SaveTrace(ctx context.Context, trace models.AutomationTrace, keep int) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&trace).Error; err != nil {
+			return fmt.Errorf("failed to save trace: %w", err)
+		}
+
+		var stale []uint
+		if err := tx.Model(&models.AutomationTrace{}).
+			Where("automation_id = ? AND script_id = ?", trace.AutomationID, trace.ScriptID).
+			Order("started_at DESC, id DESC").
+			Offset(keep).
+			Pluck("id", &stale).Error; err != nil {
+			return fmt.Errorf("failed to find old traces: %w", err)
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		return tx.Delete(&models.AutomationTrace{}, stale).Error
+	})
+}
+
+func (s *GormTraceStore) GetTraces(ctx context.Context, automationID uint64) ([]models.AutomationTrace, error) {
+	return s.getTraces(ctx, automationID, 0)
+}
+
+func (s *GormTraceStore) GetScriptTraces(ctx context.Context, scriptID uint) ([]models.AutomationTrace, error) {
+	return s.getTraces(ctx, 0, scriptID)
+}
+
+func (s *GormTraceStore) getTraces(ctx context.Context, automationID uint64, scriptID uint) ([]models.AutomationTrace, error) {
+	var traces []models.AutomationTrace
+	if err := s.db.WithContext(ctx).
+		Where("automation_id = ? AND script_id = ?", automationID, scriptID).
+		Order("started_at DESC, id DESC").
+		Find(&traces).Error; err != nil {
+		return nil, fmt.Errorf("failed to load traces: %w", err)
+	}
+	return traces, nil
+}
+
+func (s *GormTraceStore) DeleteTraces(ctx context.Context, automationID uint64) error {
+	return s.db.WithContext(ctx).Where("automation_id = ? AND script_id = 0", automationID).Delete(&models.AutomationTrace{}).Error
+}
+
+func (s *GormTraceStore) DeleteScriptTraces(ctx context.Context, scriptID uint) error {
+	return s.db.WithContext(ctx).Where("automation_id = 0 AND script_id = ?", scriptID).Delete(&models.AutomationTrace{}).Error
+}
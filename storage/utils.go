@@ -44,14 +44,15 @@ func IntegrationCfgFromStorage(icfg models.IntegrationConfig) (integration.Integ
 
 func EntityFromStorage(e models.Entity) (types.Entity, error) {
 	return types.Entity{
-		ExternalID: e.ExternalID,
-		DeviceID:   e.DeviceID,
-		EntityID:   e.EntityID,
-		Type:       types.EntityType(e.Type),
-		Name:       e.Name,
-		Enabled:    e.Enabled,
-		Available:  e.Available,
-		CreatedAt:  e.CreatedAt,
+		IntegrationID: e.IntegrationID,
+		ExternalID:    e.ExternalID,
+		DeviceID:      e.DeviceID,
+		EntityID:      e.EntityID,
+		Type:          types.EntityType(e.Type),
+		Name:          e.Name,
+		Enabled:       e.Enabled,
+		Available:     e.Available,
+		CreatedAt:     e.CreatedAt,
 	}, nil
 }
 
@@ -75,14 +76,15 @@ func DeviceFromStorage(d models.Device) (types.Device, error) {
 
 func EntityToStorage(e types.Entity) (models.Entity, error) {
 	return models.Entity{
-		ExternalID: e.ExternalID,
-		DeviceID:   e.DeviceID,
-		EntityID:   e.EntityID,
-		Type:       string(e.Type),
-		Name:       e.Name,
-		Enabled:    e.Enabled,
-		Available:  e.Available,
-		CreatedAt:  e.CreatedAt,
+		IntegrationID: e.IntegrationID,
+		ExternalID:    e.ExternalID,
+		DeviceID:      e.DeviceID,
+		EntityID:      e.EntityID,
+		Type:          string(e.Type),
+		Name:          e.Name,
+		Enabled:       e.Enabled,
+		Available:     e.Available,
+		CreatedAt:     e.CreatedAt,
 	}, nil
 }
 
@@ -105,7 +107,7 @@ func DeviceToStorage(d types.Device) (models.Device, error) {
 
 func AutomationFromStorage(m models.Automation) (automation.Automation, error) {
 	var triggers []automation.BaseTrigger
-	var conditions []automation.Condition
+	var conditions []automation.BaseCondition
 	var actions []automation.Action
 
 	if err := json.Unmarshal(m.Triggers, &triggers); err != nil {
@@ -130,6 +132,8 @@ func AutomationFromStorage(m models.Automation) (automation.Automation, error) {
 		Condition:   conditions,
 		Actions:     actions,
 		Enabled:     m.Enabled,
+		Mode:        automation.RunMode(m.Mode),
+		Max:         m.Max,
 	}, nil
 }
 
@@ -155,10 +159,89 @@ func AutomationToStorage(a automation.Automation) (models.Automation, error) {
 		Conditions:    conditionsJSON,
 		Actions:       actionsJSON,
 		Enabled:       a.Enabled,
+		Mode:          string(a.Mode),
+		Max:           a.Max,
 		LastTriggered: nil,
 	}, nil
 }
 
+func ScriptFromStorage(m models.Script) (automation.Script, error) {
+	var fields map[string]automation.ScriptField
+	var sequence []automation.Action
+
+	if len(m.Fields) > 0 {
+		if err := json.Unmarshal(m.Fields, &fields); err != nil {
+			return automation.Script{}, fmt.Errorf("failed unmarshalling fields: %w", err)
+		}
+	}
+	if err := json.Unmarshal(m.Sequence, &sequence); err != nil {
+		return automation.Script{}, fmt.Errorf("failed unmarshalling sequence: %w", err)
+	}
+
+	return automation.Script{
+		Id:          m.ID,
+		Name:        m.Name,
+		Alias:       m.Alias,
+		Description: m.Description,
+		Fields:      fields,
+		Sequence:    sequence,
+		Mode:        automation.RunMode(m.Mode),
+		Max:         m.Max,
+	}, nil
+}
+
+func ScriptToStorage(s automation.Script) (models.Script, error) {
+	fieldsJSON, err := json.Marshal(s.Fields)
+	if err != nil {
+		return models.Script{}, fmt.Errorf("failed marshalling fields: %w", err)
+	}
+	sequenceJSON, err := json.Marshal(s.Sequence)
+	if err != nil {
+		return models.Script{}, fmt.Errorf("failed marshalling sequence: %w", err)
+	}
+
+	return models.Script{
+		ID:          s.Id,
+		Name:        s.Name,
+		Alias:       s.Alias,
+		Description: s.Description,
+		Fields:      fieldsJSON,
+		Sequence:    sequenceJSON,
+		Mode:        string(s.Mode),
+		Max:         s.Max,
+	}, nil
+}
+
+func SceneFromStorage(m models.Scene) (automation.Scene, error) {
+	var entities map[string]automation.SceneEntity
+	if err := json.Unmarshal(m.Entities, &entities); err != nil {
+		return automation.Scene{}, fmt.Errorf("failed unmarshalling entities: %w", err)
+	}
+
+	return automation.Scene{
+		Id:          m.ID,
+		Name:        m.Name,
+		Alias:       m.Alias,
+		Description: m.Description,
+		Entities:    entities,
+	}, nil
+}
+
+func SceneToStorage(s automation.Scene) (models.Scene, error) {
+	entitiesJSON, err := json.Marshal(s.Entities)
+	if err != nil {
+		return models.Scene{}, fmt.Errorf("failed marshalling entities: %w", err)
+	}
+
+	return models.Scene{
+		ID:          s.Id,
+		Name:        s.Name,
+		Alias:       s.Alias,
+		Description: s.Description,
+		Entities:    entitiesJSON,
+	}, nil
+}
+
 func EventToStorage(e types.Event) (models.Event, error) {
 	var dataBytes []byte
 	var err error
@@ -193,3 +276,20 @@ func EventToStorage(e types.Event) (models.Event, error) {
 
 	return eventModel, nil
 }
+
+func TraceToStorage(t *automation.Trace) (models.AutomationTrace, error) {
+	traceJSON, err := json.Marshal(t)
+	if err != nil {
+		return models.AutomationTrace{}, fmt.Errorf("failed marshalling trace: %w", err)
+	}
+
+	return models.AutomationTrace{
+		AutomationID: t.AutomationID,
+		ScriptID:     t.ScriptID,
+		RunID:        t.RunID,
+		Result:       string(t.Result),
+		Trace:        traceJSON,
+		StartedAt:    t.Started,
+		FinishedAt:   t.Finished,
+	}, nil
+}
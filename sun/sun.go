@@ -0,0 +1,135 @@
+// Package sun computes sunrise, sunset, dawn and dusk locally using the NOAA sunrise equation.
+package sun
+
+import (
+	"math"
+	"time"
+)
+
+type Event string
+
+const (
+	Dawn    Event = "dawn"
+	Sunrise Event = "sunrise"
+	Noon    Event = "noon"
+	Sunset  Event = "sunset"
+	Dusk    Event = "dusk"
+)
+
+// HorizonElevation is the elevation of the sun's centre at sunrise and sunset. It accounts for refraction
+// and the radius of the solar disc.
+const HorizonElevation = -0.833
+
+const (
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+
+	civilDusk        = -6.0
+	earthAxialTilt   = 23.4397
+	secondsPerDay    = 86400.0
+	degreesPerRadian = 180 / math.Pi
+)
+
+// Location is the position of the observer. Longitude is positive east of Greenwich.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Times holds the sun events of a single day. An event is the zero time if it does not occur,
+// e.g. sunset during the polar day.
+type Times struct {
+	Dawn    time.Time
+	Sunrise time.Time
+	Noon    time.Time
+	Sunset  time.Time
+	Dusk    time.Time
+}
+
+func (t Times) Get(event Event) time.Time {
+	switch event {
+	case Dawn:
+		return t.Dawn
+	case Sunrise:
+		return t.Sunrise
+	case Noon:
+		return t.Noon
+	case Sunset:
+		return t.Sunset
+	case Dusk:
+		return t.Dusk
+	default:
+		return time.Time{}
+	}
+}
+
+// Times returns the sun events for the calendar day of date, in the time zone of date.
+func (l Location) Times(date time.Time) Times {
+	tz := date.Location()
+	localNoon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, tz)
+
+	transit, declination := l.solarTransit(toJulian(localNoon))
+	times := Times{Noon: fromJulian(transit, tz)}
+
+	times.Sunrise, times.Sunset = l.crossings(transit, declination, HorizonElevation, tz)
+	times.Dawn, times.Dusk = l.crossings(transit, declination, civilDusk, tz)
+	return times
+}
+
+// Next returns the first occurrence of event after t, looking at most a week ahead.
+func (l Location) Next(event Event, t time.Time) time.Time {
+	for day := 0; day < 7; day++ {
+		candidate := l.Times(t.AddDate(0, 0, day)).Get(event)
+		if !candidate.IsZero() && candidate.After(t) {
+			return candidate
+		}
+	}
+	return time.Time{}
+}
+
+// Elevation returns the approximate elevation of the sun above the horizon in degrees at t.
+func (l Location) Elevation(t time.Time) float64 {
+	j := toJulian(t)
+	transit, declination := l.solarTransit(j)
+	hourAngle := (j - transit) * 2 * math.Pi
+	lat := l.Latitude / degreesPerRadian
+
+	sinElevation := math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Cos(hourAngle)
+	return math.Asin(sinElevation) * degreesPerRadian
+}
+
+// solarTransit returns the julian date of solar noon closest to j and the declination of the sun.
+func (l Location) solarTransit(j float64) (float64, float64) {
+	n := math.Round(j - julian2000 + l.Longitude/360)
+	meanSolarTime := n - l.Longitude/360
+
+	meanAnomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360) / degreesPerRadian
+	center := 1.9148*math.Sin(meanAnomaly) + 0.02*math.Sin(2*meanAnomaly) + 0.0003*math.Sin(3*meanAnomaly)
+	eclipticLongitude := math.Mod(meanAnomaly*degreesPerRadian+center+180+102.9372, 360) / degreesPerRadian
+
+	transit := julian2000 + meanSolarTime + 0.0053*math.Sin(meanAnomaly) - 0.0069*math.Sin(2*eclipticLongitude)
+	declination := math.Asin(math.Sin(eclipticLongitude) * math.Sin(earthAxialTilt/degreesPerRadian))
+	return transit, declination
+}
+
+// crossings returns when the sun passes the given elevation before and after the transit.
+func (l Location) crossings(transit, declination, elevation float64, tz *time.Location) (time.Time, time.Time) {
+	lat := l.Latitude / degreesPerRadian
+	cosHourAngle := (math.Sin(elevation/degreesPerRadian) - math.Sin(lat)*math.Sin(declination)) /
+		(math.Cos(lat) * math.Cos(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{} // sun never crosses the elevation on this day
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * degreesPerRadian
+	return fromJulian(transit-hourAngle/360, tz), fromJulian(transit+hourAngle/360, tz)
+}
+
+func toJulian(t time.Time) float64 {
+	return float64(t.UnixNano())/1e9/secondsPerDay + julianUnixEpoch
+}
+
+func fromJulian(j float64, tz *time.Location) time.Time {
+	seconds := (j - julianUnixEpoch) * secondsPerDay
+	return time.Unix(0, int64(seconds*1e9)).In(tz).Truncate(time.Second)
+}
@@ -0,0 +1,121 @@
+package sun
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	london  = Location{Latitude: 51.5074, Longitude: -0.1278}
+	newYork = Location{Latitude: 40.7128, Longitude: -74.0060}
+	sydney  = Location{Latitude: -33.8688, Longitude: 151.2093}
+	tromso  = Location{Latitude: 69.6492, Longitude: 18.9553}
+
+	bst  = time.FixedZone("BST", 1*60*60)
+	est  = time.FixedZone("EST", -5*60*60)
+	aest = time.FixedZone("AEST", 10*60*60)
+	cet  = time.FixedZone("CET", 1*60*60)
+)
+
+// tolerance allows for the precision of the sunrise equation compared to published tables.
+const tolerance = 2 * time.Minute
+
+func TestTimes(t *testing.T) {
+	tests := []struct {
+		name     string
+		location Location
+		date     time.Time
+		event    Event
+		want     string // local time of day, rounded to the minute
+	}{
+		{"london summer solstice sunrise", london, time.Date(2024, 6, 21, 0, 0, 0, 0, bst), Sunrise, "04:43"},
+		{"london summer solstice sunset", london, time.Date(2024, 6, 21, 0, 0, 0, 0, bst), Sunset, "21:21"},
+		{"london summer solstice noon", london, time.Date(2024, 6, 21, 0, 0, 0, 0, bst), Noon, "13:02"},
+		{"london summer solstice dawn", london, time.Date(2024, 6, 21, 0, 0, 0, 0, bst), Dawn, "03:55"},
+		{"london summer solstice dusk", london, time.Date(2024, 6, 21, 0, 0, 0, 0, bst), Dusk, "22:09"},
+		{"new york winter solstice sunrise", newYork, time.Date(2024, 12, 21, 0, 0, 0, 0, est), Sunrise, "07:17"},
+		{"new york winter solstice sunset", newYork, time.Date(2024, 12, 21, 0, 0, 0, 0, est), Sunset, "16:32"},
+		{"sydney winter solstice sunrise", sydney, time.Date(2024, 6, 21, 0, 0, 0, 0, aest), Sunrise, "07:00"},
+		{"sydney winter solstice sunset", sydney, time.Date(2024, 6, 21, 0, 0, 0, 0, aest), Sunset, "16:54"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.location.Times(tt.date).Get(tt.event)
+			want, err := time.ParseInLocation("2006-01-02 15:04", tt.date.Format("2006-01-02 ")+tt.want, tt.date.Location())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := got.Sub(want).Abs(); diff > tolerance {
+				t.Errorf("%s = %s, want %s ±%s", tt.event, got.Format(time.TimeOnly), tt.want, tolerance)
+			}
+			if got.Location() != tt.date.Location() {
+				t.Errorf("%s is in %s, want the time zone of the date %s", tt.event, got.Location(), tt.date.Location())
+			}
+		})
+	}
+}
+
+func TestTimesPolar(t *testing.T) {
+	midsummer := tromso.Times(time.Date(2024, 6, 21, 0, 0, 0, 0, cet))
+	if !midsummer.Sunrise.IsZero() || !midsummer.Sunset.IsZero() {
+		t.Errorf("midnight sun: sunrise %s, sunset %s, want none", midsummer.Sunrise, midsummer.Sunset)
+	}
+	if midsummer.Noon.IsZero() {
+		t.Error("midnight sun: want a noon")
+	}
+
+	midwinter := tromso.Times(time.Date(2024, 12, 21, 0, 0, 0, 0, cet))
+	if !midwinter.Sunrise.IsZero() || !midwinter.Sunset.IsZero() {
+		t.Errorf("polar night: sunrise %s, sunset %s, want none", midwinter.Sunrise, midwinter.Sunset)
+	}
+	if midwinter.Dawn.IsZero() || midwinter.Dusk.IsZero() {
+		t.Error("polar night: want a civil dawn and dusk")
+	}
+}
+
+func TestNext(t *testing.T) {
+	day := time.Date(2024, 6, 21, 0, 0, 0, 0, bst)
+	today := london.Times(day)
+	tomorrow := london.Times(day.AddDate(0, 0, 1))
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"before sunrise", day, today.Sunrise},
+		{"at sunrise", today.Sunrise, tomorrow.Sunrise},
+		{"after sunrise", today.Noon, tomorrow.Sunrise},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := london.Next(Sunrise, tt.t); !got.Equal(tt.want) {
+				t.Errorf("Next(sunrise, %s) = %s, want %s", tt.t, got, tt.want)
+			}
+		})
+	}
+
+	if got := tromso.Next(Sunrise, time.Date(2024, 6, 21, 0, 0, 0, 0, cet)); !got.IsZero() {
+		t.Errorf("Next(sunrise) during the midnight sun = %s, want none", got)
+	}
+}
+
+func TestElevation(t *testing.T) {
+	times := london.Times(time.Date(2024, 6, 21, 0, 0, 0, 0, bst))
+	tests := []struct {
+		name     string
+		t        time.Time
+		min, max float64
+	}{
+		{"sunrise", times.Sunrise, HorizonElevation - 0.5, HorizonElevation + 0.5},
+		{"noon", times.Noon, 61.5, 62.5}, // 90 - latitude + axial tilt
+		{"midnight", times.Noon.Add(12 * time.Hour), -16, -14},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := london.Elevation(tt.t); got < tt.min || got > tt.max {
+				t.Errorf("Elevation(%s) = %.2f, want between %.2f and %.2f", tt.t, got, tt.min, tt.max)
+			}
+		})
+	}
+}
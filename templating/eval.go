@@ -0,0 +1,683 @@
+package templating
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// undefined is the value of unknown names and missing attributes. It renders as an empty string,
+// is falsy and is replaced by the default filter.
+type undefined struct{}
+
+// function is a global callable from templates, e.g. state('light.kitchen').
+type function func(r *renderer, args []any) (any, error)
+
+// renderer holds the variables of a single render.
+type renderer struct {
+	env    *Env
+	scopes []map[string]any
+}
+
+func (r *renderer) lookup(name string) any {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if v, ok := r.scopes[i][name]; ok {
+			return v
+		}
+	}
+	if v, ok := r.env.Vars[name]; ok {
+		return v
+	}
+	if fn, ok := globals[name]; ok {
+		return fn
+	}
+	return undefined{}
+}
+
+func (r *renderer) renderNodes(sb *strings.Builder, nodes []node) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			sb.WriteString(n.text)
+
+		case outputNode:
+			v, err := r.eval(n.expr)
+			if err != nil {
+				return err
+			}
+			sb.WriteString(toString(v))
+
+		case ifNode:
+			body := n.orElse
+			for _, branch := range n.branches {
+				v, err := r.eval(branch.cond)
+				if err != nil {
+					return err
+				}
+				if truthy(v) {
+					body = branch.body
+					break
+				}
+			}
+			if err := r.renderNodes(sb, body); err != nil {
+				return err
+			}
+
+		case forNode:
+			if err := r.renderFor(sb, n); err != nil {
+				return err
+			}
+
+		case setNode:
+			v, err := r.eval(n.expr)
+			if err != nil {
+				return err
+			}
+			r.scopes[len(r.scopes)-1][n.name] = v
+
+		default:
+			return fmt.Errorf("unknown node %T", n)
+		}
+	}
+	return nil
+}
+
+func (r *renderer) renderFor(sb *strings.Builder, n forNode) error {
+	v, err := r.eval(n.iter)
+	if err != nil {
+		return err
+	}
+
+	var items [][]any // loop variable values per iteration
+	if m, ok := v.(map[string]any); ok {
+		for _, k := range sortedKeys(m) {
+			items = append(items, []any{k, m[k]})
+		}
+	} else {
+		list, err := toList(v)
+		if err != nil {
+			return fmt.Errorf("cannot iterate over %s", typeName(v))
+		}
+		for _, item := range list {
+			items = append(items, []any{item})
+		}
+	}
+
+	if len(items) == 0 {
+		return r.renderNodes(sb, n.orElse)
+	}
+
+	scope := make(map[string]any)
+	r.scopes = append(r.scopes, scope)
+	defer func() { r.scopes = r.scopes[:len(r.scopes)-1] }()
+
+	for i, item := range items {
+		switch {
+		case len(n.names) == 1 && len(item) == 1:
+			scope[n.names[0]] = item[0]
+		case len(n.names) == 1:
+			scope[n.names[0]] = item[0] // iterating a map yields its keys
+		case len(item) == 2:
+			scope[n.names[0]], scope[n.names[1]] = item[0], item[1]
+		default:
+			pair, err := toList(item[0])
+			if err != nil || len(pair) != 2 {
+				return fmt.Errorf("cannot unpack %s into two loop variables", typeName(item[0]))
+			}
+			scope[n.names[0]], scope[n.names[1]] = pair[0], pair[1]
+		}
+		scope["loop"] = map[string]any{
+			"index":  i + 1,
+			"index0": i,
+			"first":  i == 0,
+			"last":   i == len(items)-1,
+			"length": len(items),
+		}
+		if err := r.renderNodes(sb, n.body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *renderer) eval(e expr) (any, error) {
+	switch e := e.(type) {
+	case literalExpr:
+		return e.val, nil
+
+	case nameExpr:
+		return r.lookup(e.name), nil
+
+	case listExpr:
+		list := make([]any, len(e.items))
+		for i, item := range e.items {
+			v, err := r.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+
+	case unaryExpr:
+		v, err := r.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case "not":
+			return !truthy(v), nil
+		case "-":
+			return arithmetic("-", 0, v)
+		default:
+			return arithmetic("+", 0, v)
+		}
+
+	case binaryExpr:
+		return r.evalBinary(e)
+
+	case condExpr:
+		cond, err := r.eval(e.cond)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return r.eval(e.then)
+		}
+		return r.eval(e.orElse)
+
+	case attrExpr:
+		v, err := r.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		return getAttr(v, e.name)
+
+	case indexExpr:
+		v, err := r.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		index, err := r.eval(e.index)
+		if err != nil {
+			return nil, err
+		}
+		return getIndex(v, index)
+
+	case callExpr:
+		fn, err := r.eval(e.fn)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := fn.(function)
+		if !ok {
+			return nil, fmt.Errorf("%s is not callable", describe(e.fn))
+		}
+		args, err := r.evalArgs(e.args)
+		if err != nil {
+			return nil, err
+		}
+		return f(r, args)
+
+	case filterExpr:
+		f, ok := filters[e.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter %q", e.name)
+		}
+		v, err := r.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		args, err := r.evalArgs(e.args)
+		if err != nil {
+			return nil, err
+		}
+		return f(v, args)
+
+	case testExpr:
+		v, err := r.eval(e.x)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := runTest(e.name, v)
+		if err != nil {
+			return nil, err
+		}
+		return ok != e.negate, nil
+
+	default:
+		return nil, fmt.Errorf("unknown expression %T", e)
+	}
+}
+
+func (r *renderer) evalArgs(exprs []expr) ([]any, error) {
+	args := make([]any, len(exprs))
+	for i, arg := range exprs {
+		v, err := r.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+func (r *renderer) evalBinary(e binaryExpr) (any, error) {
+	l, err := r.eval(e.l)
+	if err != nil {
+		return nil, err
+	}
+	// and/or short-circuit and return the deciding operand, like Jinja
+	switch e.op {
+	case "and":
+		if !truthy(l) {
+			return l, nil
+		}
+		return r.eval(e.r)
+	case "or":
+		if truthy(l) {
+			return l, nil
+		}
+		return r.eval(e.r)
+	}
+
+	rv, err := r.eval(e.r)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return equal(l, rv), nil
+	case "!=":
+		return !equal(l, rv), nil
+	case "<", "<=", ">", ">=":
+		return compare(e.op, l, rv)
+	case "in":
+		return contains(rv, l)
+	case "~":
+		return toString(l) + toString(rv), nil
+	case "+":
+		if ls, ok := l.(string); ok {
+			if rs, ok := rv.(string); ok {
+				return ls + rs, nil
+			}
+		}
+		if ll, ok := l.([]any); ok {
+			if rl, ok := rv.([]any); ok {
+				return append(append([]any{}, ll...), rl...), nil
+			}
+		}
+		return arithmetic(e.op, l, rv)
+	default:
+		return arithmetic(e.op, l, rv)
+	}
+}
+
+// ---------- values ----------
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "none"
+	case undefined:
+		return "undefined"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func describe(e expr) string {
+	switch e := e.(type) {
+	case nameExpr:
+		return fmt.Sprintf("%q", e.name)
+	case attrExpr:
+		return fmt.Sprintf("%q", e.name)
+	default:
+		return "expression"
+	}
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case map[string]any:
+		return len(v) > 0
+	}
+	if n, ok := toNumber(v); ok {
+		return n != 0
+	}
+	if list, err := toList(v); err == nil {
+		return len(list) > 0
+	}
+	return true
+}
+
+// toNumber converts numeric values to int or float64. Strings are not converted.
+func toNumber(v any) (any, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return nil, false
+}
+
+func toFloat(v any) (float64, bool) {
+	n, ok := toNumber(v)
+	if !ok {
+		return 0, false
+	}
+	if i, ok := n.(int); ok {
+		return float64(i), true
+	}
+	return n.(float64), true
+}
+
+func arithmetic(op string, l, r any) (any, error) {
+	ln, lok := toNumber(l)
+	rn, rok := toNumber(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("unsupported operand types for %s: %s and %s", op, typeName(l), typeName(r))
+	}
+
+	li, lint := ln.(int)
+	ri, rint := rn.(int)
+	if lint && rint {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "//", "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			q, m := li/ri, li%ri
+			if m != 0 && (m < 0) != (ri < 0) { // floor towards negative infinity
+				q--
+				m += ri
+			}
+			if op == "//" {
+				return q, nil
+			}
+			return m, nil
+		case "**":
+			if ri >= 0 {
+				return int(math.Pow(float64(li), float64(ri))), nil
+			}
+		}
+	}
+
+	lf, _ := toFloat(ln)
+	rf, _ := toFloat(rn)
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	case "//":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Floor(lf / rf), nil
+	case "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf - math.Floor(lf/rf)*rf, nil
+	case "**":
+		return math.Pow(lf, rf), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+func equal(l, r any) bool {
+	if lf, ok := toFloat(l); ok {
+		if rf, ok := toFloat(r); ok {
+			_, lbool := l.(bool)
+			_, rbool := r.(bool)
+			if lbool == rbool {
+				return lf == rf
+			}
+			return false
+		}
+	}
+	if _, ok := l.(undefined); ok {
+		l = nil
+	}
+	if _, ok := r.(undefined); ok {
+		r = nil
+	}
+	return reflect.DeepEqual(l, r)
+}
+
+func compare(op string, l, r any) (bool, error) {
+	var c int
+	if lf, ok := toFloat(l); ok {
+		rf, ok := toFloat(r)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %s with %s", typeName(l), typeName(r))
+		}
+		switch {
+		case lf < rf:
+			c = -1
+		case lf > rf:
+			c = 1
+		}
+	} else if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %s with %s", typeName(l), typeName(r))
+		}
+		c = strings.Compare(ls, rs)
+	} else if lt, ok := l.(time.Time); ok {
+		rt, ok := r.(time.Time)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %s with %s", typeName(l), typeName(r))
+		}
+		c = lt.Compare(rt)
+	} else {
+		return false, fmt.Errorf("cannot compare %s with %s", typeName(l), typeName(r))
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func contains(container, item any) (bool, error) {
+	switch c := container.(type) {
+	case string:
+		s, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("'in <string>' requires a string, got %s", typeName(item))
+		}
+		return strings.Contains(c, s), nil
+	case map[string]any:
+		s, ok := item.(string)
+		if !ok {
+			return false, nil
+		}
+		_, found := c[s]
+		return found, nil
+	}
+	list, err := toList(container)
+	if err != nil {
+		return false, fmt.Errorf("argument of type %s is not iterable", typeName(container))
+	}
+	for _, v := range list {
+		if equal(v, item) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// toList converts any slice or array to []any.
+func toList(v any) ([]any, error) {
+	if list, ok := v.([]any); ok {
+		return list, nil
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		return nil, fmt.Errorf("%s is not a list", typeName(v))
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func getAttr(v any, name string) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		if val, ok := v[name]; ok {
+			return val, nil
+		}
+		return undefined{}, nil
+	case time.Time:
+		return timeAttr(v, name)
+	case nil, undefined:
+		return nil, fmt.Errorf("cannot get attribute %q of %s", name, typeName(v))
+	}
+	return getIndex(v, name)
+}
+
+func timeAttr(t time.Time, name string) (any, error) {
+	switch name {
+	case "year":
+		return t.Year(), nil
+	case "month":
+		return int(t.Month()), nil
+	case "day":
+		return t.Day(), nil
+	case "hour":
+		return t.Hour(), nil
+	case "minute":
+		return t.Minute(), nil
+	case "second":
+		return t.Second(), nil
+	case "weekday":
+		return (int(t.Weekday()) + 6) % 7, nil // monday is 0
+	case "timestamp":
+		return float64(t.UnixMilli()) / 1000, nil
+	}
+	return undefined{}, nil
+}
+
+func getIndex(v any, index any) (any, error) {
+	switch c := v.(type) {
+	case map[string]any:
+		key, ok := index.(string)
+		if !ok {
+			return undefined{}, nil
+		}
+		if val, ok := c[key]; ok {
+			return val, nil
+		}
+		return undefined{}, nil
+	case string:
+		i, ok := index.(int)
+		if !ok {
+			return nil, fmt.Errorf("string indices must be integers")
+		}
+		runes := []rune(c)
+		if i < 0 {
+			i += len(runes)
+		}
+		if i < 0 || i >= len(runes) {
+			return nil, fmt.Errorf("string index out of range")
+		}
+		return string(runes[i]), nil
+	}
+
+	list, err := toList(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not subscriptable", typeName(v))
+	}
+	i, ok := index.(int)
+	if !ok {
+		return nil, fmt.Errorf("list indices must be integers, got %s", typeName(index))
+	}
+	if i < 0 {
+		i += len(list)
+	}
+	if i < 0 || i >= len(list) {
+		return nil, fmt.Errorf("list index out of range")
+	}
+	return list[i], nil
+}
+
+func runTest(name string, v any) (bool, error) {
+	switch name {
+	case "defined":
+		_, isUndefined := v.(undefined)
+		return !isUndefined, nil
+	case "undefined":
+		_, isUndefined := v.(undefined)
+		return isUndefined, nil
+	case "none":
+		return v == nil, nil
+	case "number":
+		_, isBool := v.(bool)
+		_, ok := toNumber(v)
+		return ok && !isBool, nil
+	case "string":
+		_, ok := v.(string)
+		return ok, nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok, nil
+	}
+	return false, fmt.Errorf("unknown test %q", name)
+}
@@ -0,0 +1,432 @@
+package templating
+
+import (
+	"fmt"
+	"home_automation_server/types"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// globals are the functions available in every template.
+var globals map[string]function
+
+// filters are applied with "value | name(args)".
+var filters map[string]func(v any, args []any) (any, error)
+
+func init() {
+	globals = map[string]function{
+		"state":         stateFunc,
+		"state_attr":    stateAttrFunc,
+		"is_state":      isStateFunc,
+		"is_state_attr": isStateAttrFunc,
+		"states":        statesFunc,
+		"now":           nowFunc,
+		"float":         func(_ *renderer, args []any) (any, error) { return floatFilter(arg(args, 0), args[min(1, len(args)):]) },
+		"int":           func(_ *renderer, args []any) (any, error) { return intFilter(arg(args, 0), args[min(1, len(args)):]) },
+		"range":         rangeFunc,
+	}
+
+	filters = map[string]func(v any, args []any) (any, error){
+		"round":   roundFilter,
+		"clamp":   clampFilter,
+		"int":     intFilter,
+		"float":   floatFilter,
+		"default": defaultFilter,
+		"d":       defaultFilter,
+		"string":  func(v any, _ []any) (any, error) { return toString(v), nil },
+		"lower":   func(v any, _ []any) (any, error) { return strings.ToLower(toString(v)), nil },
+		"upper":   func(v any, _ []any) (any, error) { return strings.ToUpper(toString(v)), nil },
+		"trim":    func(v any, _ []any) (any, error) { return strings.TrimSpace(toString(v)), nil },
+		"replace": replaceFilter,
+		"abs":     absFilter,
+		"length":  lengthFilter,
+		"count":   lengthFilter,
+		"join":    joinFilter,
+		"first":   func(v any, _ []any) (any, error) { return getIndex(v, 0) },
+		"last":    func(v any, _ []any) (any, error) { return getIndex(v, -1) },
+		"min":     func(v any, _ []any) (any, error) { return extreme(v, "<") },
+		"max":     func(v any, _ []any) (any, error) { return extreme(v, ">") },
+		"sum":     sumFilter,
+		"list":    func(v any, _ []any) (any, error) { return toList(v) },
+	}
+}
+
+// arg returns the i-th argument or undefined if it was not passed.
+func arg(args []any, i int) any {
+	if i < len(args) {
+		return args[i]
+	}
+	return undefined{}
+}
+
+func stringArg(args []any, i int, fn string) (string, error) {
+	s, ok := arg(args, i).(string)
+	if !ok {
+		return "", fmt.Errorf("%s: argument %d must be a string, got %s", fn, i+1, typeName(arg(args, i)))
+	}
+	return s, nil
+}
+
+// ---------- state functions ----------
+
+// StateObject converts a state to its template representation, with entity_id, domain, object_id, name,
+// state, attributes, last_changed and last_updated.
+func StateObject(st types.State) map[string]any {
+	domain, objectID, _ := strings.Cut(st.EntityID, ".")
+	attributes := st.Attributes
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+	name, ok := attributes["friendly_name"]
+	if !ok {
+		name = st.EntityID
+	}
+	return map[string]any{
+		"entity_id":    st.EntityID,
+		"domain":       domain,
+		"object_id":    objectID,
+		"name":         name,
+		"state":        st.State,
+		"attributes":   attributes,
+		"last_changed": st.LastChanged,
+		"last_updated": st.LastUpdated,
+	}
+}
+
+func (r *renderer) getState(fn string, args []any) (types.State, error) {
+	entityID, err := stringArg(args, 0, fn)
+	if err != nil {
+		return types.State{}, err
+	}
+	if r.env.States == nil {
+		return types.State{}, fmt.Errorf("%s: no states available", fn)
+	}
+	st, ok := r.env.States.Get(entityID)
+	if !ok {
+		return types.State{}, fmt.Errorf("failed to get state for entity_id: %s", entityID)
+	}
+	return st, nil
+}
+
+// stateFunc returns the main state of an entity: state('light.kitchen').
+func stateFunc(r *renderer, args []any) (any, error) {
+	st, err := r.getState("state", args)
+	if err != nil {
+		return nil, err
+	}
+	if st.State == nil {
+		return nil, fmt.Errorf("main_state for entity: %s is nil", st.EntityID)
+	}
+	return st.State, nil
+}
+
+// stateAttrFunc returns an attribute of an entity: state_attr('light.kitchen', 'brightness').
+func stateAttrFunc(r *renderer, args []any) (any, error) {
+	st, err := r.getState("state_attr", args)
+	if err != nil {
+		return nil, err
+	}
+	attr, err := stringArg(args, 1, "state_attr")
+	if err != nil {
+		return nil, err
+	}
+	val, ok := st.Attributes[attr]
+	if !ok {
+		return nil, fmt.Errorf("state does not contain the attribute: %s", attr)
+	}
+	return val, nil
+}
+
+// isStateFunc reports whether an entity has the given state, or one of a list of states.
+// Unknown entities are never in any state.
+func isStateFunc(r *renderer, args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("is_state takes 2 arguments, got %d", len(args))
+	}
+	st, err := r.getState("is_state", args)
+	if err != nil {
+		return false, nil
+	}
+	return matches(st.State, args[1]), nil
+}
+
+func isStateAttrFunc(r *renderer, args []any) (any, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("is_state_attr takes 3 arguments, got %d", len(args))
+	}
+	st, err := r.getState("is_state_attr", args)
+	if err != nil {
+		return false, nil
+	}
+	attr, err := stringArg(args, 1, "is_state_attr")
+	if err != nil {
+		return nil, err
+	}
+	val, ok := st.Attributes[attr]
+	return ok && matches(val, args[2]), nil
+}
+
+func matches(val, expected any) bool {
+	if _, isString := expected.(string); !isString {
+		if list, err := toList(expected); err == nil {
+			for _, e := range list {
+				if equal(val, e) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return equal(val, expected)
+}
+
+// statesFunc returns all states sorted by entity ID, the states of a domain with states('light'),
+// or the main state of an entity with states('light.kitchen').
+func statesFunc(r *renderer, args []any) (any, error) {
+	if r.env.States == nil {
+		return []any{}, nil
+	}
+	filter := ""
+	if len(args) > 0 {
+		var err error
+		if filter, err = stringArg(args, 0, "states"); err != nil {
+			return nil, err
+		}
+		if strings.Contains(filter, ".") {
+			st, ok := r.env.States.Get(filter)
+			if !ok {
+				return "unknown", nil
+			}
+			return st.State, nil
+		}
+	}
+
+	all := r.env.States.GetAll()
+	sort.Slice(all, func(i, j int) bool { return all[i].EntityID < all[j].EntityID })
+	list := make([]any, 0, len(all))
+	for _, st := range all {
+		if filter != "" && !strings.HasPrefix(st.EntityID, filter+".") {
+			continue
+		}
+		list = append(list, StateObject(st))
+	}
+	return list, nil
+}
+
+func nowFunc(r *renderer, _ []any) (any, error) {
+	return r.env.now(), nil
+}
+
+func rangeFunc(_ *renderer, args []any) (any, error) {
+	bounds := make([]int, len(args))
+	for i, a := range args {
+		n, ok := a.(int)
+		if !ok {
+			return nil, fmt.Errorf("range: arguments must be integers, got %s", typeName(a))
+		}
+		bounds[i] = n
+	}
+	start, stop, step := 0, 0, 1
+	switch len(bounds) {
+	case 1:
+		stop = bounds[0]
+	case 2:
+		start, stop = bounds[0], bounds[1]
+	case 3:
+		start, stop, step = bounds[0], bounds[1], bounds[2]
+	default:
+		return nil, fmt.Errorf("range takes 1 to 3 arguments, got %d", len(args))
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("range: step must not be zero")
+	}
+	var list []any
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		list = append(list, i)
+	}
+	return list, nil
+}
+
+// ---------- filters ----------
+
+// parseNumber converts numbers and numeric strings to float64.
+func parseNumber(v any) (float64, bool) {
+	if f, ok := toFloat(v); ok {
+		return f, true
+	}
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// roundFilter rounds to the given precision (default 0). Halves are rounded away from zero.
+func roundFilter(v any, args []any) (any, error) {
+	f, ok := parseNumber(v)
+	if !ok {
+		return nil, fmt.Errorf("round: %s is not a number", typeName(v))
+	}
+	precision := 0
+	if len(args) > 0 {
+		p, ok := args[0].(int)
+		if !ok {
+			return nil, fmt.Errorf("round: precision must be an integer")
+		}
+		precision = p
+	}
+	scale := math.Pow(10, float64(precision))
+	return math.Round(f*scale) / scale, nil
+}
+
+func clampFilter(v any, args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("clamp takes 2 arguments, got %d", len(args))
+	}
+	lo, ok1 := toNumber(args[0])
+	hi, ok2 := toNumber(args[1])
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("clamp: bounds must be numbers")
+	}
+	n, ok := toNumber(v)
+	if !ok {
+		f, ok := parseNumber(v)
+		if !ok {
+			return nil, fmt.Errorf("clamp: %s is not a number", typeName(v))
+		}
+		n = f
+	}
+	if less, _ := compare("<", n, lo); less {
+		return lo, nil
+	}
+	if greater, _ := compare(">", n, hi); greater {
+		return hi, nil
+	}
+	return n, nil
+}
+
+// intFilter converts to an integer, truncating floats. Values that cannot be converted yield the
+// default argument or 0.
+func intFilter(v any, args []any) (any, error) {
+	if f, ok := parseNumber(v); ok {
+		return int(f), nil
+	}
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	return 0, nil
+}
+
+// floatFilter converts to a float. Values that cannot be converted yield the default argument or 0.0.
+func floatFilter(v any, args []any) (any, error) {
+	if f, ok := parseNumber(v); ok {
+		return f, nil
+	}
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	return 0.0, nil
+}
+
+// defaultFilter replaces undefined values. With a true second argument falsy values are replaced as well.
+func defaultFilter(v any, args []any) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("default takes a default value")
+	}
+	if _, ok := v.(undefined); ok {
+		return args[0], nil
+	}
+	if len(args) > 1 && truthy(args[1]) && !truthy(v) {
+		return args[0], nil
+	}
+	return v, nil
+}
+
+// replaceFilter replaces all occurrences of the first argument with the second: "light.a" | replace("light.", "switch.").
+func replaceFilter(v any, args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("replace takes 2 arguments, got %d", len(args))
+	}
+	return strings.ReplaceAll(toString(v), toString(args[0]), toString(args[1])), nil
+}
+
+func absFilter(v any, _ []any) (any, error) {
+	n, ok := toNumber(v)
+	if !ok {
+		return nil, fmt.Errorf("abs: %s is not a number", typeName(v))
+	}
+	if i, ok := n.(int); ok {
+		if i < 0 {
+			return -i, nil
+		}
+		return i, nil
+	}
+	return math.Abs(n.(float64)), nil
+}
+
+func lengthFilter(v any, _ []any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return len([]rune(v)), nil
+	case map[string]any:
+		return len(v), nil
+	}
+	list, err := toList(v)
+	if err != nil {
+		return nil, fmt.Errorf("length: %s has no length", typeName(v))
+	}
+	return len(list), nil
+}
+
+func joinFilter(v any, args []any) (any, error) {
+	list, err := toList(v)
+	if err != nil {
+		return nil, fmt.Errorf("join: %w", err)
+	}
+	sep := ""
+	if len(args) > 0 {
+		sep = toString(args[0])
+	}
+	parts := make([]string, len(list))
+	for i, item := range list {
+		parts[i] = toString(item)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func extreme(v any, op string) (any, error) {
+	list, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return undefined{}, nil
+	}
+	best := list[0]
+	for _, item := range list[1:] {
+		better, err := compare(op, item, best)
+		if err != nil {
+			return nil, err
+		}
+		if better {
+			best = item
+		}
+	}
+	return best, nil
+}
+
+func sumFilter(v any, _ []any) (any, error) {
+	list, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	var total any = 0
+	for _, item := range list {
+		if total, err = arithmetic("+", total, item); err != nil {
+			return nil, fmt.Errorf("sum: %w", err)
+		}
+	}
+	return total, nil
+}
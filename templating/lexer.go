@@ -0,0 +1,207 @@
+package templating
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokText        tokenKind = iota
+	tokOutputOpen            // {{
+	tokOutputClose           // }}
+	tokStmtOpen              // {%
+	tokStmtClose             // %}
+	tokName
+	tokNumber
+	tokString
+	tokOp
+	tokEOF
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of template"
+	case tokText:
+		return "text"
+	default:
+		return fmt.Sprintf("%q", t.val)
+	}
+}
+
+// operators, longest first so "==" wins over "=".
+var operators = []string{"==", "!=", "<=", ">=", "//", "**", "<", ">", "+", "-", "*", "/", "%", "~", "|", ".", ",", "(", ")", "[", "]", "=", ":"}
+
+// lex splits a template into text and tag tokens. Whitespace control markers ("{%-", "-%}") strip the
+// whitespace next to the tag, comments ("{# #}") are dropped.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	trimNext := false
+	pos := 0
+
+	for pos < len(src) {
+		start := nextTagStart(src, pos)
+		if start < 0 {
+			tokens = appendText(tokens, src[pos:], pos, trimNext, false)
+			break
+		}
+
+		trimPrev := start+2 < len(src) && src[start+2] == '-'
+		tokens = appendText(tokens, src[pos:start], pos, trimNext, trimPrev)
+		trimNext = false
+
+		open := src[start : start+2]
+		pos = start + 2
+		if trimPrev {
+			pos++
+		}
+
+		if open == "{#" {
+			end := strings.Index(src[pos:], "#}")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed comment at %d", start)
+			}
+			trimNext = end > 0 && src[pos+end-1] == '-'
+			pos += end + 2
+			continue
+		}
+
+		closeKind, closeTag := tokOutputClose, "}}"
+		openKind := tokOutputOpen
+		if open == "{%" {
+			openKind, closeKind, closeTag = tokStmtOpen, tokStmtClose, "%}"
+		}
+		tokens = append(tokens, token{kind: openKind, val: open, pos: start})
+
+		var err error
+		tokens, pos, trimNext, err = lexTag(src, pos, tokens, closeTag)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token{kind: closeKind, val: closeTag, pos: pos})
+		pos += len(closeTag)
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(src)})
+	return tokens, nil
+}
+
+func nextTagStart(src string, pos int) int {
+	for i := pos; i+1 < len(src); i++ {
+		if src[i] == '{' && (src[i+1] == '{' || src[i+1] == '%' || src[i+1] == '#') {
+			return i
+		}
+	}
+	return -1
+}
+
+func appendText(tokens []token, text string, pos int, trimLeft, trimRight bool) []token {
+	if trimLeft {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	}
+	if trimRight {
+		text = strings.TrimRightFunc(text, unicode.IsSpace)
+	}
+	if text == "" {
+		return tokens
+	}
+	return append(tokens, token{kind: tokText, val: text, pos: pos})
+}
+
+// lexTag tokenizes the expression inside a tag up to closeTag. It returns the position of closeTag and
+// whether the tag ends with a whitespace control marker.
+func lexTag(src string, pos int, tokens []token, closeTag string) ([]token, int, bool, error) {
+	for pos < len(src) {
+		c := src[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+
+		case strings.HasPrefix(src[pos:], closeTag):
+			return tokens, pos, false, nil
+
+		case c == '-' && strings.HasPrefix(src[pos+1:], closeTag):
+			return tokens, pos + 1, true, nil
+
+		case c == '\'' || c == '"':
+			s, end, err := lexString(src, pos)
+			if err != nil {
+				return nil, 0, false, err
+			}
+			tokens = append(tokens, token{kind: tokString, val: s, pos: pos})
+			pos = end
+
+		case c >= '0' && c <= '9':
+			end := pos
+			for end < len(src) && (src[end] >= '0' && src[end] <= '9' || src[end] == '_') {
+				end++
+			}
+			// a dot followed by a digit continues the number, otherwise it is attribute access
+			if end+1 < len(src) && src[end] == '.' && src[end+1] >= '0' && src[end+1] <= '9' {
+				end++
+				for end < len(src) && src[end] >= '0' && src[end] <= '9' {
+					end++
+				}
+			}
+			tokens = append(tokens, token{kind: tokNumber, val: strings.ReplaceAll(src[pos:end], "_", ""), pos: pos})
+			pos = end
+
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := pos
+			for end < len(src) && (src[end] == '_' || unicode.IsLetter(rune(src[end])) || unicode.IsDigit(rune(src[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokName, val: src[pos:end], pos: pos})
+			pos = end
+
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[pos:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, 0, false, fmt.Errorf("unexpected character %q at %d", c, pos)
+			}
+			tokens = append(tokens, token{kind: tokOp, val: op, pos: pos})
+			pos += len(op)
+		}
+	}
+	return nil, 0, false, fmt.Errorf("unclosed tag, expected %q", closeTag)
+}
+
+func lexString(src string, pos int) (string, int, error) {
+	quote := src[pos]
+	var sb strings.Builder
+	for i := pos + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(src[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at %d", pos)
+}
@@ -0,0 +1,623 @@
+package templating
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ---------- nodes ----------
+
+type node interface{}
+
+type textNode struct{ text string }
+
+type outputNode struct{ expr expr }
+
+type ifBranch struct {
+	cond expr
+	body []node
+}
+
+type ifNode struct {
+	branches []ifBranch
+	orElse   []node
+}
+
+type forNode struct {
+	names  []string // loop variables, two for "for key, value in ..."
+	iter   expr
+	body   []node
+	orElse []node // rendered if the iterable is empty
+}
+
+type setNode struct {
+	name string
+	expr expr
+}
+
+// ---------- expressions ----------
+
+type expr interface{}
+
+type literalExpr struct{ val any }
+
+type nameExpr struct{ name string }
+
+type listExpr struct{ items []expr }
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+type condExpr struct {
+	cond, then, orElse expr
+}
+
+type attrExpr struct {
+	x    expr
+	name string
+}
+
+type indexExpr struct {
+	x, index expr
+}
+
+type callExpr struct {
+	fn   expr
+	args []expr
+}
+
+type filterExpr struct {
+	x    expr
+	name string
+	args []expr
+}
+
+type testExpr struct {
+	x      expr
+	name   string
+	negate bool
+}
+
+// ---------- parser ----------
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) ([]node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	nodes, end, err := p.parseNodes()
+	if err != nil {
+		return nil, err
+	}
+	if end != "" {
+		return nil, fmt.Errorf("unexpected {%% %s %%}", end)
+	}
+	return nodes, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.val == op
+}
+
+func (p *parser) isName(name string) bool {
+	t := p.peek()
+	return t.kind == tokName && t.val == name
+}
+
+func (p *parser) expect(kind tokenKind, val string) error {
+	t := p.next()
+	if t.kind != kind || (val != "" && t.val != val) {
+		return fmt.Errorf("unexpected %s at %d, expected %q", t, t.pos, val)
+	}
+	return nil
+}
+
+func (p *parser) expectName() (string, error) {
+	t := p.next()
+	if t.kind != tokName {
+		return "", fmt.Errorf("unexpected %s at %d, expected a name", t, t.pos)
+	}
+	return t.val, nil
+}
+
+// parseNodes parses until the end of the template or a block keyword (elif, else, endif, endfor),
+// which is returned with its statement tag left open.
+func (p *parser) parseNodes() ([]node, string, error) {
+	var nodes []node
+	for {
+		t := p.next()
+		switch t.kind {
+		case tokEOF:
+			return nodes, "", nil
+
+		case tokText:
+			nodes = append(nodes, textNode{text: t.val})
+
+		case tokOutputOpen:
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, "", err
+			}
+			if err := p.expect(tokOutputClose, "}}"); err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, outputNode{expr: e})
+
+		case tokStmtOpen:
+			keyword, err := p.expectName()
+			if err != nil {
+				return nil, "", err
+			}
+			switch keyword {
+			case "if":
+				n, err := p.parseIf()
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+			case "for":
+				n, err := p.parseFor()
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+			case "set":
+				n, err := p.parseSet()
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, n)
+			case "elif", "else", "endif", "endfor":
+				return nodes, keyword, nil
+			default:
+				return nil, "", fmt.Errorf("unknown statement %q at %d", keyword, t.pos)
+			}
+
+		default:
+			return nil, "", fmt.Errorf("unexpected %s at %d", t, t.pos)
+		}
+	}
+}
+
+func (p *parser) parseIf() (node, error) {
+	n := ifNode{}
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expect(tokStmtClose, "%}"); err != nil {
+			return nil, err
+		}
+		body, end, err := p.parseNodes()
+		if err != nil {
+			return nil, err
+		}
+		n.branches = append(n.branches, ifBranch{cond: cond, body: body})
+
+		switch end {
+		case "elif":
+			if cond, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		case "else":
+			if err := p.expect(tokStmtClose, "%}"); err != nil {
+				return nil, err
+			}
+			if n.orElse, end, err = p.parseNodes(); err != nil {
+				return nil, err
+			}
+			if end != "endif" {
+				return nil, fmt.Errorf("expected endif, got %q", end)
+			}
+			return n, p.expect(tokStmtClose, "%}")
+		case "endif":
+			return n, p.expect(tokStmtClose, "%}")
+		default:
+			return nil, fmt.Errorf("expected endif, got %q", end)
+		}
+	}
+}
+
+func (p *parser) parseFor() (node, error) {
+	n := forNode{}
+	for {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		n.names = append(n.names, name)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	if len(n.names) > 2 {
+		return nil, fmt.Errorf("for loops take at most two variables")
+	}
+	if err := p.expect(tokName, "in"); err != nil {
+		return nil, err
+	}
+	iter, err := p.parseOr() // no conditional expression, "if" would be ambiguous
+	if err != nil {
+		return nil, err
+	}
+	n.iter = iter
+	if err := p.expect(tokStmtClose, "%}"); err != nil {
+		return nil, err
+	}
+
+	body, end, err := p.parseNodes()
+	if err != nil {
+		return nil, err
+	}
+	n.body = body
+	if end == "else" {
+		if err := p.expect(tokStmtClose, "%}"); err != nil {
+			return nil, err
+		}
+		if n.orElse, end, err = p.parseNodes(); err != nil {
+			return nil, err
+		}
+	}
+	if end != "endfor" {
+		return nil, fmt.Errorf("expected endfor, got %q", end)
+	}
+	return n, p.expect(tokStmtClose, "%}")
+}
+
+func (p *parser) parseSet() (node, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokOp, "="); err != nil {
+		return nil, err
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return setNode{name: name, expr: e}, p.expect(tokStmtClose, "%}")
+}
+
+// Expression precedence, lowest first:
+// conditional (a if c else b), or, and, not, comparisons and tests, ~, + -, * / // %, unary - +, **,
+// postfix (.attr, [index], (call), |filter).
+
+func (p *parser) parseExpr() (expr, error) {
+	x, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isName("if") {
+		return x, nil
+	}
+	p.next()
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	var orElse expr = literalExpr{val: undefined{}}
+	if p.isName("else") {
+		p.next()
+		if orElse, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return condExpr{cond: cond, then: x, orElse: orElse}, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isName("or") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: "or", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isName("and") {
+		p.next()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: "and", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.isName("not") {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: "not", x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (expr, error) {
+	l, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokOp && (t.val == "==" || t.val == "!=" || t.val == "<" || t.val == "<=" || t.val == ">" || t.val == ">="):
+			p.next()
+			r, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			l = binaryExpr{op: t.val, l: l, r: r}
+
+		case p.isName("in"):
+			p.next()
+			r, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			l = binaryExpr{op: "in", l: l, r: r}
+
+		case p.isName("not") && p.tokens[p.pos+1].kind == tokName && p.tokens[p.pos+1].val == "in":
+			p.pos += 2
+			r, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			l = unaryExpr{op: "not", x: binaryExpr{op: "in", l: l, r: r}}
+
+		case p.isName("is"):
+			p.next()
+			test := testExpr{x: l}
+			if p.isName("not") {
+				p.next()
+				test.negate = true
+			}
+			name := p.next()
+			if name.kind != tokName {
+				return nil, fmt.Errorf("unexpected %s at %d, expected a test name", name, name.pos)
+			}
+			test.name = name.val
+			l = test
+
+		default:
+			return l, nil
+		}
+	}
+}
+
+func (p *parser) parseConcat() (expr, error) {
+	l, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("~") {
+		p.next()
+		r, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: "~", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAdd() (expr, error) {
+	l, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().val
+		r, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseMul() (expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("//") || p.isOp("%") {
+		op := p.next().val
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.isOp("-") || p.isOp("+") {
+		op := p.next().val
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: op, x: x}, nil
+	}
+	return p.parsePower()
+}
+
+func (p *parser) parsePower() (expr, error) {
+	l, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("**") {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr{op: "**", l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parsePostfix() (expr, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokName && t.kind != tokNumber {
+				return nil, fmt.Errorf("unexpected %s at %d, expected an attribute name", t, t.pos)
+			}
+			x = attrExpr{x: x, name: t.val}
+
+		case p.isOp("["):
+			p.next()
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(tokOp, "]"); err != nil {
+				return nil, err
+			}
+			x = indexExpr{x: x, index: index}
+
+		case p.isOp("("):
+			p.next()
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			x = callExpr{fn: x, args: args}
+
+		case p.isOp("|"):
+			p.next()
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			f := filterExpr{x: x, name: name}
+			if p.isOp("(") {
+				p.next()
+				if f.args, err = p.parseArgs(")"); err != nil {
+					return nil, err
+				}
+			}
+			x = f
+
+		default:
+			return x, nil
+		}
+	}
+}
+
+// parseArgs parses a comma separated expression list up to and including the closing operator.
+func (p *parser) parseArgs(closing string) ([]expr, error) {
+	var args []expr
+	for !p.isOp(closing) {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	return args, p.expect(tokOp, closing)
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if i, err := strconv.Atoi(t.val); err == nil {
+			return literalExpr{val: i}, nil
+		}
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.val, t.pos)
+		}
+		return literalExpr{val: f}, nil
+
+	case tokString:
+		return literalExpr{val: t.val}, nil
+
+	case tokName:
+		switch t.val {
+		case "true", "True":
+			return literalExpr{val: true}, nil
+		case "false", "False":
+			return literalExpr{val: false}, nil
+		case "none", "None":
+			return literalExpr{val: nil}, nil
+		}
+		return nameExpr{name: t.val}, nil
+
+	case tokOp:
+		switch t.val {
+		case "(":
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(tokOp, ")")
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return listExpr{items: items}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
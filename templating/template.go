@@ -0,0 +1,146 @@
+// Package templating implements the template language used in action params, conditions and waits.
+//
+// It is a subset of Jinja: "{{ expression }}" outputs a value, "{% if %}...{% elif %}...{% else %}...{% endif %}",
+// "{% for x in list %}...{% endfor %}" and "{% set x = expression %}" control the output and "{# #}" is a comment.
+// Expressions support arithmetic, comparisons, "and"/"or"/"not", "in", "a if cond else b", filters
+// ("value | round(1)") and the functions state, state_attr, is_state, is_state_attr, states and now.
+package templating
+
+import (
+	"fmt"
+	"home_automation_server/types"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Env is the data a template is rendered against.
+type Env struct {
+	States types.StateStore
+	Now    time.Time      // returned by now(), the current time if zero
+	Vars   map[string]any // additional variables, e.g. the trigger of an automation run
+}
+
+func (env *Env) now() time.Time {
+	if env.Now.IsZero() {
+		return time.Now()
+	}
+	return env.Now
+}
+
+type Template struct {
+	nodes []node
+	// native is set if the template is a single expression, whose value is returned as is.
+	native expr
+}
+
+// IsTemplate reports whether s contains template syntax.
+func IsTemplate(s string) bool {
+	return strings.Contains(s, "{{") || strings.Contains(s, "{%")
+}
+
+// Parse parses a template.
+func Parse(src string) (*Template, error) {
+	nodes, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %q: %w", src, err)
+	}
+
+	t := &Template{nodes: nodes}
+	var outputs []outputNode
+	onlyOutput := true
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case outputNode:
+			outputs = append(outputs, n)
+		case textNode:
+			if strings.TrimFunc(n.text, unicode.IsSpace) != "" {
+				onlyOutput = false
+			}
+		default:
+			onlyOutput = false
+		}
+	}
+	if onlyOutput && len(outputs) == 1 {
+		t.native = outputs[0].expr
+	}
+	return t, nil
+}
+
+// Render renders the template. A template that consists of a single "{{ expression }}" returns the value
+// of the expression with its type (number, bool, list, ...), any other template returns a string.
+func (t *Template) Render(env *Env) (any, error) {
+	if env == nil {
+		env = &Env{}
+	}
+	r := &renderer{env: env, scopes: []map[string]any{{}}}
+
+	if t.native != nil {
+		v, err := r.eval(t.native)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(undefined); ok {
+			return "", nil
+		}
+		return v, nil
+	}
+
+	var sb strings.Builder
+	if err := r.renderNodes(&sb, t.nodes); err != nil {
+		return nil, err
+	}
+	return sb.String(), nil
+}
+
+// Render parses and renders a template.
+func Render(src string, env *Env) (any, error) {
+	t, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return t.Render(env)
+}
+
+// RenderString renders a template and formats the result as a string.
+func RenderString(src string, env *Env) (string, error) {
+	v, err := Render(src, env)
+	if err != nil {
+		return "", err
+	}
+	return toString(v), nil
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "None"
+	case undefined:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999-07:00")
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			if s, ok := item.(string); ok {
+				parts[i] = strconv.Quote(s)
+			} else {
+				parts[i] = toString(item)
+			}
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
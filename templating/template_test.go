@@ -0,0 +1,237 @@
+package templating
+
+import (
+	"home_automation_server/types"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stateStore is a types.StateStore backed by a map.
+type stateStore map[string]types.State
+
+func (s stateStore) Get(entityID string) (types.State, bool) {
+	st, ok := s[entityID]
+	return st, ok
+}
+func (s stateStore) Set(entityID string, newState types.State) { s[entityID] = newState }
+func (s stateStore) GetAll() []types.State {
+	states := make([]types.State, 0, len(s))
+	for _, st := range s {
+		states = append(states, st)
+	}
+	return states
+}
+func (s stateStore) Rename(entityID, newEntityID string) bool { return false }
+func (s stateStore) Delete(entityID string)                   { delete(s, entityID) }
+
+func testEnv() *Env {
+	return &Env{
+		States: stateStore{
+			"light.kitchen": {EntityID: "light.kitchen", State: "on", Attributes: map[string]any{"brightness": 200}},
+			"sensor.temp":   {EntityID: "sensor.temp", State: "21.46", Attributes: map[string]any{"unit": "°C"}},
+		},
+		Now: time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC),
+		Vars: map[string]any{
+			"x":     3,
+			"items": []any{"a", "b", "c"},
+			"trigger": map[string]any{
+				"to_state": map[string]any{"state": "on"},
+			},
+		},
+	}
+}
+
+func TestLex(t *testing.T) {
+	type tok struct {
+		kind tokenKind
+		val  string
+	}
+	tests := []struct {
+		name string
+		src  string
+		want []tok
+	}{
+		{"text", "hello", []tok{{tokText, "hello"}, {tokEOF, ""}}},
+		{"output", "{{ a + 1 }}", []tok{
+			{tokOutputOpen, "{{"}, {tokName, "a"}, {tokOp, "+"}, {tokNumber, "1"}, {tokOutputClose, "}}"}, {tokEOF, ""},
+		}},
+		{"longest operator first", "{{ a == b // 2 }}", []tok{
+			{tokOutputOpen, "{{"}, {tokName, "a"}, {tokOp, "=="}, {tokName, "b"}, {tokOp, "//"}, {tokNumber, "2"},
+			{tokOutputClose, "}}"}, {tokEOF, ""},
+		}},
+		{"string", `{{ 'it\'s' }}`, []tok{
+			{tokOutputOpen, "{{"}, {tokString, "it's"}, {tokOutputClose, "}}"}, {tokEOF, ""},
+		}},
+		{"statement", "{% if a %}x{% endif %}", []tok{
+			{tokStmtOpen, "{%"}, {tokName, "if"}, {tokName, "a"}, {tokStmtClose, "%}"}, {tokText, "x"},
+			{tokStmtOpen, "{%"}, {tokName, "endif"}, {tokStmtClose, "%}"}, {tokEOF, ""},
+		}},
+		{"comment dropped", "a{# note #}b", []tok{{tokText, "a"}, {tokText, "b"}, {tokEOF, ""}}},
+		{"whitespace control", "a  {%- if b -%}  c", []tok{
+			{tokText, "a"}, {tokStmtOpen, "{%"}, {tokName, "if"}, {tokName, "b"}, {tokStmtClose, "%}"}, {tokText, "c"}, {tokEOF, ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lex(tt.src)
+			if err != nil {
+				t.Fatalf("lex(%q): %v", tt.src, err)
+			}
+			got := make([]tok, len(tokens))
+			for i, token := range tokens {
+				got[i] = tok{token.kind, token.val}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lex(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want any
+	}{
+		// native values of single expressions
+		{"int", "{{ 1 + 2 }}", 3},
+		{"float", "{{ 1.5 * 2 }}", 3.0},
+		{"bool", "{{ x > 2 }}", true},
+		{"list", "{{ [1, 'a'] }}", []any{1, "a"}},
+		{"text around expression", "x = {{ x }}", "x = 3"},
+
+		// precedence
+		{"mul before add", "{{ 1 + 2 * 3 }}", 7},
+		{"parentheses", "{{ (1 + 2) * 3 }}", 9},
+		{"power before unary minus", "{{ -2 ** 2 }}", -4},
+		{"floor division", "{{ -7 // 2 }}", -4},
+		{"modulo", "{{ -7 % 3 }}", 2},
+		{"true division", "{{ 7 / 2 }}", 3.5},
+		{"and before or", "{{ true or false and false }}", true},
+		{"not before and", "{{ not false and false }}", false},
+		{"comparison before not", "{{ not 1 == 2 }}", true},
+		{"concat after add", "{{ 1 + 2 ~ 'x' }}", "3x"},
+		{"conditional", "{{ 'big' if x > 2 else 'small' }}", "big"},
+		{"conditional without else", "{{ 'big' if x > 5 }}", ""},
+		{"filter before unary minus", "{{ 1 + -2 | abs }}", -1},
+		{"in", "{{ 'b' in items }}", true},
+		{"not in", "{{ 'z' not in items }}", true},
+
+		// variables and states
+		{"attribute", "{{ trigger.to_state.state }}", "on"},
+		{"index", "{{ items[1] }}", "b"},
+		{"negative index", "{{ items[-1] }}", "c"},
+		{"state", "{{ states('light.kitchen') }}", "on"},
+		{"state attribute", "{{ state_attr('light.kitchen', 'brightness') }}", 200},
+		{"is_state", "{{ is_state('light.kitchen', 'on') }}", true},
+		{"unknown entity", "{{ states('light.unknown') }}", "unknown"},
+		{"now", "{{ now().hour }}", 12},
+
+		// undefined variables
+		{"undefined renders empty", "{{ missing }}", ""},
+		{"undefined attribute", "{{ trigger.missing }}", ""},
+		{"undefined is falsy", "{{ 'yes' if missing else 'no' }}", "no"},
+		{"undefined in text", "a{{ missing }}b", "ab"},
+
+		// filters
+		{"round", "{{ 2.345 | round(2) }}", 2.35},
+		{"round half away from zero", "{{ 2.5 | round }}", 3.0},
+		{"round numeric string", "{{ states('sensor.temp') | round(1) }}", 21.5},
+		{"int truncates", "{{ '3.9' | int }}", 3},
+		{"int default", "{{ 'abc' | int(-1) }}", -1},
+		{"float", "{{ '1.25' | float }}", 1.25},
+		{"float default", "{{ 'abc' | float }}", 0.0},
+		{"clamp", "{{ 15 | clamp(0, 10) }}", 10},
+		{"default of undefined", "{{ missing | default('x') }}", "x"},
+		{"default keeps defined", "{{ x | default(0) }}", 3},
+		{"default of falsy", "{{ '' | default('x', true) }}", "x"},
+		{"replace", "{{ 'light.a' | replace('light.', 'switch.') }}", "switch.a"},
+		{"upper", "{{ 'on' | upper }}", "ON"},
+		{"length", "{{ items | length }}", 3},
+		{"join", "{{ items | join(', ') }}", "a, b, c"},
+		{"first", "{{ items | first }}", "a"},
+		{"last", "{{ items | last }}", "c"},
+		{"max", "{{ [3, 7, 5] | max }}", 7},
+		{"sum", "{{ [1, 2, 3.5] | sum }}", 6.5},
+		{"chained", "{{ ' On ' | trim | lower }}", "on"},
+
+		// statements
+		{"if elif else", "{% if x == 1 %}one{% elif x == 3 %}three{% else %}other{% endif %}", "three"},
+		{"for", "{% for i in items %}{{ loop.index }}{{ i }}{% endfor %}", "1a2b3c"},
+		{"for else", "{% for i in [] %}{{ i }}{% else %}empty{% endfor %}", "empty"},
+		{"set", "{% set y = x * 2 %}{{ y }}", "6"},
+		{"comment", "a{# comment #}b", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.src, testEnv())
+			if err != nil {
+				t.Fatalf("Render(%q): %v", tt.src, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Render(%q) = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // part of the error
+	}{
+		{"unclosed output", "{{ x", "unclosed"},
+		{"unclosed comment", "a {# b", "unclosed comment"},
+		{"unclosed if", "{% if x %}a", "endif"},
+		{"unexpected end tag", "{% endfor %}", "endfor"},
+		{"missing operand", "{{ 1 + }}", "unexpected"},
+		{"attribute of undefined", "{{ trigger.missing.state }}", "of undefined"},
+		{"unknown filter", "{{ x | nope }}", "nope"},
+		{"unknown function", "{{ nope() }}", "nope"},
+		{"division by zero", "{{ 1 / 0 }}", "division by zero"},
+		{"integer division by zero", "{{ 1 // 0 }}", "division by zero"},
+		{"mixed operands", "{{ 'a' - 1 }}", "unsupported operand"},
+		{"round of text", "{{ 'abc' | round }}", "not a number"},
+		{"clamp arguments", "{{ 1 | clamp(0) }}", "clamp takes 2 arguments"},
+		{"default without value", "{{ x | default }}", "default takes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.src, testEnv())
+			if err == nil {
+				t.Fatalf("Render(%q) = %#v, want an error containing %q", tt.src, got, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Render(%q) error = %q, want it to contain %q", tt.src, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderString(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"{{ true }}", "True"},
+		{"{{ none }}", "None"},
+		{"{{ 2.50 }}", "2.5"},
+		{"{{ ['a', 1] }}", `["a", 1]`},
+		{"{{ missing }}", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := RenderString(tt.src, testEnv())
+			if err != nil {
+				t.Fatalf("RenderString(%q): %v", tt.src, err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderString(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ const (
 	DeviceTypeLight        DeviceType = "light"
 	DeviceTypeGroupedLight DeviceType = "grouped_light"
 	DeviceTypeRemote       DeviceType = "remote"
+	DeviceTypeVirtual      DeviceType = "virtual" // not backed by hardware, e.g. the device of the helpers
 )
 
 type Device struct {
@@ -20,5 +21,6 @@ type Device struct {
 	Metadata      map[string]any
 	Enabled       bool
 	Available     bool
+	Area          string // name of the area suggested by the integration, e.g. the Hue room, empty if none
 	CreatedAt     time.Time
 }
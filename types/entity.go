@@ -10,15 +10,23 @@ const (
 	EntityTypeSpeaker EntityType = "speaker"
 	EntityTypeButton  EntityType = "button"
 	EntityTypeUnknown EntityType = "unknown"
+
+	// helpers, virtual entities the engine provides
+	EntityTypeInputBoolean EntityType = "input_boolean"
+	EntityTypeInputNumber  EntityType = "input_number"
+	EntityTypeInputSelect  EntityType = "input_select"
+	EntityTypeCounter      EntityType = "counter"
+	EntityTypeTimer        EntityType = "timer"
 )
 
 type Entity struct {
-	ExternalID string // ExternalID used internally in integration. eg. hue bridge supplied UUID.
-	DeviceID   string // ExternalID of the device that exposes the entity
-	EntityID   string // human readable unique id (eg. light.living_room)
-	Type       EntityType
-	Name       string
-	Enabled    bool
-	Available  bool
-	CreatedAt  time.Time
+	IntegrationID uint   // ID of the integration config that owns the entity
+	ExternalID    string // ExternalID used internally in integration. eg. hue bridge supplied UUID.
+	DeviceID      string // ExternalID of the device that exposes the entity
+	EntityID      string // human readable unique id (eg. light.living_room)
+	Type          EntityType
+	Name          string
+	Enabled       bool
+	Available     bool
+	CreatedAt     time.Time
 }
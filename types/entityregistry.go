@@ -1,7 +1,7 @@
 package types
 
 type EntityRegistry interface {
-	Register(externalID, entityID string)
+	Register(externalID, entityID string) string
 	Resolve(externalID string) (string, bool)
 	ResolveExternalID(entityID string) (string, bool)
 }
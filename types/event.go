@@ -10,6 +10,7 @@ const (
 	EventTypeStateChanged EventType = "state_changed"
 	EventTypeCallService  EventType = "call_service"
 	EventTimeChanged      EventType = "time_changed"
+	EventTimerFinished    EventType = "timer_finished"
 )
 
 // Event is the base event
@@ -43,12 +44,20 @@ type State struct {
 	Context     *Context       `json:"context"`
 }
 
-// CallServiceData is the data for a call_service event.
+// CallServiceData is the data for a call_service event, published for every service call.
 type CallServiceData struct {
-	Domain      string         `json:"domain"`       // e.g. "light"
-	Service     string         `json:"service"`      // e.g. "turn_on"
-	ServiceData map[string]any `json:"service_data"` // arbitrary service parameters
-	EntityID    string         `json:"entity_id"`    // optional target
+	Domain      string         `json:"domain"`            // e.g. "light"
+	Service     string         `json:"service"`           // e.g. "turn_on"
+	ServiceData map[string]any `json:"service_data"`      // the params the handler was called with
+	Targets     []string       `json:"targets,omitempty"` // entity IDs of the targets
+	Success     bool           `json:"success"`
+	Error       string         `json:"error,omitempty"` // why the call failed
+}
+
+// TimerFinishedData is the data for a timer_finished event, published when a timer helper runs out. Timers
+// that are cancelled do not finish.
+type TimerFinishedData struct {
+	EntityID string `json:"entity_id"`
 }
 
 // TimeChangedData is the data for a time_changed event
@@ -4,4 +4,6 @@ type StateStore interface {
 	Get(entityID string) (State, bool)
 	Set(entityID string, newState State)
 	GetAll() []State
+	Rename(entityID, newEntityID string) bool
+	Delete(entityID string)
 }
@@ -5,6 +5,7 @@ import (
 	"home_automation_server/types"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -83,3 +84,35 @@ func ToFloat64(val any) (float64, bool) {
 		return 0, false
 	}
 }
+
+// ParseNumber is like ToFloat64 but also parses numeric strings, e.g. the state "21.5" of a sensor.
+func ParseNumber(val any) (float64, bool) {
+	if f, ok := ToFloat64(val); ok {
+		return f, true
+	}
+	if s, ok := val.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// IsTruthy reports whether a value should be treated as true, e.g. the result of a template.
+func IsTruthy(val any) bool {
+	switch v := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "", "false", "off", "no", "0", "none":
+			return false
+		}
+		return true
+	}
+	if f, ok := ToFloat64(val); ok {
+		return f != 0
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIsTruthy(t *testing.T) {
+	tests := []struct {
+		val  any
+		want bool
+	}{
+		{nil, false},
+		{true, true},
+		{false, false},
+		{"", false},
+		{"  ", false},
+		{"false", false},
+		{"False", false},
+		{"off", false},
+		{"no", false},
+		{"0", false},
+		{"None", false},
+		{"true", true},
+		{"on", true},
+		{"yes", true},
+		{"1", true},
+		{"0.0", true}, // only the listed strings are falsy
+		{"anything", true},
+		{0, false},
+		{1, true},
+		{-1, true},
+		{int64(0), false},
+		{0.0, false},
+		{0.5, true},
+		{json.Number("0"), false},
+		{json.Number("2"), true},
+		{[]any{}, true}, // values that are not strings or numbers are true
+		{map[string]any{}, true},
+	}
+	for _, tt := range tests {
+		if got := IsTruthy(tt.val); got != tt.want {
+			t.Errorf("IsTruthy(%#v) = %v, want %v", tt.val, got, tt.want)
+		}
+	}
+}